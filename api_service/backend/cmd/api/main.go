@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"cookie-syncer/api/internal/config"
-	"cookie-syncer/api/internal/handler"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/probe"
 	"cookie-syncer/api/internal/router"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/cachestore"
 	"cookie-syncer/api/internal/store/gormstore"
+	"cookie-syncer/api/internal/store/memstore"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"cookie-syncer/api/docs" // Import the generated docs
 
@@ -40,7 +48,7 @@ func main() {
 	// Configure zerolog for pretty console output
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	// Load application configuration
+	// Load application configuration. Configuration flags must come before the subcommand.
 	cfg := config.Load()
 
 	// Set log level based on configuration
@@ -51,16 +59,138 @@ func main() {
 	}
 	zerolog.SetGlobalLevel(logLevel)
 
+	// Without a subcommand the binary starts the server, as it always has.
+	args := flag.Args()
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		err = runServe(cfg)
+	case "migrate":
+		err = runMigrate(cfg, args)
+	case "backup":
+		err = runBackup(cfg, args)
+	case "restore":
+		err = runRestore(cfg, args)
+	case "check":
+		err = runCheck(cfg, args)
+	case "users":
+		err = runUsers(cfg, args)
+	case "keys":
+		err = runKeys(cfg, args)
+	case "help", "-h", "--help":
+		printUsage()
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal().Err(err).Msgf("%s failed", command)
+	}
+}
+
+// newStore creates the store selected by cfg.DBType.
+func newStore(cfg *config.Config) (store.Store, error) {
+	if cfg.DBType == "memory" {
+		mem := memstore.New(cfg.AdminKey, cfg.PoolAccessKey)
+		user, err := mem.EnsureDefaultUser("Default user")
+		if err != nil {
+			return nil, err
+		}
+		log.Warn().Msg("Using the in-memory store: all users and cookies are lost when the server stops")
+		log.Info().Str("api_key", user.APIKey).Int64("user_id", user.ID).Msg("Created default user")
+		return mem, nil
+	}
+
 	// Initialize a new GORM store based on configuration.
 	db, err := gormstore.New(cfg, cfg.AdminKey, cfg.PoolAccessKey)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize database")
+		return nil, err
 	}
 	log.Info().Msgf("Database initialized and connected to %s database", cfg.DBType)
+	return db, nil
+}
+
+// withCache wraps db with the read cache selected by cfg.Cache.
+func withCache(cfg *config.Config, db store.Store) (store.Store, error) {
+	var backend cachestore.Backend
+	switch cfg.Cache {
+	case "none", "":
+		return db, nil
+	case "memory":
+		backend = cachestore.NewLRU(cfg.CacheSize)
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		r, err := cachestore.NewRedis(ctx, cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		backend = r
+	default:
+		return nil, fmt.Errorf("unknown cache %q (want memory, redis or none)", cfg.Cache)
+	}
+	log.Info().Str("backend", backend.Name()).Dur("ttl", cfg.CacheTTL).Msg("Caching cookie reads")
+	return cachestore.New(db, backend, cfg.CacheTTL), nil
+}
+
+// newSyncLocker creates the per-user sync locker selected by cfg.SyncLocker.
+func newSyncLocker(cfg *config.Config) (locker.Locker, error) {
+	switch cfg.SyncLocker {
+	case "", "local":
+		return locker.NewLocal(cfg.SyncLockTimeout), nil
+	case "database":
+		syncLocker, err := gormstore.NewSyncLocker(cfg)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("backend", syncLocker.Stats().Backend).Msg("Using database sync locks")
+		return syncLocker, nil
+	default:
+		return nil, fmt.Errorf("unknown sync locker %q (want local or database)", cfg.SyncLocker)
+	}
+}
+
+// runServe connects to the database, migrates it and starts the HTTP server.
+func runServe(cfg *config.Config) error {
+	db, err := newStore(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	db, err = withCache(cfg, db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache: %w", err)
+	}
 
 	// Create a new router and pass the store to it.
-	lockManager := handler.NewUserLockManager()
-	mux := router.NewRouter(db, lockManager, cfg)
+	syncLocker, err := newSyncLocker(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize sync locker: %w", err)
+	}
+	if cfg.PoolHandleSecret == "" {
+		secret, persistent, err := poolhandle.DefaultSecret(cfg.AdminKey)
+		if err != nil {
+			return err
+		}
+		if !persistent {
+			log.Warn().Msg("Neither POOL_HANDLE_SECRET nor ADMIN_KEY is set, contributor handles in pool responses change when the server restarts")
+		}
+		cfg.PoolHandleSecret = secret
+	}
+	mux := router.NewRouter(db, syncLocker, cfg)
+
+	if cfg.ProbeInterval > 0 {
+		scheduler := probe.NewScheduler(db, probe.NewClient(cfg.ProbeTimeout, cfg.ProbeAllowPrivate), cfg.ProbeInterval)
+		go scheduler.Run(context.Background())
+		log.Info().Dur("interval", cfg.ProbeInterval).Msg("Running session probes")
+	}
+	if cfg.PoolStatsRetention > 0 {
+		go prunePoolUsage(db, cfg.PoolStatsRetention)
+	}
 
 	// Print all registered routes
 	router.PrintRoutes(mux)
@@ -79,6 +209,22 @@ func main() {
 	addr := fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
 	log.Info().Msgf("Starting API server on %s", addr)
 	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatal().Err(err).Msg("Could not start server")
+		return fmt.Errorf("could not start server: %w", err)
+	}
+	return nil
+}
+
+// prunePoolUsage deletes the pool usage counts older than retention, once an
+// hour.
+func prunePoolUsage(db store.Store, retention time.Duration) {
+	for ; ; time.Sleep(time.Hour) {
+		pruned, err := db.PrunePoolUsage(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not prune pool usage")
+			continue
+		}
+		if pruned > 0 {
+			log.Info().Int64("rows", pruned).Msg("Pruned old pool usage")
+		}
 	}
 }
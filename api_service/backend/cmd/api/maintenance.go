@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/gormstore"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const usageText = `Usage: cookiepusher [config flags] <command> [args]
+
+Commands:
+  serve                                  Start the API server (default)
+  migrate up [--dry-run]                 Apply pending schema migrations
+  migrate status                         Show the current schema version
+  migrate down [--steps N] [--dry-run]   Revert the newest migrations
+  backup --out FILE                      Write a JSON backup of all users and cookies
+  restore --in FILE [--force]            Replace all data with a JSON backup
+  check [--repair]                       Verify stored cookies are consistent
+  users bootstrap [--remark R] [--force] Create the initial user and print its API key
+  keys rotate-master [--pool] [--env-file FILE]
+                                         Generate a new admin (or pool) key
+
+Config flags (see -h for the full list) must come before the command,
+e.g. "cookiepusher -db-type postgres -dsn ... migrate status".
+`
+
+func printUsage() {
+	fmt.Fprint(os.Stderr, usageText)
+}
+
+// openStore connects to the configured database without migrating it.
+func openStore(cfg *config.Config) (*gormstore.GormStore, error) {
+	s, err := gormstore.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msgf("Connected to %s database", s.Dialect())
+	return s, nil
+}
+
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|status|down")
+	}
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only print the migrations that would run")
+	steps := fs.Int("steps", 1, "Number of migrations to revert (down only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	switch args[0] {
+	case "status":
+		status, err := s.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Dialect:         %s\nCurrent version: %d\nLatest version:  %d\n\n", status.Dialect, status.Current, status.Latest)
+		for _, m := range status.Migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+				if m.AppliedAt != nil {
+					state += " " + m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				}
+			}
+			if m.Modified {
+				state += " (MODIFIED: checksum mismatch)"
+			}
+			fmt.Printf("v%-3d %-55s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+
+	case "up":
+		applied, err := s.MigrateUp(*dryRun)
+		if err != nil {
+			return err
+		}
+		printSteps(applied, *dryRun, "apply", "Applied")
+		return nil
+
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("--steps must be at least 1")
+		}
+		reverted, err := s.MigrateDown(*steps, *dryRun)
+		printSteps(reverted, *dryRun, "revert", "Reverted")
+		return err
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, status or down)", args[0])
+	}
+}
+
+func printSteps(steps []gormstore.MigrationInfo, dryRun bool, verb, done string) {
+	if len(steps) == 0 {
+		fmt.Printf("Nothing to %s.\n", verb)
+		return
+	}
+	for _, m := range steps {
+		label := done
+		if dryRun {
+			label = "Would " + verb
+		}
+		fmt.Printf("%s: v%d %s\n", label, m.Version, m.Name)
+	}
+}
+
+func runBackup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "File to write the backup to (\"-\" for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("usage: backup --out FILE")
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	w := os.Stdout
+	if *out != "-" {
+		// Backups contain API keys and session cookies.
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	backup, err := s.WriteBackup(w)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("users", len(backup.Users)).Int("cookies", len(backup.Cookies)).Int("pool_clients", len(backup.PoolClients)).Int("session_probes", len(backup.SessionProbes)).Int("share_links", len(backup.ShareLinks)).Msgf("Backup written to %s", *out)
+	return nil
+}
+
+func runRestore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("in", "", "Backup file to restore (\"-\" for stdin)")
+	force := fs.Bool("force", false, "Overwrite a database that already contains users")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return fmt.Errorf("usage: restore --in FILE [--force]")
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if _, err := s.MigrateUp(false); err != nil {
+		return fmt.Errorf("could not migrate database schema: %w", err)
+	}
+
+	r := os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	backup, err := s.RestoreBackup(r, *force)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("users", len(backup.Users)).Int("cookies", len(backup.Cookies)).Int("pool_clients", len(backup.PoolClients)).Int("session_probes", len(backup.SessionProbes)).Int("share_links", len(backup.ShareLinks)).Msgf("Restored backup taken from %s at %s", backup.Dialect, backup.CreatedAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+func runCheck(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "Fix the issues found")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	report, err := s.CheckConsistency(*repair)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		target := fmt.Sprintf("user %d", issue.UserID)
+		if issue.CookieID != 0 {
+			target += fmt.Sprintf(" cookie %d", issue.CookieID)
+		}
+		fmt.Printf("%-22s %-24s %s\n", issue.Kind, target, issue.Detail)
+	}
+	switch {
+	case len(report.Issues) == 0:
+		fmt.Println("No issues found.")
+	case report.Repaired:
+		fmt.Printf("Repaired %d issue(s).\n", len(report.Issues))
+	default:
+		return fmt.Errorf("found %d issue(s); run \"check --repair\" to fix them", len(report.Issues))
+	}
+	return nil
+}
+
+func runUsers(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "bootstrap" {
+		return fmt.Errorf("usage: users bootstrap [--remark R] [--force]")
+	}
+	fs := flag.NewFlagSet("users bootstrap", flag.ContinueOnError)
+	remark := fs.String("remark", "Default user", "Remark for the new user")
+	force := fs.Bool("force", false, "Create the user even if other users already exist")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if _, err := s.MigrateUp(false); err != nil {
+		return fmt.Errorf("could not migrate database schema: %w", err)
+	}
+
+	if *force {
+		users, err := s.CreateUsers(context.Background(), []string{*remark})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created user %d. API key: %s\n", users[0].ID, users[0].APIKey)
+		return nil
+	}
+
+	user, err := s.EnsureDefaultUser(*remark)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("database already has users; pass --force to create another one")
+	}
+	fmt.Printf("Created user %d. API key: %s\n", user.ID, user.APIKey)
+	return nil
+}
+
+func runKeys(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "rotate-master" {
+		return fmt.Errorf("usage: keys rotate-master [--pool] [--env-file FILE]")
+	}
+	fs := flag.NewFlagSet("keys rotate-master", flag.ContinueOnError)
+	pool := fs.Bool("pool", false, "Rotate POOL_ACCESS_KEY instead of ADMIN_KEY")
+	envFile := fs.String("env-file", "", "Rewrite the key in this .env file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	s, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	envVar, other := "ADMIN_KEY", cfg.PoolAccessKey
+	if *pool {
+		envVar, other = "POOL_ACCESS_KEY", cfg.AdminKey
+	}
+
+	// Master keys share the header namespace with user API keys, so make sure
+	// the new key can never be mistaken for one.
+	var newKey string
+	for {
+		newKey = uuid.New().String()
+		if newKey == other {
+			continue
+		}
+		_, err := s.GetUserByAPIKey(context.Background(), newKey)
+		if errors.Is(err, store.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if *envFile != "" {
+		if err := setEnvFileValue(*envFile, envVar, newKey); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s in %s. Restart the server to apply it.\n", envVar, *envFile)
+		return nil
+	}
+	fmt.Printf("%s=%s\n", envVar, newKey)
+	fmt.Fprintf(os.Stderr, "Set %s to the value above and restart the server to apply it.\n", envVar)
+	return nil
+}
+
+// setEnvFileValue replaces (or appends) KEY=value in a .env file.
+func setEnvFileValue(path, key, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	replaced := false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, key+"=") || strings.HasPrefix(trimmed, "export "+key+"=") {
+			line = key + "=" + value
+			replaced = true
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !replaced {
+		lines = append(lines, key+"="+value)
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"cookie-syncer/api/internal/export"
+	"cookie-syncer/api/internal/model"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+func runCookies(app *App, args []string) error {
+	if len(args) == 0 {
+		return usageError("cookies get|export")
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) > 2 {
+			return usageError("cookies get [domain]")
+		}
+		if len(args) == 2 {
+			cookies, err := app.Client.GetDomainCookies(args[1])
+			if err != nil {
+				return err
+			}
+			rows := make([][]string, 0, len(cookies))
+			for _, name := range sortedKeys(cookies) {
+				rows = append(rows, []string{name, cookies[name]})
+			}
+			return app.Print(cookies, []string{"NAME", "VALUE"}, rows)
+		}
+
+		cookies, err := app.Client.GetAllCookies()
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		for _, domain := range sortedKeys(cookies) {
+			for _, name := range sortedKeys(cookies[domain]) {
+				rows = append(rows, []string{domain, name, cookies[domain][name]})
+			}
+		}
+		return app.Print(cookies, []string{"DOMAIN", "NAME", "VALUE"}, rows)
+
+	case "export":
+		fs := flag.NewFlagSet("cookies export", flag.ContinueOnError)
+		format := fs.String("format", string(export.FormatNetscape), "Export format (netscape, playwright)")
+		domain := fs.String("domain", "", "Only export cookies for this domain")
+		out := fs.String("out", "", "Write to this file instead of stdout")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		f, err := export.ParseFormat(*format)
+		if err != nil {
+			return err
+		}
+		data, err := app.Client.ExportCookies(string(f), *domain)
+		if err != nil {
+			return err
+		}
+
+		// Netscape exports arrive as a JSON string; write the file contents verbatim.
+		var content []byte
+		if f == export.FormatNetscape {
+			var text string
+			if err := json.Unmarshal(data, &text); err != nil {
+				return fmt.Errorf("unexpected export payload: %w", err)
+			}
+			content = []byte(text)
+		} else {
+			content, err = json.MarshalIndent(json.RawMessage(data), "", "  ")
+			if err != nil {
+				return err
+			}
+			content = append(content, '\n')
+		}
+
+		if *out == "" {
+			_, err = os.Stdout.Write(content)
+			return err
+		}
+		if err := os.WriteFile(*out, content, 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported cookies to %s.\n", *out)
+		return nil
+
+	default:
+		return usageError("cookies get|export")
+	}
+}
+
+func runPool(app *App, args []string) error {
+	if len(args) != 2 || args[0] != "get" {
+		return usageError("pool get <domain>")
+	}
+	contributors, err := app.Client.GetPoolCookies(args[1])
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, c := range contributors {
+		for _, domain := range sortedKeys(c.Cookies) {
+			for _, name := range sortedKeys(c.Cookies[domain]) {
+				rows = append(rows, []string{c.Contributor, domain, name, c.Cookies[domain][name]})
+			}
+		}
+	}
+	return app.Print(contributors, []string{"CONTRIBUTOR", "DOMAIN", "NAME", "VALUE"}, rows)
+}
+
+func runSync(app *App, args []string) error {
+	if len(args) != 2 || args[0] != "push" {
+		return usageError("sync push <file>")
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	var cookies []*model.Cookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return fmt.Errorf("%s is not a JSON array of cookies: %w", args[1], err)
+	}
+	stored, err := app.Client.Sync(cookies)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(stored))
+	for _, c := range stored {
+		rows = append(rows, []string{c.Domain, c.Name, c.Path, strconv.FormatBool(c.IsSharable)})
+	}
+	return app.Print(stored, []string{"DOMAIN", "NAME", "PATH", "SHARABLE"}, rows)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,152 @@
+// Command cookiepusher is a command-line client for the CookiePusher API.
+//
+// Usage:
+//
+//	cookiepusher [global flags] <command> <subcommand> [flags] [args]
+//
+// Connection settings are read from named profiles stored in
+// $XDG_CONFIG_HOME/cookiepusher/config.json (see "cookiepusher profile set"),
+// and can be overridden with global flags or COOKIEPUSHER_* environment variables.
+package main
+
+import (
+	"cookie-syncer/api/internal/client"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: cookiepusher [global flags] <command> <subcommand> [flags] [args]
+
+Commands:
+  profile set [name] [--server URL] [--api-key K] [--admin-key K] [--pool-key K]
+  profile list | use <name> | show
+  users create [--remark R]...
+  users list
+  users rename <id> <remark>
+  users rotate-key <id>
+  users suspend <id>
+  cookies get [domain]
+  cookies export --format netscape|playwright [--domain D] [--out FILE]
+  pool get <domain>
+  sync push <file>
+
+Global flags:
+`
+
+// usageError reports incorrect command-line usage.
+type usageError string
+
+func (e usageError) Error() string { return "usage: cookiepusher " + string(e) }
+
+// App carries the resolved global options shared by all commands.
+type App struct {
+	ProfileName string
+	Profile     *Profile
+	Output      string
+	Client      *client.Client
+}
+
+func main() {
+	fs := flag.NewFlagSet("cookiepusher", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	profileName := fs.String("profile", getEnv("COOKIEPUSHER_PROFILE", ""), "Profile to use (default: the current profile)")
+	server := fs.String("server", os.Getenv("COOKIEPUSHER_SERVER"), "Override the profile's server URL")
+	apiKey := fs.String("api-key", os.Getenv("COOKIEPUSHER_API_KEY"), "Override the profile's API key")
+	admin := fs.String("admin-key", os.Getenv("COOKIEPUSHER_ADMIN_KEY"), "Override the profile's admin key")
+	pool := fs.String("pool-key", os.Getenv("COOKIEPUSHER_POOL_KEY"), "Override the profile's pool key")
+	team := fs.String("team", os.Getenv("COOKIEPUSHER_TEAM"), "Read and sync the cookies of this team's vault (team ID)")
+	output := fs.String("o", getEnv("COOKIEPUSHER_OUTPUT", "table"), "Output format (table, json)")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid output format %q (expected table or json)\n", *output)
+		os.Exit(2)
+	}
+
+	pf, err := loadProfiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	name := *profileName
+	if name == "" {
+		name = pf.Current
+	}
+	profile := Profile{}
+	if p, ok := pf.Profiles[name]; ok {
+		profile = *p
+	}
+	// Flags and environment variables take precedence over the stored profile.
+	if *server != "" {
+		profile.Server = *server
+	}
+	if *apiKey != "" {
+		profile.APIKey = *apiKey
+	}
+	if *admin != "" {
+		profile.AdminKey = *admin
+	}
+	if *pool != "" {
+		profile.PoolKey = *pool
+	}
+
+	c := client.New(profile.Server)
+	c.APIKey = profile.APIKey
+	c.AdminKey = profile.AdminKey
+	c.PoolKey = profile.PoolKey
+	c.Team = *team
+
+	app := &App{ProfileName: name, Profile: &profile, Output: *output, Client: c}
+
+	args := fs.Args()
+	var runErr error
+	switch args[0] {
+	case "profile":
+		runErr = runProfile(app, args[1:])
+	case "users":
+		runErr = runUsers(app, args[1:])
+	case "cookies":
+		runErr = runCookies(app, args[1:])
+	case "pool":
+		runErr = runPool(app, args[1:])
+	case "sync":
+		runErr = runSync(app, args[1:])
+	case "help":
+		fs.Usage()
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if runErr != nil {
+		if errors.Is(runErr, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", runErr)
+		var ue usageError
+		if errors.As(runErr, &ue) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Profile holds the connection settings for one server.
+type Profile struct {
+	Server   string `json:"server"`
+	APIKey   string `json:"api_key,omitempty"`
+	AdminKey string `json:"admin_key,omitempty"`
+	PoolKey  string `json:"pool_key,omitempty"`
+}
+
+// ProfileFile is the on-disk CLI configuration.
+type ProfileFile struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// profilePath returns the config file location, honouring COOKIEPUSHER_CONFIG.
+func profilePath() (string, error) {
+	if p := os.Getenv("COOKIEPUSHER_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cookiepusher", "config.json"), nil
+}
+
+func loadProfiles() (*ProfileFile, error) {
+	pf := &ProfileFile{Current: "default", Profiles: map[string]*Profile{}}
+	path, err := profilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pf, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, pf); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	if pf.Profiles == nil {
+		pf.Profiles = map[string]*Profile{}
+	}
+	return pf, nil
+}
+
+func saveProfiles(pf *ProfileFile) error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file holds API keys, so keep it private to the current user.
+	return os.WriteFile(path, data, 0o600)
+}
+
+func runProfile(app *App, args []string) error {
+	if len(args) == 0 {
+		return usageError("profile set|list|use|show")
+	}
+	pf, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "set":
+		fs := flag.NewFlagSet("profile set", flag.ContinueOnError)
+		server := fs.String("server", "", "Server base URL, e.g. http://localhost:8080")
+		apiKey := fs.String("api-key", "", "User API key (x-api-key)")
+		admin := fs.String("admin-key", "", "Admin key (x-admin-key)")
+		pool := fs.String("pool-key", "", "Pool access key (x-pool-key)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		name := app.ProfileName
+		if fs.NArg() > 0 {
+			name = fs.Arg(0)
+		}
+		p, ok := pf.Profiles[name]
+		if !ok {
+			p = &Profile{}
+			pf.Profiles[name] = p
+		}
+		// Only overwrite the fields that were passed explicitly.
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "server":
+				p.Server = *server
+			case "api-key":
+				p.APIKey = *apiKey
+			case "admin-key":
+				p.AdminKey = *admin
+			case "pool-key":
+				p.PoolKey = *pool
+			}
+		})
+		if len(pf.Profiles) == 1 {
+			pf.Current = name
+		}
+		if err := saveProfiles(pf); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Profile %q saved.\n", name)
+		return nil
+
+	case "use":
+		if len(args) < 2 {
+			return usageError("profile use <name>")
+		}
+		if _, ok := pf.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q does not exist", args[1])
+		}
+		pf.Current = args[1]
+		if err := saveProfiles(pf); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Now using profile %q.\n", args[1])
+		return nil
+
+	case "list":
+		names := make([]string, 0, len(pf.Profiles))
+		for name := range pf.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		type entry struct {
+			Name    string `json:"name"`
+			Server  string `json:"server"`
+			Current bool   `json:"current"`
+		}
+		entries := make([]entry, 0, len(names))
+		rows := make([][]string, 0, len(names))
+		for _, name := range names {
+			current := ""
+			if name == pf.Current {
+				current = "*"
+			}
+			entries = append(entries, entry{Name: name, Server: pf.Profiles[name].Server, Current: name == pf.Current})
+			rows = append(rows, []string{current, name, pf.Profiles[name].Server})
+		}
+		return app.Print(entries, []string{"", "NAME", "SERVER"}, rows)
+
+	case "show":
+		p := app.Profile
+		masked := map[string]string{
+			"profile":   app.ProfileName,
+			"server":    p.Server,
+			"api_key":   mask(p.APIKey),
+			"admin_key": mask(p.AdminKey),
+			"pool_key":  mask(p.PoolKey),
+		}
+		rows := [][]string{}
+		for _, field := range []string{"profile", "server", "api_key", "admin_key", "pool_key"} {
+			rows = append(rows, []string{field, masked[field]})
+		}
+		return app.Print(masked, []string{"FIELD", "VALUE"}, rows)
+
+	default:
+		return usageError("profile set|list|use|show")
+	}
+}
+
+// mask hides all but the last four characters of a secret.
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cookie-syncer/api/internal/handler"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stringList is a flag.Value that collects repeated flags.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func runUsers(app *App, args []string) error {
+	if len(args) == 0 {
+		return usageError("users create|list|rename|rotate-key|suspend")
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+		var remarks stringList
+		fs.Var(&remarks, "remark", "Remark for a new user (repeat to create several users)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if len(remarks) == 0 {
+			remarks = stringList{""}
+		}
+		users, err := app.Client.CreateUsers(remarks)
+		if err != nil {
+			return err
+		}
+		return printUsers(app, users)
+
+	case "list":
+		users, err := app.Client.ListUsers()
+		if err != nil {
+			return err
+		}
+		return printUsers(app, users)
+
+	case "rename":
+		if len(args) != 3 {
+			return usageError("users rename <id> <remark>")
+		}
+		id, err := parseUserID(args[1])
+		if err != nil {
+			return err
+		}
+		if err := app.Client.RenameUser(id, args[2]); err != nil {
+			return err
+		}
+		return app.Print(map[string]interface{}{"id": id, "remark": args[2]}, nil, [][]string{{fmt.Sprintf("User %d renamed to %q.", id, args[2])}})
+
+	case "rotate-key":
+		if len(args) != 2 {
+			return usageError("users rotate-key <id>")
+		}
+		id, err := parseUserID(args[1])
+		if err != nil {
+			return err
+		}
+		user, err := app.Client.RotateUserKey(id)
+		if err != nil {
+			return err
+		}
+		return printUsers(app, []handler.AdminUserResponse{*user})
+
+	case "suspend":
+		if len(args) != 2 {
+			return usageError("users suspend <id>")
+		}
+		id, err := parseUserID(args[1])
+		if err != nil {
+			return err
+		}
+		if err := app.Client.SuspendUser(id); err != nil {
+			return err
+		}
+		return app.Print(map[string]interface{}{"id": id, "suspended": true}, nil, [][]string{{fmt.Sprintf("User %d suspended.", id)}})
+
+	default:
+		return usageError("users create|list|rename|rotate-key|suspend")
+	}
+}
+
+func parseUserID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID %q", s)
+	}
+	return id, nil
+}
+
+func printUsers(app *App, users []handler.AdminUserResponse) error {
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		status := "active"
+		if u.Suspended {
+			status = "suspended"
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(u.ID, 10),
+			u.APIKey,
+			deref(u.Remark),
+			strconv.FormatBool(u.SharingEnabled),
+			status,
+			formatTime(u.LastSyncedAt),
+		})
+	}
+	return app.Print(users, []string{"ID", "API KEY", "REMARK", "SHARING", "STATUS", "LAST SYNC"}, rows)
+}
@@ -23,41 +23,19 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/admin/users": {
-            "post": {
-                "description": "Creates new users based on the request body array. Each object in the array can specify a remark.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/admin/pool/clients": {
+            "get": {
+                "description": "Lists every pool client, including revoked and expired ones, with their usage counters. Keys are not shown.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Admin"
                 ],
-                "summary": "[Admin] Create one or more users",
-                "parameters": [
-                    {
-                        "description": "Array of users to create. Can be empty to create one default user.",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "object",
-                                "properties": {
-                                    "remark": {
-                                        "type": "string"
-                                    }
-                                }
-                            }
-                        }
-                    }
-                ],
+                "summary": "[Admin] List pool clients",
                 "responses": {
-                    "201": {
-                        "description": "Returns an array of created users including their new API keys.",
+                    "200": {
+                        "description": "OK",
                         "schema": {
                             "allOf": [
                                 {
@@ -69,7 +47,7 @@ const docTemplate = `{
                                         "data": {
                                             "type": "array",
                                             "items": {
-                                                "$ref": "#/definitions/handler.AdminUserResponse"
+                                                "$ref": "#/definitions/model.PoolClient"
                                             }
                                         }
                                     }
@@ -77,12 +55,6 @@ const docTemplate = `{
                             ]
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/handler.APIResponse"
-                        }
-                    },
                     "403": {
                         "description": "Forbidden",
                         "schema": {
@@ -94,6 +66,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
@@ -101,11 +79,9 @@ const docTemplate = `{
                         "AdminKeyAuth": []
                     }
                 ]
-            }
-        },
-        "/admin/users/by-key/{apiKey}": {
-            "put": {
-                "description": "Updates a user's details, such as their remark, by finding them via API key.",
+            },
+            "post": {
+                "description": "Creates a pool consumer with its own key, sent as ` + "`" + `x-pool-key` + "`" + `. The key is only shown in this response; the server keeps a hash of it. allowed_domains limits the client to those domains and their subdomains (empty for all), rate_limit caps its requests per minute (0 for no limit) and expires_at ends its access (null for never).",
                 "consumes": [
                     "application/json"
                 ],
@@ -115,35 +91,35 @@ const docTemplate = `{
                 "tags": [
                     "Admin"
                 ],
-                "summary": "[Admin] Update user by API key",
+                "summary": "[Admin] Create a pool client",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User API Key",
-                        "name": "apiKey",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "User details to update",
+                        "description": "Pool client",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "properties": {
-                                "remark": {
-                                    "type": "string"
-                                }
-                            }
+                            "$ref": "#/definitions/handler.PoolClientRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "The new client including its key",
                         "schema": {
-                            "$ref": "#/definitions/handler.APIResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.CreatedPoolClientResponse"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -158,11 +134,23 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
@@ -172,42 +160,42 @@ const docTemplate = `{
                 ]
             }
         },
-        "/admin/users/by-key/{apiKey}/refresh-key": {
-            "post": {
-                "description": "Generates a new API key for the specified user and returns the full updated user object.",
+        "/admin/pool/clients/{id}": {
+            "put": {
+                "description": "Replaces the client's name, allowed domains, rate limit and expiry. Its key and counters are kept.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Admin"
                 ],
-                "summary": "[Admin] Refresh user API key by API key",
+                "summary": "[Admin] Update a pool client",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User API Key",
-                        "name": "apiKey",
+                        "type": "integer",
+                        "description": "Pool client ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Pool client",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.PoolClientRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "allOf": [
-                                {
-                                    "$ref": "#/definitions/handler.APIResponse"
-                                },
-                                {
-                                    "type": "object",
-                                    "properties": {
-                                        "data": {
-                                            "$ref": "#/definitions/handler.AdminUserResponse"
-                                        }
-                                    }
-                                }
-                            ]
+                            "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
                     "400": {
@@ -222,11 +210,29 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
@@ -236,40 +242,23 @@ const docTemplate = `{
                 ]
             }
         },
-        "/admin/users/{id}": {
-            "put": {
-                "description": "Updates a user's details, such as their remark.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/admin/pool/clients/{id}/revoke": {
+            "post": {
+                "description": "Revokes the client's key for good; requests with it get 401. The client stays listed with its counters.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Admin"
                 ],
-                "summary": "[Admin] Update user by ID",
+                "summary": "[Admin] Revoke a pool client",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Pool client ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "User details to update",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "object",
-                            "properties": {
-                                "remark": {
-                                    "type": "string"
-                                }
-                            }
-                        }
                     }
                 ],
                 "responses": {
@@ -291,11 +280,23 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
@@ -305,23 +306,34 @@ const docTemplate = `{
                 ]
             }
         },
-        "/admin/users/{id}/refresh-key": {
-            "post": {
-                "description": "Generates a new API key for the specified user and returns the full updated user object.",
+        "/admin/pool/stats": {
+            "get": {
+                "description": "Shows how often sessions were served, leased or reported as bad, per domain (with a breakdown by contributor) and per hour, over the last hours (24 by default, the current hour included, at most 2160). Counts are kept for POOL_STATS_RETENTION.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Admin"
                 ],
-                "summary": "[Admin] Refresh user API key by ID",
+                "summary": "[Admin] Get pool usage",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "How many hours back to cover",
+                        "name": "hours",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this domain",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only this contributor",
+                        "name": "user_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -336,7 +348,7 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "$ref": "#/definitions/handler.AdminUserResponse"
+                                            "$ref": "#/definitions/handler.PoolStats"
                                         }
                                     }
                                 }
@@ -360,6 +372,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
@@ -369,16 +387,16 @@ const docTemplate = `{
                 ]
             }
         },
-        "/auth/test": {
+        "/admin/probes": {
             "get": {
-                "description": "A simple endpoint to check if the provided API key in the ` + "`" + `x-api-key` + "`" + ` header is valid and associated with a user.",
+                "description": "Lists the admin probes of the pool (user_id 0) and every user's probes.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Auth"
+                    "Admin"
                 ],
-                "summary": "Test API Key",
+                "summary": "[Admin] List session probes",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -391,14 +409,9 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "object",
-                                            "properties": {
-                                                "role": {
-                                                    "type": "string"
-                                                },
-                                                "user_id": {
-                                                    "type": "integer"
-                                                }
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.SessionProbe"
                                             }
                                         }
                                     }
@@ -406,8 +419,20 @@ const docTemplate = `{
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -415,35 +440,36 @@ const docTemplate = `{
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
-            }
-        },
-        "/cookies/all": {
-            "get": {
-                "description": "Retrieves all cookies for the authenticated user. By default, groups them by domain and returns them as HTTP header strings. Use ?format=json to get structured JSON.",
+            },
+            "post": {
+                "description": "Like POST /user/probes, but the probe runs against every user's cookies for the domain that are shared in the pool. The pool leaves out sessions a probe found expired while other sessions for the domain are left.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Cookies"
+                    "Admin"
                 ],
-                "summary": "Get all cookies",
+                "summary": "[Admin] Create a pool session probe",
                 "parameters": [
                     {
-                        "enum": [
-                            "json"
-                        ],
-                        "type": "string",
-                        "description": "Output format",
-                        "name": "format",
-                        "in": "query"
+                        "description": "Probe",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.SessionProbeRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
                             "allOf": [
                                 {
@@ -453,61 +479,125 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "object"
+                                            "$ref": "#/definitions/model.SessionProbe"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
-                    "500": {
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
             }
         },
-        "/cookies/{domain}": {
-            "get": {
-                "description": "Retrieves cookies for a specific domain. By default, returns an HTTP header string. Use ?format=json to get structured JSON.",
+        "/admin/probes/{id}": {
+            "delete": {
+                "description": "Deletes an admin or user probe and its results.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Cookies"
+                    "Admin"
                 ],
-                "summary": "Get cookies for a domain",
+                "summary": "[Admin] Delete a session probe",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Domain",
-                        "name": "domain",
+                        "type": "integer",
+                        "description": "Probe ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
                     {
-                        "enum": [
-                            "json"
-                        ],
-                        "type": "string",
-                        "description": "Output format",
-                        "name": "format",
-                        "in": "query"
+                        "AdminKeyAuth": []
                     }
+                ]
+            }
+        },
+        "/admin/stats/cache": {
+            "get": {
+                "description": "Returns hit, miss, error and invalidation counters for the cookie and pool read cache (configured with CACHE). The backend is \"none\" when caching is disabled.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
                 ],
+                "summary": "[Admin] Read cache statistics",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -520,21 +610,15 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "object"
+                                            "$ref": "#/definitions/cachestore.Stats"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/handler.APIResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -542,37 +626,21 @@ const docTemplate = `{
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
             }
         },
-        "/cookies/{domain}/{name}": {
+        "/admin/stats/locks": {
             "get": {
-                "description": "Retrieves the raw value of a specific cookie, returned in the 'data' field.",
+                "description": "Returns counters for the per-user sync locks: which backend is in use, how many locks are held, how often a sync had to wait (for this process or for another replica), and how many waits timed out.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Cookies"
-                ],
-                "summary": "Get a single cookie's value",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Domain",
-                        "name": "domain",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Cookie Name",
-                        "name": "name",
-                        "in": "path",
-                        "required": true
-                    }
+                    "Admin"
                 ],
+                "summary": "[Admin] Sync lock statistics",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -585,27 +653,15 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "string"
+                                            "$ref": "#/definitions/locker.Stats"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/handler.APIResponse"
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/handler.APIResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -613,42 +669,24 @@ const docTemplate = `{
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
             }
         },
-        "/pool/cookies/{domain}": {
+        "/admin/users": {
             "get": {
-                "description": "Retrieves all sharable cookies for a given domain from users who have opted into sharing.\nThis endpoint is protected by a dedicated Pool Access Key (` + "`" + `x-pool-key` + "`" + ` header), not a user's API key.\nBy default, returns an array of strings, where each string is a user's cookies formatted as an HTTP 'Cookie' header.\nUse ` + "`" + `?format=json` + "`" + ` to get a structured JSON response, where each element contains the user's ID and their list of cookies.",
+                "description": "Returns every user, including suspended ones, together with their API keys.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Pool"
-                ],
-                "summary": "Get sharable cookies by domain",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "The domain to fetch cookies for",
-                        "name": "domain",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "enum": [
-                            "json"
-                        ],
-                        "type": "string",
-                        "description": "Output format",
-                        "name": "format",
-                        "in": "query"
-                    }
+                    "Admin"
                 ],
+                "summary": "[Admin] List users",
                 "responses": {
                     "200": {
-                        "description": "JSON response with ` + "`" + `?format=json` + "`" + `",
+                        "description": "OK",
                         "schema": {
                             "allOf": [
                                 {
@@ -660,15 +698,7 @@ const docTemplate = `{
                                         "data": {
                                             "type": "array",
                                             "items": {
-                                                "type": "object",
-                                                "properties": {
-                                                    "cookies": {
-                                                        "type": "object"
-                                                    },
-                                                    "user_id": {
-                                                        "type": "integer"
-                                                    }
-                                                }
+                                                "$ref": "#/definitions/handler.AdminUserResponse"
                                             }
                                         }
                                     }
@@ -676,8 +706,8 @@ const docTemplate = `{
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -687,18 +717,22 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
                     {
-                        "PoolKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
-            }
-        },
-        "/sync": {
+            },
             "post": {
-                "description": "Receives a list of cookies from the browser extension. It then performs an atomic \"replace\" operation: all existing cookies for that user are deleted, and the new list is inserted. Finally, it returns the full updated list of cookies for the user.",
+                "description": "Creates new users based on the request body array. Each object in the array can specify a remark.",
                 "consumes": [
                     "application/json"
                 ],
@@ -706,26 +740,31 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Sync"
+                    "Admin"
                 ],
-                "summary": "Sync cookies",
+                "summary": "[Admin] Create one or more users",
                 "parameters": [
                     {
-                        "description": "List of cookies to sync",
-                        "name": "cookies",
+                        "description": "Array of users to create. Can be empty to create one default user.",
+                        "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/model.Cookie"
+                                "type": "object",
+                                "properties": {
+                                    "remark": {
+                                        "type": "string"
+                                    }
+                                }
                             }
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Returns an array of created users including their new API keys.",
                         "schema": {
                             "allOf": [
                                 {
@@ -737,7 +776,7 @@ const docTemplate = `{
                                         "data": {
                                             "type": "array",
                                             "items": {
-                                                "$ref": "#/definitions/model.Cookie"
+                                                "$ref": "#/definitions/handler.AdminUserResponse"
                                             }
                                         }
                                     }
@@ -751,8 +790,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -762,51 +807,160 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
             }
         },
-        "/user/settings": {
-            "get": {
-                "description": "Retrieves settings for the authenticated user, such as whether cookie sharing is enabled.",
+        "/admin/users/by-key/{apiKey}": {
+            "put": {
+                "description": "Updates a user's details, such as their remark, by finding them via API key.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User"
+                    "Admin"
+                ],
+                "summary": "[Admin] Update user by API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User API Key",
+                        "name": "apiKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User details to update",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "remark": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
                 ],
-                "summary": "Get user settings",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "allOf": [
-                                {
-                                    "$ref": "#/definitions/handler.APIResponse"
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/users/by-key/{apiKey}/refresh-key": {
+            "post": {
+                "description": "Generates a new API key for the specified user and returns the full updated user object.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "[Admin] Refresh user API key by API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User API Key",
+                        "name": "apiKey",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
                                 },
                                 {
                                     "type": "object",
                                     "properties": {
                                         "data": {
-                                            "type": "object",
-                                            "properties": {
-                                                "sharing_enabled": {
-                                                    "type": "boolean"
-                                                }
-                                            }
+                                            "$ref": "#/definitions/handler.AdminUserResponse"
                                         }
                                     }
                                 }
                             ]
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -816,16 +970,24 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
-            },
+            }
+        },
+        "/admin/users/{id}": {
             "put": {
-                "description": "Updates settings for the authenticated user, such as enabling or disabling cookie sharing.",
+                "description": "Updates a user's details, such as their remark.",
                 "consumes": [
                     "application/json"
                 ],
@@ -833,20 +995,27 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "User"
+                    "Admin"
                 ],
-                "summary": "Update user settings",
+                "summary": "[Admin] Update user by ID",
                 "parameters": [
                     {
-                        "description": "Settings payload",
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User details to update",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "object",
                             "properties": {
-                                "sharing_enabled": {
-                                    "type": "boolean"
+                                "remark": {
+                                    "type": "string"
                                 }
                             }
                         }
@@ -865,8 +1034,20 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.APIResponse"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
@@ -876,52 +1057,3574 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handler.APIResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
                     }
                 },
                 "security": [
                     {
-                        "ApiKeyAuth": []
+                        "AdminKeyAuth": []
                     }
                 ]
             }
-        }
-    },
-    "definitions": {
-        "handler.APIResponse": {
-            "type": "object",
-            "properties": {
-                "code": {
-                    "type": "integer"
+        },
+        "/admin/users/{id}/quota": {
+            "put": {
+                "description": "Replaces the user's quota overrides. Each limit is a number (0 for unlimited) or null to use the server default (QUOTA_MAX_COOKIES, QUOTA_MAX_BYTES, QUOTA_MAX_DOMAINS). Lower limits apply from the user's next sync; cookies already stored are kept. Returns the resulting usage report.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "[Admin] Set a user's quota",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Quota overrides",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.Quota"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/quota.Report"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
                 },
-                "data": {},
-                "message": {
-                    "type": "string"
-                }
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ]
             }
         },
-        "handler.AdminUserResponse": {
-            "type": "object",
-            "properties": {
-                "api_key": {
-                    "type": "string"
-                },
-                "created_at": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "last_synced_at": {
-                    "type": "string"
-                },
-                "remark": {
-                    "type": "string"
-                },
-                "sharing_enabled": {
-                    "type": "boolean"
-                },
-                "updated_at": {
+        "/admin/users/{id}/refresh-key": {
+            "post": {
+                "description": "Generates a new API key for the specified user and returns the full updated user object.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "[Admin] Refresh user API key by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.AdminUserResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/users/{id}/suspend": {
+            "post": {
+                "description": "Suspends the specified user. A suspended user's API key is rejected by all authenticated endpoints.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "[Admin] Suspend user by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/admin/users/{id}/usage": {
+            "get": {
+                "description": "Shows the user's usage next to their effective limits (0 means unlimited) and their per-user overrides.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "[Admin] Get a user's quota usage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/quota.Report"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "AdminKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/auth/test": {
+            "get": {
+                "description": "A simple endpoint to check if the provided API key in the ` + "`" + `x-api-key` + "`" + ` header is valid and associated with a user. With an x-team-id header, it also checks that the user is a member of the team and reports their role in it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Test API Key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Team ID",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object",
+                                            "properties": {
+                                                "role": {
+                                                    "type": "string"
+                                                },
+                                                "team_id": {
+                                                    "type": "integer"
+                                                },
+                                                "user_id": {
+                                                    "type": "integer"
+                                                }
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/cookies/all": {
+            "get": {
+                "description": "Retrieves all cookies for the authenticated user. By default, groups them by domain and returns them as HTTP header strings. Use ?format=json to get structured JSON.\nResponses carry an ETag and a Last-Modified header (the user's last sync); send them back in If-None-Match or If-Modified-Since to get 304 Not Modified when nothing changed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Get all cookies",
+                "parameters": [
+                    {
+                        "enum": [
+                            "json"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified from an earlier response",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Read the cookies of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object"
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Hash of the response body"
+                            },
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "Time of the user's last sync"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/cookies/{domain}": {
+            "get": {
+                "description": "Retrieves cookies for a specific domain. By default, returns an HTTP header string. Use ?format=json to get structured JSON.\nResponses carry an ETag and a Last-Modified header (the user's last sync); send them back in If-None-Match or If-Modified-Since to get 304 Not Modified when nothing changed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Get cookies for a domain",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified from an earlier response",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Read the cookies of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object"
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Hash of the response body"
+                            },
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "Time of the user's last sync"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/cookies/{domain}/{name}": {
+            "get": {
+                "description": "Retrieves the raw value of a specific cookie, returned in the 'data' field.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Get a single cookie's value",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Domain",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cookie Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Read the cookies of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/export/cookies": {
+            "get": {
+                "description": "Exports the authenticated user's cookies as a Netscape cookies.txt file (returned as a string) or a Playwright storage state (returned as an object). Optionally restricted to a single domain.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Cookies"
+                ],
+                "summary": "Export cookies",
+                "parameters": [
+                    {
+                        "enum": [
+                            "netscape",
+                            "playwright"
+                        ],
+                        "type": "string",
+                        "description": "Export format",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only export cookies for this domain",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Read the cookies of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/pool/cookies/{domain}": {
+            "get": {
+                "description": "Retrieves all sharable cookies for a given domain from users who have opted into sharing.\nThis endpoint is protected by a pool client's key (` + "`" + `x-pool-key` + "`" + ` header), not a user's API key. A client whose allowed domains do not cover the domain gets 403; a client over its rate limit gets 429.\nBy default, returns an array of strings, where each string is a user's cookies formatted as an HTTP 'Cookie' header.\nUse ` + "`" + `?format=json` + "`" + ` to get a structured JSON response, where each element contains a contributor handle and the contributor's cookies. Handles are pseudonyms: the same for a contributor every time this pool key asks about this domain, so they can be given to POST /pool/report, but different for other domains and other pool keys.\nSessions under an active lease (see POST /pool/leases) are left out until the lease ends.\nResponses carry an ETag; send it back in If-None-Match to get 304 Not Modified when the pool is unchanged. There is no Last-Modified, as sharing changes alter the pool without a timestamp.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pool"
+                ],
+                "summary": "Get sharable cookies by domain",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The domain to fetch cookies for",
+                        "name": "domain",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "JSON response with ` + "`" + `?format=json` + "`" + `",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "type": "object",
+                                                "properties": {
+                                                    "contributor": {
+                                                        "type": "string"
+                                                    },
+                                                    "cookies": {
+                                                        "type": "object"
+                                                    }
+                                                }
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Hash of the response body"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "PoolKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/pool/domains": {
+            "get": {
+                "description": "Lists the registrable domains (example.com for www.example.com) for which at least one contributor shares a healthy session: one that is neither quarantined nor found expired by a probe. Each domain comes with the number of such contributors and the newest of their latest syncs. Only domains the pool key may read are listed; a key limited to a subdomain sees that subdomain instead of its registrable domain.\nDomains are sorted by name and paginated with page (from 1) and per_page (100 by default, at most 1000).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pool"
+                ],
+                "summary": "List pool domains",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Domains per page",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.PoolDomainPage"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "PoolKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/pool/leases": {
+            "post": {
+                "description": "Checks out one contributor's session (their shared cookies for the domain) for the given number of minutes (POOL_LEASE_TTL if 0, at most POOL_LEASE_MAX_TTL). The response names the session's contributor by the same handle as pool reads. Sessions are handed out least recently leased first, so consumers rotate through them, and a session is not leased again until its lease is released or runs out. Release the lease when done, marking it bad if the session did not work.\nLeases belong to the pool client that took them. Everyone using the legacy POOL_ACCESS_KEY is one client, so they can release each other's leases; give each consumer its own pool key (POST /admin/pool/clients) to keep them apart.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pool"
+                ],
+                "summary": "Lease a pool session",
+                "parameters": [
+                    {
+                        "description": "Domain and lease duration",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.PoolLeaseRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.PoolLeaseResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Nobody shares cookies for the domain",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Every session for the domain is leased",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "PoolKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/pool/leases/{id}/release": {
+            "post": {
+                "description": "Ends the lease so the session can be leased again. Set bad to report that the session did not work, as POST /pool/report with reason invalid would.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pool"
+                ],
+                "summary": "Release a pool lease",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Lease ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Whether the session did not work",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "bad": {
+                                    "type": "boolean"
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No such active lease of this client",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "PoolKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/pool/report": {
+            "post": {
+                "description": "Reports that the contributor's cookies for the domain (and its subdomains) did not work upstream: invalid (logged out or rejected) or rate_limited. Once POOL_QUARANTINE_THRESHOLD different pool clients have reported a session within POOL_REPORT_WINDOW, it is left out of the pool and of leases: an invalid session until the contributor syncs new cookies for it, a rate-limited one for POOL_RATE_LIMIT_COOLDOWN. Repeated reports by one client count once. Reports made before a rate-limit cooldown ends no longer count after it; a sync that changes the session's cookies or a lease of it released as good clears them.\nThe contributor is the handle that a pool read or lease for the same domain with the same pool key returned.\nEveryone using the legacy POOL_ACCESS_KEY is one client: they see the same handles, and their reports of a session count once towards POOL_QUARANTINE_THRESHOLD. Give each consumer its own pool key (POST /admin/pool/clients) for their reports to count separately.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pool"
+                ],
+                "summary": "Report a failing pool session",
+                "parameters": [
+                    {
+                        "description": "The failing session",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.PoolReportRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.PoolReportResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No contributor with this handle shares cookies for the domain in the pool (quarantined sessions are not in it)",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "PoolKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/share/{token}": {
+            "post": {
+                "description": "Returns the cookies the link shares, as they are now, as a Netscape cookies.txt file (returned as a string) or a Playwright storage state (returned as an object). Needs no API key: the token is the credential. A link with a password needs it in the body.\nEach redemption counts against the link's max_uses. A revoked, expired or used up link, or one whose owner is suspended, is 410 Gone. After 5 wrong passwords the link is locked for good and is 410 Gone as well. Every redemption and refusal is recorded in the link's audit log; a refusal repeating the latest entry only counts towards its repeats.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Share"
+                ],
+                "summary": "Redeem a share link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Share link token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "netscape",
+                            "playwright"
+                        ],
+                        "type": "string",
+                        "description": "Export format",
+                        "name": "format",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "Password",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handler.RedeemShareLinkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sync": {
+            "post": {
+                "description": "Receives a list of cookies from the browser extension. It then performs an atomic \"replace\" operation: all existing cookies for that user are deleted, and the new list is inserted (if the list contains the same cookie more than once, the last one wins). The body may be gzip-compressed (Content-Encoding: gzip). Requests with more cookies than the configured MAX_SYNC_COOKIES, or a (decompressed) body larger than MAX_BODY_BYTES, are rejected with 413. Every cookie is normalized (domain lower-cased, empty path set to \"/\", same_site mapped to no_restriction, lax, strict or unspecified) and checked; if any is invalid, nothing is synced and a 422 lists each offending index with the field and reason. Cookies for domains the user's domain rules (see /user/settings) do not allow are dropped and listed in \"filtered\" by their index in the request, or, in reject mode, fail the sync with 422. A sync that would exceed the user's quota of cookies, bytes or distinct domains is rejected with 413 listing the exceeded limits. If another sync for the same user holds the lock for longer than SYNC_LOCK_TIMEOUT, the request fails with 503. Finally, it returns the full updated list of cookies for the user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sync"
+                ],
+                "summary": "Sync cookies",
+                "parameters": [
+                    {
+                        "description": "List of cookies to sync",
+                        "name": "cookies",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Cookie"
+                            }
+                        }
+                    },
+                    {
+                        "enum": [
+                            "gzip"
+                        ],
+                        "type": "string",
+                        "description": "Set to gzip when the body is gzip-compressed",
+                        "name": "Content-Encoding",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Sync into this team's vault instead (needs the editor role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.SyncResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.Cookie"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/quota.Violation"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/validate.Problem"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/teams": {
+            "get": {
+                "description": "Lists the teams the user is a member of, with the user's role in each.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "List teams",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/handler.TeamInfo"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "post": {
+                "description": "Creates a team with an empty cookie vault and makes the user its owner. Members sync into the vault and read it by sending the team's ID in the x-team-id header to POST /sync and the cookie endpoints: readers may read, editors may also sync, owners may also manage members. The vault has its own quota, which admins manage as that of the user vault_user_id, and its own settings, which owners change with x-team-id on PUT /user/settings. Endpoints for the user's own account, such as probes and share links, refuse x-team-id with 400. A user may own up to 10 teams.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "Create a team",
+                "parameters": [
+                    {
+                        "description": "Team",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.TeamRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.TeamInfo"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/teams/{id}": {
+            "delete": {
+                "description": "Deletes the team, its memberships and every cookie in its vault.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "Delete a team",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Team ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/teams/{id}/members": {
+            "get": {
+                "description": "Lists the team's members and their roles. Any member may list them.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "List team members",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Team ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.TeamMember"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/teams/{id}/members/{userID}": {
+            "put": {
+                "description": "Adds the user (by the user ID that GET /auth/test reports) to the team with the role, or changes their role. Only owners may do this. Demoting the last owner is refused with 409.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "Set a team member's role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Team ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Role",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.TeamMemberRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.TeamMember"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "delete": {
+                "description": "Removes the user from the team. Owners may remove anyone; any member may remove themselves to leave the team. Removing the last owner is refused with 409; delete the team instead.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Teams"
+                ],
+                "summary": "Remove a team member",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Team ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/pool/stats": {
+            "get": {
+                "description": "Shows how often pool clients were served, leased or reported as bad each of the user's shared sessions, per domain and per hour, over the last hours (24 by default, the current hour included, at most 2160).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Get pool usage of your sessions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "How many hours back to cover",
+                        "name": "hours",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.PoolStats"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/probes": {
+            "get": {
+                "description": "Lists the probes the user defined for their own cookies.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "List session probes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.SessionProbe"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "post": {
+                "description": "Defines how to tell whether the user's session for a domain still works: the server requests url with the user's cookies for the domain and expects expect_status (200 if 0), a body matching body_regex if given, and no redirect to a Location matching login_redirect if given. Probes run every PROBE_INTERVAL; see GET /user/sessions for the results. A user may have up to 20 probes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Create a session probe",
+                "parameters": [
+                    {
+                        "description": "Probe",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.SessionProbeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.SessionProbe"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/probes/{id}": {
+            "delete": {
+                "description": "Deletes the probe and its results.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Delete a session probe",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Probe ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/sessions": {
+            "get": {
+                "description": "For each domain the user's cookies were probed for (by their own probes, or by admin probes if the cookies are shared), shows expired if any probe found the session no longer works, ok if the probes found it working, error if they could not tell, and unknown for the user's own probes that have not run yet. A sync that changes a session's cookies clears its status until the next probe.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Get session status per domain",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/handler.SessionStatus"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/settings": {
+            "get": {
+                "description": "Retrieves settings for the authenticated user: whether cookie sharing is enabled, the sharing rules applied to the pool and the domain rules applied to syncs.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Get user settings",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Get the settings of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "object",
+                                            "properties": {
+                                                "domain_rules": {
+                                                    "$ref": "#/definitions/model.DomainRules"
+                                                },
+                                                "sharing_enabled": {
+                                                    "type": "boolean"
+                                                },
+                                                "sharing_rules": {
+                                                    "$ref": "#/definitions/model.SharingRules"
+                                                }
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "put": {
+                "description": "Updates settings for the authenticated user: whether cookie sharing is enabled, the sharing rules that decide which sharable cookies the pool sees, and the domain rules that decide which cookies a sync may store. Only the settings present in the body are changed.\nDomain rules have a type (exact, wildcard or regex) and a pattern. Wildcards match any characters with '*', and \"*.example.com\" matches example.com too; regexes (RE2) must match the whole domain. Domains are compared lower-case without a leading dot. A domain matching a deny rule is never synced; if there are allow rules, only domains matching one of them are. In \"drop\" mode (the default) other cookies are synced and the filtered ones reported; in \"reject\" mode the whole sync fails with 422.\nSharing rules use the same rule format: a domain matching a deny rule is never shared with the pool; if there are allow rules, only domains matching one of them are, whatever the cookies' is_sharable flags say.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Update user settings",
+                "parameters": [
+                    {
+                        "description": "Settings payload",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "domain_rules": {
+                                    "$ref": "#/definitions/model.DomainRules"
+                                },
+                                "sharing_enabled": {
+                                    "type": "boolean"
+                                },
+                                "sharing_rules": {
+                                    "$ref": "#/definitions/model.SharingRules"
+                                }
+                            }
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Update the settings of this team's vault instead (needs the owner role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/share-links": {
+            "get": {
+                "description": "Lists the user's share links, including revoked, expired and used up ones, without their tokens.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "List share links",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/handler.ShareLinkInfo"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            },
+            "post": {
+                "description": "Creates a link that hands the user's cookies for a domain (and its subdomains), with the given names, or both, to whoever holds its token, e.g. a teammate who needs the session. The link works max_uses times (1 by default, at most 1000) until expires_at (SHARE_LINK_TTL from now by default, at most SHARE_LINK_MAX_TTL), and with a password only when it comes with the password. Redeem it with POST /share/{token}.\nThe token is returned only here; the server keeps its hash. A user may have up to 50 usable links.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Create a share link",
+                "parameters": [
+                    {
+                        "description": "Share link",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ShareLinkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/handler.CreatedShareLinkResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/share-links/{id}/events": {
+            "get": {
+                "description": "Lists when the link was created, redeemed (with the export format and the number of cookies handed out) and revoked, and every refused redemption with the reason, each with the client's address and user agent, oldest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "List share link events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Share link ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.ShareLinkEvent"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/share-links/{id}/revoke": {
+            "post": {
+                "description": "Stops the link from being redeemed. Revoking a revoked link does nothing.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Revoke a share link",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Share link ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        },
+        "/user/usage": {
+            "get": {
+                "description": "Shows how many cookies, bytes (domains, names, values and paths) and distinct domains the user stores, next to the effective limits (0 means unlimited) and any per-user overrides set by an admin.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "Get quota usage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report the usage of this team's vault instead (needs the reader role)",
+                        "name": "x-team-id",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/handler.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/quota.Report"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.APIResponse"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ]
+            }
+        }
+    },
+    "definitions": {
+        "cachestore.Stats": {
+            "type": "object",
+            "properties": {
+                "backend": {
+                    "description": "memory, redis or none",
+                    "type": "string"
+                },
+                "entries": {
+                    "description": "entries currently held (memory only)",
+                    "type": "integer"
+                },
+                "errors": {
+                    "description": "backend failures, answered from the database instead",
+                    "type": "integer"
+                },
+                "evictions": {
+                    "description": "entries dropped to make room (memory only)",
+                    "type": "integer"
+                },
+                "hit_ratio": {
+                    "description": "hits / (hits + misses)",
+                    "type": "number"
+                },
+                "hits": {
+                    "description": "reads answered from the cache",
+                    "type": "integer"
+                },
+                "invalidations": {
+                    "description": "generation bumps caused by writes",
+                    "type": "integer"
+                },
+                "misses": {
+                    "description": "reads that went to the database",
+                    "type": "integer"
+                },
+                "ttl_ms": {
+                    "description": "configured entry lifetime in milliseconds",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.APIResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "data": {},
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.AdminUserResponse": {
+            "type": "object",
+            "properties": {
+                "api_key": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_synced_at": {
+                    "type": "string"
+                },
+                "quota": {
+                    "$ref": "#/definitions/model.Quota"
+                },
+                "remark": {
+                    "type": "string"
+                },
+                "sharing_enabled": {
+                    "type": "boolean"
+                },
+                "suspended": {
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ContributorPoolStats": {
+            "type": "object",
+            "properties": {
+                "leased": {
+                    "description": "leases of a session",
+                    "type": "integer"
+                },
+                "reported_bad": {
+                    "description": "failure reports, including leases returned as bad",
+                    "type": "integer"
+                },
+                "served": {
+                    "description": "pool reads that returned a session",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.CreatedPoolClientResponse": {
+            "type": "object",
+            "properties": {
+                "allowed_domains": {
+                    "description": "domains (with their subdomains) the client may read; empty for all",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "cookies_served": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "key_prefix": {
+                    "description": "start of the key, to tell keys apart",
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rate_limit": {
+                    "description": "requests per minute, 0 for no limit",
+                    "type": "integer"
+                },
+                "request_count": {
+                    "type": "integer"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreatedShareLinkResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "the domain (with its subdomains) shared, empty for every domain",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "failed_attempts": {
+                    "description": "wrong passwords given",
+                    "type": "integer"
+                },
+                "has_password": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "max_uses": {
+                    "type": "integer"
+                },
+                "names": {
+                    "description": "the cookie names shared, empty for every name",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "token_prefix": {
+                    "description": "start of the token, to tell links apart",
+                    "type": "string"
+                },
+                "uses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.DomainPoolStats": {
+            "type": "object",
+            "properties": {
+                "contributors": {
+                    "description": "admins only",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.ContributorPoolStats"
+                    }
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "leased": {
+                    "description": "leases of a session",
+                    "type": "integer"
+                },
+                "reported_bad": {
+                    "description": "failure reports, including leases returned as bad",
+                    "type": "integer"
+                },
+                "served": {
+                    "description": "pool reads that returned a session",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.HourlyPoolStats": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "hour": {
+                    "type": "string"
+                },
+                "leased": {
+                    "description": "leases of a session",
+                    "type": "integer"
+                },
+                "reported_bad": {
+                    "description": "failure reports, including leases returned as bad",
+                    "type": "integer"
+                },
+                "served": {
+                    "description": "pool reads that returned a session",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.PoolClientRequest": {
+            "type": "object",
+            "properties": {
+                "allowed_domains": {
+                    "description": "empty for all domains",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "expires_at": {
+                    "description": "null for no expiry",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rate_limit": {
+                    "description": "requests per minute, 0 for no limit",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.PoolDomain": {
+            "type": "object",
+            "properties": {
+                "contributors": {
+                    "description": "contributors with a healthy session for the domain",
+                    "type": "integer"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "last_synced_at": {
+                    "description": "the newest of their latest syncs",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.PoolDomainPage": {
+            "type": "object",
+            "properties": {
+                "domains": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.PoolDomain"
+                    }
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "per_page": {
+                    "type": "integer"
+                },
+                "total": {
+                    "description": "domains on all pages",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.PoolLeaseRequest": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "type": "string"
+                },
+                "minutes": {
+                    "description": "0 for the server default",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.PoolLeaseResponse": {
+            "type": "object",
+            "properties": {
+                "contributor": {
+                    "description": "handle of the session's contributor, as in pool reads",
+                    "type": "string"
+                },
+                "cookie": {
+                    "description": "the cookies as an HTTP Cookie header",
+                    "type": "string"
+                },
+                "cookies": {
+                    "description": "values by domain and name",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "object",
+                        "additionalProperties": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.PoolReportRequest": {
+            "type": "object",
+            "properties": {
+                "contributor": {
+                    "description": "handle from a pool read or lease for the domain",
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string",
+                    "enum": [
+                        "invalid",
+                        "rate_limited"
+                    ]
+                }
+            }
+        },
+        "handler.PoolReportResponse": {
+            "type": "object",
+            "properties": {
+                "contributor": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "failures": {
+                    "description": "distinct clients reporting within the window",
+                    "type": "integer"
+                },
+                "last_reason": {
+                    "type": "string",
+                    "enum": [
+                        "invalid",
+                        "rate_limited"
+                    ]
+                },
+                "quarantined_at": {
+                    "type": "string"
+                },
+                "quarantined_until": {
+                    "description": "empty while quarantined: until the cookies change",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.PoolStats": {
+            "type": "object",
+            "properties": {
+                "domains": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.DomainPoolStats"
+                    }
+                },
+                "hourly": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.HourlyPoolStats"
+                    }
+                },
+                "since": {
+                    "type": "string"
+                },
+                "total": {
+                    "$ref": "#/definitions/handler.PoolUsageCounts"
+                }
+            }
+        },
+        "handler.PoolUsageCounts": {
+            "type": "object",
+            "properties": {
+                "leased": {
+                    "description": "leases of a session",
+                    "type": "integer"
+                },
+                "reported_bad": {
+                    "description": "failure reports, including leases returned as bad",
+                    "type": "integer"
+                },
+                "served": {
+                    "description": "pool reads that returned a session",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.RedeemShareLinkRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.SessionProbeRequest": {
+            "type": "object",
+            "properties": {
+                "body_regex": {
+                    "description": "the body must match it, empty for no check",
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expect_status": {
+                    "description": "0 for 200",
+                    "type": "integer"
+                },
+                "login_redirect": {
+                    "description": "a redirect to a Location matching it means logged out, empty for no check",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "on the domain or a subdomain",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.SessionStatus": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "expired if any probe found it expired, unknown until probed",
+                    "type": "string",
+                    "enum": [
+                        "ok",
+                        "expired",
+                        "error",
+                        "unknown"
+                    ]
+                }
+            }
+        },
+        "handler.ShareLinkInfo": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "the domain (with its subdomains) shared, empty for every domain",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "failed_attempts": {
+                    "description": "wrong passwords given",
+                    "type": "integer"
+                },
+                "has_password": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "max_uses": {
+                    "type": "integer"
+                },
+                "names": {
+                    "description": "the cookie names shared, empty for every name",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "token_prefix": {
+                    "description": "start of the token, to tell links apart",
+                    "type": "string"
+                },
+                "uses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.ShareLinkRequest": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "description": "share cookies for this domain and its subdomains",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "SHARE_LINK_TTL from now if omitted",
+                    "type": "string"
+                },
+                "max_uses": {
+                    "description": "redemptions allowed, 1 if 0",
+                    "type": "integer"
+                },
+                "names": {
+                    "description": "share only cookies with these names",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "password": {
+                    "description": "required to redeem the link if set",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.SyncResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "data": {},
+                "filtered": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validate.Problem"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.TeamInfo": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "vault_user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.TeamMemberRequest": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "owner",
+                        "editor",
+                        "reader"
+                    ]
+                }
+            }
+        },
+        "handler.TeamRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "locker.Stats": {
+            "type": "object",
+            "properties": {
+                "acquired": {
+                    "description": "locks acquired",
+                    "type": "integer"
+                },
+                "active_locks": {
+                    "description": "users with a holder or waiters in this process right now",
+                    "type": "integer"
+                },
+                "backend": {
+                    "description": "local, postgres, mysql or sqlite",
                     "type": "string"
+                },
+                "cancelled": {
+                    "description": "waits abandoned by the caller",
+                    "type": "integer"
+                },
+                "contended": {
+                    "description": "acquisitions that had to wait for this process",
+                    "type": "integer"
+                },
+                "max_wait_ms": {
+                    "description": "longest single wait in this process, in milliseconds",
+                    "type": "number"
+                },
+                "remote_contended": {
+                    "description": "acquisitions that had to wait for another replica",
+                    "type": "integer"
+                },
+                "timed_out": {
+                    "description": "waits that hit the timeout",
+                    "type": "integer"
+                },
+                "timeout_ms": {
+                    "description": "configured wait limit, 0 for none",
+                    "type": "integer"
+                },
+                "total_wait_ms": {
+                    "description": "time spent waiting in this process, in milliseconds",
+                    "type": "number"
+                },
+                "waiting": {
+                    "description": "requests in this process currently waiting for a lock",
+                    "type": "integer"
                 }
             }
         },
@@ -966,6 +4669,325 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "model.DomainRule": {
+            "type": "object",
+            "properties": {
+                "pattern": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "exact",
+                        "wildcard",
+                        "regex"
+                    ]
+                }
+            }
+        },
+        "model.DomainRules": {
+            "type": "object",
+            "properties": {
+                "allow": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.DomainRule"
+                    }
+                },
+                "deny": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.DomainRule"
+                    }
+                },
+                "mode": {
+                    "description": "empty means drop",
+                    "type": "string",
+                    "enum": [
+                        "drop",
+                        "reject"
+                    ]
+                }
+            }
+        },
+        "model.PoolClient": {
+            "type": "object",
+            "properties": {
+                "allowed_domains": {
+                    "description": "domains (with their subdomains) the client may read; empty for all",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "cookies_served": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key_prefix": {
+                    "description": "start of the key, to tell keys apart",
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rate_limit": {
+                    "description": "requests per minute, 0 for no limit",
+                    "type": "integer"
+                },
+                "request_count": {
+                    "type": "integer"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Quota": {
+            "type": "object",
+            "properties": {
+                "max_bytes": {
+                    "description": "total size of domains, names, values and paths",
+                    "type": "integer"
+                },
+                "max_cookies": {
+                    "description": "cookies stored",
+                    "type": "integer"
+                },
+                "max_domains": {
+                    "description": "distinct cookie domains",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.SessionProbe": {
+            "type": "object",
+            "properties": {
+                "body_regex": {
+                    "description": "the body must match it",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expect_status": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "login_redirect": {
+                    "description": "a redirect to a Location matching it means logged out",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "owner, 0 for an admin probe of the pool",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.ShareLinkEvent": {
+            "type": "object",
+            "properties": {
+                "cookie_count": {
+                    "description": "cookies handed out by a redemption",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "description": "why a redemption was denied, or the export format of one",
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string",
+                    "enum": [
+                        "created",
+                        "redeemed",
+                        "denied",
+                        "revoked"
+                    ]
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_at": {
+                    "description": "when the last of them happened",
+                    "type": "string"
+                },
+                "link_id": {
+                    "type": "integer"
+                },
+                "remote_addr": {
+                    "type": "string"
+                },
+                "repeats": {
+                    "description": "further identical denials folded into this entry",
+                    "type": "integer"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.SharingRules": {
+            "type": "object",
+            "properties": {
+                "allow": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.DomainRule"
+                    }
+                },
+                "deny": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.DomainRule"
+                    }
+                }
+            }
+        },
+        "model.TeamMember": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "owner",
+                        "editor",
+                        "reader"
+                    ]
+                },
+                "team_id": {
+                    "type": "integer"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "quota.Limits": {
+            "type": "object",
+            "properties": {
+                "max_bytes": {
+                    "type": "integer"
+                },
+                "max_cookies": {
+                    "type": "integer"
+                },
+                "max_domains": {
+                    "type": "integer"
+                }
+            }
+        },
+        "quota.Report": {
+            "type": "object",
+            "properties": {
+                "exceeded": {
+                    "description": "limits already exceeded, e.g. after an admin lowered them",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/quota.Violation"
+                    }
+                },
+                "limits": {
+                    "description": "effective limits, 0 for unlimited",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/quota.Limits"
+                        }
+                    ]
+                },
+                "overrides": {
+                    "description": "the user's own limits, null where the default applies",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Quota"
+                        }
+                    ]
+                },
+                "usage": {
+                    "$ref": "#/definitions/quota.Usage"
+                }
+            }
+        },
+        "quota.Usage": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "description": "domains, names, values and paths together",
+                    "type": "integer"
+                },
+                "cookies": {
+                    "type": "integer"
+                },
+                "domains": {
+                    "description": "distinct domains, ignoring case and a leading dot",
+                    "type": "integer"
+                }
+            }
+        },
+        "quota.Violation": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "resource": {
+                    "description": "cookies, bytes or domains",
+                    "type": "string"
+                },
+                "used": {
+                    "type": "integer"
+                }
+            }
+        },
+        "validate.Problem": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "description": "JSON field at fault, empty for the whole cookie",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "position in the submitted array",
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
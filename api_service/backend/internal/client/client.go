@@ -0,0 +1,211 @@
+package client
+
+import (
+	"bytes"
+	"cookie-syncer/api/internal/handler"
+	"cookie-syncer/api/internal/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client is a thin wrapper around the CookiePusher HTTP API.
+type Client struct {
+	BaseURL  string
+	APIKey   string
+	AdminKey string
+	PoolKey  string
+	Team     string // ID of the team whose vault API-key requests act on, empty for the user's own
+	HTTP     *http.Client
+}
+
+// New creates a client for the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is returned when the server answers with a non-2xx status.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// envelope is handler.APIResponse with the payload left undecoded.
+type envelope struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// keyHeader selects which credential a request is sent with.
+type keyHeader int
+
+const (
+	userKey keyHeader = iota
+	adminKey
+	poolKey
+)
+
+func (c *Client) do(method, path string, query url.Values, auth keyHeader, body, out interface{}) error {
+	if c.BaseURL == "" {
+		return fmt.Errorf("no server URL configured")
+	}
+	u := c.BaseURL + "/api/v1" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not encode request body: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch auth {
+	case adminKey:
+		if c.AdminKey == "" {
+			return fmt.Errorf("no admin key configured")
+		}
+		req.Header.Set("x-admin-key", c.AdminKey)
+	case poolKey:
+		if c.PoolKey == "" {
+			return fmt.Errorf("no pool key configured")
+		}
+		req.Header.Set("x-pool-key", c.PoolKey)
+	default:
+		if c.APIKey == "" {
+			return fmt.Errorf("no API key configured")
+		}
+		req.Header.Set("x-api-key", c.APIKey)
+		if c.Team != "" {
+			req.Header.Set("x-team-id", c.Team)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		if resp.StatusCode >= 300 {
+			return &APIError{Status: resp.StatusCode, Message: resp.Status}
+		}
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return &APIError{Status: resp.StatusCode, Message: env.Message}
+	}
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return fmt.Errorf("could not decode response data: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateUsers creates one user per remark.
+func (c *Client) CreateUsers(remarks []string) ([]handler.AdminUserResponse, error) {
+	body := make([]map[string]string, 0, len(remarks))
+	for _, remark := range remarks {
+		body = append(body, map[string]string{"remark": remark})
+	}
+	var users []handler.AdminUserResponse
+	err := c.do(http.MethodPost, "/admin/users", nil, adminKey, body, &users)
+	return users, err
+}
+
+// ListUsers lists every user, including suspended ones.
+func (c *Client) ListUsers() ([]handler.AdminUserResponse, error) {
+	var users []handler.AdminUserResponse
+	err := c.do(http.MethodGet, "/admin/users", nil, adminKey, nil, &users)
+	return users, err
+}
+
+// RenameUser replaces a user's remark.
+func (c *Client) RenameUser(userID int64, remark string) error {
+	return c.do(http.MethodPut, fmt.Sprintf("/admin/users/%d", userID), nil, adminKey, map[string]string{"remark": remark}, nil)
+}
+
+// RotateUserKey issues a new API key for a user.
+func (c *Client) RotateUserKey(userID int64) (*handler.AdminUserResponse, error) {
+	var user handler.AdminUserResponse
+	if err := c.do(http.MethodPost, fmt.Sprintf("/admin/users/%d/refresh-key", userID), nil, adminKey, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SuspendUser suspends a user.
+func (c *Client) SuspendUser(userID int64) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", userID), nil, adminKey, nil, nil)
+}
+
+// GetAllCookies returns the user's cookies grouped by domain as name/value maps.
+func (c *Client) GetAllCookies() (map[string]map[string]string, error) {
+	var cookies map[string]map[string]string
+	err := c.do(http.MethodGet, "/cookies/all", url.Values{"format": {"json"}}, userKey, nil, &cookies)
+	return cookies, err
+}
+
+// GetDomainCookies returns the user's cookies for one domain as a name/value map.
+func (c *Client) GetDomainCookies(domain string) (map[string]string, error) {
+	var cookies map[string]string
+	err := c.do(http.MethodGet, "/cookies/"+url.PathEscape(domain), url.Values{"format": {"json"}}, userKey, nil, &cookies)
+	return cookies, err
+}
+
+// ExportCookies returns the user's cookies rendered in the given export format.
+// Netscape exports decode to a JSON string, Playwright exports to an object.
+func (c *Client) ExportCookies(format, domain string) (json.RawMessage, error) {
+	query := url.Values{"format": {format}}
+	if domain != "" {
+		query.Set("domain", domain)
+	}
+	var data json.RawMessage
+	err := c.do(http.MethodGet, "/export/cookies", query, userKey, nil, &data)
+	return data, err
+}
+
+// PoolContributor is one contributor's cookies as returned by the pool API.
+type PoolContributor struct {
+	Contributor string                       `json:"contributor"` // pseudonymous handle, see POST /pool/report
+	Cookies     map[string]map[string]string `json:"cookies"`
+}
+
+// GetPoolCookies returns the shared cookies for a domain.
+func (c *Client) GetPoolCookies(domain string) ([]PoolContributor, error) {
+	var contributors []PoolContributor
+	err := c.do(http.MethodGet, "/pool/cookies/"+url.PathEscape(domain), url.Values{"format": {"json"}}, poolKey, nil, &contributors)
+	return contributors, err
+}
+
+// Sync replaces the user's cookies and returns the stored result.
+func (c *Client) Sync(cookies []*model.Cookie) ([]*model.Cookie, error) {
+	var stored []*model.Cookie
+	err := c.do(http.MethodPost, "/sync", nil, userKey, cookies, &stored)
+	return stored, err
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"cookie-syncer/api/internal/model"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// request is what the test server saw of one call.
+type request struct {
+	Method, Path, Query, Body string
+	Header                    http.Header
+}
+
+// newServer answers every request with status and body and records it in got.
+func newServer(t *testing.T, status int, body string, got *request) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		*got = request{r.Method, r.URL.Path, r.URL.RawQuery, string(data), r.Header.Clone()}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	c := New(srv.URL + "/")
+	c.APIKey, c.AdminKey, c.PoolKey = "user-key", "admin-key", "pool-key"
+	return c
+}
+
+func TestRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		team   string
+		call   func(c *Client) error
+		method string
+		path   string
+		query  string
+		header string
+		value  string
+	}{
+		{"export", "", func(c *Client) error {
+			_, err := c.ExportCookies("netscape", "example.com")
+			return err
+		}, http.MethodGet, "/api/v1/export/cookies", "domain=example.com&format=netscape", "x-api-key", "user-key"},
+		{"export for a team", "7", func(c *Client) error {
+			_, err := c.ExportCookies("playwright", "")
+			return err
+		}, http.MethodGet, "/api/v1/export/cookies", "format=playwright", "x-team-id", "7"},
+		{"domain cookies", "", func(c *Client) error {
+			_, err := c.GetDomainCookies("example.com")
+			return err
+		}, http.MethodGet, "/api/v1/cookies/example.com", "format=json", "x-api-key", "user-key"},
+		{"pool cookies", "7", func(c *Client) error {
+			_, err := c.GetPoolCookies("example.com")
+			return err
+		}, http.MethodGet, "/api/v1/pool/cookies/example.com", "format=json", "x-pool-key", "pool-key"},
+		{"suspend", "", func(c *Client) error {
+			return c.SuspendUser(3)
+		}, http.MethodPost, "/api/v1/admin/users/3/suspend", "", "x-admin-key", "admin-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got request
+			c := newServer(t, http.StatusOK, `{"code":200,"message":"ok","data":null}`, &got)
+			c.Team = tt.team
+			if err := tt.call(c); err != nil {
+				t.Fatal(err)
+			}
+			if got.Method != tt.method || got.Path != tt.path || got.Query != tt.query {
+				t.Errorf("request = %s %s?%s, want %s %s?%s", got.Method, got.Path, got.Query, tt.method, tt.path, tt.query)
+			}
+			if v := got.Header.Get(tt.header); v != tt.value {
+				t.Errorf("%s = %q, want %q", tt.header, v, tt.value)
+			}
+			if tt.header != "x-api-key" && tt.header != "x-team-id" && got.Header.Get("x-team-id") != "" {
+				t.Error("x-team-id sent with a non-user key")
+			}
+		})
+	}
+}
+
+func TestSyncDecodesData(t *testing.T) {
+	var got request
+	c := newServer(t, http.StatusOK, `{"code":200,"message":"ok","data":[{"domain":"example.com","name":"sid","value":"2"}]}`, &got)
+	stored, err := c.Sync([]*model.Cookie{{Domain: "example.com", Name: "sid", Value: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Value != "2" {
+		t.Errorf("stored = %+v", stored)
+	}
+	if ct := got.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var sent []*model.Cookie
+	if err := json.Unmarshal([]byte(got.Body), &sent); err != nil || len(sent) != 1 || sent[0].Value != "1" {
+		t.Errorf("body = %s (%v)", got.Body, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"error envelope", http.StatusNotFound, `{"code":404,"message":"no such domain"}`, "no such domain"},
+		{"non-JSON body", http.StatusBadGateway, `<html>bad gateway</html>`, "502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got request
+			c := newServer(t, tt.status, tt.body, &got)
+			_, err := c.GetAllCookies()
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an *APIError", err)
+			}
+			if apiErr.Status != tt.status || apiErr.Message != tt.message {
+				t.Errorf("error = %+v, want %d %q", apiErr, tt.status, tt.message)
+			}
+		})
+	}
+
+	c := New("http://unused")
+	if _, err := c.GetAllCookies(); err == nil {
+		t.Error("request without an API key succeeded")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
@@ -16,11 +17,50 @@ type Config struct {
 	AdminKey      string
 
 	// Database
-	DBType               string // "sqlite", "postgres", or "mysql"
+	DBType               string // "sqlite", "postgres", "mysql" or "memory"
 	DSN                  string // Data Source Name for the database
 	DBMaxOpenConnections int
 	DBMaxIdleConnections int
 
+	// Sync
+	MaxSyncCookies  int           // Maximum number of cookies accepted by one sync, 0 for no limit
+	SyncLockTimeout time.Duration // How long a sync waits for another sync of the same user, 0 for no limit
+	SyncLocker      string        // "local" (per process) or "database" (shared by all replicas)
+
+	// Requests
+	MaxBodyBytes int64 // Maximum size of a request body (after decompression), 0 for no limit
+
+	// Quotas, the server-wide defaults that admins can override per user (0 for unlimited)
+	QuotaMaxCookies int64
+	QuotaMaxBytes   int64
+	QuotaMaxDomains int64
+
+	// Pool
+	PoolLeaseTTL    time.Duration // Lease duration when the client asks for none
+	PoolLeaseMaxTTL time.Duration // Longest lease a client may ask for
+
+	PoolQuarantineThreshold int           // Distinct clients reporting failures that take a session out of the pool, 0 to never quarantine
+	PoolRateLimitCooldown   time.Duration // How long a session reported as rate limited stays out
+	PoolReportWindow        time.Duration // How long a failure report counts, 0 for until the cookies change
+	PoolStatsRetention      time.Duration // How long hourly pool usage counts are kept, 0 to keep them forever
+
+	PoolHandleSecret string // Key for the contributor handles in pool responses, derived from AdminKey if empty
+
+	// Session probes
+	ProbeInterval     time.Duration // How often every probe runs, 0 to never run them
+	ProbeTimeout      time.Duration // How long one probe request may take
+	ProbeAllowPrivate bool          // Whether probes may reach loopback and private addresses
+
+	// Share links
+	ShareLinkTTL    time.Duration // Link lifetime when the user asks for none
+	ShareLinkMaxTTL time.Duration // Longest lifetime a user may ask for
+
+	// Cache
+	Cache     string        // "memory", "redis" or "none"
+	CacheTTL  time.Duration // How long a cached read is served
+	CacheSize int           // Maximum number of entries in the memory cache
+	RedisURL  string        // Redis server for the redis cache
+
 	// Server
 	Port         string
 	Host         string
@@ -41,12 +81,35 @@ func Load() *Config {
 	var cfg Config
 
 	// Define command-line flags
-	flag.StringVar(&cfg.PoolAccessKey, "pool-key", getEnv("POOL_ACCESS_KEY", ""), "Access key for the cookie pool API")
+	flag.StringVar(&cfg.PoolAccessKey, "pool-key", getEnv("POOL_ACCESS_KEY", ""), "Shared access key for the cookie pool API, with access to every domain (empty to allow only pool client keys)")
 	flag.StringVar(&cfg.AdminKey, "admin-key", getEnv("ADMIN_KEY", ""), "Key for accessing admin endpoints")
-	flag.StringVar(&cfg.DBType, "db-type", getEnv("DB_TYPE", "sqlite"), "Database type (sqlite, postgres, mysql)")
+	flag.StringVar(&cfg.DBType, "db-type", getEnv("DB_TYPE", "sqlite"), "Database type (sqlite, postgres, mysql, or memory for a throwaway demo store)")
 	flag.StringVar(&cfg.DSN, "dsn", getEnv("DSN", "CookiePusher.db"), "Database connection string (DSN)")
 	flag.IntVar(&cfg.DBMaxOpenConnections, "db-max-open-conns", getEnvAsInt("DB_MAX_OPEN_CONNECTIONS", 25), "Database max open connections")
 	flag.IntVar(&cfg.DBMaxIdleConnections, "db-max-idle-conns", getEnvAsInt("DB_MAX_IDLE_CONNECTIONS", 5), "Database max idle connections")
+	flag.IntVar(&cfg.MaxSyncCookies, "max-sync-cookies", getEnvAsInt("MAX_SYNC_COOKIES", 5000), "Maximum number of cookies accepted by one sync (0 for no limit)")
+	flag.DurationVar(&cfg.SyncLockTimeout, "sync-lock-timeout", getEnvAsDuration("SYNC_LOCK_TIMEOUT", 10*time.Second), "How long a sync waits for another sync of the same user (0 for no limit)")
+	flag.StringVar(&cfg.SyncLocker, "sync-locker", getEnv("SYNC_LOCKER", "local"), "Where per-user sync locks live (local, or database to share them between replicas)")
+	flag.Int64Var(&cfg.MaxBodyBytes, "max-body-bytes", getEnvAsInt64("MAX_BODY_BYTES", 10<<20), "Maximum size of a request body in bytes, after decompression (0 for no limit)")
+	flag.Int64Var(&cfg.QuotaMaxCookies, "quota-max-cookies", getEnvAsInt64("QUOTA_MAX_COOKIES", 0), "Default maximum number of cookies a user may store (0 for no limit)")
+	flag.Int64Var(&cfg.QuotaMaxBytes, "quota-max-bytes", getEnvAsInt64("QUOTA_MAX_BYTES", 0), "Default maximum total size of a user's cookies in bytes (0 for no limit)")
+	flag.Int64Var(&cfg.QuotaMaxDomains, "quota-max-domains", getEnvAsInt64("QUOTA_MAX_DOMAINS", 0), "Default maximum number of distinct cookie domains per user (0 for no limit)")
+	flag.DurationVar(&cfg.PoolLeaseTTL, "pool-lease-ttl", getEnvAsDuration("POOL_LEASE_TTL", 10*time.Minute), "Pool session lease duration when the client asks for none")
+	flag.DurationVar(&cfg.PoolLeaseMaxTTL, "pool-lease-max-ttl", getEnvAsDuration("POOL_LEASE_MAX_TTL", time.Hour), "Longest pool session lease a client may ask for")
+	flag.IntVar(&cfg.PoolQuarantineThreshold, "pool-quarantine-threshold", getEnvAsInt("POOL_QUARANTINE_THRESHOLD", 3), "Distinct pool clients whose failure reports quarantine a pool session (0 to never quarantine)")
+	flag.DurationVar(&cfg.PoolRateLimitCooldown, "pool-rate-limit-cooldown", getEnvAsDuration("POOL_RATE_LIMIT_COOLDOWN", 15*time.Minute), "How long a pool session quarantined for rate limiting stays out of the pool")
+	flag.DurationVar(&cfg.PoolReportWindow, "pool-report-window", getEnvAsDuration("POOL_REPORT_WINDOW", 24*time.Hour), "How long a failure report about a pool session counts towards its quarantine (0 for until its cookies change)")
+	flag.DurationVar(&cfg.PoolStatsRetention, "pool-stats-retention", getEnvAsDuration("POOL_STATS_RETENTION", 90*24*time.Hour), "How long hourly pool usage counts are kept (0 to keep them forever)")
+	flag.StringVar(&cfg.PoolHandleSecret, "pool-handle-secret", getEnv("POOL_HANDLE_SECRET", ""), "Secret key for the contributor handles in pool responses, shared by all replicas (empty to derive it from the admin key)")
+	flag.DurationVar(&cfg.ProbeInterval, "probe-interval", getEnvAsDuration("PROBE_INTERVAL", 15*time.Minute), "How often session probes run (0 to never run them)")
+	flag.DurationVar(&cfg.ProbeTimeout, "probe-timeout", getEnvAsDuration("PROBE_TIMEOUT", 10*time.Second), "How long one session probe request may take")
+	flag.BoolVar(&cfg.ProbeAllowPrivate, "probe-allow-private", getEnvAsBool("PROBE_ALLOW_PRIVATE_NETWORKS", false), "Allow session probes to reach loopback and private network addresses")
+	flag.DurationVar(&cfg.ShareLinkTTL, "share-link-ttl", getEnvAsDuration("SHARE_LINK_TTL", 24*time.Hour), "Share link lifetime when the user asks for none")
+	flag.DurationVar(&cfg.ShareLinkMaxTTL, "share-link-max-ttl", getEnvAsDuration("SHARE_LINK_MAX_TTL", 7*24*time.Hour), "Longest share link lifetime a user may ask for")
+	flag.StringVar(&cfg.Cache, "cache", getEnv("CACHE", "memory"), "Read cache for cookie and pool queries (memory, redis, or none)")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", getEnvAsDuration("CACHE_TTL", time.Minute), "How long a cached read is served")
+	flag.IntVar(&cfg.CacheSize, "cache-size", getEnvAsInt("CACHE_SIZE", 10000), "Maximum number of entries in the memory cache")
+	flag.StringVar(&cfg.RedisURL, "redis-url", getEnv("REDIS_URL", "redis://localhost:6379/0"), "Redis server used by the redis cache")
 	flag.StringVar(&cfg.Port, "port", getEnv("PORT", "8080"), "Server port")
 	flag.StringVar(&cfg.Host, "host", getEnv("HOST", "0.0.0.0"), "Server host")
 	flag.StringVar(&cfg.SwaggerHost, "swagger-host", getEnv("SWAGGER_HOST", ""), "Public host for Swagger UI, e.g., my-service.hf.space")
@@ -75,3 +138,33 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// Helper function to get an environment variable as an int64 or return a default value.
+func getEnvAsInt64(key string, fallback int64) int64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// Helper function to get an environment variable as a duration (e.g. "10s") or return a default value.
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// Helper function to get an environment variable as a boolean (e.g. "true", "1") or return a default value.
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,203 @@
+// Package domainrule matches cookie domains against users' domain rules.
+package domainrule
+
+import (
+	"cookie-syncer/api/internal/model"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits on a user's rules, to keep matching cheap.
+const (
+	MaxRules        = 100 // per list
+	MaxPatternBytes = 1024
+)
+
+// Normalize checks rules and returns them in canonical form: an empty mode
+// becomes drop, types are lower-cased and exact and wildcard patterns are
+// lower-cased and stripped of a leading dot. Regex patterns are kept as
+// written.
+func Normalize(rules model.DomainRules) (model.DomainRules, error) {
+	mode := strings.ToLower(strings.TrimSpace(rules.Mode))
+	switch mode {
+	case "":
+		mode = model.DomainRulesDrop
+	case model.DomainRulesDrop, model.DomainRulesReject:
+	default:
+		return model.DomainRules{}, fmt.Errorf("mode %q is not one of drop or reject", rules.Mode)
+	}
+	allow, err := normalizeList("allow", rules.Allow)
+	if err != nil {
+		return model.DomainRules{}, err
+	}
+	deny, err := normalizeList("deny", rules.Deny)
+	if err != nil {
+		return model.DomainRules{}, err
+	}
+	return model.DomainRules{Mode: mode, Allow: allow, Deny: deny}, nil
+}
+
+// NormalizeSharing checks sharing rules and returns them in canonical form,
+// like Normalize.
+func NormalizeSharing(rules model.SharingRules) (model.SharingRules, error) {
+	allow, err := normalizeList("allow", rules.Allow)
+	if err != nil {
+		return model.SharingRules{}, err
+	}
+	deny, err := normalizeList("deny", rules.Deny)
+	if err != nil {
+		return model.SharingRules{}, err
+	}
+	return model.SharingRules{Allow: allow, Deny: deny}, nil
+}
+
+func normalizeList(list string, rules []model.DomainRule) ([]model.DomainRule, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("%s has %d rules, more than the limit of %d", list, len(rules), MaxRules)
+	}
+	normalized := make([]model.DomainRule, 0, len(rules))
+	for i, r := range rules {
+		r.Type = strings.ToLower(strings.TrimSpace(r.Type))
+		if r.Type != model.DomainRuleRegex {
+			r.Pattern = normalizeDomain(r.Pattern)
+		}
+		if _, err := compile(r); err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", list, i, err)
+		}
+		normalized = append(normalized, r)
+	}
+	return normalized, nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// Set is a compiled list of rules.
+type Set []rule
+
+type rule struct {
+	model.DomainRule
+	match func(domain string) bool
+}
+
+// Compile compiles rules, which should have been normalized.
+func Compile(rules []model.DomainRule) (Set, error) {
+	set := make(Set, 0, len(rules))
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		set = append(set, c)
+	}
+	return set, nil
+}
+
+func compile(r model.DomainRule) (rule, error) {
+	switch {
+	case r.Pattern == "":
+		return rule{}, fmt.Errorf("pattern is empty")
+	case len(r.Pattern) > MaxPatternBytes:
+		return rule{}, fmt.Errorf("pattern is %d bytes, more than the limit of %d", len(r.Pattern), MaxPatternBytes)
+	}
+
+	switch r.Type {
+	case model.DomainRuleExact:
+		pattern := r.Pattern
+		return rule{r, func(domain string) bool { return domain == pattern }}, nil
+	case model.DomainRuleWildcard:
+		glob := func(pattern string) string {
+			return strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+		}
+		expr := glob(r.Pattern)
+		if rest, ok := strings.CutPrefix(r.Pattern, "*."); ok {
+			// "*.example.com" covers example.com as well.
+			expr = `(?:.*\.)?` + glob(rest)
+		}
+		re := regexp.MustCompile(`^(?:` + expr + `)$`)
+		return rule{r, re.MatchString}, nil
+	case model.DomainRuleRegex:
+		re, err := regexp.Compile(`^(?:` + r.Pattern + `)$`)
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid regex: %w", err)
+		}
+		return rule{r, re.MatchString}, nil
+	default:
+		return rule{}, fmt.Errorf("type %q is not one of exact, wildcard or regex", r.Type)
+	}
+}
+
+// Match returns the first rule matching domain.
+func (s Set) Match(domain string) (model.DomainRule, bool) {
+	domain = normalizeDomain(domain)
+	for _, r := range s {
+		if r.match(domain) {
+			return r.DomainRule, true
+		}
+	}
+	return model.DomainRule{}, false
+}
+
+// Filter applies a user's DomainRules or SharingRules.
+type Filter struct {
+	allow, deny Set
+	reject      bool
+}
+
+// NewFilter compiles rules.
+func NewFilter(rules model.DomainRules) (*Filter, error) {
+	f, err := newFilter(rules.Allow, rules.Deny)
+	if err != nil {
+		return nil, err
+	}
+	f.reject = rules.Mode == model.DomainRulesReject
+	return f, nil
+}
+
+// NewSharingFilter compiles rules.
+func NewSharingFilter(rules model.SharingRules) (*Filter, error) {
+	return newFilter(rules.Allow, rules.Deny)
+}
+
+func newFilter(allowRules, denyRules []model.DomainRule) (*Filter, error) {
+	allow, err := Compile(allowRules)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile allow rules: %w", err)
+	}
+	deny, err := Compile(denyRules)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile deny rules: %w", err)
+	}
+	return &Filter{allow: allow, deny: deny}, nil
+}
+
+// Rejects reports whether a sync with disallowed cookies must fail as a
+// whole, rather than drop them.
+func (f *Filter) Rejects() bool {
+	return f.reject
+}
+
+// Empty reports whether the filter allows every domain.
+func (f *Filter) Empty() bool {
+	return len(f.allow) == 0 && len(f.deny) == 0
+}
+
+// Allows reports whether cookies for domain may pass.
+func (f *Filter) Allows(domain string) bool {
+	return f.Check(domain) == ""
+}
+
+// Check returns why cookies for domain may not be synced, or "" if they may.
+func (f *Filter) Check(domain string) string {
+	if r, ok := f.deny.Match(domain); ok {
+		return fmt.Sprintf("domain %s matches the %s deny rule %q", domain, r.Type, r.Pattern)
+	}
+	if len(f.allow) > 0 {
+		if _, ok := f.allow.Match(domain); !ok {
+			return fmt.Sprintf("domain %s matches no allow rule", domain)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package domainrule
+
+import (
+	"cookie-syncer/api/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestSetMatch(t *testing.T) {
+	tests := []struct {
+		rule    model.DomainRule
+		domain  string
+		matches bool
+	}{
+		{model.DomainRule{Type: "exact", Pattern: "bank.com"}, "bank.com", true},
+		{model.DomainRule{Type: "exact", Pattern: "bank.com"}, ".Bank.com", true},
+		{model.DomainRule{Type: "exact", Pattern: "bank.com"}, "www.bank.com", false},
+		{model.DomainRule{Type: "wildcard", Pattern: "*.bank.com"}, "www.bank.com", true},
+		{model.DomainRule{Type: "wildcard", Pattern: "*.bank.com"}, "a.b.bank.com", true},
+		{model.DomainRule{Type: "wildcard", Pattern: "*.bank.com"}, "bank.com", true},
+		{model.DomainRule{Type: "wildcard", Pattern: "*.bank.com"}, "mybank.com", false},
+		{model.DomainRule{Type: "wildcard", Pattern: "mail.*"}, "mail.google.com", true},
+		{model.DomainRule{Type: "wildcard", Pattern: "a.b"}, "axb", false},
+		{model.DomainRule{Type: "regex", Pattern: `(www\.)?bank\d+\.com`}, "bank42.com", true},
+		{model.DomainRule{Type: "regex", Pattern: `bank`}, "mybank.com", false}, // anchored
+	}
+	for _, tt := range tests {
+		set, err := Compile([]model.DomainRule{tt.rule})
+		if err != nil {
+			t.Fatalf("Compile(%+v): %v", tt.rule, err)
+		}
+		if _, ok := set.Match(tt.domain); ok != tt.matches {
+			t.Errorf("%s %q matching %q = %v, want %v", tt.rule.Type, tt.rule.Pattern, tt.domain, ok, tt.matches)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got, err := Normalize(model.DomainRules{
+		Allow: []model.DomainRule{{Type: " Wildcard ", Pattern: " *.Example.COM "}},
+		Deny:  []model.DomainRule{{Type: "exact", Pattern: ".Bank.com"}, {Type: "regex", Pattern: `Mail\..*`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode != model.DomainRulesDrop || got.Allow[0] != (model.DomainRule{Type: "wildcard", Pattern: "*.example.com"}) ||
+		got.Deny[0].Pattern != "bank.com" || got.Deny[1].Pattern != `Mail\..*` {
+		t.Errorf("Normalize = %+v", got)
+	}
+
+	tooMany := make([]model.DomainRule, MaxRules+1)
+	for i := range tooMany {
+		tooMany[i] = model.DomainRule{Type: "exact", Pattern: "a.com"}
+	}
+	for _, bad := range []model.DomainRules{
+		{Mode: "ignore"},
+		{Deny: []model.DomainRule{{Type: "glob", Pattern: "a.com"}}},
+		{Deny: []model.DomainRule{{Type: "exact", Pattern: " "}}},
+		{Deny: []model.DomainRule{{Type: "regex", Pattern: "("}}},
+		{Deny: []model.DomainRule{{Type: "regex", Pattern: strings.Repeat("a", MaxPatternBytes+1)}}},
+		{Allow: tooMany},
+	} {
+		if _, err := Normalize(bad); err == nil {
+			t.Errorf("Normalize(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := NewFilter(model.DomainRules{
+		Mode:  model.DomainRulesReject,
+		Allow: []model.DomainRule{{Type: "wildcard", Pattern: "*.example.com"}, {Type: "exact", Pattern: "bank.com"}},
+		Deny:  []model.DomainRule{{Type: "exact", Pattern: "bank.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Rejects() {
+		t.Error("Rejects() = false in reject mode")
+	}
+	if reason := f.Check("www.example.com"); reason != "" {
+		t.Errorf("allowed domain: %s", reason)
+	}
+	if reason := f.Check("bank.com"); !strings.Contains(reason, "deny rule") {
+		t.Errorf("denied domain: reason %q, want the deny rule (deny wins over allow)", reason)
+	}
+	if reason := f.Check("other.org"); !strings.Contains(reason, "no allow rule") {
+		t.Errorf("unlisted domain: reason %q, want no allow rule", reason)
+	}
+
+	none, err := NewFilter(model.DomainRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := none.Check("anything.com"); reason != "" || none.Rejects() {
+		t.Errorf("empty rules: reason %q, rejects %v; want everything allowed and drop mode", reason, none.Rejects())
+	}
+}
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"cookie-syncer/api/internal/model"
+	"fmt"
+	"strings"
+)
+
+// Format identifies a cookie export format.
+type Format string
+
+const (
+	// FormatNetscape is the tab-separated cookies.txt format understood by curl, wget and yt-dlp.
+	FormatNetscape Format = "netscape"
+	// FormatPlaywright is the storage state JSON accepted by Playwright's browser contexts.
+	FormatPlaywright Format = "playwright"
+)
+
+// Formats lists every supported export format.
+var Formats = []Format{FormatNetscape, FormatPlaywright}
+
+// ParseFormat validates a user-supplied format name.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(s, string(f)) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported export format: %q", s)
+}
+
+// Render converts cookies into the given format. Netscape output is a string,
+// Playwright output is a PlaywrightState ready to be JSON encoded.
+func Render(format Format, cookies []*model.Cookie) (interface{}, error) {
+	switch format {
+	case FormatNetscape:
+		return Netscape(cookies), nil
+	case FormatPlaywright:
+		return Playwright(cookies), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+// Netscape renders cookies as a Netscape cookies.txt file.
+func Netscape(cookies []*model.Cookie) string {
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	for _, c := range cookies {
+		domain := c.Domain
+		if c.HTTPOnly {
+			// curl's convention for marking HttpOnly cookies.
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if c.Expires != nil {
+			expires = c.Expires.Unix()
+		}
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain,
+			netscapeBool(strings.HasPrefix(c.Domain, ".")),
+			path,
+			netscapeBool(c.Secure),
+			expires,
+			c.Name,
+			c.Value,
+		)
+	}
+	return b.String()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// PlaywrightCookie is a single cookie in Playwright's storage state.
+type PlaywrightCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires"`
+	HTTPOnly bool    `json:"httpOnly"`
+	Secure   bool    `json:"secure"`
+	SameSite string  `json:"sameSite"`
+}
+
+// PlaywrightState mirrors the file written by Playwright's context.storageState().
+type PlaywrightState struct {
+	Cookies []PlaywrightCookie `json:"cookies"`
+	Origins []interface{}      `json:"origins"`
+}
+
+// Playwright renders cookies as a Playwright storage state.
+func Playwright(cookies []*model.Cookie) PlaywrightState {
+	state := PlaywrightState{
+		Cookies: make([]PlaywrightCookie, 0, len(cookies)),
+		Origins: []interface{}{},
+	}
+	for _, c := range cookies {
+		// Playwright uses -1 for session cookies.
+		expires := float64(-1)
+		if c.Expires != nil {
+			expires = float64(c.Expires.Unix())
+		}
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		state.Cookies = append(state.Cookies, PlaywrightCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     path,
+			Expires:  expires,
+			HTTPOnly: c.HTTPOnly,
+			Secure:   c.Secure,
+			SameSite: playwrightSameSite(c.SameSite),
+		})
+	}
+	return state
+}
+
+// playwrightSameSite maps the browser extension's sameSite values
+// ("no_restriction", "lax", "strict", "unspecified") to Playwright's.
+func playwrightSameSite(s string) string {
+	switch strings.ToLower(s) {
+	case "no_restriction", "none":
+		return "None"
+	case "strict":
+		return "Strict"
+	default:
+		return "Lax"
+	}
+}
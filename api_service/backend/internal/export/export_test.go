@@ -0,0 +1,118 @@
+package export
+
+import (
+	"cookie-syncer/api/internal/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{"netscape", FormatNetscape, false},
+		{"Playwright", FormatPlaywright, false},
+		{"", "", true},
+		{"xml", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNetscape(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		cookies []*model.Cookie
+		want    string
+	}{
+		{"no cookies", nil, "# Netscape HTTP Cookie File\n"},
+		{
+			"session cookie for a host",
+			[]*model.Cookie{{Domain: "example.com", Name: "sid", Value: "1", Path: "/app"}},
+			"# Netscape HTTP Cookie File\nexample.com\tFALSE\t/app\tFALSE\t0\tsid\t1\n",
+		},
+		{
+			"domain cookie with expiry, secure and no path",
+			[]*model.Cookie{{Domain: ".example.com", Name: "pref", Value: "a b", Secure: true, Expires: &expires}},
+			"# Netscape HTTP Cookie File\n.example.com\tTRUE\t/\tTRUE\t1700000000\tpref\ta b\n",
+		},
+		{
+			"HttpOnly cookie",
+			[]*model.Cookie{{Domain: ".example.com", Name: "tok", Value: "x", Path: "/", HTTPOnly: true}},
+			"# Netscape HTTP Cookie File\n#HttpOnly_.example.com\tTRUE\t/\tFALSE\t0\ttok\tx\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Netscape(tt.cookies); got != tt.want {
+				t.Errorf("Netscape =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaywright(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		cookie *model.Cookie
+		want   PlaywrightCookie
+	}{
+		{
+			"session cookie",
+			&model.Cookie{Domain: "example.com", Name: "sid", Value: "1"},
+			PlaywrightCookie{Name: "sid", Value: "1", Domain: "example.com", Path: "/", Expires: -1, SameSite: "Lax"},
+		},
+		{
+			"persistent cross-site cookie",
+			&model.Cookie{Domain: ".example.com", Name: "id", Value: "2", Path: "/a", Expires: &expires, Secure: true, SameSite: "no_restriction"},
+			PlaywrightCookie{Name: "id", Value: "2", Domain: ".example.com", Path: "/a", Expires: 1700000000, Secure: true, SameSite: "None"},
+		},
+		{
+			"strict HttpOnly cookie",
+			&model.Cookie{Domain: "example.com", Name: "tok", Value: "3", Path: "/", HTTPOnly: true, SameSite: "strict"},
+			PlaywrightCookie{Name: "tok", Value: "3", Domain: "example.com", Path: "/", Expires: -1, HTTPOnly: true, SameSite: "Strict"},
+		},
+		{
+			"unspecified same site",
+			&model.Cookie{Domain: "example.com", Name: "u", Value: "4", Path: "/", SameSite: "unspecified"},
+			PlaywrightCookie{Name: "u", Value: "4", Domain: "example.com", Path: "/", Expires: -1, SameSite: "Lax"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := Playwright([]*model.Cookie{tt.cookie})
+			if len(state.Cookies) != 1 || !reflect.DeepEqual(state.Cookies[0], tt.want) {
+				t.Errorf("Playwright = %+v, want %+v", state.Cookies, tt.want)
+			}
+			if state.Origins == nil {
+				t.Error("origins is nil, want an empty list")
+			}
+		})
+	}
+
+	if state := Playwright(nil); state.Cookies == nil || len(state.Cookies) != 0 {
+		t.Errorf("Playwright(nil) cookies = %#v, want an empty list", state.Cookies)
+	}
+}
+
+func TestRender(t *testing.T) {
+	cookies := []*model.Cookie{{Domain: "example.com", Name: "sid", Value: "1", Path: "/"}}
+	if got, err := Render(FormatNetscape, cookies); err != nil || got != Netscape(cookies) {
+		t.Errorf("Render(netscape) = %v, %v", got, err)
+	}
+	if got, err := Render(FormatPlaywright, cookies); err != nil || !reflect.DeepEqual(got, Playwright(cookies)) {
+		t.Errorf("Render(playwright) = %v, %v", got, err)
+	}
+	if _, err := Render("xml", cookies); err == nil {
+		t.Error("Render(xml) succeeded")
+	}
+}
@@ -3,15 +3,35 @@ package handler
 import (
 	"context"
 	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
 	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/team"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // contextKey is a custom type to avoid key collisions in context.
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey       = contextKey("user")
+	teamContextKey       = contextKey("team")
+	poolClientContextKey = contextKey("pool-client")
+)
+
+// TeamAccess is the team a request acts for, named by its x-team-id header:
+// the team, the user's role in it and the team's vault.
+type TeamAccess struct {
+	Team  *model.Team
+	Role  string
+	Vault *model.User
+}
 
 // AuthMiddleware creates a middleware to handle API key authentication.
 func AuthMiddleware(db store.Store) func(http.Handler) http.Handler {
@@ -23,22 +43,27 @@ func AuthMiddleware(db store.Store) func(http.Handler) http.Handler {
 				return
 			}
 
-			user, err := db.GetUserByAPIKey(apiKey)
+			user, err := db.GetUserByAPIKey(r.Context(), apiKey)
 			if err != nil {
-				// Check if the error is specifically "user not found"
-				if err.Error() == "user not found" {
+				if errors.Is(err, store.ErrNotFound) {
 					log.Printf("[Auth Failed] Middleware rejected request. Reason: user not found. Received API Key: '%s'", apiKey)
 					RespondWithError(w, http.StatusUnauthorized, "Invalid API Key")
 				} else {
 					// For all other errors (like database locked), it's a server-side issue.
-					log.Printf("[Auth Error] Middleware encountered a database error. Reason: %v. Received API Key: '%s'", err, apiKey)
-					RespondWithError(w, http.StatusInternalServerError, "Internal Server Error during authentication")
+					RespondWithStoreError(w, r, err, "Could not authenticate request")
 				}
 				return
 			}
 
 			// Store user in context to pass to the next handler
 			ctx := context.WithValue(r.Context(), userContextKey, user)
+			if header := r.Header.Get("x-team-id"); header != "" {
+				access, ok := resolveTeam(w, r, db, user, header)
+				if !ok {
+					return
+				}
+				ctx = context.WithValue(ctx, teamContextKey, access)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -54,33 +79,142 @@ func UserFromContext(ctx context.Context) *model.User {
 	return user
 }
 
-// PoolKeyAuthMiddleware returns a middleware that checks for a valid pool access key.
-func PoolKeyAuthMiddleware(expectedKey string) func(http.Handler) http.Handler {
+// resolveTeam looks up the team named by the x-team-id header for user, who
+// must be a member, writing the error response if that fails.
+func resolveTeam(w http.ResponseWriter, r *http.Request, db store.Store, user *model.User, header string) (*TeamAccess, bool) {
+	teamID, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid x-team-id header")
+		return nil, false
+	}
+	member, err := db.GetTeamMember(r.Context(), teamID, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusForbidden, "Not a member of this team")
+		} else {
+			RespondWithStoreError(w, r, err, "Could not authenticate request")
+		}
+		return nil, false
+	}
+	team, err := db.GetTeam(r.Context(), teamID)
+	if err != nil {
+		RespondWithStoreError(w, r, err, "Could not get team")
+		return nil, false
+	}
+	vault, err := db.GetUserByID(r.Context(), team.VaultUserID)
+	if err != nil {
+		RespondWithStoreError(w, r, err, "Could not get team vault")
+		return nil, false
+	}
+	return &TeamAccess{Team: team, Role: member.Role, Vault: vault}, true
+}
+
+// TeamFromContext retrieves the team the request acts for from the request
+// context. Returns nil if it names none.
+func TeamFromContext(ctx context.Context) *TeamAccess {
+	access, ok := ctx.Value(teamContextKey).(*TeamAccess)
+	if !ok {
+		return nil
+	}
+	return access
+}
+
+// cookieOwner returns whose cookies the request reads or writes: the vault of
+// the team it names, in which the user needs the role need, or else the user.
+// It writes the error response if there is none.
+func cookieOwner(w http.ResponseWriter, r *http.Request, need string) (*model.User, bool) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		// This should theoretically not happen if middleware is set up correctly
+		RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		return nil, false
+	}
+	access := TeamFromContext(r.Context())
+	if access == nil {
+		return user, true
+	}
+	if !team.Allows(access.Role, need) {
+		RespondWithError(w, http.StatusForbidden, fmt.Sprintf("This needs the %s role in the team", need))
+		return nil, false
+	}
+	return access.Vault, true
+}
+
+// ownUser returns the user for endpoints that only act on the user's own
+// account, refusing requests that name a team rather than silently acting on
+// the user instead. It writes the error response if there is no user.
+func ownUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		// This should theoretically not happen if middleware is set up correctly
+		RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		return nil, false
+	}
+	if TeamFromContext(r.Context()) != nil {
+		RespondWithError(w, http.StatusBadRequest, "This endpoint does not support x-team-id")
+		return nil, false
+	}
+	return user, true
+}
+
+// PoolKeyAuthMiddleware returns a middleware that identifies the pool client
+// by its key and enforces the client's rate limit. The shared legacyKey
+// (POOL_ACCESS_KEY), if set, is accepted as well and acts as a client that
+// may read every domain without a limit.
+func PoolKeyAuthMiddleware(db store.Store, legacyKey string, limiter *poolclient.Limiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if expectedKey == "" {
-				log.Printf("[Auth Error] Pool access key is not configured on the server. Access to pool denied.")
-				RespondWithError(w, http.StatusInternalServerError, "Pool access is not configured")
-				return
-			}
-
 			poolKey := r.Header.Get("x-pool-key")
 			if poolKey == "" {
 				RespondWithError(w, http.StatusUnauthorized, "x-pool-key header required")
 				return
 			}
 
-			if poolKey != expectedKey {
-				log.Printf("[Auth Failed] Pool middleware rejected request. Reason: invalid pool key.")
-				RespondWithError(w, http.StatusUnauthorized, "Invalid Pool Key")
+			var client *model.PoolClient
+			if legacyKey != "" && subtle.ConstantTimeCompare([]byte(poolKey), []byte(legacyKey)) == 1 {
+				client = &model.PoolClient{Name: "POOL_ACCESS_KEY"}
+			} else {
+				var err error
+				client, err = db.GetPoolClientByKeyHash(r.Context(), poolclient.Hash(poolKey))
+				if err != nil {
+					if errors.Is(err, store.ErrNotFound) {
+						log.Printf("[Auth Failed] Pool middleware rejected request. Reason: invalid pool key.")
+						RespondWithError(w, http.StatusUnauthorized, "Invalid Pool Key")
+					} else {
+						RespondWithStoreError(w, r, err, "Could not authenticate request")
+					}
+					return
+				}
+			}
+
+			now := time.Now()
+			if reason := poolclient.Inactive(client, now); reason != "" {
+				log.Printf("[Auth Failed] Pool middleware rejected request. Reason: pool client %d is %s.", client.ID, reason)
+				RespondWithError(w, http.StatusUnauthorized, "Pool Key is "+reason)
+				return
+			}
+			if ok, wait := limiter.Allow(client.ID, client.RateLimit, now); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				RespondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit of %d requests per minute exceeded", client.RateLimit))
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), poolClientContextKey, client)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// PoolClientFromContext retrieves the pool client from the request context.
+// Returns nil if there is none.
+func PoolClientFromContext(ctx context.Context) *model.PoolClient {
+	client, ok := ctx.Value(poolClientContextKey).(*model.PoolClient)
+	if !ok {
+		return nil
+	}
+	return client
+}
+
 // AdminKeyAuthMiddleware returns a middleware that checks for a valid admin key.
 func AdminKeyAuthMiddleware(expectedKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -110,14 +244,22 @@ func AdminKeyAuthMiddleware(expectedKey string) func(http.Handler) http.Handler
 
 // AuthTestHandler is a simple handler to confirm that a token is valid.
 // @Summary      Test API Key
-// @Description  A simple endpoint to check if the provided API key in the `x-api-key` header is valid and associated with a user.
+// @Description  A simple endpoint to check if the provided API key in the `x-api-key` header is valid and associated with a user. With an x-team-id header, it also checks that the user is a member of the team and reports their role in it.
 // @Tags         Auth
 // @Produce      json
-// @Success      200  {object}  handler.APIResponse{data=object{user_id=int,role=string}}
+// @Param        x-team-id  header  int  false  "Team ID"
+// @Success      200  {object}  handler.APIResponse{data=object{user_id=int,team_id=int,role=string}}
+// @Failure      400  {object}  handler.APIResponse
 // @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /auth/test [get]
 func AuthTestHandler(w http.ResponseWriter, r *http.Request) {
 	user := UserFromContext(r.Context())
-	RespondWithJSON(w, http.StatusOK, "Token is valid", map[string]interface{}{"user_id": user.ID})
+	data := map[string]interface{}{"user_id": user.ID}
+	if access := TeamFromContext(r.Context()); access != nil {
+		data["team_id"] = access.Team.ID
+		data["role"] = access.Role
+	}
+	RespondWithJSON(w, http.StatusOK, "Token is valid", data)
 }
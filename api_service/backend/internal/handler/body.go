@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LimitRequestBody caps every request body at maxBytes, so a client cannot
+// make a handler buffer an arbitrarily large JSON document. Reading past the
+// limit fails with *http.MaxBytesError, which RespondWithDecodeError turns
+// into 413. Zero or a negative value disables the limit.
+func LimitRequestBody(maxBytes int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DecompressRequestBody accepts gzip-encoded request bodies. The decompressed
+// body is capped at maxBytes as well, so a small compressed body cannot
+// expand without bound. Other encodings are rejected with 415.
+func DecompressRequestBody(maxBytes int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+			case "", "identity":
+			case "gzip", "x-gzip":
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					RespondWithDecodeError(w, err)
+					return
+				}
+				var body io.ReadCloser = gz
+				if maxBytes > 0 {
+					body = http.MaxBytesReader(w, gz, maxBytes)
+				}
+				r.Body = body
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+				r.ContentLength = -1
+			default:
+				RespondWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported Content-Encoding %q, use gzip or none", encoding))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RespondWithDecodeError writes the response for a request body that could
+// not be read or decoded: 413 if it exceeded the size limit, 400 otherwise.
+func RespondWithDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body too large: the limit is %d bytes", tooLarge.Limit))
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum):
+		RespondWithError(w, http.StatusBadRequest, "Invalid gzip body")
+	default:
+		RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+	}
+}
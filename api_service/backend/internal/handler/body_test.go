@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/store/memstore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSyncRequestBodies(t *testing.T) {
+	const limit = 1024
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync := SyncHandler(db, locker.NewLocal(time.Second), &config.Config{})
+	h := LimitRequestBody(limit)(DecompressRequestBody(limit)(AuthMiddleware(db)(sync)))
+
+	post := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/sync", bytes.NewReader(body))
+		req.Header.Set("x-api-key", user.APIKey)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	valid := `[{"domain":"a.com","name":"x","value":"1","path":"/"}]`
+	// Padding inside the JSON keeps it valid while making it large.
+	large := `[{"domain":"a.com","name":"x","value":"` + strings.Repeat("v", 4*limit) + `","path":"/"}]`
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		want     int
+	}{
+		{"plain", []byte(valid), "", http.StatusOK},
+		{"gzip", gzipped(t, valid), "gzip", http.StatusOK},
+		{"plain over the limit", []byte(large), "", http.StatusRequestEntityTooLarge},
+		// Compresses far below the limit but expands past it.
+		{"gzip expanding over the limit", gzipped(t, large), "gzip", http.StatusRequestEntityTooLarge},
+		{"invalid gzip", []byte(valid), "gzip", http.StatusBadRequest},
+		{"unsupported encoding", []byte(valid), "zstd", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "gzip expanding over the limit" && len(tt.body) >= limit {
+				t.Fatalf("compressed body is %d bytes, want it under the %d byte limit", len(tt.body), limit)
+			}
+			if rec := post(tt.body, tt.encoding); rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bytes"
+	"cookie-syncer/api/internal/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RespondWithJSONConditional writes a 200 JSON response like RespondWithJSON,
+// or an empty 304 if the client's copy is still current.
+//
+// The ETag is a hash of the encoded response, so it changes exactly when the
+// body does, whatever format was requested. It is weak because the response
+// compression middleware may send the same content in different encodings.
+//
+// lastModified, unless zero, is sent as Last-Modified and checked against
+// If-Modified-Since; as RFC 9110 requires, If-None-Match takes precedence
+// when both are present. It reports whether the payload was sent.
+func RespondWithJSONConditional(w http.ResponseWriter, r *http.Request, message string, payload interface{}, lastModified time.Time) bool {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(APIResponse{Code: http.StatusOK, Message: message, Data: payload}); err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Could not encode response")
+		return false
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	// Clients may keep the response but must revalidate before using it.
+	h.Set("Cache-Control", "private, no-cache")
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+	return true
+}
+
+// notModified evaluates the request's If-None-Match or If-Modified-Since
+// header against the response's validators.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/") // weak comparison
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have whole-second precision.
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// lastSynced returns when the user last synced, or the zero time if never.
+func lastSynced(user *model.User) time.Time {
+	if user.LastSyncedAt != nil {
+		return *user.LastSyncedAt
+	}
+	return time.Time{}
+}
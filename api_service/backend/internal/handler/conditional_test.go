@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/store/memstore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestConditionalCookieReads(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "pool-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserSharing(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	sync := func(value string) {
+		t.Helper()
+		c := &model.Cookie{Domain: "a.com", Name: "x", Value: value, Path: "/", IsSharable: true}
+		if err := db.SyncCookies(ctx, user.ID, []*model.Cookie{c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync("1")
+
+	r := chi.NewRouter()
+	r.With(AuthMiddleware(db)).Get("/cookies/all", GetAllCookiesHandler(db))
+	r.With(AuthMiddleware(db)).Get("/cookies/{domain}", GetDomainCookiesHandler(db))
+	r.With(PoolKeyAuthMiddleware(db, "pool-key", poolclient.NewLimiter())).Get("/pool/cookies/{domain}", GetSharableCookiesHandler(db, &config.Config{}))
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("x-api-key", user.APIKey)
+		req.Header.Set("x-pool-key", "pool-key")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/cookies/all", "/cookies/all?format=json", "/cookies/a.com", "/cookies/a.com?format=json", "/pool/cookies/a.com"} {
+		t.Run(path, func(t *testing.T) {
+			first := get(path)
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" {
+				t.Fatalf("first GET: status %d, ETag %q; want 200 with an ETag", first.Code, etag)
+			}
+
+			if rec := get(path, "If-None-Match", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Errorf("If-None-Match current ETag: status %d, %d body bytes; want empty 304", rec.Code, rec.Body.Len())
+			}
+			if rec := get(path, "If-None-Match", `"stale", `+strings.TrimPrefix(etag, "W/")); rec.Code != http.StatusNotModified {
+				t.Errorf("If-None-Match list with strong form of current ETag: status %d, want 304", rec.Code)
+			}
+			if rec := get(path, "If-None-Match", `"stale"`); rec.Code != http.StatusOK {
+				t.Errorf("If-None-Match stale ETag: status %d, want 200", rec.Code)
+			}
+
+			lastModified := first.Header().Get("Last-Modified")
+			if path == "/pool/cookies/a.com" {
+				if lastModified != "" {
+					t.Errorf("pool response has Last-Modified %q, want none", lastModified)
+				}
+				if rec := get(path, "If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); rec.Code != http.StatusOK {
+					t.Errorf("pool If-Modified-Since: status %d, want 200", rec.Code)
+				}
+				return
+			}
+			if lastModified == "" {
+				t.Fatal("no Last-Modified header")
+			}
+			if rec := get(path, "If-Modified-Since", lastModified); rec.Code != http.StatusNotModified {
+				t.Errorf("If-Modified-Since = Last-Modified: status %d, want 304", rec.Code)
+			}
+			earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+			if rec := get(path, "If-Modified-Since", earlier); rec.Code != http.StatusOK {
+				t.Errorf("If-Modified-Since an hour ago: status %d, want 200", rec.Code)
+			}
+			// If-None-Match takes precedence over If-Modified-Since.
+			if rec := get(path, "If-None-Match", `"stale"`, "If-Modified-Since", lastModified); rec.Code != http.StatusOK {
+				t.Errorf("stale If-None-Match with current If-Modified-Since: status %d, want 200", rec.Code)
+			}
+		})
+	}
+
+	// A sync that changes the cookies changes the ETag.
+	before := get("/cookies/all").Header().Get("ETag")
+	poolBefore := get("/pool/cookies/a.com").Header().Get("ETag")
+	sync("2")
+	if rec := get("/cookies/all", "If-None-Match", before); rec.Code != http.StatusOK {
+		t.Errorf("after sync, old ETag: status %d, want 200", rec.Code)
+	}
+	if rec := get("/pool/cookies/a.com", "If-None-Match", poolBefore); rec.Code != http.StatusOK {
+		t.Errorf("after sync, old pool ETag: status %d, want 200", rec.Code)
+	}
+}
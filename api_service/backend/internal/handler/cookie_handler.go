@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"cookie-syncer/api/internal/export"
+	"cookie-syncer/api/internal/model"
 	"cookie-syncer/api/internal/store"
 	"net/http"
 	"strings"
@@ -11,25 +13,33 @@ import (
 // GetAllCookiesHandler handles the request to get all cookies for a user.
 // @Summary      Get all cookies
 // @Description  Retrieves all cookies for the authenticated user. By default, groups them by domain and returns them as HTTP header strings. Use ?format=json to get structured JSON.
+// @Description  Responses carry an ETag and a Last-Modified header (the user's last sync); send them back in If-None-Match or If-Modified-Since to get 304 Not Modified when nothing changed.
 // @Tags         Cookies
 // @Produce      json
 // @Param        format query     string  false  "Output format"  Enums(json)
+// @Param        If-None-Match      header    string  false  "ETag from an earlier response"
+// @Param        If-Modified-Since  header    string  false  "Last-Modified from an earlier response"
+// @Param        x-team-id          header    int     false  "Read the cookies of this team's vault instead (needs the reader role)"
 // @Success      200    {object}  handler.APIResponse{data=object}
+// @Header       200  {string}  ETag  "Hash of the response body"
+// @Header       200  {string}  Last-Modified  "Time of the user's last sync"
+// @Success      304  "Not Modified"
 // @Failure      401    {object}  handler.APIResponse
+// @Failure      403    {object}  handler.APIResponse
 // @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /cookies/all [get]
 func GetAllCookiesHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := UserFromContext(r.Context())
-		if user == nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
 			return
 		}
 
-		allCookies, err := db.GetCookiesByUserID(user.ID)
+		allCookies, err := db.GetCookiesByUserID(r.Context(), user.ID)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not fetch cookies")
+			RespondWithStoreError(w, r, err, "Could not fetch cookies")
 			return
 		}
 
@@ -44,7 +54,7 @@ func GetAllCookiesHandler(db store.Store) http.HandlerFunc {
 				}
 				groupedCookies[domain][cookie.Name] = cookie.Value
 			}
-			RespondWithJSON(w, http.StatusOK, "Successfully retrieved all cookies", groupedCookies)
+			RespondWithJSONConditional(w, r, "Successfully retrieved all cookies", groupedCookies, lastSynced(user))
 			return
 		}
 
@@ -58,34 +68,42 @@ func GetAllCookiesHandler(db store.Store) http.HandlerFunc {
 			groupedCookieStrings[domain] = strings.Join(parts, "; ")
 		}
 
-		RespondWithJSON(w, http.StatusOK, "Successfully retrieved all cookies", groupedCookieStrings)
+		RespondWithJSONConditional(w, r, "Successfully retrieved all cookies", groupedCookieStrings, lastSynced(user))
 	}
 }
 
 // GetDomainCookiesHandler handles the request to get all cookies for a specific domain.
 // @Summary      Get cookies for a domain
 // @Description  Retrieves cookies for a specific domain. By default, returns an HTTP header string. Use ?format=json to get structured JSON.
+// @Description  Responses carry an ETag and a Last-Modified header (the user's last sync); send them back in If-None-Match or If-Modified-Since to get 304 Not Modified when nothing changed.
 // @Tags         Cookies
 // @Produce      json
 // @Param        domain   path      string  true   "Domain"
 // @Param        format   query     string  false  "Output format"  Enums(json)
+// @Param        If-None-Match      header    string  false  "ETag from an earlier response"
+// @Param        If-Modified-Since  header    string  false  "Last-Modified from an earlier response"
+// @Param        x-team-id          header    int     false  "Read the cookies of this team's vault instead (needs the reader role)"
 // @Success      200      {object}  handler.APIResponse{data=object}
+// @Header       200  {string}  ETag  "Hash of the response body"
+// @Header       200  {string}  Last-Modified  "Time of the user's last sync"
+// @Success      304  "Not Modified"
 // @Failure      401      {object}  handler.APIResponse
+// @Failure      403      {object}  handler.APIResponse
 // @Failure      500      {object}  handler.APIResponse
+// @Failure      503      {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /cookies/{domain} [get]
 func GetDomainCookiesHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := UserFromContext(r.Context())
-		if user == nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
 			return
 		}
 
 		domain := chi.URLParam(r, "domain")
-		cookies, err := db.GetCookiesByDomain(user.ID, domain)
+		cookies, err := db.GetCookiesByDomain(r.Context(), user.ID, domain)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not fetch cookies for domain")
+			RespondWithStoreError(w, r, err, "Could not fetch cookies for domain")
 			return
 		}
 
@@ -96,7 +114,7 @@ func GetDomainCookiesHandler(db store.Store) http.HandlerFunc {
 			for _, cookie := range cookies {
 				cookieMap[cookie.Name] = cookie.Value
 			}
-			RespondWithJSON(w, http.StatusOK, "Successfully retrieved cookies for domain", cookieMap)
+			RespondWithJSONConditional(w, r, "Successfully retrieved cookies for domain", cookieMap, lastSynced(user))
 			return
 		}
 
@@ -107,7 +125,7 @@ func GetDomainCookiesHandler(db store.Store) http.HandlerFunc {
 		}
 		cookieHeader := strings.Join(cookieParts, "; ")
 
-		RespondWithJSON(w, http.StatusOK, "Successfully retrieved cookies for domain", cookieHeader)
+		RespondWithJSONConditional(w, r, "Successfully retrieved cookies for domain", cookieHeader, lastSynced(user))
 	}
 }
 
@@ -118,17 +136,19 @@ func GetDomainCookiesHandler(db store.Store) http.HandlerFunc {
 // @Produce      json
 // @Param        domain   path      string  true  "Domain"
 // @Param        name     path      string  true  "Cookie Name"
+// @Param        x-team-id header    int     false  "Read the cookies of this team's vault instead (needs the reader role)"
 // @Success      200      {object}  handler.APIResponse{data=string}
 // @Failure      401      {object}  handler.APIResponse
+// @Failure      403      {object}  handler.APIResponse
 // @Failure      404      {object}  handler.APIResponse
 // @Failure      500      {object}  handler.APIResponse
+// @Failure      503      {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /cookies/{domain}/{name} [get]
 func GetCookieValueHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := UserFromContext(r.Context())
-		if user == nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
 			return
 		}
 
@@ -137,9 +157,9 @@ func GetCookieValueHandler(db store.Store) http.HandlerFunc {
 
 		// With the new storage model, it's more efficient to get all cookies for the domain
 		// and then filter by name in the application.
-		cookies, err := db.GetCookiesByDomain(user.ID, domain)
+		cookies, err := db.GetCookiesByDomain(r.Context(), user.ID, domain)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not retrieve cookies for domain")
+			RespondWithStoreError(w, r, err, "Could not retrieve cookies for domain")
 			return
 		}
 
@@ -153,3 +173,53 @@ func GetCookieValueHandler(db store.Store) http.HandlerFunc {
 		RespondWithError(w, http.StatusNotFound, "Cookie not found")
 	}
 }
+
+// ExportCookiesHandler handles exporting cookies in a tool-specific file format.
+// @Summary      Export cookies
+// @Description  Exports the authenticated user's cookies as a Netscape cookies.txt file (returned as a string) or a Playwright storage state (returned as an object). Optionally restricted to a single domain.
+// @Tags         Cookies
+// @Produce      json
+// @Param        format   query     string  true   "Export format"  Enums(netscape, playwright)
+// @Param        domain   query     string  false  "Only export cookies for this domain"
+// @Param        x-team-id header    int     false  "Read the cookies of this team's vault instead (needs the reader role)"
+// @Success      200      {object}  handler.APIResponse{data=object}
+// @Failure      400      {object}  handler.APIResponse
+// @Failure      401      {object}  handler.APIResponse
+// @Failure      403      {object}  handler.APIResponse
+// @Failure      500      {object}  handler.APIResponse
+// @Failure      503      {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /export/cookies [get]
+func ExportCookiesHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
+			return
+		}
+
+		format, err := export.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var cookies []*model.Cookie
+		if domain := r.URL.Query().Get("domain"); domain != "" {
+			cookies, err = db.GetCookiesByDomain(r.Context(), user.ID, domain)
+		} else {
+			cookies, err = db.GetCookiesByUserID(r.Context(), user.ID)
+		}
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not fetch cookies")
+			return
+		}
+
+		rendered, err := export.Render(format, cookies)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not export cookies")
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Successfully exported cookies", rendered)
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PoolClientRequest is the body for creating or updating a pool client.
+type PoolClientRequest struct {
+	Name           string     `json:"name"`
+	AllowedDomains []string   `json:"allowed_domains"` // empty for all domains
+	RateLimit      int        `json:"rate_limit"`      // requests per minute, 0 for no limit
+	ExpiresAt      *time.Time `json:"expires_at"`      // null for no expiry
+}
+
+// CreatedPoolClientResponse is a new pool client with its key.
+type CreatedPoolClientResponse struct {
+	model.PoolClient
+	Key string `json:"key"`
+}
+
+// decodePoolClientRequest decodes and checks the body into client, writing
+// the error response if that fails.
+func decodePoolClientRequest(w http.ResponseWriter, r *http.Request, client *model.PoolClient) bool {
+	var payload PoolClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		RespondWithDecodeError(w, err)
+		return false
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		RespondWithError(w, http.StatusBadRequest, "name is required")
+		return false
+	}
+	if payload.RateLimit < 0 {
+		RespondWithError(w, http.StatusBadRequest, "rate_limit must be 0 (no limit) or a positive number of requests per minute")
+		return false
+	}
+	domains, err := poolclient.NormalizeDomains(payload.AllowedDomains)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid allowed_domains: "+err.Error())
+		return false
+	}
+
+	client.Name = payload.Name
+	client.AllowedDomains = domains
+	client.RateLimit = payload.RateLimit
+	client.ExpiresAt = payload.ExpiresAt
+	return true
+}
+
+// AdminListPoolClientsHandler lists all pool clients.
+// @Summary      [Admin] List pool clients
+// @Description  Lists every pool client, including revoked and expired ones, with their usage counters. Keys are not shown.
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]model.PoolClient}
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/pool/clients [get]
+func AdminListPoolClientsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clients, err := db.ListPoolClients(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list pool clients: "+err.Error())
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved pool clients", clients)
+	}
+}
+
+// AdminCreatePoolClientHandler creates a pool client with a new key.
+// @Summary      [Admin] Create a pool client
+// @Description  Creates a pool consumer with its own key, sent as `x-pool-key`. The key is only shown in this response; the server keeps a hash of it. allowed_domains limits the client to those domains and their subdomains (empty for all), rate_limit caps its requests per minute (0 for no limit) and expires_at ends its access (null for never).
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.PoolClientRequest true "Pool client"
+// @Success      201  {object}  handler.APIResponse{data=handler.CreatedPoolClientResponse} "The new client including its key"
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/pool/clients [post]
+func AdminCreatePoolClientHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var client model.PoolClient
+		if !decodePoolClientRequest(w, r, &client) {
+			return
+		}
+		if client.ExpiresAt != nil && !client.ExpiresAt.After(time.Now()) {
+			RespondWithError(w, http.StatusBadRequest, "expires_at is in the past")
+			return
+		}
+
+		key, prefix, hash, err := poolclient.NewKey()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not generate a key")
+			return
+		}
+		client.KeyPrefix = prefix
+		client.KeyHash = hash
+		if err := db.CreatePoolClient(r.Context(), &client); err != nil {
+			RespondWithStoreError(w, r, err, "Could not create pool client: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusCreated, "Pool client created successfully", CreatedPoolClientResponse{PoolClient: client, Key: key})
+	}
+}
+
+// AdminUpdatePoolClientHandler updates a pool client.
+// @Summary      [Admin] Update a pool client
+// @Description  Replaces the client's name, allowed domains, rate limit and expiry. Its key and counters are kept.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Pool client ID"
+// @Param        body body      handler.PoolClientRequest true "Pool client"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/pool/clients/{id} [put]
+func AdminUpdatePoolClientHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid pool client ID")
+			return
+		}
+
+		client := model.PoolClient{ID: id}
+		if !decodePoolClientRequest(w, r, &client) {
+			return
+		}
+		if err := db.UpdatePoolClient(r.Context(), &client); err != nil {
+			RespondWithStoreError(w, r, err, "Could not update pool client: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Pool client updated successfully", nil)
+	}
+}
+
+// AdminRevokePoolClientHandler revokes a pool client's key.
+// @Summary      [Admin] Revoke a pool client
+// @Description  Revokes the client's key for good; requests with it get 401. The client stays listed with its counters.
+// @Tags         Admin
+// @Produce      json
+// @Param        id   path      int  true  "Pool client ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/pool/clients/{id}/revoke [post]
+func AdminRevokePoolClientHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid pool client ID")
+			return
+		}
+
+		if err := db.RevokePoolClient(r.Context(), id); err != nil {
+			RespondWithStoreError(w, r, err, "Could not revoke pool client: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Pool client revoked successfully", nil)
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPoolClients(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserSharing(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	err = db.SyncCookies(ctx, user.ID, []*model.Cookie{
+		{Domain: "example.com", Name: "a", Value: "1", Path: "/", IsSharable: true},
+		{Domain: "other.org", Name: "b", Value: "2", Path: "/", IsSharable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.With(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter())).Get("/pool/cookies/{domain}", GetSharableCookiesHandler(db, &config.Config{}))
+	r.Post("/admin/pool/clients", AdminCreatePoolClientHandler(db))
+	r.Put("/admin/pool/clients/{id}", AdminUpdatePoolClientHandler(db))
+	r.Post("/admin/pool/clients/{id}/revoke", AdminRevokePoolClientHandler(db))
+
+	do := func(method, path, body, poolKey string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if poolKey != "" {
+			req.Header.Set("x-pool-key", poolKey)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/admin/pool/clients", `{"name":" ","rate_limit":1}`, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("client without a name: status %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPost, "/admin/pool/clients", `{"name":"scraper","allowed_domains":["Example.com"],"rate_limit":2}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating a client: status %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Data CreatedPoolClientResponse `json:"data"`
+	}
+	body := rec.Body.String()
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatal(err)
+	}
+	key, id := created.Data.Key, strconv.FormatInt(created.Data.ID, 10)
+	if !strings.HasPrefix(key, created.Data.KeyPrefix) || strings.Contains(body, poolclient.Hash(key)) {
+		t.Errorf("created client %+v: want the key with its prefix and no hash", created.Data)
+	}
+
+	if rec := do(http.MethodGet, "/pool/cookies/example.com", "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/pool/cookies/example.com", "", key); rec.Code != http.StatusOK {
+		t.Errorf("allowed domain: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/pool/cookies/other.org", "", key); rec.Code != http.StatusForbidden {
+		t.Errorf("domain outside the client's scope: status %d, want 403", rec.Code)
+	}
+	// The 403 spent the second request of the burst of 2.
+	rec = do(http.MethodGet, "/pool/cookies/example.com", "", key)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("over the rate limit: status %d, Retry-After %q; want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do(http.MethodGet, "/pool/cookies/other.org", "", "legacy-key"); rec.Code != http.StatusOK {
+		t.Errorf("legacy key: status %d, want 200", rec.Code)
+	}
+
+	if rec := do(http.MethodPut, "/admin/pool/clients/"+id, `{"name":"scraper","allowed_domains":["*"]}`, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("wildcard domain: status %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/admin/pool/clients/999", `{"name":"x"}`, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("updating a missing client: status %d, want 404", rec.Code)
+	}
+
+	clients, err := db.ListPoolClients(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := clients[0]; c.RequestCount != 1 || c.CookiesServed != 1 || c.LastUsedAt == nil {
+		t.Errorf("counters: %d requests, %d cookies served; want 1 and 1", c.RequestCount, c.CookiesServed)
+	}
+
+	if rec := do(http.MethodPost, "/admin/pool/clients/"+id+"/revoke", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoking: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/pool/cookies/example.com", "", key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/store"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Pool domain list pages.
+const (
+	defaultPoolDomainsPerPage = 100
+	maxPoolDomainsPerPage     = 1000
+)
+
+// PoolDomain is a domain with healthy shared sessions in the pool.
+type PoolDomain struct {
+	Domain       string     `json:"domain"`
+	Contributors int        `json:"contributors"`             // contributors with a healthy session for the domain
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"` // the newest of their latest syncs
+}
+
+// PoolDomainPage is one page of the pool's domains.
+type PoolDomainPage struct {
+	Domains []PoolDomain `json:"domains"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	Total   int          `json:"total"` // domains on all pages
+}
+
+// queryInt parses the query parameter name as a number between 1 and limit,
+// fallback if it is missing, writing the error response if that fails.
+func queryInt(w http.ResponseWriter, r *http.Request, name string, fallback, limit int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > limit {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be between 1 and %d", name, limit))
+		return 0, false
+	}
+	return n, true
+}
+
+// ListPoolDomainsHandler lists the domains the client can get sessions for.
+// @Summary      List pool domains
+// @Description  Lists the registrable domains (example.com for www.example.com) for which at least one contributor shares a healthy session: one that is neither quarantined nor found expired by a probe. Each domain comes with the number of such contributors and the newest of their latest syncs. Only domains the pool key may read are listed; a key limited to a subdomain sees that subdomain instead of its registrable domain.
+// @Description  Domains are sorted by name and paginated with page (from 1) and per_page (100 by default, at most 1000).
+// @Tags         Pool
+// @Produce      json
+// @Param        page     query     int  false  "Page number, from 1"
+// @Param        per_page query     int  false  "Domains per page"
+// @Success      200      {object}  handler.APIResponse{data=handler.PoolDomainPage}
+// @Failure      400      {object}  handler.APIResponse
+// @Failure      401      {object}  handler.APIResponse
+// @Failure      429      {object}  handler.APIResponse
+// @Failure      500      {object}  handler.APIResponse
+// @Failure      503      {object}  handler.APIResponse
+// @Security     PoolKeyAuth
+// @Router       /pool/domains [get]
+func ListPoolDomainsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := PoolClientFromContext(r.Context())
+		if client == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify pool client")
+			return
+		}
+		page, ok := queryInt(w, r, "page", 1, 1<<20)
+		if !ok {
+			return
+		}
+		perPage, ok := queryInt(w, r, "per_page", defaultPoolDomainsPerPage, maxPoolDomainsPerPage)
+		if !ok {
+			return
+		}
+
+		sessions, err := db.ListPoolSessions(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list pool domains")
+			return
+		}
+
+		domains := make(map[string]*PoolDomain)
+		contributors := make(map[string]map[int64]bool)
+		for _, s := range sessions {
+			scope, ok := poolclient.Scope(client, s.Domain)
+			if !ok {
+				continue
+			}
+			d, found := domains[scope]
+			if !found {
+				d = &PoolDomain{Domain: scope}
+				domains[scope] = d
+				contributors[scope] = make(map[int64]bool)
+			}
+			if !contributors[scope][s.UserID] {
+				contributors[scope][s.UserID] = true
+				d.Contributors++
+			}
+			if s.LastSyncedAt != nil && (d.LastSyncedAt == nil || s.LastSyncedAt.After(*d.LastSyncedAt)) {
+				d.LastSyncedAt = s.LastSyncedAt
+			}
+		}
+		list := make([]PoolDomain, 0, len(domains))
+		for _, d := range domains {
+			list = append(list, *d)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+
+		resp := PoolDomainPage{Domains: []PoolDomain{}, Page: page, PerPage: perPage, Total: len(list)}
+		if start := (page - 1) * perPage; start < len(list) {
+			resp.Domains = list[start:min(start+perPage, len(list))]
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved pool domains", resp)
+		recordPoolClientUse(r, db, client, 0)
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPoolDomains(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	created, err := db.CreateUsers(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := created[0], created[1]
+	for _, u := range created {
+		if err := db.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := func(userID int64, domains ...string) {
+		t.Helper()
+		var cookies []*model.Cookie
+		for _, d := range domains {
+			cookies = append(cookies, &model.Cookie{Domain: d, Name: "sid", Value: "1", Path: "/", IsSharable: true})
+		}
+		if err := db.SyncCookies(ctx, userID, cookies); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync(a.ID, "www.example.com", "mail.example.com", "other.org", "broken.net")
+	sync(b.ID, ".example.com", "shop.example.co.uk")
+	if _, err := db.ReportPoolSession(ctx, 1, a.ID, "broken.net", model.SessionInvalid, poolhealth.Policy{Threshold: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, prefix, hash, err := poolclient.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped := &model.PoolClient{Name: "mail", AllowedDomains: []string{"mail.example.com"}, KeyPrefix: prefix, KeyHash: hash}
+	if err := db.CreatePoolClient(ctx, scoped); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter()))
+	r.Get("/pool/domains", ListPoolDomainsHandler(db))
+
+	list := func(poolKey, query string) (PoolDomainPage, int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/pool/domains"+query, nil)
+		req.Header.Set("x-pool-key", poolKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Data PoolDomainPage `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Data, rec.Code
+	}
+	summary := func(page PoolDomainPage) []string {
+		t.Helper()
+		var out []string
+		for _, d := range page.Domains {
+			if d.LastSyncedAt == nil {
+				t.Errorf("domain %s has no last sync", d.Domain)
+			}
+			out = append(out, d.Domain+"="+strconv.Itoa(d.Contributors))
+		}
+		return out
+	}
+
+	page, code := list("legacy-key", "")
+	if code != http.StatusOK {
+		t.Fatalf("listing: status %d", code)
+	}
+	if got, want := summary(page), []string{"example.co.uk=1", "example.com=2", "other.org=1"}; !slices.Equal(got, want) {
+		t.Errorf("domains %v, want %v (the quarantined one left out)", got, want)
+	}
+	if page.Total != 3 || page.Page != 1 || page.PerPage != defaultPoolDomainsPerPage {
+		t.Errorf("page %+v, want all 3 domains on page 1", page)
+	}
+
+	page, _ = list("legacy-key", "?page=2&per_page=2")
+	if got := summary(page); !slices.Equal(got, []string{"other.org=1"}) || page.Total != 3 {
+		t.Errorf("second page %v of %d, want other.org of 3", got, page.Total)
+	}
+	if page, _ = list("legacy-key", "?page=3&per_page=2"); len(page.Domains) != 0 {
+		t.Errorf("page past the end %v, want none", page.Domains)
+	}
+	for _, query := range []string{"?page=0", "?per_page=1001", "?per_page=x"} {
+		if _, code := list("legacy-key", query); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+
+	page, _ = list(key, "")
+	if got := summary(page); !slices.Equal(got, []string{"mail.example.com=1"}) {
+		t.Errorf("domains for a client scoped to a subdomain %v, want mail.example.com", got)
+	}
+}
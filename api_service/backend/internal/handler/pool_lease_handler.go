@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PoolLeaseRequest is the body for leasing a pool session.
+type PoolLeaseRequest struct {
+	Domain  string `json:"domain"`
+	Minutes int    `json:"minutes"` // 0 for the server default
+}
+
+// PoolLeaseResponse is a lease with the leased session's cookies.
+type PoolLeaseResponse struct {
+	ID          int64                        `json:"id"`
+	Contributor string                       `json:"contributor"` // handle of the session's contributor, as in pool reads
+	Domain      string                       `json:"domain"`
+	ExpiresAt   time.Time                    `json:"expires_at"`
+	CreatedAt   time.Time                    `json:"created_at"`
+	Cookie      string                       `json:"cookie"`  // the cookies as an HTTP Cookie header
+	Cookies     map[string]map[string]string `json:"cookies"` // values by domain and name
+}
+
+// LeasePoolSessionHandler checks out one contributor's session for a domain.
+// @Summary      Lease a pool session
+// @Description  Checks out one contributor's session (their shared cookies for the domain) for the given number of minutes (POOL_LEASE_TTL if 0, at most POOL_LEASE_MAX_TTL). The response names the session's contributor by the same handle as pool reads. Sessions are handed out least recently leased first, so consumers rotate through them, and a session is not leased again until its lease is released or runs out. Release the lease when done, marking it bad if the session did not work.
+// @Description  Leases belong to the pool client that took them. Everyone using the legacy POOL_ACCESS_KEY is one client, so they can release each other's leases; give each consumer its own pool key (POST /admin/pool/clients) to keep them apart.
+// @Tags         Pool
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.PoolLeaseRequest true "Domain and lease duration"
+// @Success      201  {object}  handler.APIResponse{data=handler.PoolLeaseResponse}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse "Nobody shares cookies for the domain"
+// @Failure      409  {object}  handler.APIResponse "Every session for the domain is leased"
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      429  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     PoolKeyAuth
+// @Router       /pool/leases [post]
+func LeasePoolSessionHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := PoolClientFromContext(r.Context())
+		if client == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify pool client")
+			return
+		}
+
+		var payload PoolLeaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		payload.Domain = strings.TrimSpace(payload.Domain)
+		if payload.Domain == "" {
+			RespondWithError(w, http.StatusBadRequest, "domain is required")
+			return
+		}
+		ttl := cfg.PoolLeaseTTL
+		if payload.Minutes != 0 {
+			ttl = time.Duration(payload.Minutes) * time.Minute
+		}
+		if ttl <= 0 || (cfg.PoolLeaseMaxTTL > 0 && ttl > cfg.PoolLeaseMaxTTL) {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("minutes must be between 1 and %d", int(cfg.PoolLeaseMaxTTL.Minutes())))
+			return
+		}
+		if !poolclient.Allows(client, payload.Domain) {
+			RespondWithError(w, http.StatusForbidden, "Forbidden: this pool key may not read "+payload.Domain)
+			return
+		}
+
+		lease, cookies, err := db.LeasePoolSession(r.Context(), client.ID, payload.Domain, ttl)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			RespondWithError(w, http.StatusNotFound, "Nobody shares cookies for "+payload.Domain)
+			return
+		case errors.Is(err, store.ErrConflict):
+			RespondWithError(w, http.StatusConflict, "Every shared session for "+payload.Domain+" is leased, try again later")
+			return
+		case err != nil:
+			RespondWithStoreError(w, r, err, "Could not lease a session")
+			return
+		}
+
+		resp := PoolLeaseResponse{
+			ID:          lease.ID,
+			Contributor: poolhandle.For(cfg.PoolHandleSecret, client.ID, lease.Domain, lease.UserID),
+			Domain:      lease.Domain,
+			ExpiresAt:   lease.ExpiresAt,
+			CreatedAt:   lease.CreatedAt,
+			Cookies:     make(map[string]map[string]string),
+		}
+		var parts []string
+		for _, c := range cookies {
+			parts = append(parts, c.Name+"="+c.Value)
+			if resp.Cookies[c.Domain] == nil {
+				resp.Cookies[c.Domain] = make(map[string]string)
+			}
+			resp.Cookies[c.Domain][c.Name] = c.Value
+		}
+		resp.Cookie = strings.Join(parts, "; ")
+
+		RespondWithJSON(w, http.StatusCreated, "Session leased successfully", resp)
+		recordPoolClientUse(r, db, client, len(cookies))
+		recordPoolUsage(r, db, &model.PoolUsage{UserID: lease.UserID, Domain: lease.Domain, Leased: 1})
+	}
+}
+
+// ReleasePoolLeaseHandler ends one of the client's leases.
+// @Summary      Release a pool lease
+// @Description  Ends the lease so the session can be leased again. Set bad to report that the session did not work, as POST /pool/report with reason invalid would.
+// @Tags         Pool
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Lease ID"
+// @Param        body body      object{bad=bool} false "Whether the session did not work"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse "No such active lease of this client"
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      429  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     PoolKeyAuth
+// @Router       /pool/leases/{id}/release [post]
+func ReleasePoolLeaseHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := PoolClientFromContext(r.Context())
+		if client == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify pool client")
+			return
+		}
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid lease ID")
+			return
+		}
+
+		var payload struct {
+			Bad bool `json:"bad"`
+		}
+		// The body is optional.
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		outcome := model.LeaseReleased
+		if payload.Bad {
+			outcome = model.LeaseBad
+		}
+
+		lease, err := db.EndPoolLease(r.Context(), client.ID, id, outcome)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "No active lease with this ID")
+			return
+		}
+		if payload.Bad {
+			recordPoolUsage(r, db, &model.PoolUsage{UserID: lease.UserID, Domain: lease.Domain, ReportedBad: 1})
+			// A bad lease counts as a report that the session is invalid.
+			_, err := db.ReportPoolSession(r.Context(), client.ID, lease.UserID, lease.Domain, model.SessionInvalid, quarantinePolicy(cfg))
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				log.Printf("[Pool] Could not report session of lease %d: %v", lease.ID, err)
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Lease released successfully", nil)
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPoolLeases(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserSharing(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	err = db.SyncCookies(ctx, user.ID, []*model.Cookie{
+		{Domain: "example.com", Name: "a", Value: "1", Path: "/", IsSharable: true},
+		{Domain: ".example.com", Name: "b", Value: "2", Path: "/", IsSharable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{PoolLeaseTTL: 10 * time.Minute, PoolLeaseMaxTTL: time.Hour}
+	r := chi.NewRouter()
+	r.Use(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter()))
+	r.Post("/pool/leases", LeasePoolSessionHandler(db, cfg))
+	r.Post("/pool/leases/{id}/release", ReleasePoolLeaseHandler(db, cfg))
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("x-pool-key", "legacy-key")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("/pool/leases", `{"domain":"example.com","minutes":120}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("lease over the maximum: status %d, want 400", rec.Code)
+	}
+	if rec := do("/pool/leases", `{"domain":"nobody.org"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unshared domain: status %d, want 404", rec.Code)
+	}
+
+	rec := do("/pool/leases", `{"domain":"example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("lease: status %d: %s", rec.Code, rec.Body)
+	}
+	var leased struct {
+		Data PoolLeaseResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&leased); err != nil {
+		t.Fatal(err)
+	}
+	if leased.Data.Contributor != poolhandle.For(cfg.PoolHandleSecret, 0, "example.com", user.ID) || leased.Data.Cookie != "a=1; b=2" || leased.Data.Cookies["example.com"]["a"] != "1" {
+		t.Errorf("lease %+v: want the user's session", leased.Data)
+	}
+	if d := time.Until(leased.Data.ExpiresAt); d < 9*time.Minute || d > 10*time.Minute {
+		t.Errorf("lease expires in %s, want the default 10m", d)
+	}
+
+	if rec := do("/pool/leases", `{"domain":"example.com"}`); rec.Code != http.StatusConflict {
+		t.Errorf("second lease of the only session: status %d, want 409", rec.Code)
+	}
+
+	id := strconv.FormatInt(leased.Data.ID, 10)
+	if rec := do("/pool/leases/"+id+"/release", ""); rec.Code != http.StatusOK {
+		t.Fatalf("release: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("/pool/leases/"+id+"/release", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("releasing twice: status %d, want 404", rec.Code)
+	}
+	if rec := do("/pool/leases", `{"domain":"example.com","minutes":5}`); rec.Code != http.StatusCreated {
+		t.Errorf("lease after release: status %d, want 201", rec.Code)
+	}
+}
+
+func TestPoolLeasesHideSessionsFromBulkReads(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	users, err := db.CreateUsers(ctx, []string{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, u := range users {
+		if err := db.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatal(err)
+		}
+		value := strconv.Itoa(i + 1)
+		if err := db.SyncCookies(ctx, u.ID, []*model.Cookie{{Domain: ".example.com", Name: "sid", Value: value, Path: "/", IsSharable: true}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, prefix, hash, err := poolclient.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreatePoolClient(ctx, &model.PoolClient{Name: "other", KeyPrefix: prefix, KeyHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{PoolLeaseTTL: 10 * time.Minute, PoolLeaseMaxTTL: time.Hour}
+	r := chi.NewRouter()
+	r.Use(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter()))
+	r.Get("/pool/cookies/{domain}", GetSharableCookiesHandler(db, cfg))
+	r.Post("/pool/leases", LeasePoolSessionHandler(db, cfg))
+
+	read := func(domain string) []string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/pool/cookies/"+domain, nil)
+		req.Header.Set("x-pool-key", key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("read %s: status %d: %s", domain, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data []string `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	if got := read("example.com"); len(got) != 2 {
+		t.Fatalf("pool before the lease = %v, want both sessions", got)
+	}
+
+	// The legacy key client leases the first user's session.
+	req := httptest.NewRequest(http.MethodPost, "/pool/leases", strings.NewReader(`{"domain":"example.com"}`))
+	req.Header.Set("x-pool-key", "legacy-key")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("lease: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if got := read("example.com"); len(got) != 1 || got[0] != "sid=2" {
+		t.Errorf("pool during the lease = %v, want only the unleased session", got)
+	}
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PoolReportRequest reports a failure with a contributor's session.
+type PoolReportRequest struct {
+	Contributor string `json:"contributor"` // handle from a pool read or lease for the domain
+	Domain      string `json:"domain"`
+	Reason      string `json:"reason" enums:"invalid,rate_limited"`
+}
+
+// PoolReportResponse is the reported session's health.
+type PoolReportResponse struct {
+	Contributor      string     `json:"contributor"`
+	Domain           string     `json:"domain"`
+	Failures         int        `json:"failures"` // distinct clients reporting within the window
+	LastReason       string     `json:"last_reason" enums:"invalid,rate_limited"`
+	QuarantinedAt    *time.Time `json:"quarantined_at,omitempty"`
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"` // empty while quarantined: until the cookies change
+}
+
+// quarantinePolicy returns when reported failures quarantine a session.
+func quarantinePolicy(cfg *config.Config) poolhealth.Policy {
+	return poolhealth.Policy{Threshold: cfg.PoolQuarantineThreshold, RateLimitCooldown: cfg.PoolRateLimitCooldown, Window: cfg.PoolReportWindow}
+}
+
+// ReportPoolSessionHandler records that a contributor's session for a domain
+// failed upstream.
+// @Summary      Report a failing pool session
+// @Description  Reports that the contributor's cookies for the domain (and its subdomains) did not work upstream: invalid (logged out or rejected) or rate_limited. Once POOL_QUARANTINE_THRESHOLD different pool clients have reported a session within POOL_REPORT_WINDOW, it is left out of the pool and of leases: an invalid session until the contributor syncs new cookies for it, a rate-limited one for POOL_RATE_LIMIT_COOLDOWN. Repeated reports by one client count once. Reports made before a rate-limit cooldown ends no longer count after it; a sync that changes the session's cookies or a lease of it released as good clears them.
+// @Description  The contributor is the handle that a pool read or lease for the same domain with the same pool key returned.
+// @Description  Everyone using the legacy POOL_ACCESS_KEY is one client: they see the same handles, and their reports of a session count once towards POOL_QUARANTINE_THRESHOLD. Give each consumer its own pool key (POST /admin/pool/clients) for their reports to count separately.
+// @Tags         Pool
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.PoolReportRequest true "The failing session"
+// @Success      200  {object}  handler.APIResponse{data=handler.PoolReportResponse}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse "No contributor with this handle shares cookies for the domain in the pool (quarantined sessions are not in it)"
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      429  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     PoolKeyAuth
+// @Router       /pool/report [post]
+func ReportPoolSessionHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := PoolClientFromContext(r.Context())
+		if client == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify pool client")
+			return
+		}
+
+		var payload PoolReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		payload.Domain = strings.TrimSpace(payload.Domain)
+		payload.Contributor = strings.TrimSpace(payload.Contributor)
+		if payload.Contributor == "" || payload.Domain == "" {
+			RespondWithError(w, http.StatusBadRequest, "contributor and domain are required")
+			return
+		}
+		if !poolhealth.ValidReason(payload.Reason) {
+			RespondWithError(w, http.StatusBadRequest, "reason must be invalid or rate_limited")
+			return
+		}
+		if !poolclient.Allows(client, payload.Domain) {
+			RespondWithError(w, http.StatusForbidden, "Forbidden: this pool key may not read "+payload.Domain)
+			return
+		}
+
+		// Only the contributors a pool read of the domain could have named
+		// are candidates; suspended users are not among them.
+		cookies, err := db.GetSharableCookiesByDomain(r.Context(), payload.Domain)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not record the report")
+			return
+		}
+		seen := make(map[int64]bool)
+		var contributors []int64
+		for _, c := range cookies {
+			if !seen[c.UserID] {
+				seen[c.UserID] = true
+				contributors = append(contributors, c.UserID)
+			}
+		}
+		userID, ok := poolhandle.Resolve(cfg.PoolHandleSecret, client.ID, payload.Domain, payload.Contributor, contributors)
+		if !ok {
+			RespondWithError(w, http.StatusNotFound, "No contributor "+payload.Contributor+" shares cookies for "+payload.Domain)
+			return
+		}
+
+		health, err := db.ReportPoolSession(r.Context(), client.ID, userID, payload.Domain, payload.Reason, quarantinePolicy(cfg))
+		if errors.Is(err, store.ErrNotFound) {
+			RespondWithError(w, http.StatusNotFound, "No contributor "+payload.Contributor+" shares cookies for "+payload.Domain)
+			return
+		}
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not record the report")
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Report recorded successfully", PoolReportResponse{
+			Contributor:      payload.Contributor,
+			Domain:           health.Domain,
+			Failures:         health.Failures,
+			LastReason:       health.LastReason,
+			QuarantinedAt:    health.QuarantinedAt,
+			QuarantinedUntil: health.QuarantinedUntil,
+		})
+		recordPoolUsage(r, db, &model.PoolUsage{UserID: health.UserID, Domain: health.Domain, ReportedBad: 1})
+	}
+}
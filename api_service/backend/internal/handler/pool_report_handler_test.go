@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPoolReports(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserSharing(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	session := []*model.Cookie{{Domain: "example.com", Name: "sid", Value: "1", Path: "/", IsSharable: true}}
+	if err := db.SyncCookies(ctx, user.ID, session); err != nil {
+		t.Fatal(err)
+	}
+	key, prefix, hash, err := poolclient.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &model.PoolClient{Name: "other", KeyPrefix: prefix, KeyHash: hash}
+	if err := db.CreatePoolClient(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{PoolLeaseTTL: time.Minute, PoolLeaseMaxTTL: time.Hour, PoolQuarantineThreshold: 2, PoolRateLimitCooldown: time.Minute, PoolHandleSecret: "secret"}
+	r := chi.NewRouter()
+	r.Use(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter()))
+	r.Post("/pool/report", ReportPoolSessionHandler(db, cfg))
+	r.Post("/pool/leases", LeasePoolSessionHandler(db, cfg))
+	r.Post("/pool/leases/{id}/release", ReleasePoolLeaseHandler(db, cfg))
+
+	doAs := func(poolKey, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("x-pool-key", poolKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	do := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return doAs("legacy-key", path, body)
+	}
+	contributor := poolhandle.For(cfg.PoolHandleSecret, 0, "example.com", user.ID)
+	report := `{"contributor":"` + contributor + `","domain":"example.com","reason":"invalid"}`
+
+	if rec := do("/pool/report", strings.Replace(report, "invalid", "broken", 1)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown reason: status %d, want 400", rec.Code)
+	}
+	if rec := do("/pool/report", strings.Replace(report, "example.com", "nobody.org", 1)); rec.Code != http.StatusNotFound {
+		t.Errorf("unshared domain: status %d, want 404", rec.Code)
+	}
+	if rec := do("/pool/report", strings.Replace(report, contributor, strconv.FormatInt(user.ID, 10), 1)); rec.Code != http.StatusNotFound {
+		t.Errorf("user ID as the contributor: status %d, want 404", rec.Code)
+	}
+
+	// A lease returned as bad counts as the first report.
+	rec := do("/pool/leases", `{"domain":"example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("lease: status %d: %s", rec.Code, rec.Body)
+	}
+	var leased struct {
+		Data PoolLeaseResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&leased); err != nil {
+		t.Fatal(err)
+	}
+	if leased.Data.Contributor != contributor {
+		t.Errorf("leased contributor %q, want %q", leased.Data.Contributor, contributor)
+	}
+	if rec := do("/pool/leases/"+strconv.FormatInt(leased.Data.ID, 10)+"/release", `{"bad":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("release: status %d: %s", rec.Code, rec.Body)
+	}
+
+	send := func(poolKey, report string) PoolReportResponse {
+		t.Helper()
+		rec := doAs(poolKey, "/pool/report", report)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("report: status %d: %s", rec.Code, rec.Body)
+		}
+		var reported struct {
+			Data PoolReportResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&reported); err != nil {
+			t.Fatal(err)
+		}
+		return reported.Data
+	}
+	// The same client reporting again still counts once.
+	for range 3 {
+		if h := send("legacy-key", report); h.Failures != 1 || h.QuarantinedAt != nil {
+			t.Errorf("session health %+v, want one failure and no quarantine", h)
+		}
+	}
+	rec = do("/pool/leases", `{"domain":"example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("lease of a session reported by one client: status %d, want 201", rec.Code)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&leased); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do("/pool/leases/"+strconv.FormatInt(leased.Data.ID, 10)+"/release", `{"bad":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("release: status %d: %s", rec.Code, rec.Body)
+	}
+	otherReport := strings.Replace(report, contributor, poolhandle.For(cfg.PoolHandleSecret, other.ID, "example.com", user.ID), 1)
+	if h := send(key, otherReport); h.Failures != 2 || h.QuarantinedAt == nil {
+		t.Errorf("session health %+v, want two failures and a quarantine", h)
+	}
+	if rec := do("/pool/leases", `{"domain":"example.com"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("lease of a quarantined session: status %d, want 404", rec.Code)
+	}
+
+	session[0].Value = "2"
+	if err := db.SyncCookies(ctx, user.ID, session); err != nil {
+		t.Fatal(err)
+	}
+	rec = do("/pool/leases", `{"domain":"example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("lease after the contributor synced new cookies: status %d, want 201", rec.Code)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&leased); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do("/pool/leases/"+strconv.FormatInt(leased.Data.ID, 10)+"/release", ""); rec.Code != http.StatusOK {
+		t.Fatalf("release: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if err := db.SuspendUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do("/pool/report", report); rec.Code != http.StatusNotFound {
+		t.Errorf("report of a suspended contributor: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxPoolStatsHours is the longest window pool statistics cover.
+const maxPoolStatsHours = 90 * 24
+
+// PoolUsageCounts are how often sessions were used through the pool.
+type PoolUsageCounts struct {
+	Served      int64 `json:"served"`       // pool reads that returned a session
+	Leased      int64 `json:"leased"`       // leases of a session
+	ReportedBad int64 `json:"reported_bad"` // failure reports, including leases returned as bad
+}
+
+func (c *PoolUsageCounts) add(u *model.PoolUsage) {
+	c.Served += u.Served
+	c.Leased += u.Leased
+	c.ReportedBad += u.ReportedBad
+}
+
+// PoolStats sums pool usage since a given hour.
+type PoolStats struct {
+	Since   time.Time         `json:"since"`
+	Total   PoolUsageCounts   `json:"total"`
+	Domains []DomainPoolStats `json:"domains"`
+	Hourly  []HourlyPoolStats `json:"hourly"`
+}
+
+// DomainPoolStats is the usage of the sessions for one domain.
+type DomainPoolStats struct {
+	Domain string `json:"domain"`
+	PoolUsageCounts
+	Contributors []ContributorPoolStats `json:"contributors,omitempty"` // admins only
+}
+
+// ContributorPoolStats is the usage of one contributor's session.
+type ContributorPoolStats struct {
+	UserID int64 `json:"user_id"`
+	PoolUsageCounts
+}
+
+// HourlyPoolStats is the usage of the sessions for one domain in one hour.
+type HourlyPoolStats struct {
+	Hour   time.Time `json:"hour"`
+	Domain string    `json:"domain"`
+	PoolUsageCounts
+}
+
+// poolStatsSince parses the hours query parameter into the start of the
+// window, writing the error response if that fails.
+func poolStatsSince(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	hours := 24
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPoolStatsHours {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("hours must be between 1 and %d", maxPoolStatsHours))
+			return time.Time{}, false
+		}
+		hours = n
+	}
+	// The current hour counts as one of them.
+	return time.Now().UTC().Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour), true
+}
+
+// summarizePoolUsage sums rows, which are ordered by hour, domain and user,
+// by domain and by hour, and by contributor too if contributors is set.
+func summarizePoolUsage(rows []*model.PoolUsage, since time.Time, contributors bool) PoolStats {
+	stats := PoolStats{Since: since, Domains: make([]DomainPoolStats, 0), Hourly: make([]HourlyPoolStats, 0)}
+	domains := make(map[string]*DomainPoolStats)
+	byContributor := make(map[string]map[int64]*ContributorPoolStats)
+	for _, u := range rows {
+		stats.Total.add(u)
+
+		if n := len(stats.Hourly); n == 0 || !stats.Hourly[n-1].Hour.Equal(u.Hour) || stats.Hourly[n-1].Domain != u.Domain {
+			stats.Hourly = append(stats.Hourly, HourlyPoolStats{Hour: u.Hour, Domain: u.Domain})
+		}
+		stats.Hourly[len(stats.Hourly)-1].add(u)
+
+		d, ok := domains[u.Domain]
+		if !ok {
+			d = &DomainPoolStats{Domain: u.Domain}
+			domains[u.Domain] = d
+			byContributor[u.Domain] = make(map[int64]*ContributorPoolStats)
+		}
+		d.add(u)
+		if contributors {
+			c, ok := byContributor[u.Domain][u.UserID]
+			if !ok {
+				c = &ContributorPoolStats{UserID: u.UserID}
+				byContributor[u.Domain][u.UserID] = c
+			}
+			c.add(u)
+		}
+	}
+
+	for domain, d := range domains {
+		for _, c := range byContributor[domain] {
+			d.Contributors = append(d.Contributors, *c)
+		}
+		sort.Slice(d.Contributors, func(i, j int) bool { return d.Contributors[i].UserID < d.Contributors[j].UserID })
+		stats.Domains = append(stats.Domains, *d)
+	}
+	sort.Slice(stats.Domains, func(i, j int) bool { return stats.Domains[i].Domain < stats.Domains[j].Domain })
+	return stats
+}
+
+// UserPoolStatsHandler shows how pool clients used the user's sessions.
+// @Summary      Get pool usage of your sessions
+// @Description  Shows how often pool clients were served, leased or reported as bad each of the user's shared sessions, per domain and per hour, over the last hours (24 by default, the current hour included, at most 2160).
+// @Tags         User
+// @Produce      json
+// @Param        hours query     int  false  "How many hours back to cover"
+// @Success      200   {object}  handler.APIResponse{data=handler.PoolStats}
+// @Failure      400   {object}  handler.APIResponse
+// @Failure      401   {object}  handler.APIResponse
+// @Failure      500   {object}  handler.APIResponse
+// @Failure      503   {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/pool/stats [get]
+func UserPoolStatsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		since, ok := poolStatsSince(w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.ListPoolUsage(r.Context(), user.ID, "", since)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not get pool usage")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved pool usage", summarizePoolUsage(rows, since, false))
+	}
+}
+
+// AdminPoolStatsHandler shows the demand on the pool.
+// @Summary      [Admin] Get pool usage
+// @Description  Shows how often sessions were served, leased or reported as bad, per domain (with a breakdown by contributor) and per hour, over the last hours (24 by default, the current hour included, at most 2160). Counts are kept for POOL_STATS_RETENTION.
+// @Tags         Admin
+// @Produce      json
+// @Param        hours   query     int     false  "How many hours back to cover"
+// @Param        domain  query     string  false  "Only this domain"
+// @Param        user_id query     int     false  "Only this contributor"
+// @Success      200     {object}  handler.APIResponse{data=handler.PoolStats}
+// @Failure      400     {object}  handler.APIResponse
+// @Failure      403     {object}  handler.APIResponse
+// @Failure      500     {object}  handler.APIResponse
+// @Failure      503     {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/pool/stats [get]
+func AdminPoolStatsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, ok := poolStatsSince(w, r)
+		if !ok {
+			return
+		}
+		var userID int64
+		if v := r.URL.Query().Get("user_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 1 {
+				RespondWithError(w, http.StatusBadRequest, "Invalid user_id")
+				return
+			}
+			userID = id
+		}
+		domain := poolhealth.NormalizeDomain(r.URL.Query().Get("domain"))
+
+		rows, err := db.ListPoolUsage(r.Context(), userID, domain, since)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not get pool usage: "+err.Error())
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved pool usage", summarizePoolUsage(rows, since, true))
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPoolStats(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "legacy-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := db.CreateUsers(ctx, []string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := created[0]
+	for _, u := range []*model.User{user, other} {
+		if err := db.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatal(err)
+		}
+		session := []*model.Cookie{{Domain: "example.com", Name: "sid", Value: u.APIKey, Path: "/", IsSharable: true}}
+		if err := db.SyncCookies(ctx, u.ID, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{PoolLeaseTTL: time.Minute, PoolLeaseMaxTTL: time.Hour, PoolQuarantineThreshold: 3, PoolRateLimitCooldown: time.Minute, PoolHandleSecret: "secret"}
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(PoolKeyAuthMiddleware(db, "legacy-key", poolclient.NewLimiter()))
+		r.Get("/pool/cookies/{domain}", GetSharableCookiesHandler(db, cfg))
+		r.Post("/pool/leases", LeasePoolSessionHandler(db, cfg))
+		r.Post("/pool/report", ReportPoolSessionHandler(db, cfg))
+	})
+	r.With(AuthMiddleware(db)).Get("/user/pool/stats", UserPoolStatsHandler(db))
+	r.Get("/admin/pool/stats", AdminPoolStatsHandler(db))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-pool-key", "legacy-key")
+		req.Header.Set("x-api-key", other.APIKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	stats := func(path string) PoolStats {
+		t.Helper()
+		rec := do(http.MethodGet, path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data PoolStats `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	rec := do(http.MethodGet, "/pool/cookies/example.com?format=json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pool read: status %d: %s", rec.Code, rec.Body)
+	}
+	var read struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&read); err != nil {
+		t.Fatal(err)
+	}
+	contributor := poolhandle.For(cfg.PoolHandleSecret, 0, "example.com", other.ID)
+	var found bool
+	for _, c := range read.Data {
+		if _, ok := c["user_id"]; ok {
+			t.Errorf("pool read %v gives away the user ID", c)
+		}
+		found = found || c["contributor"] == contributor
+	}
+	if len(read.Data) != 2 || !found {
+		t.Errorf("pool read %v, want two contributors including %s", read.Data, contributor)
+	}
+	if rec := do(http.MethodPost, "/pool/leases", `{"domain":"example.com"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("lease: status %d: %s", rec.Code, rec.Body)
+	}
+	report := `{"contributor":"` + contributor + `","domain":"example.com","reason":"invalid"}`
+	if rec := do(http.MethodPost, "/pool/report", report); rec.Code != http.StatusOK {
+		t.Fatalf("report: status %d: %s", rec.Code, rec.Body)
+	}
+
+	all := stats("/admin/pool/stats")
+	if want := (PoolUsageCounts{Served: 2, Leased: 1, ReportedBad: 1}); all.Total != want {
+		t.Errorf("admin total %+v, want %+v", all.Total, want)
+	}
+	if len(all.Domains) != 1 || all.Domains[0].Domain != "example.com" || len(all.Domains[0].Contributors) != 2 {
+		t.Fatalf("admin domains %+v, want example.com with two contributors", all.Domains)
+	}
+	if len(all.Hourly) != 1 || all.Hourly[0].PoolUsageCounts != all.Total {
+		t.Errorf("admin hourly %+v, want one hour with the total", all.Hourly)
+	}
+	if got := stats("/admin/pool/stats?domain=nobody.org"); got.Total != (PoolUsageCounts{}) {
+		t.Errorf("admin total for another domain %+v, want none", got.Total)
+	}
+	byUser := stats("/admin/pool/stats?user_id=" + strconv.FormatInt(other.ID, 10))
+	if byUser.Total.Served != 1 || byUser.Total.ReportedBad != 1 {
+		t.Errorf("admin total for one contributor %+v, want one read and one report", byUser.Total)
+	}
+
+	mine := stats("/user/pool/stats?hours=1")
+	if mine.Total != byUser.Total {
+		t.Errorf("user total %+v, want %+v", mine.Total, byUser.Total)
+	}
+	if len(mine.Domains) != 1 || mine.Domains[0].Contributors != nil {
+		t.Errorf("user domains %+v, want one without contributors", mine.Domains)
+	}
+
+	for _, hours := range []string{"0", "2161", "day"} {
+		if rec := do(http.MethodGet, "/user/pool/stats?hours="+hours, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("hours=%s: status %d, want 400", hours, rec.Code)
+		}
+	}
+	if rec := do(http.MethodGet, "/admin/pool/stats?user_id=x", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad user_id: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/probe"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SessionProbeRequest is the body for creating a session probe.
+type SessionProbeRequest struct {
+	Domain        string `json:"domain"`
+	URL           string `json:"url"`            // on the domain or a subdomain
+	ExpectStatus  int    `json:"expect_status"`  // 0 for 200
+	BodyRegex     string `json:"body_regex"`     // the body must match it, empty for no check
+	LoginRedirect string `json:"login_redirect"` // a redirect to a Location matching it means logged out, empty for no check
+}
+
+// SessionStatus is how the probes last found a user's session for a domain.
+type SessionStatus struct {
+	Domain    string     `json:"domain"`
+	Status    string     `json:"status" enums:"ok,expired,error,unknown"` // expired if any probe found it expired, unknown until probed
+	Detail    string     `json:"detail,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// decodeSessionProbeRequest decodes and checks the body into p, writing the
+// error response if that fails.
+func decodeSessionProbeRequest(w http.ResponseWriter, r *http.Request, p *model.SessionProbe) bool {
+	var payload SessionProbeRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		RespondWithDecodeError(w, err)
+		return false
+	}
+	p.Domain = payload.Domain
+	p.URL = payload.URL
+	p.ExpectStatus = payload.ExpectStatus
+	p.BodyRegex = payload.BodyRegex
+	p.LoginRedirect = payload.LoginRedirect
+	if err := probe.Validate(p); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid probe: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// probeIDParam parses the {id} URL parameter, writing the error response if
+// that fails.
+func probeIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid probe ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// ListUserProbesHandler lists the authenticated user's session probes.
+// @Summary      List session probes
+// @Description  Lists the probes the user defined for their own cookies.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]model.SessionProbe}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/probes [get]
+func ListUserProbesHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		probes, err := db.ListSessionProbes(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list probes")
+			return
+		}
+		own := make([]*model.SessionProbe, 0)
+		for _, p := range probes {
+			if p.UserID == user.ID {
+				own = append(own, p)
+			}
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved probes", own)
+	}
+}
+
+// CreateUserProbeHandler adds a session probe for the user's own cookies.
+// @Summary      Create a session probe
+// @Description  Defines how to tell whether the user's session for a domain still works: the server requests url with the user's cookies for the domain and expects expect_status (200 if 0), a body matching body_regex if given, and no redirect to a Location matching login_redirect if given. Probes run every PROBE_INTERVAL; see GET /user/sessions for the results. A user may have up to 20 probes.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.SessionProbeRequest true "Probe"
+// @Success      201  {object}  handler.APIResponse{data=model.SessionProbe}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/probes [post]
+func CreateUserProbeHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		p := model.SessionProbe{UserID: user.ID}
+		if !decodeSessionProbeRequest(w, r, &p) {
+			return
+		}
+
+		probes, err := db.ListSessionProbes(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list probes")
+			return
+		}
+		count := 0
+		for _, existing := range probes {
+			if existing.UserID == user.ID {
+				count++
+			}
+		}
+		if count >= probe.MaxPerUser {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("A user may have at most %d probes", probe.MaxPerUser))
+			return
+		}
+
+		if err := db.CreateSessionProbe(r.Context(), &p); err != nil {
+			RespondWithStoreError(w, r, err, "Could not create probe")
+			return
+		}
+		RespondWithJSON(w, http.StatusCreated, "Probe created successfully", p)
+	}
+}
+
+// DeleteUserProbeHandler deletes one of the user's session probes.
+// @Summary      Delete a session probe
+// @Description  Deletes the probe and its results.
+// @Tags         User
+// @Produce      json
+// @Param        id   path      int  true  "Probe ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/probes/{id} [delete]
+func DeleteUserProbeHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		id, ok := probeIDParam(w, r)
+		if !ok {
+			return
+		}
+		p, err := db.GetSessionProbe(r.Context(), id)
+		if err == nil && p.UserID != user.ID {
+			err = fmt.Errorf("session probe %w", store.ErrNotFound)
+		}
+		if err == nil {
+			err = db.DeleteSessionProbe(r.Context(), id)
+		}
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Probe not found")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Probe deleted successfully", nil)
+	}
+}
+
+// UserSessionStatusHandler reports per domain whether the user's session
+// still works, as the probes last found it.
+// @Summary      Get session status per domain
+// @Description  For each domain the user's cookies were probed for (by their own probes, or by admin probes if the cookies are shared), shows expired if any probe found the session no longer works, ok if the probes found it working, error if they could not tell, and unknown for the user's own probes that have not run yet. A sync that changes a session's cookies clears its status until the next probe.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]handler.SessionStatus}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/sessions [get]
+func UserSessionStatusHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		results, err := db.ListProbeResults(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not get probe results")
+			return
+		}
+		probes, err := db.ListSessionProbes(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list probes")
+			return
+		}
+
+		// Results come ordered by domain. Within a domain an expired
+		// result outranks an error, which outranks ok.
+		rank := map[string]int{model.ProbeOK: 1, model.ProbeError: 2, model.ProbeExpired: 3}
+		statuses := make([]SessionStatus, 0)
+		index := make(map[string]int)
+		for _, res := range results {
+			i, ok := index[res.Domain]
+			if !ok {
+				i = len(statuses)
+				index[res.Domain] = i
+				statuses = append(statuses, SessionStatus{Domain: res.Domain})
+			}
+			st := &statuses[i]
+			if rank[res.Outcome] > rank[st.Status] {
+				checkedAt := res.CheckedAt
+				st.Status, st.Detail, st.CheckedAt = res.Outcome, res.Detail, &checkedAt
+			}
+		}
+		for _, p := range probes {
+			if _, ok := index[p.Domain]; p.UserID == user.ID && !ok {
+				index[p.Domain] = len(statuses)
+				statuses = append(statuses, SessionStatus{Domain: p.Domain, Status: "unknown"})
+			}
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved session status", statuses)
+	}
+}
+
+// AdminListProbesHandler lists every session probe.
+// @Summary      [Admin] List session probes
+// @Description  Lists the admin probes of the pool (user_id 0) and every user's probes.
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]model.SessionProbe}
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/probes [get]
+func AdminListProbesHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		probes, err := db.ListSessionProbes(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list probes: "+err.Error())
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved probes", probes)
+	}
+}
+
+// AdminCreateProbeHandler adds a probe of the pool's sessions for a domain.
+// @Summary      [Admin] Create a pool session probe
+// @Description  Like POST /user/probes, but the probe runs against every user's cookies for the domain that are shared in the pool. The pool leaves out sessions a probe found expired while other sessions for the domain are left.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.SessionProbeRequest true "Probe"
+// @Success      201  {object}  handler.APIResponse{data=model.SessionProbe}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/probes [post]
+func AdminCreateProbeHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p model.SessionProbe
+		if !decodeSessionProbeRequest(w, r, &p) {
+			return
+		}
+		if err := db.CreateSessionProbe(r.Context(), &p); err != nil {
+			RespondWithStoreError(w, r, err, "Could not create probe: "+err.Error())
+			return
+		}
+		RespondWithJSON(w, http.StatusCreated, "Probe created successfully", p)
+	}
+}
+
+// AdminDeleteProbeHandler deletes any session probe.
+// @Summary      [Admin] Delete a session probe
+// @Description  Deletes an admin or user probe and its results.
+// @Tags         Admin
+// @Produce      json
+// @Param        id   path      int  true  "Probe ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/probes/{id} [delete]
+func AdminDeleteProbeHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := probeIDParam(w, r)
+		if !ok {
+			return
+		}
+		if err := db.DeleteSessionProbe(r.Context(), id); err != nil {
+			RespondWithStoreError(w, r, err, "Probe not found")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Probe deleted successfully", nil)
+	}
+}
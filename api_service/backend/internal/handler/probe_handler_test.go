@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSessionProbes(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUsers(ctx, []string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.With(AuthMiddleware(db)).Get("/user/probes", ListUserProbesHandler(db))
+	r.With(AuthMiddleware(db)).Post("/user/probes", CreateUserProbeHandler(db))
+	r.With(AuthMiddleware(db)).Delete("/user/probes/{id}", DeleteUserProbeHandler(db))
+	r.With(AuthMiddleware(db)).Get("/user/sessions", UserSessionStatusHandler(db))
+	r.Post("/admin/probes", AdminCreateProbeHandler(db))
+
+	do := func(method, path, body, apiKey string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", apiKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	sessions := func() []SessionStatus {
+		t.Helper()
+		rec := do(http.MethodGet, "/user/sessions", "", user.APIKey)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("session status: %d: %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data []SessionStatus `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	if rec := do(http.MethodPost, "/user/probes", `{"domain":"example.com","url":"https://evil.com/"}`, user.APIKey); rec.Code != http.StatusBadRequest {
+		t.Errorf("probe URL off the domain: status %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPost, "/user/probes", `{"domain":"Example.com","url":"https://example.com/account","login_redirect":"/login"}`, user.APIKey)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create probe: status %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Data model.SessionProbe `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Data.UserID != user.ID || created.Data.Domain != "example.com" || created.Data.ExpectStatus != 200 {
+		t.Errorf("created probe %+v, want the user's example.com probe expecting 200", created.Data)
+	}
+	if rec := do(http.MethodPost, "/admin/probes", `{"domain":"example.com","url":"https://example.com/"}`, ""); rec.Code != http.StatusCreated {
+		t.Fatalf("create admin probe: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(http.MethodGet, "/user/probes", "", user.APIKey)
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"url"`) != 1 {
+		t.Errorf("list probes: status %d: %s, want only the user's probe", rec.Code, rec.Body)
+	}
+
+	if got := sessions(); len(got) != 1 || got[0].Domain != "example.com" || got[0].Status != "unknown" {
+		t.Errorf("status before any probe ran = %+v, want example.com unknown", got)
+	}
+	err = db.RecordProbeResult(ctx, &model.ProbeResult{ProbeID: created.Data.ID, UserID: user.ID, Domain: "example.com", Outcome: model.ProbeExpired, Detail: "redirected to /login", CheckedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sessions(); len(got) != 1 || got[0].Status != model.ProbeExpired || got[0].Detail != "redirected to /login" || got[0].CheckedAt == nil {
+		t.Errorf("status after an expired result = %+v, want example.com expired", got)
+	}
+
+	id := strconv.FormatInt(created.Data.ID, 10)
+	if rec := do(http.MethodDelete, "/user/probes/"+id, "", other[0].APIKey); rec.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's probe: status %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/user/probes/"+id, "", user.APIKey); rec.Code != http.StatusOK {
+		t.Errorf("delete probe: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := sessions(); len(got) != 0 {
+		t.Errorf("status after deleting the probe = %+v, want none", got)
+	}
+}
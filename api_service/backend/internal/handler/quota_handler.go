@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/quota"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultQuota returns the server-wide quota configured in cfg.
+func defaultQuota(cfg *config.Config) quota.Limits {
+	return quota.Limits{
+		MaxCookies: cfg.QuotaMaxCookies,
+		MaxBytes:   cfg.QuotaMaxBytes,
+		MaxDomains: cfg.QuotaMaxDomains,
+	}
+}
+
+// UserUsageHandler reports the authenticated user's storage against their quota.
+// @Summary      Get quota usage
+// @Description  Shows how many cookies, bytes (domains, names, values and paths) and distinct domains the user stores, next to the effective limits (0 means unlimited) and any per-user overrides set by an admin.
+// @Tags         User
+// @Produce      json
+// @Param        x-team-id  header  int  false  "Report the usage of this team's vault instead (needs the reader role)"
+// @Success      200  {object}  handler.APIResponse{data=quota.Report}
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/usage [get]
+func UserUsageHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
+			return
+		}
+
+		cookies, err := db.GetCookiesByUserID(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not fetch cookies")
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved quota usage", quota.NewReport(defaultQuota(cfg), user, cookies))
+	}
+}
+
+// AdminUserUsageHandler reports a user's storage against their quota.
+// @Summary      [Admin] Get a user's quota usage
+// @Description  Shows the user's usage next to their effective limits (0 means unlimited) and their per-user overrides.
+// @Tags         Admin
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  handler.APIResponse{data=quota.Report}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/users/{id}/usage [get]
+func AdminUserUsageHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		report, err := usageReport(r, db, cfg, id)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not get quota usage: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved quota usage", report)
+	}
+}
+
+// AdminUpdateUserQuotaHandler sets a user's quota overrides.
+// @Summary      [Admin] Set a user's quota
+// @Description  Replaces the user's quota overrides. Each limit is a number (0 for unlimited) or null to use the server default (QUOTA_MAX_COOKIES, QUOTA_MAX_BYTES, QUOTA_MAX_DOMAINS). Lower limits apply from the user's next sync; cookies already stored are kept. Returns the resulting usage report.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int          true  "User ID"
+// @Param        body  body      model.Quota  true  "Quota overrides"
+// @Success      200   {object}  handler.APIResponse{data=quota.Report}
+// @Failure      400   {object}  handler.APIResponse
+// @Failure      403   {object}  handler.APIResponse
+// @Failure      404   {object}  handler.APIResponse
+// @Failure      413   {object}  handler.APIResponse
+// @Failure      500   {object}  handler.APIResponse
+// @Failure      503   {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/users/{id}/quota [put]
+func AdminUpdateUserQuotaHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var payload model.Quota
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		for _, limit := range []*int64{payload.MaxCookies, payload.MaxBytes, payload.MaxDomains} {
+			if limit != nil && *limit < 0 {
+				RespondWithError(w, http.StatusBadRequest, "Quota limits must be 0 (unlimited), a positive number or null")
+				return
+			}
+		}
+
+		if err := db.UpdateUserQuota(r.Context(), id, payload); err != nil {
+			RespondWithStoreError(w, r, err, "Could not update user quota: "+err.Error())
+			return
+		}
+		report, err := usageReport(r, db, cfg, id)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not get quota usage: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "User quota updated successfully", report)
+	}
+}
+
+func usageReport(r *http.Request, db store.Store, cfg *config.Config, userID int64) (quota.Report, error) {
+	user, err := db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return quota.Report{}, err
+	}
+	cookies, err := db.GetCookiesByUserID(r.Context(), userID)
+	if err != nil {
+		return quota.Report{}, err
+	}
+	return quota.NewReport(defaultQuota(cfg), user, cookies), nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/quota"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{QuotaMaxCookies: 2}
+
+	r := chi.NewRouter()
+	r.With(AuthMiddleware(db)).Post("/sync", SyncHandler(db, locker.NewLocal(time.Second), cfg))
+	r.With(AuthMiddleware(db)).Get("/user/usage", UserUsageHandler(db, cfg))
+	r.Get("/admin/users/{id}/usage", AdminUserUsageHandler(db, cfg))
+	r.Put("/admin/users/{id}/quota", AdminUpdateUserQuotaHandler(db, cfg))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", user.APIKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	report := func(rec *httptest.ResponseRecorder) quota.Report {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data quota.Report `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	three := `[{"domain":"a.com","name":"x","value":"1"},{"domain":"b.com","name":"y","value":"2"},{"domain":"c.com","name":"z","value":"3"}]`
+	rec := do(http.MethodPost, "/sync", three)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("sync over the default quota: status %d, want 413: %s", rec.Code, rec.Body)
+	}
+	var rejected struct {
+		Data []quota.Violation `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if want := []quota.Violation{{Resource: "cookies", Used: 3, Limit: 2}}; len(rejected.Data) != 1 || rejected.Data[0] != want[0] {
+		t.Errorf("violations = %+v, want %+v", rejected.Data, want)
+	}
+	if cookies, _ := db.GetCookiesByUserID(ctx, user.ID); len(cookies) != 0 {
+		t.Errorf("%d cookies stored, want none after a rejected sync", len(cookies))
+	}
+
+	// An admin override replaces the default; 0 lifts the limit.
+	id := strconv.FormatInt(user.ID, 10)
+	if rec := do(http.MethodPut, "/admin/users/"+id+"/quota", `{"max_cookies":-1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative quota: status %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/admin/users/999/quota", `{"max_cookies":0}`); rec.Code != http.StatusNotFound {
+		t.Errorf("quota of a missing user: status %d, want 404", rec.Code)
+	}
+	got := report(do(http.MethodPut, "/admin/users/"+id+"/quota", `{"max_cookies":0,"max_domains":3}`))
+	if got.Limits != (quota.Limits{MaxCookies: 0, MaxDomains: 3}) {
+		t.Errorf("limits after override = %+v, want unlimited cookies and 3 domains", got.Limits)
+	}
+	if rec := do(http.MethodPost, "/sync", three); rec.Code != http.StatusOK {
+		t.Fatalf("sync within the override: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	got = report(do(http.MethodGet, "/user/usage", ""))
+	if got.Usage.Cookies != 3 || got.Usage.Domains != 3 || got.Usage.Bytes != int64(3*(5+1+1+1)) {
+		t.Errorf("usage = %+v, want 3 cookies, 3 domains, 24 bytes", got.Usage)
+	}
+	if got.Overrides.MaxDomains == nil || *got.Overrides.MaxDomains != 3 || got.Overrides.MaxBytes != nil {
+		t.Errorf("overrides = %+v, want max_domains 3 and no max_bytes", got.Overrides)
+	}
+	if len(got.Exceeded) != 0 {
+		t.Errorf("exceeded = %+v, want none", got.Exceeded)
+	}
+
+	// Lowering a limit below the stored usage shows up in the report.
+	report(do(http.MethodPut, "/admin/users/"+id+"/quota", `{"max_domains":1}`))
+	got = report(do(http.MethodGet, "/admin/users/"+id+"/usage", ""))
+	if len(got.Exceeded) != 2 {
+		t.Errorf("exceeded = %+v, want cookies (default 2) and domains (1)", got.Exceeded)
+	}
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"cookie-syncer/api/internal/store"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 )
 
@@ -29,3 +32,27 @@ func RespondWithJSON(w http.ResponseWriter, code int, message string, payload in
 func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, message, nil)
 }
+
+// RespondWithStoreError writes an error response for a failed store call,
+// choosing the status from the store's sentinel errors. If the request's
+// context is already done, nothing is written: the client has gone away, or
+// the timeout middleware answers with 504.
+func RespondWithStoreError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if r.Context().Err() != nil {
+		log.Printf("[Store] %s %s abandoned: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		RespondWithError(w, http.StatusNotFound, message)
+	case errors.Is(err, store.ErrConflict):
+		RespondWithError(w, http.StatusConflict, message)
+	case errors.Is(err, store.ErrUnavailable):
+		log.Printf("[Store] %s %s: database unavailable: %v", r.Method, r.URL.Path, err)
+		w.Header().Set("Retry-After", "1")
+		RespondWithError(w, http.StatusServiceUnavailable, message)
+	default:
+		log.Printf("[Store] %s %s: %v", r.Method, r.URL.Path, err)
+		RespondWithError(w, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/export"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/sharelink"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxShareLinkUses is the most redemptions a link may allow.
+const maxShareLinkUses = 1000
+
+// ShareLinkRequest defines the structure for creating a share link.
+type ShareLinkRequest struct {
+	Domain    string     `json:"domain"`     // share cookies for this domain and its subdomains
+	Names     []string   `json:"names"`      // share only cookies with these names
+	MaxUses   int        `json:"max_uses"`   // redemptions allowed, 1 if 0
+	ExpiresAt *time.Time `json:"expires_at"` // SHARE_LINK_TTL from now if omitted
+	Password  string     `json:"password"`   // required to redeem the link if set
+}
+
+// ShareLinkInfo is a share link as its owner sees it.
+type ShareLinkInfo struct {
+	model.ShareLink
+	HasPassword bool `json:"has_password"`
+}
+
+// CreatedShareLinkResponse is a new share link with its token, which is shown
+// only once.
+type CreatedShareLinkResponse struct {
+	ShareLinkInfo
+	Token string `json:"token"`
+}
+
+// RedeemShareLinkRequest carries the password of a protected share link.
+type RedeemShareLinkRequest struct {
+	Password string `json:"password"`
+}
+
+func shareLinkInfo(link *model.ShareLink) ShareLinkInfo {
+	return ShareLinkInfo{ShareLink: *link, HasPassword: link.PasswordHash != ""}
+}
+
+// decodeShareLinkRequest decodes and validates a share link request into
+// link, writing the error response if that fails.
+func decodeShareLinkRequest(w http.ResponseWriter, r *http.Request, cfg *config.Config, link *model.ShareLink) bool {
+	var payload ShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		RespondWithDecodeError(w, err)
+		return false
+	}
+
+	if payload.Domain != "" {
+		link.Domain = poolhealth.NormalizeDomain(payload.Domain)
+		if link.Domain == "" {
+			RespondWithError(w, http.StatusBadRequest, "Invalid share link: invalid domain")
+			return false
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range payload.Names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		link.Names = append(link.Names, name)
+	}
+	if link.Domain == "" && len(link.Names) == 0 {
+		RespondWithError(w, http.StatusBadRequest, "Invalid share link: a domain or cookie names are required")
+		return false
+	}
+
+	link.MaxUses = payload.MaxUses
+	if link.MaxUses == 0 {
+		link.MaxUses = 1
+	}
+	if link.MaxUses < 1 || link.MaxUses > maxShareLinkUses {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid share link: max_uses must be between 1 and %d", maxShareLinkUses))
+		return false
+	}
+
+	now := time.Now()
+	link.ExpiresAt = now.Add(cfg.ShareLinkTTL)
+	if payload.ExpiresAt != nil {
+		link.ExpiresAt = *payload.ExpiresAt
+	}
+	if !link.ExpiresAt.After(now) {
+		RespondWithError(w, http.StatusBadRequest, "Invalid share link: expires_at must be in the future")
+		return false
+	}
+	if link.ExpiresAt.After(now.Add(cfg.ShareLinkMaxTTL)) {
+		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid share link: a link may last at most %s", cfg.ShareLinkMaxTTL))
+		return false
+	}
+
+	if payload.Password != "" {
+		if len(payload.Password) > sharelink.MaxPasswordBytes {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid share link: the password may be at most %d bytes", sharelink.MaxPasswordBytes))
+			return false
+		}
+		hash, err := sharelink.HashPassword(payload.Password)
+		if err != nil {
+			log.Printf("[Share] %v", err)
+			RespondWithError(w, http.StatusInternalServerError, "Could not create share link")
+			return false
+		}
+		link.PasswordHash = hash
+	}
+	return true
+}
+
+// shareLinkIDParam parses the {id} URL parameter, writing the error response
+// if that fails.
+func shareLinkIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid share link ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// recordShareLinkEvent adds an entry to the link's audit log.
+func recordShareLinkEvent(r *http.Request, db store.Store, linkID int64, event, detail string, cookieCount int) {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	e := &model.ShareLinkEvent{
+		LinkID:      linkID,
+		Event:       event,
+		Detail:      detail,
+		CookieCount: cookieCount,
+		RemoteAddr:  remote,
+		UserAgent:   r.UserAgent(),
+	}
+	// The response is decided; record it even if the client has gone away.
+	if err := db.AddShareLinkEvent(context.WithoutCancel(r.Context()), e); err != nil {
+		log.Printf("[Share] Could not record %s event of share link %d: %v", event, linkID, err)
+	}
+}
+
+// CreateShareLinkHandler creates a share link for some of the user's cookies.
+// @Summary      Create a share link
+// @Description  Creates a link that hands the user's cookies for a domain (and its subdomains), with the given names, or both, to whoever holds its token, e.g. a teammate who needs the session. The link works max_uses times (1 by default, at most 1000) until expires_at (SHARE_LINK_TTL from now by default, at most SHARE_LINK_MAX_TTL), and with a password only when it comes with the password. Redeem it with POST /share/{token}.
+// @Description  The token is returned only here; the server keeps its hash. A user may have up to 50 usable links.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.ShareLinkRequest true "Share link"
+// @Success      201  {object}  handler.APIResponse{data=handler.CreatedShareLinkResponse}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/share-links [post]
+func CreateShareLinkHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		link := model.ShareLink{UserID: user.ID}
+		if !decodeShareLinkRequest(w, r, cfg, &link) {
+			return
+		}
+
+		links, err := db.ListShareLinks(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list share links")
+			return
+		}
+		now := time.Now()
+		active := 0
+		for _, l := range links {
+			if sharelink.Inactive(l, now) == "" {
+				active++
+			}
+		}
+		if active >= sharelink.MaxActivePerUser {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("A user may have at most %d usable share links", sharelink.MaxActivePerUser))
+			return
+		}
+
+		token, prefix, hash, err := sharelink.NewToken()
+		if err != nil {
+			log.Printf("[Share] %v", err)
+			RespondWithError(w, http.StatusInternalServerError, "Could not create share link")
+			return
+		}
+		link.TokenPrefix = prefix
+		link.TokenHash = hash
+		if err := db.CreateShareLink(r.Context(), &link); err != nil {
+			RespondWithStoreError(w, r, err, "Could not create share link")
+			return
+		}
+		recordShareLinkEvent(r, db, link.ID, model.ShareLinkCreated, "", 0)
+		RespondWithJSON(w, http.StatusCreated, "Share link created successfully", CreatedShareLinkResponse{ShareLinkInfo: shareLinkInfo(&link), Token: token})
+	}
+}
+
+// ListShareLinksHandler lists the user's share links.
+// @Summary      List share links
+// @Description  Lists the user's share links, including revoked, expired and used up ones, without their tokens.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]handler.ShareLinkInfo}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/share-links [get]
+func ListShareLinksHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		links, err := db.ListShareLinks(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list share links")
+			return
+		}
+		infos := make([]ShareLinkInfo, 0, len(links))
+		for _, l := range links {
+			infos = append(infos, shareLinkInfo(l))
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved share links", infos)
+	}
+}
+
+// RevokeShareLinkHandler revokes one of the user's share links.
+// @Summary      Revoke a share link
+// @Description  Stops the link from being redeemed. Revoking a revoked link does nothing.
+// @Tags         User
+// @Produce      json
+// @Param        id   path      int  true  "Share link ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/share-links/{id}/revoke [post]
+func RevokeShareLinkHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		id, ok := shareLinkIDParam(w, r)
+		if !ok {
+			return
+		}
+		if err := db.RevokeShareLink(r.Context(), user.ID, id); err != nil {
+			RespondWithStoreError(w, r, err, "Could not revoke share link")
+			return
+		}
+		recordShareLinkEvent(r, db, id, model.ShareLinkRevoked, "", 0)
+		RespondWithJSON(w, http.StatusOK, "Share link revoked successfully", nil)
+	}
+}
+
+// ListShareLinkEventsHandler returns the audit log of one of the user's share
+// links.
+// @Summary      List share link events
+// @Description  Lists when the link was created, redeemed (with the export format and the number of cookies handed out) and revoked, and every refused redemption with the reason, each with the client's address and user agent, oldest first.
+// @Tags         User
+// @Produce      json
+// @Param        id   path      int  true  "Share link ID"
+// @Success      200  {object}  handler.APIResponse{data=[]model.ShareLinkEvent}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /user/share-links/{id}/events [get]
+func ListShareLinkEventsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := ownUser(w, r)
+		if !ok {
+			return
+		}
+		id, ok := shareLinkIDParam(w, r)
+		if !ok {
+			return
+		}
+		events, err := db.ListShareLinkEvents(r.Context(), user.ID, id)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list share link events")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved share link events", events)
+	}
+}
+
+// RedeemShareLinkHandler hands out the cookies of a share link.
+// @Summary      Redeem a share link
+// @Description  Returns the cookies the link shares, as they are now, as a Netscape cookies.txt file (returned as a string) or a Playwright storage state (returned as an object). Needs no API key: the token is the credential. A link with a password needs it in the body.
+// @Description  Each redemption counts against the link's max_uses. A revoked, expired or used up link, or one whose owner is suspended, is 410 Gone. After 5 wrong passwords the link is locked for good and is 410 Gone as well. Every redemption and refusal is recorded in the link's audit log; a refusal repeating the latest entry only counts towards its repeats.
+// @Tags         Share
+// @Accept       json
+// @Produce      json
+// @Param        token  path      string                          true   "Share link token"
+// @Param        format query     string                          true   "Export format"  Enums(netscape, playwright)
+// @Param        body   body      handler.RedeemShareLinkRequest  false  "Password"
+// @Success      200    {object}  handler.APIResponse{data=object}
+// @Failure      400    {object}  handler.APIResponse
+// @Failure      401    {object}  handler.APIResponse
+// @Failure      404    {object}  handler.APIResponse
+// @Failure      410    {object}  handler.APIResponse
+// @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
+// @Router       /share/{token} [post]
+func RedeemShareLinkHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := export.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var payload RedeemShareLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			RespondWithDecodeError(w, err)
+			return
+		}
+
+		link, err := db.GetShareLinkByTokenHash(r.Context(), sharelink.Hash(chi.URLParam(r, "token")))
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Share link not found")
+			return
+		}
+		deny := func(status int, reason, message string) {
+			recordShareLinkEvent(r, db, link.ID, model.ShareLinkDenied, reason, 0)
+			RespondWithError(w, status, message)
+		}
+
+		if reason := sharelink.Inactive(link, time.Now()); reason != "" {
+			deny(http.StatusGone, reason, "Share link is "+strings.ReplaceAll(reason, "_", " "))
+			return
+		}
+		ok, err := sharelink.CheckPassword(link, payload.Password)
+		if err != nil {
+			log.Printf("[Share] Could not check password of share link %d: %v", link.ID, err)
+			RespondWithError(w, http.StatusInternalServerError, "Could not check password")
+			return
+		}
+		if !ok {
+			failed, err := db.FailShareLinkPassword(r.Context(), link.ID)
+			if err != nil {
+				RespondWithStoreError(w, r, err, "Could not check password")
+				return
+			}
+			message := "Wrong password"
+			if sharelink.Inactive(failed, time.Now()) == sharelink.ReasonLocked {
+				message += "; the share link is now locked"
+			}
+			deny(http.StatusUnauthorized, sharelink.ReasonWrongPassword, message)
+			return
+		}
+		if _, err := db.GetUserByID(r.Context(), link.UserID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				deny(http.StatusGone, sharelink.ReasonSuspended, "Share link owner is suspended")
+				return
+			}
+			RespondWithStoreError(w, r, err, "Could not get share link owner")
+			return
+		}
+
+		used, err := db.UseShareLink(r.Context(), link.ID, time.Now())
+		if err != nil {
+			if !errors.Is(err, store.ErrConflict) {
+				RespondWithStoreError(w, r, err, "Could not use share link")
+				return
+			}
+			// Another redemption took the last use, or the owner revoked the
+			// link, since it was read.
+			reason := sharelink.ReasonUsedUp
+			if current, err := db.GetShareLinkByTokenHash(r.Context(), link.TokenHash); err == nil {
+				if why := sharelink.Inactive(current, time.Now()); why != "" {
+					reason = why
+				}
+			}
+			deny(http.StatusGone, reason, "Share link is no longer usable")
+			return
+		}
+
+		// Fetch all of the owner's cookies: a domain link covers subdomains too.
+		cookies, err := db.GetCookiesByUserID(r.Context(), used.UserID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not fetch cookies")
+			return
+		}
+		cookies = sharelink.Filter(used, cookies)
+		rendered, err := export.Render(format, cookies)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not export cookies")
+			return
+		}
+		recordShareLinkEvent(r, db, link.ID, model.ShareLinkRedeemed, string(format), len(cookies))
+		RespondWithJSON(w, http.StatusOK, "Successfully redeemed share link", rendered)
+	}
+}
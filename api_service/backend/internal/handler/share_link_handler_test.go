@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/sharelink"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestShareLinks(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := db.CreateUsers(ctx, []string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := created[0]
+	cookies := []*model.Cookie{
+		{Domain: ".example.com", Name: "sid", Value: "1", Path: "/"},
+		{Domain: "mail.example.com", Name: "pref", Value: "2", Path: "/"},
+		{Domain: "other.org", Name: "sid", Value: "3", Path: "/"},
+	}
+	if err := db.SyncCookies(ctx, user.ID, cookies); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{ShareLinkTTL: time.Hour, ShareLinkMaxTTL: 24 * time.Hour}
+	r := chi.NewRouter()
+	r.With(AuthMiddleware(db)).Get("/user/share-links", ListShareLinksHandler(db))
+	r.With(AuthMiddleware(db)).Post("/user/share-links", CreateShareLinkHandler(db, cfg))
+	r.With(AuthMiddleware(db)).Post("/user/share-links/{id}/revoke", RevokeShareLinkHandler(db))
+	r.With(AuthMiddleware(db)).Get("/user/share-links/{id}/events", ListShareLinkEventsHandler(db))
+	r.Post("/share/{token}", RedeemShareLinkHandler(db))
+
+	do := func(method, path, body, apiKey string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", apiKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	create := func(body string) CreatedShareLinkResponse {
+		t.Helper()
+		rec := do(http.MethodPost, "/user/share-links", body, user.APIKey)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", body, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data CreatedShareLinkResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+	redeem := func(token, format, body string) (*httptest.ResponseRecorder, []string) {
+		t.Helper()
+		rec := do(http.MethodPost, "/share/"+token+"?format="+format, body, "")
+		if rec.Code != http.StatusOK || format != "playwright" {
+			return rec, nil
+		}
+		var resp struct {
+			Data struct {
+				Cookies []struct {
+					Domain string `json:"domain"`
+					Name   string `json:"name"`
+				} `json:"cookies"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range resp.Data.Cookies {
+			got = append(got, c.Domain+"/"+c.Name)
+		}
+		slices.Sort(got)
+		return rec, got
+	}
+	events := func(id int64, apiKey string) ([]model.ShareLinkEvent, int) {
+		t.Helper()
+		rec := do(http.MethodGet, "/user/share-links/"+strconv.FormatInt(id, 10)+"/events", "", apiKey)
+		var resp struct {
+			Data []model.ShareLinkEvent `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Data, rec.Code
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"domain":"example.com","max_uses":1001}`,
+		`{"domain":"example.com","expires_at":"2000-01-01T00:00:00Z"}`,
+		`{"domain":"example.com","expires_at":"` + time.Now().Add(48*time.Hour).Format(time.RFC3339) + `"}`,
+		`{"domain":"example.com","password":"` + strings.Repeat("x", sharelink.MaxPasswordBytes+1) + `"}`,
+	} {
+		if rec := do(http.MethodPost, "/user/share-links", body, user.APIKey); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	// A domain link with two uses hands out the domain and its subdomains.
+	link := create(`{"domain":"Example.com","max_uses":2}`)
+	if !strings.HasPrefix(link.Token, link.TokenPrefix) || link.Domain != "example.com" || link.MaxUses != 2 || link.HasPassword {
+		t.Errorf("created link %+v", link)
+	}
+	if rec, _ := redeem(link.Token, "xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, want 400", rec.Code)
+	}
+	if rec, _ := redeem("csl_nope", "netscape", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown token: status %d, want 404", rec.Code)
+	}
+	rec, got := redeem(link.Token, "playwright", "")
+	if want := []string{".example.com/sid", "mail.example.com/pref"}; rec.Code != http.StatusOK || !slices.Equal(got, want) {
+		t.Errorf("redeem: status %d, cookies %v, want %v", rec.Code, got, want)
+	}
+	if rec, _ := redeem(link.Token, "netscape", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "mail.example.com") {
+		t.Errorf("redeem as netscape: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec, _ := redeem(link.Token, "netscape", ""); rec.Code != http.StatusGone {
+		t.Errorf("third redemption of a two-use link: status %d, want 410", rec.Code)
+	}
+
+	logged, code := events(link.ID, user.APIKey)
+	var audit []string
+	for _, e := range logged {
+		audit = append(audit, e.Event+":"+e.Detail+":"+strconv.Itoa(e.CookieCount))
+	}
+	if want := []string{"created::0", "redeemed:playwright:2", "redeemed:netscape:2", "denied:used_up:0"}; code != http.StatusOK || !slices.Equal(audit, want) {
+		t.Errorf("events: status %d, %v, want %v", code, audit, want)
+	}
+	if _, code := events(link.ID, other.APIKey); code != http.StatusNotFound {
+		t.Errorf("another user's events: status %d, want 404", code)
+	}
+
+	// A names link with a password.
+	link = create(`{"names":["sid"," sid "],"password":"hunter2"}`)
+	if !slices.Equal(link.Names, []string{"sid"}) || !link.HasPassword {
+		t.Errorf("created link %+v", link)
+	}
+	if rec, _ := redeem(link.Token, "playwright", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no password: status %d, want 401", rec.Code)
+	}
+	if rec, _ := redeem(link.Token, "playwright", `{"password":"hunter3"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d, want 401", rec.Code)
+	}
+	rec, got = redeem(link.Token, "playwright", `{"password":"hunter2"}`)
+	if want := []string{".example.com/sid", "other.org/sid"}; rec.Code != http.StatusOK || !slices.Equal(got, want) {
+		t.Errorf("redeem with password: status %d, cookies %v, want %v", rec.Code, got, want)
+	}
+
+	// Wrong passwords lock the link for good, and the log folds them.
+	link = create(`{"domain":"example.com","max_uses":5,"password":"hunter2"}`)
+	for i := 1; i <= sharelink.MaxFailedAttempts; i++ {
+		rec, _ := redeem(link.Token, "playwright", `{"password":"guess`+strconv.Itoa(i)+`"}`)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("guess %d: status %d, want 401", i, rec.Code)
+		}
+	}
+	for range 2 {
+		if rec, _ := redeem(link.Token, "playwright", `{"password":"hunter2"}`); rec.Code != http.StatusGone {
+			t.Errorf("right password for a locked link: status %d, want 410", rec.Code)
+		}
+	}
+	logged, _ = events(link.ID, user.APIKey)
+	audit = nil
+	for _, e := range logged {
+		audit = append(audit, e.Event+":"+e.Detail+":"+strconv.Itoa(e.Repeats))
+	}
+	if want := []string{"created::0", "denied:wrong_password:4", "denied:locked:1"}; !slices.Equal(audit, want) {
+		t.Errorf("events of a locked link: %v, want %v", audit, want)
+	}
+
+	// Revoking.
+	link = create(`{"domain":"other.org","max_uses":5}`)
+	path := "/user/share-links/" + strconv.FormatInt(link.ID, 10) + "/revoke"
+	if rec := do(http.MethodPost, path, "", other.APIKey); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke another user's link: status %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPost, path, "", user.APIKey); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec, _ := redeem(link.Token, "netscape", ""); rec.Code != http.StatusGone {
+		t.Errorf("revoked link: status %d, want 410", rec.Code)
+	}
+
+	// The owner's suspension stops every link.
+	link = create(`{"domain":"example.com"}`)
+	if err := db.SuspendUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := redeem(link.Token, "netscape", ""); rec.Code != http.StatusGone {
+		t.Errorf("suspended owner's link: status %d, want 410", rec.Code)
+	}
+	links, err := db.ListShareLinks(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 5 || links[4].Uses != 0 || links[2].FailedAttempts != sharelink.MaxFailedAttempts {
+		t.Errorf("links %+v, want 5 with the locked one's failed attempts and the last one unused", links)
+	}
+}
@@ -1,12 +1,20 @@
 package handler
 
 import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/domainrule"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/poolhandle"
+	"cookie-syncer/api/internal/poolhealth"
 	"cookie-syncer/api/internal/store"
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"sort"
 	"strings"
+	"time"
 
 	"cookie-syncer/api/internal/model"
 
@@ -15,62 +23,115 @@ import (
 
 // UpdateUserSettingsHandler handles updating a user's sharing settings.
 // @Summary      Update user settings
-// @Description  Updates settings for the authenticated user, such as enabling or disabling cookie sharing.
+// @Description  Updates settings for the authenticated user: whether cookie sharing is enabled, the sharing rules that decide which sharable cookies the pool sees, and the domain rules that decide which cookies a sync may store. Only the settings present in the body are changed.
+// @Description  Domain rules have a type (exact, wildcard or regex) and a pattern. Wildcards match any characters with '*', and "*.example.com" matches example.com too; regexes (RE2) must match the whole domain. Domains are compared lower-case without a leading dot. A domain matching a deny rule is never synced; if there are allow rules, only domains matching one of them are. In "drop" mode (the default) other cookies are synced and the filtered ones reported; in "reject" mode the whole sync fails with 422.
+// @Description  Sharing rules use the same rule format: a domain matching a deny rule is never shared with the pool; if there are allow rules, only domains matching one of them are, whatever the cookies' is_sharable flags say.
 // @Tags         User
 // @Accept       json
 // @Produce      json
-// @Param        body body object{sharing_enabled=bool} true "Settings payload"
+// @Param        body body object{sharing_enabled=bool,sharing_rules=model.SharingRules,domain_rules=model.DomainRules} true "Settings payload"
+// @Param        x-team-id  header  int  false  "Update the settings of this team's vault instead (needs the owner role)"
 // @Success      200  {object}  handler.APIResponse
 // @Failure      400  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
 // @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
 // @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /user/settings [put]
 func UpdateUserSettingsHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := UserFromContext(r.Context())
-		if user == nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		user, ok := cookieOwner(w, r, model.TeamOwner)
+		if !ok {
 			return
 		}
 
 		var payload struct {
-			SharingEnabled bool `json:"sharing_enabled"`
+			SharingEnabled *bool               `json:"sharing_enabled"`
+			SharingRules   *model.SharingRules `json:"sharing_rules"`
+			DomainRules    *model.DomainRules  `json:"domain_rules"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			RespondWithDecodeError(w, err)
 			return
 		}
-
-		if err := db.UpdateUserSharing(user.ID, payload.SharingEnabled); err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not update user settings")
+		if payload.SharingEnabled == nil && payload.SharingRules == nil && payload.DomainRules == nil {
+			RespondWithError(w, http.StatusBadRequest, "No settings given, expected sharing_enabled, sharing_rules or domain_rules")
 			return
 		}
 
+		// Check everything before changing anything.
+		var sharingRules model.SharingRules
+		if payload.SharingRules != nil {
+			var err error
+			if sharingRules, err = domainrule.NormalizeSharing(*payload.SharingRules); err != nil {
+				RespondWithError(w, http.StatusBadRequest, "Invalid sharing rules: "+err.Error())
+				return
+			}
+		}
+		var rules model.DomainRules
+		if payload.DomainRules != nil {
+			var err error
+			if rules, err = domainrule.Normalize(*payload.DomainRules); err != nil {
+				RespondWithError(w, http.StatusBadRequest, "Invalid domain rules: "+err.Error())
+				return
+			}
+		}
+
+		// Narrow sharing before widening it, so that enabling sharing and
+		// restricting it in one request never exposes more than asked.
+		if payload.SharingRules != nil {
+			if err := db.UpdateUserSharingRules(r.Context(), user.ID, sharingRules); err != nil {
+				RespondWithStoreError(w, r, err, "Could not update user settings")
+				return
+			}
+		}
+		if payload.SharingEnabled != nil {
+			if err := db.UpdateUserSharing(r.Context(), user.ID, *payload.SharingEnabled); err != nil {
+				RespondWithStoreError(w, r, err, "Could not update user settings")
+				return
+			}
+		}
+		if payload.DomainRules != nil {
+			if err := db.UpdateUserDomainRules(r.Context(), user.ID, rules); err != nil {
+				RespondWithStoreError(w, r, err, "Could not update user settings")
+				return
+			}
+		}
+
 		RespondWithJSON(w, http.StatusOK, "User settings updated successfully", nil)
 	}
 }
 
 // GetUserSettingsHandler handles fetching a user's sharing settings.
 // @Summary      Get user settings
-// @Description  Retrieves settings for the authenticated user, such as whether cookie sharing is enabled.
+// @Description  Retrieves settings for the authenticated user: whether cookie sharing is enabled, the sharing rules applied to the pool and the domain rules applied to syncs.
 // @Tags         User
 // @Produce      json
-// @Success      200  {object}  handler.APIResponse{data=object{sharing_enabled=bool}}
+// @Param        x-team-id  header  int  false  "Get the settings of this team's vault instead (needs the reader role)"
+// @Success      200  {object}  handler.APIResponse{data=object{sharing_enabled=bool,sharing_rules=model.SharingRules,domain_rules=model.DomainRules}}
 // @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
 // @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /user/settings [get]
 func GetUserSettingsHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		user := UserFromContext(r.Context())
-		if user == nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		user, ok := cookieOwner(w, r, model.TeamReader)
+		if !ok {
 			return
 		}
 
-		RespondWithJSON(w, http.StatusOK, "Successfully retrieved user settings", map[string]bool{
+		rules := user.DomainRules
+		if rules.Mode == "" {
+			rules.Mode = model.DomainRulesDrop
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved user settings", map[string]any{
 			"sharing_enabled": user.SharingEnabled,
+			"sharing_rules":   user.SharingRules,
+			"domain_rules":    rules,
 		})
 	}
 }
@@ -78,27 +139,52 @@ func GetUserSettingsHandler(db store.Store) http.HandlerFunc {
 // GetSharableCookiesHandler handles fetching sharable cookies for a domain from the public pool.
 // @Summary      Get sharable cookies by domain
 // @Description  Retrieves all sharable cookies for a given domain from users who have opted into sharing.
-// @Description  This endpoint is protected by a dedicated Pool Access Key (`x-pool-key` header), not a user's API key.
+// @Description  This endpoint is protected by a pool client's key (`x-pool-key` header), not a user's API key. A client whose allowed domains do not cover the domain gets 403; a client over its rate limit gets 429.
 // @Description  By default, returns an array of strings, where each string is a user's cookies formatted as an HTTP 'Cookie' header.
-// @Description  Use `?format=json` to get a structured JSON response, where each element contains the user's ID and their list of cookies.
+// @Description  Use `?format=json` to get a structured JSON response, where each element contains a contributor handle and the contributor's cookies. Handles are pseudonyms: the same for a contributor every time this pool key asks about this domain, so they can be given to POST /pool/report, but different for other domains and other pool keys.
+// @Description  Sessions under an active lease (see POST /pool/leases) are left out until the lease ends.
+// @Description  Responses carry an ETag; send it back in If-None-Match to get 304 Not Modified when the pool is unchanged. There is no Last-Modified, as sharing changes alter the pool without a timestamp.
 // @Tags         Pool
 // @Produce      json
 // @Param        domain   path      string  true   "The domain to fetch cookies for"
 // @Param        format   query     string  false  "Output format"  Enums(json)
+// @Param        If-None-Match      header    string  false  "ETag from an earlier response"
 // @Success      200      {object}  handler.APIResponse{data=[]string} "Default response: Array of HTTP Cookie header strings"
-// @Success      200      {object}  handler.APIResponse{data=[]object{user_id=int,cookies=object}} "JSON response with `?format=json`"
+// @Success      200      {object}  handler.APIResponse{data=[]object{contributor=string,cookies=object}} "JSON response with `?format=json`"
+// @Header       200  {string}  ETag  "Hash of the response body"
+// @Success      304  "Not Modified"
 // @Failure      401      {object}  handler.APIResponse "Unauthorized"
+// @Failure      403      {object}  handler.APIResponse "Forbidden"
+// @Failure      429      {object}  handler.APIResponse "Too Many Requests"
 // @Failure      500      {object}  handler.APIResponse "Internal Server Error"
+// @Failure      503      {object}  handler.APIResponse "Service Unavailable"
 // @Security     PoolKeyAuth
 // @Router       /pool/cookies/{domain} [get]
-func GetSharableCookiesHandler(db store.Store) http.HandlerFunc {
+func GetSharableCookiesHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		domain := chi.URLParam(r, "domain")
-		allCookies, err := db.GetSharableCookiesByDomain(domain)
+		client := PoolClientFromContext(r.Context())
+		if client == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify pool client")
+			return
+		}
+		if !poolclient.Allows(client, domain) {
+			RespondWithError(w, http.StatusForbidden, "Forbidden: this pool key may not read "+domain)
+			return
+		}
+
+		allCookies, err := db.GetSharableCookiesByDomain(r.Context(), domain)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not fetch sharable cookies")
+			RespondWithStoreError(w, r, err, "Could not fetch sharable cookies")
 			return
 		}
+		// A leased session belongs to its lessee until the lease ends.
+		leasedIDs, err := db.ListLeasedUsers(r.Context(), domain)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not fetch sharable cookies")
+			return
+		}
+		allCookies = skipLeased(allCookies, leasedIDs)
 
 		// Group cookies by UserID
 		cookiesByUser := make(map[int64][]*model.Cookie)
@@ -106,19 +192,23 @@ func GetSharableCookiesHandler(db store.Store) http.HandlerFunc {
 			cookiesByUser[cookie.UserID] = append(cookiesByUser[cookie.UserID], cookie)
 		}
 
-		// Sort user IDs for consistent output order
+		// Sort by handle for a consistent output order that does not give
+		// away the order in which contributors signed up
+		handles := make(map[int64]string, len(cookiesByUser))
 		sortedUserIDs := make([]int64, 0, len(cookiesByUser))
 		for userID := range cookiesByUser {
+			handles[userID] = poolhandle.For(cfg.PoolHandleSecret, client.ID, domain, userID)
 			sortedUserIDs = append(sortedUserIDs, userID)
 		}
-		sort.Slice(sortedUserIDs, func(i, j int) bool { return sortedUserIDs[i] < sortedUserIDs[j] })
+		sort.Slice(sortedUserIDs, func(i, j int) bool { return handles[sortedUserIDs[i]] < handles[sortedUserIDs[j]] })
 
+		var sent bool
 		format := r.URL.Query().Get("format")
 		if format == "json" {
-			// JSON format: [{user_id: 1, cookies: {"domain": {"name": "value"}}}, ...]
+			// JSON format: [{contributor: "ctr_...", cookies: {"domain": {"name": "value"}}}, ...]
 			type userCookies struct {
-				UserID  int64                        `json:"user_id"`
-				Cookies map[string]map[string]string `json:"cookies"`
+				Contributor string                       `json:"contributor"`
+				Cookies     map[string]map[string]string `json:"cookies"`
 			}
 			var result []userCookies
 			for _, userID := range sortedUserIDs {
@@ -131,11 +221,11 @@ func GetSharableCookiesHandler(db store.Store) http.HandlerFunc {
 				}
 
 				result = append(result, userCookies{
-					UserID:  userID,
-					Cookies: domainMap,
+					Contributor: handles[userID],
+					Cookies:     domainMap,
 				})
 			}
-			RespondWithJSON(w, http.StatusOK, "Successfully retrieved sharable cookies", result)
+			sent = RespondWithJSONConditional(w, r, "Successfully retrieved sharable cookies", result, time.Time{})
 		} else {
 			// Default format: ["cookie1=v1; cookie2=v2", "cookieA=vA; cookieB=vB"]
 			var result []string
@@ -146,7 +236,63 @@ func GetSharableCookiesHandler(db store.Store) http.HandlerFunc {
 				}
 				result = append(result, strings.Join(cookieParts, "; "))
 			}
-			RespondWithJSON(w, http.StatusOK, "Successfully retrieved sharable cookies", result)
+			sent = RespondWithJSONConditional(w, r, "Successfully retrieved sharable cookies", result, time.Time{})
+		}
+
+		served := 0
+		if sent {
+			served = len(allCookies)
+			usage := make([]*model.PoolUsage, 0, len(sortedUserIDs))
+			for _, userID := range sortedUserIDs {
+				usage = append(usage, &model.PoolUsage{UserID: userID, Domain: poolhealth.NormalizeDomain(domain), Served: 1})
+			}
+			recordPoolUsage(r, db, usage...)
+		}
+		recordPoolClientUse(r, db, client, served)
+	}
+}
+
+// skipLeased drops the cookies of the users in leasedIDs.
+func skipLeased(cookies []*model.Cookie, leasedIDs []int64) []*model.Cookie {
+	if len(leasedIDs) == 0 {
+		return cookies
+	}
+	leased := make(map[int64]bool, len(leasedIDs))
+	for _, id := range leasedIDs {
+		leased[id] = true
+	}
+	free := make([]*model.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		if !leased[c.UserID] {
+			free = append(free, c)
 		}
 	}
+	return free
+}
+
+// recordPoolClientUse counts a request by client and the cookies it was
+// served. The legacy POOL_ACCESS_KEY client is not stored and not counted.
+func recordPoolClientUse(r *http.Request, db store.Store, client *model.PoolClient, cookiesServed int) {
+	if client.ID == 0 {
+		return
+	}
+	// The response is out; count it even if the client has gone away.
+	if err := db.RecordPoolClientUse(context.WithoutCancel(r.Context()), client.ID, cookiesServed); err != nil {
+		log.Printf("[Pool] Could not record use of pool client %d: %v", client.ID, err)
+	}
+}
+
+// recordPoolUsage adds usage to the contributors' statistics for the current
+// hour.
+func recordPoolUsage(r *http.Request, db store.Store, usage ...*model.PoolUsage) {
+	if len(usage) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, u := range usage {
+		u.Hour = now
+	}
+	if err := db.AddPoolUsage(context.WithoutCancel(r.Context()), usage); err != nil {
+		log.Printf("[Pool] Could not record pool usage: %v", err)
+	}
 }
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolclient"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSharingRulesSettings(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "pool-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SyncCookies(ctx, user.ID, []*model.Cookie{
+		{Domain: "example.com", Name: "a", Value: "1", Path: "/", IsSharable: true},
+		{Domain: "www.example.com", Name: "b", Value: "2", Path: "/", IsSharable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.With(AuthMiddleware(db)).Get("/user/settings", GetUserSettingsHandler(db))
+	r.With(AuthMiddleware(db)).Put("/user/settings", UpdateUserSettingsHandler(db))
+	r.With(PoolKeyAuthMiddleware(db, "pool-key", poolclient.NewLimiter())).Get("/pool/cookies/{domain}", GetSharableCookiesHandler(db, &config.Config{}))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", user.APIKey)
+		req.Header.Set("x-pool-key", "pool-key")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	pool := func() []string {
+		t.Helper()
+		rec := do(http.MethodGet, "/pool/cookies/example.com", "")
+		var resp struct {
+			Data []string `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	if rec := do(http.MethodPut, "/user/settings", `{"sharing_enabled":true,"sharing_rules":{"allow":[{"type":"bogus","pattern":"x"}]}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid sharing rules: status %d, want 400", rec.Code)
+	}
+	if got := pool(); len(got) != 0 {
+		t.Errorf("pool after a rejected settings update = %v, want empty (nothing may change)", got)
+	}
+
+	// Enabling sharing and restricting it in one request.
+	body := `{"sharing_enabled":true,"sharing_rules":{"allow":[{"type":"exact","pattern":"Example.com"}]}}`
+	if rec := do(http.MethodPut, "/user/settings", body); rec.Code != http.StatusOK {
+		t.Fatalf("updating settings: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := pool(); len(got) != 1 || got[0] != "a=1" {
+		t.Errorf("pool = %v, want only the example.com cookie", got)
+	}
+
+	var settings struct {
+		Data struct {
+			SharingEnabled bool               `json:"sharing_enabled"`
+			SharingRules   model.SharingRules `json:"sharing_rules"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(do(http.MethodGet, "/user/settings", "").Body).Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Data.SharingEnabled || len(settings.Data.SharingRules.Allow) != 1 || settings.Data.SharingRules.Allow[0].Pattern != "example.com" {
+		t.Errorf("settings = %+v, want sharing enabled with the normalized allow rule", settings.Data)
+	}
+}
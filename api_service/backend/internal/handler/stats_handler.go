@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/cachestore"
+	"net/http"
+)
+
+// AdminLockStatsHandler reports contention on the per-user sync locks.
+// @Summary      [Admin] Sync lock statistics
+// @Description  Returns counters for the per-user sync locks: which backend is in use, how many locks are held, how often a sync had to wait (for this process or for another replica), and how many waits timed out.
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=locker.Stats}
+// @Failure      403  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/stats/locks [get]
+func AdminLockStatsHandler(syncLocker locker.Locker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved lock statistics", syncLocker.Stats())
+	}
+}
+
+// AdminCacheStatsHandler reports how well the read cache is doing.
+// @Summary      [Admin] Read cache statistics
+// @Description  Returns hit, miss, error and invalidation counters for the cookie and pool read cache (configured with CACHE). The backend is "none" when caching is disabled.
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=cachestore.Stats}
+// @Failure      403  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/stats/cache [get]
+func AdminCacheStatsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := cachestore.Stats{Backend: "none"}
+		if cached, ok := db.(*cachestore.Store); ok {
+			stats = cached.CacheStats()
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved cache statistics", stats)
+	}
+}
@@ -1,60 +1,159 @@
 package handler
 
 import (
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/domainrule"
+	"cookie-syncer/api/internal/locker"
 	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/quota"
 	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/validate"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 )
 
 // SyncHandler handles the main data synchronization endpoint.
 // @Summary      Sync cookies
-// @Description  Receives a list of cookies from the browser extension. It then performs an atomic "replace" operation: all existing cookies for that user are deleted, and the new list is inserted. Finally, it returns the full updated list of cookies for the user.
+// @Description  Receives a list of cookies from the browser extension. It then performs an atomic "replace" operation: all existing cookies for that user are deleted, and the new list is inserted (if the list contains the same cookie more than once, the last one wins). The body may be gzip-compressed (Content-Encoding: gzip). Requests with more cookies than the configured MAX_SYNC_COOKIES, or a (decompressed) body larger than MAX_BODY_BYTES, are rejected with 413. Every cookie is normalized (domain lower-cased, empty path set to "/", same_site mapped to no_restriction, lax, strict or unspecified) and checked; if any is invalid, nothing is synced and a 422 lists each offending index with the field and reason. Cookies for domains the user's domain rules (see /user/settings) do not allow are dropped and listed in "filtered" by their index in the request, or, in reject mode, fail the sync with 422. A sync that would exceed the user's quota of cookies, bytes or distinct domains is rejected with 413 listing the exceeded limits. If another sync for the same user holds the lock for longer than SYNC_LOCK_TIMEOUT, the request fails with 503. Finally, it returns the full updated list of cookies for the user.
 // @Tags         Sync
 // @Accept       json
 // @Produce      json
 // @Param        cookies body      []model.Cookie  true  "List of cookies to sync"
-// @Success      200     {object}  handler.APIResponse{data=[]model.Cookie}
+// @Param        Content-Encoding  header  string  false  "Set to gzip when the body is gzip-compressed"  Enums(gzip)
+// @Param        x-team-id         header  int     false  "Sync into this team's vault instead (needs the editor role)"
+// @Success      200     {object}  handler.SyncResponse{data=[]model.Cookie}
 // @Failure      400     {object}  handler.APIResponse
 // @Failure      401     {object}  handler.APIResponse
+// @Failure      403     {object}  handler.APIResponse
+// @Failure      413     {object}  handler.APIResponse{data=[]quota.Violation}
+// @Failure      415     {object}  handler.APIResponse
+// @Failure      422     {object}  handler.APIResponse{data=[]validate.Problem}
 // @Failure      500     {object}  handler.APIResponse
+// @Failure      503     {object}  handler.APIResponse
 // @Security     ApiKeyAuth
 // @Router       /sync [post]
-func SyncHandler(db store.Store, locker *UserLockManager) http.HandlerFunc {
+func SyncHandler(db store.Store, syncLocker locker.Locker, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// The user is authenticated by the middleware at this point.
-		user := UserFromContext(r.Context())
-		if user == nil {
-			// This should theoretically not happen if middleware is set up correctly
-			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		// The user is authenticated by the middleware at this point; a
+		// request naming a team syncs into the team's vault.
+		user, ok := cookieOwner(w, r, model.TeamEditor)
+		if !ok {
 			return
 		}
 
 		// Lock this user's operations to prevent race conditions.
-		locker.Lock(user.ID)
-		defer locker.Unlock(user.ID)
+		if err := syncLocker.Lock(r.Context(), user.ID); err != nil {
+			switch {
+			case errors.Is(err, locker.ErrTimeout):
+				log.Printf("[Sync] User %d: %v", user.ID, err)
+				w.Header().Set("Retry-After", "1")
+				RespondWithError(w, http.StatusServiceUnavailable, "Another sync for this user is still running, try again later")
+			case r.Context().Err() == nil:
+				// The database-backed lockers can fail to reach the database.
+				log.Printf("[Sync] User %d: could not acquire sync lock: %v", user.ID, err)
+				w.Header().Set("Retry-After", "1")
+				RespondWithError(w, http.StatusServiceUnavailable, "Could not acquire sync lock")
+			}
+			// Otherwise the request was cancelled or timed out and nobody is listening.
+			return
+		}
+		defer syncLocker.Unlock(user.ID)
 
 		// 1. Decode JSON body into a slice of model.Cookie
 		var cookiesToSync []*model.Cookie
 		if err := json.NewDecoder(r.Body).Decode(&cookiesToSync); err != nil {
-			RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			RespondWithDecodeError(w, err)
+			return
+		}
+		if cfg.MaxSyncCookies > 0 && len(cookiesToSync) > cfg.MaxSyncCookies {
+			RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many cookies: %d exceeds the limit of %d per sync", len(cookiesToSync), cfg.MaxSyncCookies))
+			return
+		}
+		submitted := cookiesToSync
+		cookiesToSync, problems := validate.Cookies(cookiesToSync)
+		if len(problems) > 0 {
+			RespondWithJSON(w, http.StatusUnprocessableEntity, fmt.Sprintf("%d problems found in the submitted cookies, nothing was synced", len(problems)), problems)
+			return
+		}
+		filter, err := domainrule.NewFilter(user.DomainRules)
+		if err != nil {
+			log.Printf("[Sync] User %d: %v", user.ID, err)
+			RespondWithError(w, http.StatusInternalServerError, "Could not apply your domain rules")
+			return
+		}
+		cookiesToSync, filtered := filterCookies(filter, submitted, cookiesToSync)
+		if len(filtered) > 0 && filter.Rejects() {
+			RespondWithJSON(w, http.StatusUnprocessableEntity, fmt.Sprintf("%d cookies are not allowed by your domain rules, nothing was synced", len(filtered)), filtered)
+			return
+		}
+		// A sync replaces everything the user stores, so the submitted
+		// cookies are exactly what the quota applies to.
+		if exceeded := quota.Effective(defaultQuota(cfg), user.Quota).Check(quota.Measure(cookiesToSync)); len(exceeded) > 0 {
+			RespondWithJSON(w, http.StatusRequestEntityTooLarge, "Sync exceeds your quota, nothing was synced", exceeded)
 			return
 		}
 
 		// 2. Call db.SyncCookies to persist the data
-		if err := db.SyncCookies(user.ID, cookiesToSync); err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not sync cookies to database")
+		if err := db.SyncCookies(r.Context(), user.ID, cookiesToSync); err != nil {
+			RespondWithStoreError(w, r, err, "Could not sync cookies to database")
 			return
 		}
 
 		// 3. Fetch the latest full cookie list from the DB
-		latestCookies, err := db.GetCookiesByUserID(user.ID)
+		latestCookies, err := db.GetCookiesByUserID(r.Context(), user.ID)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not fetch latest cookies")
+			RespondWithStoreError(w, r, err, "Could not fetch latest cookies")
 			return
 		}
 
 		// 4. Encode the full list and return as JSON response
+		if len(filtered) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(SyncResponse{
+				APIResponse: APIResponse{
+					Code:    http.StatusOK,
+					Message: fmt.Sprintf("Sync successful, %d cookies were dropped by your domain rules", len(filtered)),
+					Data:    latestCookies,
+				},
+				Filtered: filtered,
+			})
+			return
+		}
 		RespondWithJSON(w, http.StatusOK, "Sync successful", latestCookies)
 	}
 }
+
+// SyncResponse is the response to a successful sync. Filtered lists the
+// submitted cookies that the user's domain rules dropped, by their index in
+// the request.
+type SyncResponse struct {
+	APIResponse
+	Filtered []validate.Problem `json:"filtered,omitempty"`
+}
+
+// filterCookies removes the cookies filter disallows from valid, the
+// validated form of submitted, and reports them by their index in submitted.
+func filterCookies(filter *domainrule.Filter, submitted, valid []*model.Cookie) ([]*model.Cookie, []validate.Problem) {
+	var filtered []validate.Problem
+	dropped := make(map[*model.Cookie]bool)
+	for i, c := range submitted {
+		if reason := filter.Check(c.Domain); reason != "" {
+			filtered = append(filtered, validate.Problem{Index: i, Field: "domain", Reason: reason})
+			dropped[c] = true
+		}
+	}
+	if len(dropped) == 0 {
+		return valid, nil
+	}
+	kept := make([]*model.Cookie, 0, len(valid))
+	for _, c := range valid {
+		if !dropped[c] {
+			kept = append(kept, c)
+		}
+	}
+	return kept, filtered
+}
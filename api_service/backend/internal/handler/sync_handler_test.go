@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store/memstore"
+	"cookie-syncer/api/internal/validate"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncHandlerLockTimeout(t *testing.T) {
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncLocker := locker.NewLocal(10 * time.Millisecond)
+	handler := AuthMiddleware(db)(SyncHandler(db, syncLocker, &config.Config{}))
+
+	sync := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/sync", strings.NewReader(`[{"domain":"a.com","name":"x","value":"1","path":"/"}]`))
+		req.Header.Set("x-api-key", user.APIKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := syncLocker.Lock(context.Background(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := sync(); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("sync while locked: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	syncLocker.Unlock(user.ID)
+
+	if rec := sync(); rec.Code != http.StatusOK {
+		t.Errorf("sync after unlock: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSyncRejectsInvalidCookies(t *testing.T) {
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := AuthMiddleware(db)(SyncHandler(db, locker.NewLocal(time.Second), &config.Config{}))
+
+	body := `[{"domain":"a.com","name":"ok","value":"1"},{"domain":"","name":"x"},{"domain":"a.com","name":"y","same_site":"sometimes"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sync", strings.NewReader(body))
+	req.Header.Set("x-api-key", user.APIKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data []validate.Problem `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Index != 1 || resp.Data[0].Field != "domain" || resp.Data[1].Index != 2 || resp.Data[1].Field != "same_site" {
+		t.Errorf("problems = %+v, want index 1 domain and index 2 same_site", resp.Data)
+	}
+	if cookies, _ := db.GetCookiesByUserID(context.Background(), user.ID); len(cookies) != 0 {
+		t.Errorf("%d cookies stored, want none after a rejected sync", len(cookies))
+	}
+}
+
+func TestSyncDomainRules(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateUserSharing(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	h := AuthMiddleware(db)
+	sync := h(SyncHandler(db, locker.NewLocal(time.Second), &config.Config{}))
+	getSettings := h(GetUserSettingsHandler(db))
+	putSettings := h(UpdateUserSettingsHandler(db))
+
+	do := func(handler http.Handler, method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set("x-api-key", user.APIKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(putSettings, http.MethodPut, `{"domain_rules":{"deny":[{"type":"regex","pattern":"("}]}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid regex: status %d, want 400", rec.Code)
+	}
+	if rec := do(putSettings, http.MethodPut, `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty settings: status %d, want 400", rec.Code)
+	}
+	rules := `{"domain_rules":{"deny":[{"type":"wildcard","pattern":"*.Bank.com"},{"type":"exact","pattern":"mail.example.com"}]}}`
+	if rec := do(putSettings, http.MethodPut, rules); rec.Code != http.StatusOK {
+		t.Fatalf("setting domain rules: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var settings struct {
+		Data struct {
+			SharingEnabled bool              `json:"sharing_enabled"`
+			DomainRules    model.DomainRules `json:"domain_rules"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(do(getSettings, http.MethodGet, "").Body).Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Data.SharingEnabled {
+		t.Error("setting only domain rules disabled sharing")
+	}
+	if r := settings.Data.DomainRules; r.Mode != "drop" || len(r.Deny) != 2 || r.Deny[0].Pattern != "*.bank.com" {
+		t.Errorf("domain rules = %+v, want drop mode and the normalized deny rules", r)
+	}
+
+	body := `[{"domain":"a.com","name":"x","value":"1"},{"domain":".www.bank.com","name":"s","value":"2"},{"domain":"mail.example.com","name":"m","value":"3"}]`
+	rec := do(sync, http.MethodPost, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sync in drop mode: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data     []model.Cookie     `json:"data"`
+		Filtered []validate.Problem `json:"filtered"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Domain != "a.com" {
+		t.Errorf("synced cookies = %+v, want only a.com", resp.Data)
+	}
+	if len(resp.Filtered) != 2 || resp.Filtered[0].Index != 1 || resp.Filtered[1].Index != 2 {
+		t.Errorf("filtered = %+v, want indexes 1 and 2", resp.Filtered)
+	}
+
+	if rec := do(putSettings, http.MethodPut, `{"domain_rules":{"mode":"reject","allow":[{"type":"exact","pattern":"a.com"}]}}`); rec.Code != http.StatusOK {
+		t.Fatalf("setting reject mode: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(sync, http.MethodPost, `[{"domain":"b.com","name":"y","value":"1"}]`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("sync in reject mode: status %d, want 422: %s", rec.Code, rec.Body)
+	}
+	if cookies, _ := db.GetCookiesByUserID(ctx, user.ID); len(cookies) != 1 || cookies[0].Domain != "a.com" {
+		t.Errorf("stored cookies after a rejected sync = %+v, want a.com unchanged", cookies)
+	}
+}
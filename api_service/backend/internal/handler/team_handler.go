@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/team"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxOwnedTeams is how many teams one user may own.
+const maxOwnedTeams = 10
+
+// TeamRequest defines the structure for creating a team.
+type TeamRequest struct {
+	Name string `json:"name"`
+}
+
+// TeamMemberRequest defines the structure for setting a member's role.
+type TeamMemberRequest struct {
+	Role string `json:"role" enums:"owner,editor,reader"`
+}
+
+// TeamInfo is a team with the user's role in it.
+type TeamInfo struct {
+	model.Team
+	Role string `json:"role"`
+}
+
+// teamMembership parses the {id} URL parameter and checks that the user is a
+// member of that team with at least the role need, writing the error response
+// if that fails. Teams the user is not a member of are not found.
+func teamMembership(w http.ResponseWriter, r *http.Request, db store.Store, need string) (*model.User, *model.TeamMember, bool) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+		return nil, nil, false
+	}
+	teamID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return nil, nil, false
+	}
+	member, err := db.GetTeamMember(r.Context(), teamID, user.ID)
+	if err != nil {
+		RespondWithStoreError(w, r, err, "Team not found")
+		return nil, nil, false
+	}
+	if !team.Allows(member.Role, need) {
+		RespondWithError(w, http.StatusForbidden, fmt.Sprintf("This needs the %s role in the team", need))
+		return nil, nil, false
+	}
+	return user, member, true
+}
+
+// memberIDParam parses the {userID} URL parameter, writing the error response
+// if that fails.
+func memberIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateTeamHandler creates a team owned by the user.
+// @Summary      Create a team
+// @Description  Creates a team with an empty cookie vault and makes the user its owner. Members sync into the vault and read it by sending the team's ID in the x-team-id header to POST /sync and the cookie endpoints: readers may read, editors may also sync, owners may also manage members. The vault has its own quota, which admins manage as that of the user vault_user_id, and its own settings, which owners change with x-team-id on PUT /user/settings. Endpoints for the user's own account, such as probes and share links, refuse x-team-id with 400. A user may own up to 10 teams.
+// @Tags         Teams
+// @Accept       json
+// @Produce      json
+// @Param        body body      handler.TeamRequest true "Team"
+// @Success      201  {object}  handler.APIResponse{data=handler.TeamInfo}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams [post]
+func CreateTeamHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := UserFromContext(r.Context())
+		if user == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+			return
+		}
+		var payload TeamRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		name, err := team.NormalizeName(payload.Name)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid team: "+err.Error())
+			return
+		}
+
+		memberships, err := db.ListUserTeams(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list teams")
+			return
+		}
+		owned := 0
+		for _, m := range memberships {
+			if m.Role == model.TeamOwner {
+				owned++
+			}
+		}
+		if owned >= maxOwnedTeams {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("A user may own at most %d teams", maxOwnedTeams))
+			return
+		}
+
+		t := model.Team{Name: name}
+		if err := db.CreateTeam(r.Context(), &t, user.ID); err != nil {
+			RespondWithStoreError(w, r, err, "Could not create team")
+			return
+		}
+		RespondWithJSON(w, http.StatusCreated, "Team created successfully", TeamInfo{Team: t, Role: model.TeamOwner})
+	}
+}
+
+// ListTeamsHandler lists the teams the user is a member of.
+// @Summary      List teams
+// @Description  Lists the teams the user is a member of, with the user's role in each.
+// @Tags         Teams
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]handler.TeamInfo}
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams [get]
+func ListTeamsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := UserFromContext(r.Context())
+		if user == nil {
+			RespondWithError(w, http.StatusInternalServerError, "Could not identify user")
+			return
+		}
+		memberships, err := db.ListUserTeams(r.Context(), user.ID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list teams")
+			return
+		}
+		teams := make([]TeamInfo, 0, len(memberships))
+		for _, m := range memberships {
+			t, err := db.GetTeam(r.Context(), m.TeamID)
+			if errors.Is(err, store.ErrNotFound) {
+				// Deleted since the memberships were read.
+				continue
+			}
+			if err != nil {
+				RespondWithStoreError(w, r, err, "Could not get team")
+				return
+			}
+			teams = append(teams, TeamInfo{Team: *t, Role: m.Role})
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved teams", teams)
+	}
+}
+
+// DeleteTeamHandler deletes a team the user owns.
+// @Summary      Delete a team
+// @Description  Deletes the team, its memberships and every cookie in its vault.
+// @Tags         Teams
+// @Produce      json
+// @Param        id   path      int  true  "Team ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams/{id} [delete]
+func DeleteTeamHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, member, ok := teamMembership(w, r, db, model.TeamOwner)
+		if !ok {
+			return
+		}
+		if err := db.DeleteTeam(r.Context(), member.TeamID); err != nil {
+			RespondWithStoreError(w, r, err, "Could not delete team")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Team deleted successfully", nil)
+	}
+}
+
+// ListTeamMembersHandler lists the members of a team the user belongs to.
+// @Summary      List team members
+// @Description  Lists the team's members and their roles. Any member may list them.
+// @Tags         Teams
+// @Produce      json
+// @Param        id   path      int  true  "Team ID"
+// @Success      200  {object}  handler.APIResponse{data=[]model.TeamMember}
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      401  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams/{id}/members [get]
+func ListTeamMembersHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, member, ok := teamMembership(w, r, db, model.TeamReader)
+		if !ok {
+			return
+		}
+		members, err := db.ListTeamMembers(r.Context(), member.TeamID)
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list team members")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved team members", members)
+	}
+}
+
+// SetTeamMemberHandler adds a member to a team or changes their role.
+// @Summary      Set a team member's role
+// @Description  Adds the user (by the user ID that GET /auth/test reports) to the team with the role, or changes their role. Only owners may do this. Demoting the last owner is refused with 409.
+// @Tags         Teams
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                        true  "Team ID"
+// @Param        userID path      int                        true  "User ID"
+// @Param        body   body      handler.TeamMemberRequest  true  "Role"
+// @Success      200    {object}  handler.APIResponse{data=model.TeamMember}
+// @Failure      400    {object}  handler.APIResponse
+// @Failure      401    {object}  handler.APIResponse
+// @Failure      403    {object}  handler.APIResponse
+// @Failure      404    {object}  handler.APIResponse
+// @Failure      409    {object}  handler.APIResponse
+// @Failure      413    {object}  handler.APIResponse
+// @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams/{id}/members/{userID} [put]
+func SetTeamMemberHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, owner, ok := teamMembership(w, r, db, model.TeamOwner)
+		if !ok {
+			return
+		}
+		userID, ok := memberIDParam(w, r)
+		if !ok {
+			return
+		}
+		var payload TeamMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			RespondWithDecodeError(w, err)
+			return
+		}
+		if !team.ValidRole(payload.Role) {
+			RespondWithError(w, http.StatusBadRequest, "Invalid role: must be owner, editor or reader")
+			return
+		}
+
+		member := model.TeamMember{TeamID: owner.TeamID, UserID: userID, Role: payload.Role}
+		if err := db.SetTeamMember(r.Context(), &member); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				RespondWithError(w, http.StatusConflict, "A team needs an owner")
+				return
+			}
+			RespondWithStoreError(w, r, err, "Could not set team member")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Team member set successfully", member)
+	}
+}
+
+// RemoveTeamMemberHandler removes a member from a team.
+// @Summary      Remove a team member
+// @Description  Removes the user from the team. Owners may remove anyone; any member may remove themselves to leave the team. Removing the last owner is refused with 409; delete the team instead.
+// @Tags         Teams
+// @Produce      json
+// @Param        id     path      int  true  "Team ID"
+// @Param        userID path      int  true  "User ID"
+// @Success      200    {object}  handler.APIResponse
+// @Failure      400    {object}  handler.APIResponse
+// @Failure      401    {object}  handler.APIResponse
+// @Failure      403    {object}  handler.APIResponse
+// @Failure      404    {object}  handler.APIResponse
+// @Failure      409    {object}  handler.APIResponse
+// @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
+// @Security     ApiKeyAuth
+// @Router       /teams/{id}/members/{userID} [delete]
+func RemoveTeamMemberHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, member, ok := teamMembership(w, r, db, model.TeamReader)
+		if !ok {
+			return
+		}
+		userID, ok := memberIDParam(w, r)
+		if !ok {
+			return
+		}
+		if userID != user.ID && member.Role != model.TeamOwner {
+			RespondWithError(w, http.StatusForbidden, fmt.Sprintf("This needs the %s role in the team", model.TeamOwner))
+			return
+		}
+		if err := db.RemoveTeamMember(r.Context(), member.TeamID, userID); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				RespondWithError(w, http.StatusConflict, "A team needs an owner")
+				return
+			}
+			RespondWithStoreError(w, r, err, "Could not remove team member")
+			return
+		}
+		RespondWithJSON(w, http.StatusOK, "Team member removed successfully", nil)
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTeams(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New("", "")
+	owner, err := db.EnsureDefaultUser("owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := db.CreateUsers(ctx, []string{"editor", "reader", "outsider"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor, reader, outsider := created[0], created[1], created[2]
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(AuthMiddleware(db))
+		r.Post("/sync", SyncHandler(db, locker.NewLocal(time.Second), &config.Config{}))
+		r.Get("/auth/test", AuthTestHandler)
+		r.Get("/cookies/{domain}", GetDomainCookiesHandler(db))
+		r.Get("/user/settings", GetUserSettingsHandler(db))
+		r.Put("/user/settings", UpdateUserSettingsHandler(db))
+		r.Get("/user/probes", ListUserProbesHandler(db))
+		r.Get("/user/share-links", ListShareLinksHandler(db))
+		r.Get("/teams", ListTeamsHandler(db))
+		r.Post("/teams", CreateTeamHandler(db))
+		r.Delete("/teams/{id}", DeleteTeamHandler(db))
+		r.Get("/teams/{id}/members", ListTeamMembersHandler(db))
+		r.Put("/teams/{id}/members/{userID}", SetTeamMemberHandler(db))
+		r.Delete("/teams/{id}/members/{userID}", RemoveTeamMemberHandler(db))
+	})
+
+	do := func(method, path, body string, user *model.User, team int64) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("x-api-key", user.APIKey)
+		if team != 0 {
+			req.Header.Set("x-team-id", fmt.Sprint(team))
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	cookieHeader := func(user *model.User, team int64) (string, int) {
+		t.Helper()
+		rec := do(http.MethodGet, "/cookies/example.com", "", user, team)
+		var resp struct {
+			Data string `json:"data"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Data, rec.Code
+	}
+
+	if rec := do(http.MethodPost, "/teams", `{"name":"  "}`, owner, 0); rec.Code != http.StatusBadRequest {
+		t.Errorf("create a team without a name: status %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPost, "/teams", `{"name":" Ops "}`, owner, 0)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create team: status %d: %s", rec.Code, rec.Body)
+	}
+	var team struct {
+		Data TeamInfo `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&team); err != nil {
+		t.Fatal(err)
+	}
+	if team.Data.Name != "Ops" || team.Data.Role != model.TeamOwner || team.Data.VaultUserID == 0 {
+		t.Errorf("created team %+v, want Ops owned by the user", team.Data)
+	}
+	id := team.Data.ID
+	members := fmt.Sprintf("/teams/%d/members/", id)
+
+	for _, m := range []struct {
+		user *model.User
+		role string
+	}{{editor, "editor"}, {reader, "reader"}} {
+		if rec := do(http.MethodPut, members+fmt.Sprint(m.user.ID), `{"role":"`+m.role+`"}`, owner, 0); rec.Code != http.StatusOK {
+			t.Fatalf("add %s: status %d: %s", m.role, rec.Code, rec.Body)
+		}
+	}
+	if rec := do(http.MethodPut, members+fmt.Sprint(outsider.ID), `{"role":"admin"}`, owner, 0); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: status %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPut, members+fmt.Sprint(team.Data.VaultUserID), `{"role":"reader"}`, owner, 0); rec.Code != http.StatusNotFound {
+		t.Errorf("add the vault: status %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPut, members+fmt.Sprint(outsider.ID), `{"role":"reader"}`, editor, 0); rec.Code != http.StatusForbidden {
+		t.Errorf("editor adds a member: status %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodGet, fmt.Sprintf("/teams/%d/members", id), "", outsider, 0); rec.Code != http.StatusNotFound {
+		t.Errorf("outsider lists members: status %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodGet, fmt.Sprintf("/teams/%d/members", id), "", reader, 0); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"role"`) != 3 {
+		t.Errorf("reader lists members: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Editors sync into the vault; readers only read it.
+	if rec := do(http.MethodPost, "/sync", `[{"domain":"example.com","name":"sid","value":"team","path":"/"}]`, editor, id); rec.Code != http.StatusOK {
+		t.Fatalf("editor syncs into the vault: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/sync", `[]`, reader, id); rec.Code != http.StatusForbidden {
+		t.Errorf("reader syncs into the vault: status %d, want 403", rec.Code)
+	}
+	if got, code := cookieHeader(reader, id); code != http.StatusOK || got != "sid=team" {
+		t.Errorf("reader reads the vault: status %d, %q, want sid=team", code, got)
+	}
+	if got, code := cookieHeader(editor, 0); code != http.StatusOK || got != "" {
+		t.Errorf("editor's own cookies: status %d, %q, want none", code, got)
+	}
+	if _, code := cookieHeader(outsider, id); code != http.StatusForbidden {
+		t.Errorf("outsider reads the vault: status %d, want 403", code)
+	}
+	if rec := do(http.MethodGet, "/cookies/example.com", "", reader, -1); rec.Code != http.StatusForbidden {
+		t.Errorf("unknown team: status %d, want 403", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/auth/test", nil)
+	req.Header.Set("x-api-key", reader.APIKey)
+	req.Header.Set("x-team-id", "ops")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed x-team-id: status %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/auth/test", "", reader, id); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"role":"reader"`) {
+		t.Errorf("auth test with a team: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Owners manage the vault's settings; endpoints for the user's own
+	// account refuse to act on a team.
+	denyBlocked := `{"domain_rules":{"deny":[{"type":"exact","pattern":"blocked.com"}]}}`
+	if rec := do(http.MethodPut, "/user/settings", denyBlocked, editor, id); rec.Code != http.StatusForbidden {
+		t.Errorf("editor changes the vault's settings: status %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/user/settings", denyBlocked, owner, id); rec.Code != http.StatusOK {
+		t.Fatalf("owner changes the vault's settings: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/user/settings", "", reader, id); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "blocked.com") {
+		t.Errorf("reader gets the vault's settings: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/user/settings", "", owner, 0); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "blocked.com") {
+		t.Errorf("owner's own settings: status %d: %s, want the vault's rules left out", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/sync", `[{"domain":"blocked.com","name":"a","value":"1","path":"/"}]`, editor, id); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "blocked.com") {
+		t.Errorf("sync of a denied domain into the vault: status %d: %s, want it reported as filtered", rec.Code, rec.Body)
+	}
+	for _, path := range []string{"/user/probes", "/user/share-links"} {
+		if rec := do(http.MethodGet, path, "", reader, id); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s with x-team-id: status %d, want 400", path, rec.Code)
+		}
+		if rec := do(http.MethodGet, path, "", reader, 0); rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+
+	// The last owner stays; members may leave.
+	if rec := do(http.MethodDelete, members+fmt.Sprint(owner.ID), "", owner, 0); rec.Code != http.StatusConflict {
+		t.Errorf("remove the last owner: status %d, want 409", rec.Code)
+	}
+	if rec := do(http.MethodDelete, members+fmt.Sprint(editor.ID), "", reader, 0); rec.Code != http.StatusForbidden {
+		t.Errorf("reader removes the editor: status %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodDelete, members+fmt.Sprint(reader.ID), "", reader, 0); rec.Code != http.StatusOK {
+		t.Errorf("reader leaves: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, code := cookieHeader(reader, id); code != http.StatusForbidden {
+		t.Errorf("former reader reads the vault: status %d, want 403", code)
+	}
+
+	if rec := do(http.MethodGet, "/teams", "", editor, 0); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"role":"editor"`) {
+		t.Errorf("editor lists teams: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, fmt.Sprintf("/teams/%d", id), "", editor, 0); rec.Code != http.StatusForbidden {
+		t.Errorf("editor deletes the team: status %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodDelete, fmt.Sprintf("/teams/%d", id), "", owner, 0); rec.Code != http.StatusOK {
+		t.Fatalf("delete team: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, code := cookieHeader(editor, id); code != http.StatusForbidden {
+		t.Errorf("vault of a deleted team: status %d, want 403", code)
+	}
+}
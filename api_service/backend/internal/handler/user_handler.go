@@ -5,6 +5,7 @@ import (
 	"cookie-syncer/api/internal/model"
 	"cookie-syncer/api/internal/store"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,13 +16,15 @@ import (
 // AdminUserResponse is a specific view of the User model for admin responses,
 // which includes the API key.
 type AdminUserResponse struct {
-	ID             int64      `json:"id"`
-	APIKey         string     `json:"api_key"`
-	Remark         *string    `json:"remark,omitempty"`
-	SharingEnabled bool       `json:"sharing_enabled"`
-	LastSyncedAt   *time.Time `json:"last_synced_at,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID             int64       `json:"id"`
+	APIKey         string      `json:"api_key"`
+	Remark         *string     `json:"remark,omitempty"`
+	SharingEnabled bool        `json:"sharing_enabled"`
+	LastSyncedAt   *time.Time  `json:"last_synced_at,omitempty"`
+	Quota          model.Quota `json:"quota"`
+	Suspended      bool        `json:"suspended"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
 }
 
 func toAdminUserResponse(user *model.User) AdminUserResponse {
@@ -31,6 +34,8 @@ func toAdminUserResponse(user *model.User) AdminUserResponse {
 		Remark:         user.Remark,
 		SharingEnabled: user.SharingEnabled,
 		LastSyncedAt:   user.LastSyncedAt,
+		Quota:          user.Quota,
+		Suspended:      user.DeletedAt.Valid,
 		CreatedAt:      user.CreatedAt,
 		UpdatedAt:      user.UpdatedAt,
 	}
@@ -53,8 +58,10 @@ func toAdminUserResponses(users []*model.User) []AdminUserResponse {
 // @Param        body body []object{remark=string} true "Array of users to create. Can be empty to create one default user."
 // @Success      201  {object}  handler.APIResponse{data=[]handler.AdminUserResponse} "Returns an array of created users including their new API keys."
 // @Failure      400  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
 // @Failure      403  {object}  handler.APIResponse
 // @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
 // @Security     AdminKeyAuth
 // @Router       /admin/users [post]
 func AdminCreateUsersHandler(db store.Store, cfg *config.Config) http.HandlerFunc {
@@ -69,6 +76,9 @@ func AdminCreateUsersHandler(db store.Store, cfg *config.Config) http.HandlerFun
 				usersToCreate = []struct {
 					Remark *string `json:"remark"`
 				}{{Remark: nil}}
+			} else if errors.As(err, new(*http.MaxBytesError)) {
+				RespondWithDecodeError(w, err)
+				return
 			} else {
 				RespondWithError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
 				return
@@ -88,9 +98,9 @@ func AdminCreateUsersHandler(db store.Store, cfg *config.Config) http.HandlerFun
 			remarks = append(remarks, "Default user")
 		}
 
-		createdUsers, err := db.CreateUsers(remarks)
+		createdUsers, err := db.CreateUsers(r.Context(), remarks)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not create users: "+err.Error())
+			RespondWithStoreError(w, r, err, "Could not create users: "+err.Error())
 			return
 		}
 
@@ -108,8 +118,11 @@ func AdminCreateUsersHandler(db store.Store, cfg *config.Config) http.HandlerFun
 // @Param        body body      object{remark=string} true "User details to update"
 // @Success      200  {object}  handler.APIResponse
 // @Failure      400  {object}  handler.APIResponse
+// @Failure      413  {object}  handler.APIResponse
 // @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
 // @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
 // @Security     AdminKeyAuth
 // @Router       /admin/users/{id} [put]
 func AdminUpdateUserHandler(db store.Store) http.HandlerFunc {
@@ -125,12 +138,12 @@ func AdminUpdateUserHandler(db store.Store) http.HandlerFunc {
 			Remark *string `json:"remark"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			RespondWithDecodeError(w, err)
 			return
 		}
 
-		if err := db.UpdateUserRemark(id, payload.Remark); err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not update user: "+err.Error())
+		if err := db.UpdateUserRemark(r.Context(), id, payload.Remark); err != nil {
+			RespondWithStoreError(w, r, err, "Could not update user: "+err.Error())
 			return
 		}
 
@@ -148,8 +161,11 @@ func AdminUpdateUserHandler(db store.Store) http.HandlerFunc {
 // @Param        body   body      object{remark=string} true "User details to update"
 // @Success      200    {object}  handler.APIResponse
 // @Failure      400    {object}  handler.APIResponse
+// @Failure      413    {object}  handler.APIResponse
 // @Failure      403    {object}  handler.APIResponse
+// @Failure      404    {object}  handler.APIResponse
 // @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
 // @Security     AdminKeyAuth
 // @Router       /admin/users/by-key/{apiKey} [put]
 func AdminUpdateUserByAPIKeyHandler(db store.Store) http.HandlerFunc {
@@ -160,12 +176,12 @@ func AdminUpdateUserByAPIKeyHandler(db store.Store) http.HandlerFunc {
 			Remark *string `json:"remark"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			RespondWithError(w, http.StatusBadRequest, "Invalid JSON body")
+			RespondWithDecodeError(w, err)
 			return
 		}
 
-		if err := db.UpdateUserRemarkByAPIKey(apiKey, payload.Remark); err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not update user: "+err.Error())
+		if err := db.UpdateUserRemarkByAPIKey(r.Context(), apiKey, payload.Remark); err != nil {
+			RespondWithStoreError(w, r, err, "Could not update user: "+err.Error())
 			return
 		}
 
@@ -182,7 +198,9 @@ func AdminUpdateUserByAPIKeyHandler(db store.Store) http.HandlerFunc {
 // @Success      200  {object}  handler.APIResponse{data=handler.AdminUserResponse}
 // @Failure      400  {object}  handler.APIResponse
 // @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
 // @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
 // @Security     AdminKeyAuth
 // @Router       /admin/users/{id}/refresh-key [post]
 func AdminRefreshUserAPIKeyHandler(db store.Store) http.HandlerFunc {
@@ -194,9 +212,9 @@ func AdminRefreshUserAPIKeyHandler(db store.Store) http.HandlerFunc {
 			return
 		}
 
-		updatedUser, err := db.AdminUpdateUserAPIKey(id)
+		updatedUser, err := db.AdminUpdateUserAPIKey(r.Context(), id)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not refresh API key: "+err.Error())
+			RespondWithStoreError(w, r, err, "Could not refresh API key: "+err.Error())
 			return
 		}
 
@@ -213,19 +231,76 @@ func AdminRefreshUserAPIKeyHandler(db store.Store) http.HandlerFunc {
 // @Success      200    {object}  handler.APIResponse{data=handler.AdminUserResponse}
 // @Failure      400    {object}  handler.APIResponse
 // @Failure      403    {object}  handler.APIResponse
+// @Failure      404    {object}  handler.APIResponse
 // @Failure      500    {object}  handler.APIResponse
+// @Failure      503    {object}  handler.APIResponse
 // @Security     AdminKeyAuth
 // @Router       /admin/users/by-key/{apiKey}/refresh-key [post]
 func AdminRefreshUserAPIKeyByAPIKeyHandler(db store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiKey := chi.URLParam(r, "apiKey")
 
-		updatedUser, err := db.AdminUpdateUserAPIKeyByAPIKey(apiKey)
+		updatedUser, err := db.AdminUpdateUserAPIKeyByAPIKey(r.Context(), apiKey)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Could not refresh API key: "+err.Error())
+			RespondWithStoreError(w, r, err, "Could not refresh API key: "+err.Error())
 			return
 		}
 
 		RespondWithJSON(w, http.StatusOK, "API key refreshed successfully", toAdminUserResponse(updatedUser))
 	}
 }
+
+// AdminListUsersHandler handles listing all users.
+// @Summary      [Admin] List users
+// @Description  Returns every user, including suspended ones, together with their API keys.
+// @Tags         Admin
+// @Produce      json
+// @Success      200  {object}  handler.APIResponse{data=[]handler.AdminUserResponse}
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/users [get]
+func AdminListUsersHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := db.ListUsers(r.Context())
+		if err != nil {
+			RespondWithStoreError(w, r, err, "Could not list users: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "Successfully retrieved users", toAdminUserResponses(users))
+	}
+}
+
+// AdminSuspendUserHandler handles suspending a user by ID.
+// @Summary      [Admin] Suspend user by ID
+// @Description  Suspends the specified user. A suspended user's API key is rejected by all authenticated endpoints.
+// @Tags         Admin
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  handler.APIResponse
+// @Failure      400  {object}  handler.APIResponse
+// @Failure      403  {object}  handler.APIResponse
+// @Failure      404  {object}  handler.APIResponse
+// @Failure      500  {object}  handler.APIResponse
+// @Failure      503  {object}  handler.APIResponse
+// @Security     AdminKeyAuth
+// @Router       /admin/users/{id}/suspend [post]
+func AdminSuspendUserHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		if err := db.SuspendUser(r.Context(), id); err != nil {
+			RespondWithStoreError(w, r, err, "Could not suspend user: "+err.Error())
+			return
+		}
+
+		RespondWithJSON(w, http.StatusOK, "User suspended successfully", nil)
+	}
+}
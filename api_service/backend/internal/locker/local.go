@@ -0,0 +1,145 @@
+package locker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Local provides an in-process lock for each user. A user's lock only exists
+// while someone holds or waits for it, so memory use is bounded by the number
+// of concurrent requests rather than the number of users ever seen. It only
+// protects a single server process; see Locker for multi-replica setups.
+type Local struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	locks map[int64]*userLock
+
+	acquired  atomic.Uint64
+	contended atomic.Uint64
+	timedOut  atomic.Uint64
+	cancelled atomic.Uint64
+	waitNanos atomic.Int64
+	maxWait   atomic.Int64
+}
+
+// userLock is a one-slot semaphore: whoever managed to send into sem holds
+// the lock. refs counts holders and waiters and is guarded by Local.mu.
+type userLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// NewLocal creates an in-process locker. Lock gives up after timeout; zero or
+// a negative value means it only stops when its context is done.
+func NewLocal(timeout time.Duration) *Local {
+	return &Local{
+		timeout: timeout,
+		locks:   make(map[int64]*userLock),
+	}
+}
+
+// Lock acquires the lock for a specific user ID. It returns ErrTimeout if the
+// locker's timeout expires first, or ctx's error if ctx is done first.
+func (m *Local) Lock(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	l, ok := m.locks[userID]
+	if !ok {
+		l = &userLock{sem: make(chan struct{}, 1)}
+		m.locks[userID] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	// Fast path: the lock is free.
+	select {
+	case l.sem <- struct{}{}:
+		m.acquired.Add(1)
+		return nil
+	default:
+	}
+
+	m.contended.Add(1)
+	waitCtx := ctx
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	select {
+	case l.sem <- struct{}{}:
+		m.recordWait(time.Since(start))
+		m.acquired.Add(1)
+		return nil
+	case <-waitCtx.Done():
+		m.recordWait(time.Since(start))
+		m.release(userID, l)
+		if ctx.Err() != nil {
+			m.cancelled.Add(1)
+			return ctx.Err()
+		}
+		m.timedOut.Add(1)
+		return ErrTimeout
+	}
+}
+
+// Unlock releases the lock for a specific user ID. It must only be called
+// after a successful Lock.
+func (m *Local) Unlock(userID int64) {
+	m.mu.Lock()
+	l, ok := m.locks[userID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	<-l.sem
+	m.release(userID, l)
+}
+
+// release drops one reference and forgets the lock once nobody uses it.
+func (m *Local) release(userID int64, l *userLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(m.locks, userID)
+	}
+}
+
+func (m *Local) recordWait(d time.Duration) {
+	m.waitNanos.Add(int64(d))
+	for {
+		current := m.maxWait.Load()
+		if int64(d) <= current || m.maxWait.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the locker's counters.
+func (m *Local) Stats() Stats {
+	m.mu.Lock()
+	active, waiting := len(m.locks), 0
+	for _, l := range m.locks {
+		// refs counts the holder, if any, plus the waiters.
+		waiting += l.refs - len(l.sem)
+	}
+	m.mu.Unlock()
+
+	return Stats{
+		Backend:     "local",
+		ActiveLocks: active,
+		Waiting:     waiting,
+		Acquired:    m.acquired.Load(),
+		Contended:   m.contended.Load(),
+		TimedOut:    m.timedOut.Load(),
+		Cancelled:   m.cancelled.Load(),
+		TotalWaitMS: float64(m.waitNanos.Load()) / float64(time.Millisecond),
+		MaxWaitMS:   float64(m.maxWait.Load()) / float64(time.Millisecond),
+		TimeoutMS:   m.timeout.Milliseconds(),
+	}
+}
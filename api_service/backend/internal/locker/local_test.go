@@ -0,0 +1,118 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocalMutualExclusion(t *testing.T) {
+	m := NewLocal(0)
+	var inside atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Lock(context.Background(), 1); err != nil {
+				t.Error(err)
+				return
+			}
+			if n := inside.Add(1); n != 1 {
+				t.Errorf("%d goroutines inside the lock", n)
+			}
+			time.Sleep(time.Millisecond)
+			inside.Add(-1)
+			m.Unlock(1)
+		}()
+	}
+	wg.Wait()
+
+	stats := m.Stats()
+	if stats.Acquired != 50 {
+		t.Errorf("acquired = %d, want 50", stats.Acquired)
+	}
+	if stats.ActiveLocks != 0 || stats.Waiting != 0 {
+		t.Errorf("idle manager reports %d active locks and %d waiters", stats.ActiveLocks, stats.Waiting)
+	}
+}
+
+func TestLocalEvictsIdleLocks(t *testing.T) {
+	m := NewLocal(time.Second)
+	for id := int64(1); id <= 1000; id++ {
+		if err := m.Lock(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+		m.Unlock(id)
+	}
+	if n := m.Stats().ActiveLocks; n != 0 {
+		t.Errorf("%d locks left after all users unlocked", n)
+	}
+}
+
+func TestLocalUsersAreIndependent(t *testing.T) {
+	m := NewLocal(10 * time.Millisecond)
+	if err := m.Lock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Unlock(1)
+	if err := m.Lock(context.Background(), 2); err != nil {
+		t.Fatalf("locking another user: %v", err)
+	}
+	m.Unlock(2)
+	if n := m.Stats().Contended; n != 0 {
+		t.Errorf("contended = %d, want 0", n)
+	}
+}
+
+func TestLocalTimeout(t *testing.T) {
+	m := NewLocal(20 * time.Millisecond)
+	if err := m.Lock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Lock(context.Background(), 1)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("second Lock returned %v, want ErrTimeout", err)
+	}
+	stats := m.Stats()
+	if stats.Contended != 1 || stats.TimedOut != 1 || stats.MaxWaitMS < 20 {
+		t.Errorf("stats = %+v, want one contended wait of at least 20ms that timed out", stats)
+	}
+
+	m.Unlock(1)
+	if err := m.Lock(context.Background(), 1); err != nil {
+		t.Fatalf("Lock after Unlock: %v", err)
+	}
+	m.Unlock(1)
+	if n := m.Stats().ActiveLocks; n != 0 {
+		t.Errorf("%d locks left after a timed-out wait", n)
+	}
+}
+
+func TestLocalCancel(t *testing.T) {
+	m := NewLocal(0)
+	if err := m.Lock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Unlock(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Lock(ctx, 1) }()
+
+	time.Sleep(10 * time.Millisecond)
+	if n := m.Stats().Waiting; n != 1 {
+		t.Errorf("waiting = %d, want 1", n)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Lock returned %v, want context.Canceled", err)
+	}
+	if n := m.Stats().Cancelled; n != 1 {
+		t.Errorf("cancelled = %d, want 1", n)
+	}
+}
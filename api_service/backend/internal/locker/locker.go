@@ -0,0 +1,41 @@
+// Package locker serialises concurrent syncs of the same user.
+package locker
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTimeout is returned by Locker.Lock when the lock could not be acquired
+// within the locker's timeout.
+var ErrTimeout = errors.New("timed out waiting for the user's sync lock")
+
+// Locker hands out one exclusive lock per user. Local is the in-process
+// default; the database-backed lockers in gormstore extend it across server
+// replicas that share a database.
+type Locker interface {
+	// Lock blocks until the user's lock is held, the locker's timeout expires
+	// (ErrTimeout) or ctx is done (ctx's error).
+	Lock(ctx context.Context, userID int64) error
+	// Unlock releases a lock taken by a successful Lock.
+	Unlock(userID int64)
+	// Stats returns a snapshot of the locker's counters.
+	Stats() Stats
+}
+
+// Stats describes lock usage since the locker was created.
+type Stats struct {
+	Backend         string  `json:"backend"`          // local, postgres, mysql or sqlite
+	ActiveLocks     int     `json:"active_locks"`     // users with a holder or waiters in this process right now
+	Waiting         int     `json:"waiting"`          // requests in this process currently waiting for a lock
+	Acquired        uint64  `json:"acquired"`         // locks acquired
+	Contended       uint64  `json:"contended"`        // acquisitions that had to wait for this process
+	RemoteContended uint64  `json:"remote_contended"` // acquisitions that had to wait for another replica
+	TimedOut        uint64  `json:"timed_out"`        // waits that hit the timeout
+	Cancelled       uint64  `json:"cancelled"`        // waits abandoned by the caller
+	TotalWaitMS     float64 `json:"total_wait_ms"`    // time spent waiting in this process, in milliseconds
+	MaxWaitMS       float64 `json:"max_wait_ms"`      // longest single wait in this process, in milliseconds
+	TimeoutMS       int64   `json:"timeout_ms"`       // configured wait limit, 0 for none
+}
+
+var _ Locker = (*Local)(nil)
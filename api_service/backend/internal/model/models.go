@@ -12,10 +12,58 @@ type User struct {
 	Remark      *string        `json:"remark,omitempty" gorm:"type:text"`
 	SharingEnabled bool         `json:"sharing_enabled" gorm:"default:false;not null"`
 	LastSyncedAt *time.Time    `json:"last_synced_at,omitempty"`
+	Quota       Quota          `json:"quota" gorm:"embedded;embeddedPrefix:quota_"`
+	DomainRules DomainRules    `json:"domain_rules" gorm:"serializer:json"`
+	SharingRules SharingRules  `json:"sharing_rules" gorm:"serializer:json"`
+	TeamID      *int64         `json:"team_id,omitempty" gorm:"index"` // the team whose vault this user is, nil for people
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"` // For soft deletes
-	CookiesJSON *string        `json:"-" gorm:"type:text"` // Stores cookies as a JSON blob
+}
+
+// Quota holds a user's overrides of the server-wide quota. A nil limit falls
+// back to the server default; 0 means unlimited.
+type Quota struct {
+	MaxCookies *int64 `json:"max_cookies"` // cookies stored
+	MaxBytes   *int64 `json:"max_bytes"`   // total size of domains, names, values and paths
+	MaxDomains *int64 `json:"max_domains"` // distinct cookie domains
+}
+
+// Domain rule types.
+const (
+	DomainRuleExact    = "exact"    // the domain itself
+	DomainRuleWildcard = "wildcard" // '*' matches any characters; "*.example.com" also matches example.com
+	DomainRuleRegex    = "regex"    // an RE2 expression that must match the whole domain
+)
+
+// What a sync does with cookies the domain rules do not allow.
+const (
+	DomainRulesDrop   = "drop"   // sync the remaining cookies and report the dropped ones
+	DomainRulesReject = "reject" // sync nothing and report the offending cookies
+)
+
+// DomainRule matches cookie domains. Domains are compared lower-case and
+// without a leading dot.
+type DomainRule struct {
+	Type    string `json:"type" enums:"exact,wildcard,regex"`
+	Pattern string `json:"pattern"`
+}
+
+// DomainRules decide which cookie domains a user's syncs may store. A domain
+// matching a deny rule is never stored; if there are allow rules, a domain
+// must also match one of them.
+type DomainRules struct {
+	Mode  string       `json:"mode" enums:"drop,reject"` // empty means drop
+	Allow []DomainRule `json:"allow"`
+	Deny  []DomainRule `json:"deny"`
+}
+
+// SharingRules narrow which of a user's sharable cookies the pool sees. A
+// domain matching a deny rule is never shared; if there are allow rules, a
+// domain must also match one of them.
+type SharingRules struct {
+	Allow []DomainRule `json:"allow"`
+	Deny  []DomainRule `json:"deny"`
 }
 
 // Cookie represents a cookie synced by a user.
@@ -23,6 +71,7 @@ type Cookie struct {
 	ID                         int64      `json:"id" gorm:"primaryKey"`
 	UserID                     int64      `json:"user_id" gorm:"uniqueIndex:idx_cookie_key,priority:1;not null"`
 	Domain                     string     `json:"domain" gorm:"uniqueIndex:idx_cookie_key,priority:2;not null"`
+	DomainKey                  string     `json:"-" gorm:"index;not null"` // Reversed domain labels used for suffix lookups, e.g. "com.example"
 	Name                       string     `json:"name" gorm:"uniqueIndex:idx_cookie_key,priority:3;not null"`
 	Value                      string     `json:"value" gorm:"type:text;not null"`
 	Path                       string     `json:"path" gorm:"uniqueIndex:idx_cookie_key,priority:4;not null"`
@@ -43,3 +92,216 @@ func (User) TableName() string {
 func (Cookie) TableName() string {
 	return "cookies"
 }
+
+// PoolClient is a consumer of the cookie pool with its own key. The key
+// itself is only shown when the client is created; the server keeps its
+// SHA-256 hash.
+type PoolClient struct {
+	ID             int64      `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name" gorm:"not null"`
+	KeyHash        string     `json:"-" gorm:"uniqueIndex;not null"`
+	KeyPrefix      string     `json:"key_prefix" gorm:"not null"`             // start of the key, to tell keys apart
+	AllowedDomains []string   `json:"allowed_domains" gorm:"serializer:json"` // domains (with their subdomains) the client may read; empty for all
+	RateLimit      int        `json:"rate_limit" gorm:"not null;default:0"`   // requests per minute, 0 for no limit
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	RequestCount   int64      `json:"request_count" gorm:"not null;default:0"`
+	CookiesServed  int64      `json:"cookies_served" gorm:"not null;default:0"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// How a pool lease ended.
+const (
+	LeaseReleased = "released" // returned by the client
+	LeaseBad      = "bad"      // returned by the client as not working
+	LeaseExpired  = "expired"  // not returned in time
+)
+
+// PoolLease checks out one contributor's session for a domain to one pool
+// client until ExpiresAt. While it is active, the session is not leased to
+// anyone else.
+type PoolLease struct {
+	ID         int64      `json:"id" gorm:"primaryKey"`
+	ClientID   int64      `json:"client_id" gorm:"index;not null"`
+	UserID     int64      `json:"user_id" gorm:"not null"`
+	Domain     string     `json:"domain" gorm:"not null"`
+	ActiveKey  *string    `json:"-" gorm:"uniqueIndex"` // "<user ID>:<site>" while active, so a session has one active lease
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	Outcome    string     `json:"outcome,omitempty" enums:"released,bad,expired"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// What a pool consumer reports about a session.
+const (
+	SessionInvalid     = "invalid"      // logged out or otherwise rejected upstream
+	SessionRateLimited = "rate_limited" // throttled upstream
+)
+
+// PoolSessionHealth counts the pool clients that recently reported failures
+// with one contributor's session for a domain, and whether they keep it out
+// of the pool.
+type PoolSessionHealth struct {
+	ID               int64      `json:"id" gorm:"primaryKey"`
+	UserID           int64      `json:"user_id" gorm:"uniqueIndex:idx_pool_session_health_user_domain;not null"`
+	Domain           string     `json:"domain" gorm:"uniqueIndex:idx_pool_session_health_user_domain;not null"`
+	Failures         int        `json:"failures" gorm:"not null;default:0"` // distinct clients reporting within the window
+	LastReason       string     `json:"last_reason" enums:"invalid,rate_limited"`
+	LastReportedAt   time.Time  `json:"last_reported_at"`
+	QuarantinedAt    *time.Time `json:"quarantined_at,omitempty"`
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"` // empty while quarantined: until the cookies change
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the PoolSessionHealth model.
+func (PoolSessionHealth) TableName() string {
+	return "pool_session_health"
+}
+
+// PoolSessionReport is the latest failure one pool client reported with a
+// contributor's session for a domain.
+type PoolSessionReport struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	UserID     int64     `json:"user_id" gorm:"uniqueIndex:idx_pool_session_reports_session_client;not null"`
+	Domain     string    `json:"domain" gorm:"uniqueIndex:idx_pool_session_reports_session_client;not null"`
+	ClientID   int64     `json:"client_id" gorm:"uniqueIndex:idx_pool_session_reports_session_client;not null"` // 0 for the shared pool key
+	Reason     string    `json:"reason" enums:"invalid,rate_limited"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// SessionProbe checks whether the sessions for a domain still work by
+// requesting URL with their cookies. A user's probe checks the user's own
+// cookies; an admin's probe (UserID 0) checks every session shared in the
+// pool.
+type SessionProbe struct {
+	ID            int64     `json:"id" gorm:"primaryKey"`
+	UserID        int64     `json:"user_id" gorm:"index;not null;default:0"` // owner, 0 for an admin probe of the pool
+	Domain        string    `json:"domain" gorm:"not null"`
+	URL           string    `json:"url" gorm:"not null"`
+	ExpectStatus  int       `json:"expect_status" gorm:"not null;default:200"`
+	BodyRegex     string    `json:"body_regex,omitempty"`     // the body must match it
+	LoginRedirect string    `json:"login_redirect,omitempty"` // a redirect to a Location matching it means logged out
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// How a probe of a session went.
+const (
+	ProbeOK      = "ok"      // the session works
+	ProbeExpired = "expired" // the response showed the session no longer works
+	ProbeError   = "error"   // the probe failed without telling either way
+)
+
+// PoolUsage counts how pool clients used one contributor's session for a
+// domain during one hour.
+type PoolUsage struct {
+	ID          int64     `json:"-" gorm:"primaryKey"`
+	Hour        time.Time `json:"hour" gorm:"uniqueIndex:idx_pool_usage_hour_user_domain;not null"` // start of the hour, in UTC
+	UserID      int64     `json:"user_id" gorm:"uniqueIndex:idx_pool_usage_hour_user_domain;index;not null"`
+	Domain      string    `json:"domain" gorm:"uniqueIndex:idx_pool_usage_hour_user_domain;not null"`
+	Served      int64     `json:"served" gorm:"not null;default:0"`       // pool reads that returned the session
+	Leased      int64     `json:"leased" gorm:"not null;default:0"`       // leases of the session
+	ReportedBad int64     `json:"reported_bad" gorm:"not null;default:0"` // failure reports, including leases returned as bad
+}
+
+// TableName specifies the table name for the PoolUsage model.
+func (PoolUsage) TableName() string {
+	return "pool_usage"
+}
+
+// PoolSession is one contributor's shared cookies for one cookie domain. It
+// is not stored, but listed from the cookies.
+type PoolSession struct {
+	UserID       int64      `json:"-"`
+	Domain       string     `json:"domain"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"` // the contributor's latest sync
+}
+
+// ProbeResult is the latest result of a probe for one user's session.
+type ProbeResult struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	ProbeID    int64     `json:"probe_id" gorm:"uniqueIndex:idx_probe_results_probe_user;not null"`
+	UserID     int64     `json:"user_id" gorm:"uniqueIndex:idx_probe_results_probe_user;index;not null"`
+	Domain     string    `json:"domain" gorm:"not null"`
+	Outcome    string    `json:"outcome" gorm:"not null" enums:"ok,expired,error"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Detail     string    `json:"detail,omitempty"` // why the session is expired, or the error
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// ShareLink hands some of a user's cookies to whoever holds its token, a
+// limited number of times until it expires. The token itself is only shown
+// when the link is created; the server keeps its SHA-256 hash, and a bcrypt
+// hash of the optional password.
+
+type ShareLink struct {
+	ID             int64      `json:"id" gorm:"primaryKey"`
+	UserID         int64      `json:"-" gorm:"index;not null"`
+	TokenHash      string     `json:"-" gorm:"uniqueIndex;not null"`
+	TokenPrefix    string     `json:"token_prefix" gorm:"not null"`           // start of the token, to tell links apart
+	Domain         string     `json:"domain,omitempty"`                       // the domain (with its subdomains) shared, empty for every domain
+	Names          []string   `json:"names,omitempty" gorm:"serializer:json"` // the cookie names shared, empty for every name
+	PasswordHash   string     `json:"-"`
+	MaxUses        int        `json:"max_uses" gorm:"not null"`
+	Uses           int        `json:"uses" gorm:"not null;default:0"`
+	FailedAttempts int        `json:"failed_attempts" gorm:"not null;default:0"` // wrong passwords given
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// What happened to a share link.
+const (
+	ShareLinkCreated  = "created"
+	ShareLinkRedeemed = "redeemed"
+	ShareLinkDenied   = "denied" // a redemption was refused, see the event's detail
+	ShareLinkRevoked  = "revoked"
+)
+
+// ShareLinkEvent is one entry in a share link's audit log. Denials repeating
+// the latest entry are folded into it rather than logged again.
+
+type ShareLinkEvent struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	LinkID      int64      `json:"link_id" gorm:"index;not null"`
+	Event       string     `json:"event" gorm:"not null" enums:"created,redeemed,denied,revoked"`
+	Detail      string     `json:"detail,omitempty"`       // why a redemption was denied, or the export format of one
+	CookieCount int        `json:"cookie_count,omitempty"` // cookies handed out by a redemption
+	RemoteAddr  string     `json:"remote_addr,omitempty"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+	Repeats     int        `json:"repeats,omitempty" gorm:"not null;default:0"` // further identical denials folded into this entry
+	LastAt      *time.Time `json:"last_at,omitempty"`                           // when the last of them happened
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Team member roles, from least to most privileged.
+const (
+	TeamReader = "reader" // reads the team's cookies
+	TeamEditor = "editor" // also syncs into the vault
+	TeamOwner  = "owner"  // also manages members and deletes the team
+)
+
+// Team is a group of users sharing a cookie vault. The vault is a user of
+// its own (VaultUserID, with TeamID set) that cannot sign in; members read
+// and sync its cookies by naming the team in the x-team-id header, so
+// quotas, domain rules and sync locks apply to the vault as to anyone.
+type Team struct {
+	ID          int64     `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null"`
+	VaultUserID int64     `json:"vault_user_id" gorm:"uniqueIndex;not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TeamMember gives a user a role in a team.
+type TeamMember struct {
+	TeamID    int64     `json:"team_id" gorm:"primaryKey"`
+	UserID    int64     `json:"user_id" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"not null" enums:"owner,editor,reader"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
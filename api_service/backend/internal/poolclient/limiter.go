@@ -0,0 +1,54 @@
+package poolclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter enforces the clients' per-minute rate limits with a token bucket
+// per client, so a client may spend a minute's worth of requests in a burst.
+// Buckets live in this process: with several replicas behind a load
+// balancer, a client gets up to its limit from each.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter with full buckets.
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[int64]*bucket)}
+}
+
+// Allow takes a token from the client's bucket. If there is none, it
+// returns false and how long until there is. A perMinute of 0 or less means
+// no limit.
+func (l *Limiter) Allow(clientID int64, perMinute int, now time.Time) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	capacity := float64(perMinute)
+	perSecond := capacity / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[clientID]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[clientID] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+elapsed*perSecond)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
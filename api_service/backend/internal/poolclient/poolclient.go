@@ -0,0 +1,91 @@
+// Package poolclient issues keys for pool clients, checks what they may read
+// and enforces their rate limits.
+package poolclient
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/token"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keyPrefix marks pool client keys, so a leaked key is recognizable.
+const keyPrefix = "cpk_"
+
+// NewKey returns a new random key, the prefix shown to admins to tell keys
+// apart and the hash to store.
+func NewKey() (key, prefix, hash string, err error) {
+	return token.New(keyPrefix)
+}
+
+// Hash returns the hash under which a client's key is stored.
+func Hash(key string) string {
+	return token.Hash(key)
+}
+
+// NormalizeDomains lower-cases the domains, strips a leading dot and drops
+// duplicates.
+func NormalizeDomains(domains []string) ([]string, error) {
+	normalized := make([]string, 0, len(domains))
+	seen := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d == "" || strings.ContainsAny(d, " \t/*") {
+			return nil, fmt.Errorf("%q is not a domain", d)
+		}
+		if !seen[d] {
+			seen[d] = true
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized, nil
+}
+
+// Allows reports whether client may read the pool for domain. A pool read
+// covers the domain's subdomains too, so domain must lie within one of the
+// client's allowed domains.
+func Allows(client *model.PoolClient, domain string) bool {
+	if len(client.AllowedDomains) == 0 {
+		return true
+	}
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	for _, allowed := range client.AllowedDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope returns the domain under which client sees a session for the cookie
+// domain in the pool's domain list: its registrable domain (example.com for
+// www.example.com) if the client may read that, otherwise the broadest of
+// the client's allowed domains that covers it. ok is false if the client may
+// not read the session at all.
+func Scope(client *model.PoolClient, domain string) (scope string, ok bool) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	scope = poolhealth.Site(domain)
+	if Allows(client, scope) {
+		return scope, true
+	}
+	scope = ""
+	for _, allowed := range client.AllowedDomains {
+		if (domain == allowed || strings.HasSuffix(domain, "."+allowed)) && (scope == "" || len(allowed) < len(scope)) {
+			scope = allowed
+		}
+	}
+	return scope, scope != ""
+}
+
+// Inactive returns why client may not be used at now, or "" if it may.
+func Inactive(client *model.PoolClient, now time.Time) string {
+	switch {
+	case client.RevokedAt != nil:
+		return "revoked"
+	case client.ExpiresAt != nil && !now.Before(*client.ExpiresAt):
+		return "expired"
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package poolclient
+
+import (
+	"cookie-syncer/api/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, hash, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix) || !strings.HasPrefix(prefix, keyPrefix) {
+		t.Errorf("key %q, prefix %q: want the key to start with the prefix and %q", key, prefix, keyPrefix)
+	}
+	if hash != Hash(key) || hash == key {
+		t.Errorf("hash %q does not match Hash(key)", hash)
+	}
+	other, _, _, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("two keys are equal")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	scoped := &model.PoolClient{AllowedDomains: []string{"example.com"}}
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"example.com", true},
+		{"www.Example.com", true},
+		{".example.com", true},
+		{"com", false}, // would cover every .com domain
+		{"badexample.com", false},
+		{"other.org", false},
+	}
+	for _, tt := range tests {
+		if got := Allows(scoped, tt.domain); got != tt.want {
+			t.Errorf("Allows(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+	if !Allows(&model.PoolClient{}, "anything.org") {
+		t.Error("a client without allowed domains must read every domain")
+	}
+}
+
+func TestScope(t *testing.T) {
+	all := &model.PoolClient{}
+	narrow := &model.PoolClient{AllowedDomains: []string{"www.example.com", "a.b.example.com", "b.example.com"}}
+	tests := []struct {
+		client *model.PoolClient
+		domain string
+		want   string
+	}{
+		{all, ".WWW.Example.com", "example.com"},
+		{all, "www.example.co.uk", "example.co.uk"},
+		{all, "localhost", "localhost"},
+		{narrow, "www.example.com", "www.example.com"},
+		{narrow, "x.a.b.example.com", "b.example.com"},
+		{narrow, "example.com", ""},
+		{narrow, "mail.example.com", ""},
+	}
+	for _, tt := range tests {
+		got, ok := Scope(tt.client, tt.domain)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Scope(%v, %q) = %q, %v, want %q", tt.client.AllowedDomains, tt.domain, got, ok, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	got, err := NormalizeDomains([]string{" Example.com", ".example.com", "b.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "example.com,b.org" {
+		t.Errorf("NormalizeDomains = %v", got)
+	}
+	for _, bad := range []string{"", "*.example.com", "a b.com"} {
+		if _, err := NormalizeDomains([]string{bad}); err == nil {
+			t.Errorf("NormalizeDomains(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestInactive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	if got := Inactive(&model.PoolClient{ExpiresAt: &future}, now); got != "" {
+		t.Errorf("unexpired client is %s", got)
+	}
+	if got := Inactive(&model.PoolClient{ExpiresAt: &past}, now); got != "expired" {
+		t.Errorf("expired client: %q, want expired", got)
+	}
+	if got := Inactive(&model.PoolClient{RevokedAt: &past}, now); got != "revoked" {
+		t.Errorf("revoked client: %q, want revoked", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow(1, 3, now); !ok {
+			t.Fatalf("request %d of a burst of 3 was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow(1, 3, now)
+	if ok || wait <= 0 || wait > 20*time.Second {
+		t.Fatalf("4th request: allowed %v, wait %v; want limited for up to 20s", ok, wait)
+	}
+	if ok, _ := l.Allow(2, 3, now); !ok {
+		t.Error("another client's bucket was drained")
+	}
+	if ok, _ := l.Allow(1, 3, now.Add(wait)); !ok {
+		t.Error("request after the advertised wait was limited")
+	}
+	if ok, _ := l.Allow(1, 0, now); !ok {
+		t.Error("a limit of 0 must not limit")
+	}
+}
@@ -0,0 +1,58 @@
+// Package poolhandle derives the pseudonymous handles that stand for
+// contributors in pool responses.
+//
+// A handle is a keyed hash of the pool client, the domain and the user, so a
+// client sees the same handle for a contributor every time it asks about a
+// domain, and can use it to report the session, while handles for other
+// domains or seen by other clients cannot be linked to it without the secret.
+package poolhandle
+
+import (
+	"cookie-syncer/api/internal/poolhealth"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// handlePrefix marks contributor handles, so they are not taken for user IDs.
+const handlePrefix = "ctr_"
+
+// For returns the handle that stands for userID when pool client clientID
+// asks about domain. The legacy POOL_ACCESS_KEY client has ID 0, so everyone
+// using it sees the same handles.
+func For(secret string, clientID int64, domain string, userID int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\x00%s\x00%d", clientID, poolhealth.NormalizeDomain(domain), userID)
+	return handlePrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:15])
+}
+
+// Resolve returns which of userIDs handle stands for when pool client
+// clientID asks about domain.
+func Resolve(secret string, clientID int64, domain, handle string, userIDs []int64) (int64, bool) {
+	for _, userID := range userIDs {
+		if hmac.Equal([]byte(For(secret, clientID, domain, userID)), []byte(handle)) {
+			return userID, true
+		}
+	}
+	return 0, false
+}
+
+// DefaultSecret returns the secret to use when POOL_HANDLE_SECRET is not set:
+// one derived from the admin key, which replicas share, or failing that a
+// random one, in which case persistent is false and handles change whenever
+// the server restarts.
+func DefaultSecret(adminKey string) (secret string, persistent bool, err error) {
+	if adminKey != "" {
+		mac := hmac.New(sha256.New, []byte(adminKey))
+		mac.Write([]byte("pool contributor handles"))
+		return hex.EncodeToString(mac.Sum(nil)), true, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, fmt.Errorf("could not generate pool handle secret: %w", err)
+	}
+	return hex.EncodeToString(b), false, nil
+}
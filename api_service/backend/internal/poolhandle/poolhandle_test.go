@@ -0,0 +1,56 @@
+package poolhandle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	h := For("secret", 1, "example.com", 42)
+	if !strings.HasPrefix(h, handlePrefix) || strings.Contains(h, "42") {
+		t.Errorf("handle %q, want an opaque %s handle", h, handlePrefix)
+	}
+	if got := For("secret", 1, ".Example.com", 42); got != h {
+		t.Errorf("handle for the same domain differently written %q, want %q", got, h)
+	}
+	for name, other := range map[string]string{
+		"another user":   For("secret", 1, "example.com", 43),
+		"another domain": For("secret", 1, "example.org", 42),
+		"another client": For("secret", 2, "example.com", 42),
+		"another secret": For("other", 1, "example.com", 42),
+	} {
+		if other == h {
+			t.Errorf("%s got the same handle %q", name, h)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	users := []int64{7, 42, 99}
+	if id, ok := Resolve("secret", 1, "example.com", For("secret", 1, "example.com", 42), users); !ok || id != 42 {
+		t.Errorf("Resolve = %d, %v, want 42", id, ok)
+	}
+	if _, ok := Resolve("secret", 2, "example.com", For("secret", 1, "example.com", 42), users); ok {
+		t.Error("another client resolved the handle")
+	}
+	if _, ok := Resolve("secret", 1, "example.org", For("secret", 1, "example.com", 42), users); ok {
+		t.Error("the handle resolved for another domain")
+	}
+	if _, ok := Resolve("secret", 1, "example.com", "42", users); ok {
+		t.Error("a user ID resolved as a handle")
+	}
+}
+
+func TestDefaultSecret(t *testing.T) {
+	a, persistent, err := DefaultSecret("admin")
+	if err != nil || !persistent {
+		t.Fatalf("DefaultSecret(admin) = %v, %v, want a persistent secret", persistent, err)
+	}
+	if b, _, _ := DefaultSecret("admin"); a != b || a == "admin" {
+		t.Errorf("secrets %q and %q, want the same one, not the admin key", a, b)
+	}
+	c, persistent, err := DefaultSecret("")
+	if err != nil || persistent || c == "" {
+		t.Errorf("DefaultSecret() = %q, %v, %v, want a random secret", c, persistent, err)
+	}
+}
@@ -0,0 +1,153 @@
+// Package poolhealth decides when a contributor's pool session is quarantined
+// after consumers report failures with it, and when a sync brings it back.
+package poolhealth
+
+import (
+	"cookie-syncer/api/internal/model"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Policy is when reported failures quarantine a session.
+type Policy struct {
+	Threshold         int           // distinct reporting clients that quarantine a session, 0 to never quarantine
+	RateLimitCooldown time.Duration // how long a session quarantined for rate limiting stays out
+	Window            time.Duration // how long a report counts, 0 for until the cookies change
+}
+
+// ValidReason reports whether reason is one consumers may report.
+func ValidReason(reason string) bool {
+	return reason == model.SessionInvalid || reason == model.SessionRateLimited
+}
+
+// NormalizeDomain lower-cases domain and strips its leading dot.
+func NormalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// CountSince returns the time after which reports count towards h's failures
+// at now: the start of the policy's window, or the end of a rate-limit
+// cooldown that is over, whichever is later. The reports that led to a
+// cooldown so do not bring the session straight back into quarantine.
+func CountSince(h *model.PoolSessionHealth, policy Policy, now time.Time) time.Time {
+	var since time.Time
+	if policy.Window > 0 {
+		since = now.Add(-policy.Window)
+	}
+	if h.QuarantinedUntil != nil && !now.Before(*h.QuarantinedUntil) && h.QuarantinedUntil.After(since) {
+		since = *h.QuarantinedUntil
+	}
+	return since
+}
+
+// Quarantine updates h, whose Failures already count the clients reporting
+// since CountSince, including the report with the given reason, and reports
+// whether it changed. Once the failures reach the
+// threshold, an invalid session is quarantined until its cookies change and
+// a rate-limited one for the cooldown; a quarantine until the cookies change
+// is never shortened.
+func Quarantine(h *model.PoolSessionHealth, reason string, policy Policy, now time.Time) bool {
+	if policy.Threshold <= 0 || h.Failures < policy.Threshold {
+		return false
+	}
+	if h.QuarantinedAt != nil && h.QuarantinedUntil == nil {
+		return false
+	}
+	h.QuarantinedAt = &now
+	if reason == model.SessionRateLimited {
+		until := now.Add(policy.RateLimitCooldown)
+		h.QuarantinedUntil = &until
+	} else {
+		h.QuarantinedUntil = nil
+	}
+	return true
+}
+
+// Quarantined reports whether h keeps its session out of the pool at now.
+func Quarantined(h *model.PoolSessionHealth, now time.Time) bool {
+	return h.QuarantinedAt != nil && (h.QuarantinedUntil == nil || now.Before(*h.QuarantinedUntil))
+}
+
+// Site returns the registrable domain of a normalized domain (example.com
+// for www.example.com), or domain itself if it has none, such as a public
+// suffix, an IP address or a single label. Sessions for overlapping domains
+// share their site.
+func Site(domain string) string {
+	site, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return site
+}
+
+// Covers reports whether a cookie set for cookieDomain belongs to the session
+// for domain, that is to domain or one of its subdomains. domain must be
+// normalized.
+func Covers(domain, cookieDomain string) bool {
+	c := NormalizeDomain(cookieDomain)
+	return c == domain || strings.HasSuffix(c, "."+domain)
+}
+
+// PreferWorking drops the cookies of the sessions that a probe found
+// expired, according to results, unless no other session is left.
+func PreferWorking(cookies []*model.Cookie, results []*model.ProbeResult) []*model.Cookie {
+	expired := make(map[int64]bool)
+	for _, r := range results {
+		if r.Outcome != model.ProbeExpired {
+			continue
+		}
+		for _, c := range cookies {
+			if c.UserID == r.UserID && Covers(r.Domain, c.Domain) {
+				expired[c.UserID] = true
+			}
+		}
+	}
+	if len(expired) == 0 || !slices.ContainsFunc(cookies, func(c *model.Cookie) bool { return !expired[c.UserID] }) {
+		return cookies
+	}
+	kept := make([]*model.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		if !expired[c.UserID] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// SkipExpired drops the cookies that a probe found expired, according to
+// results, whatever else is left. Unlike PreferWorking it looks at each cookie
+// on its own, for lists that span several domains.
+func SkipExpired(cookies []*model.Cookie, results []*model.ProbeResult) []*model.Cookie {
+	kept := make([]*model.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		expired := slices.ContainsFunc(results, func(r *model.ProbeResult) bool {
+			return r.Outcome == model.ProbeExpired && r.UserID == c.UserID && Covers(r.Domain, c.Domain)
+		})
+		if !expired {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Changed reports whether the session for domain differs between two
+// snapshots of a user's cookies: whether a cookie of it was added, removed or
+// given a new value. Other attributes, such as a later expiry from a refresh,
+// do not count.
+func Changed(domain string, before, after []*model.Cookie) bool {
+	return !slices.Equal(fingerprint(domain, before), fingerprint(domain, after))
+}
+
+func fingerprint(domain string, cookies []*model.Cookie) []string {
+	var keys []string
+	for _, c := range cookies {
+		if Covers(domain, c.Domain) {
+			keys = append(keys, NormalizeDomain(c.Domain)+"\x00"+c.Name+"\x00"+c.Path+"\x00"+c.Value)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
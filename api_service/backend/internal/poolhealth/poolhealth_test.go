@@ -0,0 +1,135 @@
+package poolhealth
+
+import (
+	"cookie-syncer/api/internal/model"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	now := time.Now()
+	policy := Policy{Threshold: 2, RateLimitCooldown: time.Minute}
+
+	h := &model.PoolSessionHealth{Failures: 1}
+	if Quarantine(h, model.SessionInvalid, policy, now) || Quarantined(h, now) {
+		t.Error("quarantined below the threshold")
+	}
+
+	h.Failures = 2
+	if !Quarantine(h, model.SessionRateLimited, policy, now) || !Quarantined(h, now) {
+		t.Fatal("not quarantined at the threshold")
+	}
+	if Quarantined(h, now.Add(time.Minute)) {
+		t.Error("rate limited session still quarantined after the cooldown")
+	}
+
+	h.Failures = 3
+	if !Quarantine(h, model.SessionInvalid, policy, now) || !Quarantined(h, now.Add(time.Hour)) {
+		t.Error("invalid session not quarantined until its cookies change")
+	}
+	h.Failures = 4
+	if Quarantine(h, model.SessionRateLimited, policy, now) || h.QuarantinedUntil != nil {
+		t.Error("rate limiting shortened the quarantine of an invalid session")
+	}
+
+	if Quarantine(&model.PoolSessionHealth{Failures: 100}, model.SessionInvalid, Policy{}, now) {
+		t.Error("quarantined with a zero threshold")
+	}
+}
+
+func TestCountSince(t *testing.T) {
+	now := time.Now()
+	policy := Policy{Threshold: 2, RateLimitCooldown: time.Minute, Window: time.Hour}
+
+	if got := CountSince(&model.PoolSessionHealth{}, policy, now); !got.Equal(now.Add(-time.Hour)) {
+		t.Errorf("CountSince = %v, want the start of the window", got)
+	}
+	if got := CountSince(&model.PoolSessionHealth{}, Policy{}, now); !got.IsZero() {
+		t.Errorf("CountSince without a window = %v, want every report", got)
+	}
+
+	ended := now.Add(-time.Minute)
+	h := &model.PoolSessionHealth{QuarantinedAt: &now, QuarantinedUntil: &ended}
+	if got := CountSince(h, policy, now); !got.Equal(ended) {
+		t.Errorf("CountSince after a cooldown = %v, want its end %v", got, ended)
+	}
+	running := now.Add(time.Minute)
+	h.QuarantinedUntil = &running
+	if got := CountSince(h, policy, now); !got.Equal(now.Add(-time.Hour)) {
+		t.Errorf("CountSince during a cooldown = %v, want the start of the window", got)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	before := []*model.Cookie{
+		{Domain: ".example.com", Name: "sid", Path: "/", Value: "1"},
+		{Domain: "www.example.com", Name: "pref", Path: "/", Value: "a"},
+		{Domain: "other.org", Name: "sid", Path: "/", Value: "x"},
+	}
+	expiry := time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		after []*model.Cookie
+		want  bool
+	}{
+		{"same cookies in another order", []*model.Cookie{before[2], before[1], before[0]}, false},
+		{"later expiry", []*model.Cookie{{Domain: ".example.com", Name: "sid", Path: "/", Value: "1", Expires: &expiry}, before[1]}, false},
+		{"other domain changed", []*model.Cookie{before[0], before[1], {Domain: "other.org", Name: "sid", Path: "/", Value: "y"}}, false},
+		{"new value", []*model.Cookie{{Domain: "example.com", Name: "sid", Path: "/", Value: "2"}, before[1]}, true},
+		{"cookie removed", []*model.Cookie{before[0], before[2]}, true},
+		{"subdomain cookie added", append([]*model.Cookie{{Domain: "a.example.com", Name: "n", Path: "/"}}, before...), true},
+	}
+	for _, tt := range tests {
+		if got := Changed("example.com", before, tt.after); got != tt.want {
+			t.Errorf("%s: Changed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreferWorking(t *testing.T) {
+	cookies := []*model.Cookie{
+		{UserID: 1, Domain: "www.example.com", Name: "a"},
+		{UserID: 2, Domain: "example.com", Name: "b"},
+	}
+	names := func(cookies []*model.Cookie) (out string) {
+		for _, c := range cookies {
+			out += c.Name
+		}
+		return out
+	}
+	expired := &model.ProbeResult{UserID: 1, Domain: "example.com", Outcome: model.ProbeExpired}
+	if got := names(PreferWorking(cookies, []*model.ProbeResult{expired})); got != "b" {
+		t.Errorf("with the first session expired: %q, want b", got)
+	}
+	errored := &model.ProbeResult{UserID: 2, Domain: "example.com", Outcome: model.ProbeError}
+	if got := names(PreferWorking(cookies, []*model.ProbeResult{errored})); got != "ab" {
+		t.Errorf("with a probe error: %q, want ab", got)
+	}
+	both := []*model.ProbeResult{expired, {UserID: 2, Domain: "example.com", Outcome: model.ProbeExpired}}
+	if got := names(PreferWorking(cookies, both)); got != "ab" {
+		t.Errorf("with every session expired: %q, want ab", got)
+	}
+	other := &model.ProbeResult{UserID: 1, Domain: "other.org", Outcome: model.ProbeExpired}
+	if got := names(PreferWorking(cookies, []*model.ProbeResult{other})); got != "ab" {
+		t.Errorf("with another domain expired: %q, want ab", got)
+	}
+}
+
+func TestSkipExpired(t *testing.T) {
+	cookies := []*model.Cookie{
+		{UserID: 1, Domain: "www.example.com", Name: "a"},
+		{UserID: 1, Domain: "other.org", Name: "b"},
+		{UserID: 2, Domain: "example.com", Name: "c"},
+	}
+	results := []*model.ProbeResult{
+		{UserID: 1, Domain: "example.com", Outcome: model.ProbeExpired},
+		{UserID: 2, Domain: "example.com", Outcome: model.ProbeOK},
+	}
+	var got string
+	for _, c := range SkipExpired(cookies, results) {
+		got += c.Name
+	}
+	if got != "bc" {
+		t.Errorf("SkipExpired kept %q, want bc: the expired session only, other domains of its user kept", got)
+	}
+}
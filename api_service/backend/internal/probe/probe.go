@@ -0,0 +1,178 @@
+// Package probe checks whether stored sessions still work by requesting a
+// page of the site with their cookies, and runs those checks on a schedule.
+package probe
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxPerUser is how many probes one user may define.
+	MaxPerUser = 20
+	// MaxPatternBytes is the longest body regex or login redirect pattern.
+	MaxPatternBytes = 1024
+	// maxURLBytes is the longest probe URL.
+	maxURLBytes = 2048
+	// maxBodyBytes is how much of a response body a body regex is matched
+	// against.
+	maxBodyBytes = 1 << 20
+)
+
+// Validate normalizes p's domain, defaults its expected status to 200 and
+// checks that its URL is an http or https URL on the domain (or a subdomain)
+// and its patterns compile.
+func Validate(p *model.SessionProbe) error {
+	p.Domain = poolhealth.NormalizeDomain(p.Domain)
+	if p.Domain == "" {
+		return errors.New("domain is required")
+	}
+	if len(p.URL) > maxURLBytes {
+		return fmt.Errorf("url is longer than %d bytes", maxURLBytes)
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if !poolhealth.Covers(p.Domain, u.Hostname()) {
+		return fmt.Errorf("url must be on %s or one of its subdomains", p.Domain)
+	}
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if p.ExpectStatus < 100 || p.ExpectStatus > 599 {
+		return errors.New("expect_status must be an HTTP status code")
+	}
+	for name, pattern := range map[string]string{"body_regex": p.BodyRegex, "login_redirect": p.LoginRedirect} {
+		if len(pattern) > MaxPatternBytes {
+			return fmt.Errorf("%s is longer than %d bytes", name, MaxPatternBytes)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client probes are made with. It does not follow
+// redirects, so login redirects can be recognized, and unless allowPrivate
+// is set it refuses to connect to loopback, private and link-local
+// addresses, so probes cannot reach the server's own network.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("probe of non-public address %s refused", host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Check requests p's URL with the cookies that apply to it and returns the
+// result for the session (without its user). A response that contradicts
+// the probe means the session expired; a failed request or a server error
+// says nothing about the session and is an error.
+func Check(ctx context.Context, client *http.Client, p *model.SessionProbe, cookies []*model.Cookie) *model.ProbeResult {
+	result := &model.ProbeResult{ProbeID: p.ID, Domain: p.Domain, Outcome: model.ProbeOK, CheckedAt: time.Now()}
+	end := func(outcome, detail string) *model.ProbeResult {
+		result.Outcome, result.Detail = outcome, detail
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return end(model.ProbeError, err.Error())
+	}
+	if header := cookieHeader(req.URL, cookies); header != "" {
+		req.Header.Set("Cookie", header)
+	}
+	req.Header.Set("User-Agent", "CookiePusher-Probe/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return end(model.ProbeError, err.Error())
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+
+	if p.LoginRedirect != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		re, err := regexp.Compile(p.LoginRedirect)
+		if err != nil {
+			return end(model.ProbeError, "login_redirect: "+err.Error())
+		}
+		if location := resp.Header.Get("Location"); re.MatchString(location) {
+			return end(model.ProbeExpired, "redirected to "+location)
+		}
+	}
+	if resp.StatusCode != p.ExpectStatus {
+		outcome := model.ProbeExpired
+		if resp.StatusCode >= 500 {
+			outcome = model.ProbeError
+		}
+		return end(outcome, fmt.Sprintf("status %d, want %d", resp.StatusCode, p.ExpectStatus))
+	}
+	if p.BodyRegex != "" {
+		re, err := regexp.Compile(p.BodyRegex)
+		if err != nil {
+			return end(model.ProbeError, "body_regex: "+err.Error())
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+		if err != nil {
+			return end(model.ProbeError, "could not read body: "+err.Error())
+		}
+		if !re.Match(body) {
+			return end(model.ProbeExpired, "body does not match")
+		}
+	}
+	return result
+}
+
+// cookieHeader returns the Cookie header a browser would send to u.
+func cookieHeader(u *url.URL, cookies []*model.Cookie) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var parts []string
+	for _, c := range cookies {
+		if !poolhealth.Covers(poolhealth.NormalizeDomain(c.Domain), u.Hostname()) {
+			continue
+		}
+		if c.Secure && u.Scheme != "https" {
+			continue
+		}
+		if c.Path != "" && !strings.HasPrefix(path, c.Path) {
+			continue
+		}
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	return strings.Join(parts, "; ")
+}
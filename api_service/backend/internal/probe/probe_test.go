@@ -0,0 +1,150 @@
+package probe
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store/memstore"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// target is a site where the session with sid=good is logged in.
+func target(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/broken":
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		case "/account":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		c, err := r.Cookie("sid")
+		if err != nil || c.Value != "good" {
+			http.Redirect(w, r, "/login?next=/account", http.StatusFound)
+			return
+		}
+		w.Write([]byte("Welcome back, " + r.Header.Get("Cookie")))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidate(t *testing.T) {
+	p := &model.SessionProbe{Domain: ".Example.com", URL: "https://www.example.com/account"}
+	if err := Validate(p); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.Domain != "example.com" || p.ExpectStatus != http.StatusOK {
+		t.Errorf("normalized probe %+v, want domain example.com and status 200", p)
+	}
+
+	for _, bad := range []*model.SessionProbe{
+		{Domain: "", URL: "https://example.com/"},
+		{Domain: "example.com", URL: "ftp://example.com/"},
+		{Domain: "example.com", URL: "/account"},
+		{Domain: "example.com", URL: "https://evil.com/?example.com"},
+		{Domain: "example.com", URL: "https://example.com/", ExpectStatus: 1000},
+		{Domain: "example.com", URL: "https://example.com/", BodyRegex: "("},
+		{Domain: "example.com", URL: "https://example.com/", LoginRedirect: strings.Repeat("a", MaxPatternBytes+1)},
+	} {
+		if err := Validate(bad); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	srv := target(t)
+	client := NewClient(time.Second, true)
+	host, _ := url.Parse(srv.URL)
+	good := []*model.Cookie{
+		{Domain: host.Hostname(), Name: "sid", Value: "good", Path: "/"},
+		{Domain: host.Hostname(), Name: "secure", Value: "x", Path: "/", Secure: true},
+		{Domain: host.Hostname(), Name: "elsewhere", Value: "x", Path: "/other"},
+	}
+	bad := []*model.Cookie{{Domain: host.Hostname(), Name: "sid", Value: "stale", Path: "/"}}
+
+	tests := []struct {
+		name    string
+		probe   model.SessionProbe
+		cookies []*model.Cookie
+		want    string
+	}{
+		{"working session", model.SessionProbe{URL: srv.URL + "/account", ExpectStatus: 200, BodyRegex: `Welcome back, sid=good$`}, good, model.ProbeOK},
+		{"login redirect", model.SessionProbe{URL: srv.URL + "/account", ExpectStatus: 200, LoginRedirect: `^/login`}, bad, model.ProbeExpired},
+		{"unexpected status", model.SessionProbe{URL: srv.URL + "/account", ExpectStatus: 200}, bad, model.ProbeExpired},
+		{"body mismatch", model.SessionProbe{URL: srv.URL + "/account", ExpectStatus: 200, BodyRegex: "Goodbye"}, good, model.ProbeExpired},
+		{"server error", model.SessionProbe{URL: srv.URL + "/broken", ExpectStatus: 200}, good, model.ProbeError},
+	}
+	for _, tt := range tests {
+		result := Check(context.Background(), client, &tt.probe, tt.cookies)
+		if result.Outcome != tt.want {
+			t.Errorf("%s: outcome %q (%s), want %q", tt.name, result.Outcome, result.Detail, tt.want)
+		}
+	}
+
+	p := &model.SessionProbe{URL: srv.URL + "/account", ExpectStatus: 200}
+	if result := Check(context.Background(), NewClient(time.Second, false), p, good); result.Outcome != model.ProbeError {
+		t.Errorf("probe of a loopback address without allowPrivate: outcome %q, want error", result.Outcome)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	srv := target(t)
+	host, _ := url.Parse(srv.URL)
+	db := memstore.New("", "")
+	users, err := db.CreateUsers(ctx, []string{"logged in", "logged out", "private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []string{"good", "stale", "stale"} {
+		if i < 2 {
+			if err := db.UpdateUserSharing(ctx, users[i].ID, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := db.SyncCookies(ctx, users[i].ID, []*model.Cookie{{Domain: host.Hostname(), Name: "sid", Value: value, Path: "/", IsSharable: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	poolProbe := &model.SessionProbe{Domain: host.Hostname(), URL: srv.URL + "/account", ExpectStatus: 200}
+	userProbe := &model.SessionProbe{UserID: users[2].ID, Domain: host.Hostname(), URL: srv.URL + "/account", ExpectStatus: 200}
+	for _, p := range []*model.SessionProbe{poolProbe, userProbe} {
+		if err := db.CreateSessionProbe(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewScheduler(db, NewClient(time.Second, true), time.Hour).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	for i, want := range []string{model.ProbeOK, model.ProbeExpired, model.ProbeExpired} {
+		results, err := db.ListProbeResults(ctx, users[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Outcome != want {
+			t.Errorf("results of user %d = %+v, want one %s result", users[i].ID, results, want)
+		}
+	}
+	if results, _ := db.ListProbeResults(ctx, users[2].ID); len(results) == 1 && results[0].ProbeID != userProbe.ID {
+		t.Errorf("the private user's session was probed by probe %d, want only their own probe %d", results[0].ProbeID, userProbe.ID)
+	}
+
+	pool, err := db.GetSharableCookiesByDomain(ctx, host.Hostname())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool) != 1 || pool[0].UserID != users[0].ID {
+		t.Errorf("pool = %+v, want only the logged in user's session", pool)
+	}
+}
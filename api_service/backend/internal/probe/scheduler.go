@@ -0,0 +1,133 @@
+package probe
+
+import (
+	"context"
+	"cookie-syncer/api/internal/domainrule"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Scheduler runs every probe against the sessions it covers on a fixed
+// interval and records the results.
+type Scheduler struct {
+	db       store.Store
+	client   *http.Client
+	interval time.Duration
+}
+
+// NewScheduler returns a scheduler running the probes in db with client
+// every interval.
+func NewScheduler(db store.Store, client *http.Client, interval time.Duration) *Scheduler {
+	return &Scheduler{db: db, client: client, interval: interval}
+}
+
+// Run runs the probes now and then every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Session probes failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs every probe once against each session it covers: a user's
+// probe against the user's cookies for its domain, an admin's probe against
+// each user's cookies for it in the pool.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	probes, err := s.db.ListSessionProbes(ctx)
+	if err != nil {
+		return err
+	}
+	var sharing []*model.User // loaded for the first admin probe
+	for _, p := range probes {
+		var sessions map[int64][]*model.Cookie
+		if p.UserID == 0 {
+			if sharing == nil {
+				if sharing, err = s.sharingUsers(ctx); err != nil {
+					return err
+				}
+			}
+			sessions, err = s.poolSessions(ctx, p.Domain, sharing)
+		} else {
+			sessions, err = s.userSession(ctx, p.UserID, p.Domain)
+		}
+		if err != nil {
+			return fmt.Errorf("could not get sessions for probe %d: %w", p.ID, err)
+		}
+
+		userIDs := make([]int64, 0, len(sessions))
+		for userID := range sessions {
+			userIDs = append(userIDs, userID)
+		}
+		slices.Sort(userIDs)
+		for _, userID := range userIDs {
+			result := Check(ctx, s.client, p, sessions[userID])
+			result.UserID = userID
+			if err := s.db.RecordProbeResult(ctx, result); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Warn().Err(err).Int64("probe_id", p.ID).Int64("user_id", userID).Msg("Could not record probe result")
+			}
+		}
+	}
+	return nil
+}
+
+// sharingUsers returns the active users who share cookies.
+func (s *Scheduler) sharingUsers(ctx context.Context) ([]*model.User, error) {
+	users, err := s.db.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sharing := make([]*model.User, 0, len(users))
+	for _, u := range users {
+		if u.SharingEnabled && !u.DeletedAt.Valid {
+			sharing = append(sharing, u)
+		}
+	}
+	return sharing, nil
+}
+
+// poolSessions returns each user's cookies for domain that are in the pool.
+func (s *Scheduler) poolSessions(ctx context.Context, domain string, users []*model.User) (map[int64][]*model.Cookie, error) {
+	sessions := make(map[int64][]*model.Cookie)
+	for _, u := range users {
+		filter, err := domainrule.NewSharingFilter(u.SharingRules)
+		if err != nil {
+			continue // nothing of theirs is in the pool
+		}
+		cookies, err := s.db.GetCookiesByDomain(ctx, u.ID, domain)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cookies {
+			if c.IsSharable && filter.Allows(c.Domain) {
+				sessions[u.ID] = append(sessions[u.ID], c)
+			}
+		}
+	}
+	return sessions, nil
+}
+
+// userSession returns the user's cookies for domain, if they have any.
+func (s *Scheduler) userSession(ctx context.Context, userID int64, domain string) (map[int64][]*model.Cookie, error) {
+	cookies, err := s.db.GetCookiesByDomain(ctx, userID, domain)
+	if err != nil || len(cookies) == 0 {
+		return nil, err
+	}
+	return map[int64][]*model.Cookie{userID: cookies}, nil
+}
@@ -0,0 +1,90 @@
+// Package quota measures how much a user stores and checks it against the
+// server-wide limits and the user's overrides.
+package quota
+
+import (
+	"cookie-syncer/api/internal/model"
+	"strings"
+)
+
+// Limits caps what one user may store. A zero limit means unlimited.
+type Limits struct {
+	MaxCookies int64 `json:"max_cookies"`
+	MaxBytes   int64 `json:"max_bytes"`
+	MaxDomains int64 `json:"max_domains"`
+}
+
+// Effective applies a user's overrides on top of the server defaults.
+func Effective(defaults Limits, override model.Quota) Limits {
+	limits := defaults
+	if override.MaxCookies != nil {
+		limits.MaxCookies = *override.MaxCookies
+	}
+	if override.MaxBytes != nil {
+		limits.MaxBytes = *override.MaxBytes
+	}
+	if override.MaxDomains != nil {
+		limits.MaxDomains = *override.MaxDomains
+	}
+	return limits
+}
+
+// Usage is what a set of cookies consumes.
+type Usage struct {
+	Cookies int64 `json:"cookies"`
+	Bytes   int64 `json:"bytes"`   // domains, names, values and paths together
+	Domains int64 `json:"domains"` // distinct domains, ignoring case and a leading dot
+}
+
+// Measure returns the usage of cookies.
+func Measure(cookies []*model.Cookie) Usage {
+	domains := make(map[string]struct{})
+	var u Usage
+	for _, c := range cookies {
+		u.Cookies++
+		u.Bytes += int64(len(c.Domain) + len(c.Name) + len(c.Value) + len(c.Path))
+		domains[strings.TrimPrefix(strings.ToLower(c.Domain), ".")] = struct{}{}
+	}
+	u.Domains = int64(len(domains))
+	return u
+}
+
+// Violation is one limit that a usage exceeds.
+type Violation struct {
+	Resource string `json:"resource"` // cookies, bytes or domains
+	Used     int64  `json:"used"`
+	Limit    int64  `json:"limit"`
+}
+
+// Check returns the limits that u exceeds.
+func (l Limits) Check(u Usage) []Violation {
+	var violations []Violation
+	check := func(resource string, used, limit int64) {
+		if limit > 0 && used > limit {
+			violations = append(violations, Violation{Resource: resource, Used: used, Limit: limit})
+		}
+	}
+	check("cookies", u.Cookies, l.MaxCookies)
+	check("bytes", u.Bytes, l.MaxBytes)
+	check("domains", u.Domains, l.MaxDomains)
+	return violations
+}
+
+// Report shows a user's usage next to their limits.
+type Report struct {
+	Usage     Usage       `json:"usage"`
+	Limits    Limits      `json:"limits"`    // effective limits, 0 for unlimited
+	Overrides model.Quota `json:"overrides"` // the user's own limits, null where the default applies
+	Exceeded  []Violation `json:"exceeded"`  // limits already exceeded, e.g. after an admin lowered them
+}
+
+// NewReport builds the report for a user storing cookies.
+func NewReport(defaults Limits, user *model.User, cookies []*model.Cookie) Report {
+	limits := Effective(defaults, user.Quota)
+	usage := Measure(cookies)
+	exceeded := limits.Check(usage)
+	if exceeded == nil {
+		exceeded = []Violation{}
+	}
+	return Report{Usage: usage, Limits: limits, Overrides: user.Quota, Exceeded: exceeded}
+}
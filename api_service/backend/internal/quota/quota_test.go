@@ -0,0 +1,42 @@
+package quota
+
+import (
+	"cookie-syncer/api/internal/model"
+	"reflect"
+	"testing"
+)
+
+func limit(n int64) *int64 { return &n }
+
+func TestEffective(t *testing.T) {
+	defaults := Limits{MaxCookies: 100, MaxBytes: 1000, MaxDomains: 10}
+	got := Effective(defaults, model.Quota{MaxCookies: limit(5), MaxDomains: limit(0)})
+	want := Limits{MaxCookies: 5, MaxBytes: 1000, MaxDomains: 0}
+	if got != want {
+		t.Errorf("Effective = %+v, want %+v", got, want)
+	}
+}
+
+func TestMeasureAndCheck(t *testing.T) {
+	cookies := []*model.Cookie{
+		{Domain: ".Example.com", Name: "a", Value: "12345", Path: "/"},
+		{Domain: "example.com", Name: "b", Value: "1", Path: "/"},
+		{Domain: "other.org", Name: "c", Value: "", Path: "/x"},
+	}
+	u := Measure(cookies)
+	if want := (Usage{Cookies: 3, Bytes: 12 + 1 + 5 + 1 + 11 + 1 + 1 + 1 + 9 + 1 + 0 + 2, Domains: 2}); u != want {
+		t.Fatalf("Measure = %+v, want %+v", u, want)
+	}
+
+	if v := (Limits{}).Check(u); v != nil {
+		t.Errorf("unlimited Check = %+v, want none", v)
+	}
+	if v := (Limits{MaxCookies: 3, MaxBytes: u.Bytes, MaxDomains: 2}).Check(u); v != nil {
+		t.Errorf("Check at the limits = %+v, want none", v)
+	}
+	got := (Limits{MaxCookies: 2, MaxDomains: 1}).Check(u)
+	want := []Violation{{Resource: "cookies", Used: 3, Limit: 2}, {Resource: "domains", Used: 2, Limit: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %+v, want %+v", got, want)
+	}
+}
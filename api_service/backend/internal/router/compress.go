@@ -0,0 +1,23 @@
+package router
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// compressionLevel is a middle ground valid for gzip, deflate (1-9) and
+// brotli (0-11).
+const compressionLevel = 5
+
+// newCompressor returns chi's response compressor with brotli added. Brotli
+// is registered last, so it is preferred over gzip and deflate when the
+// client accepts it.
+func newCompressor() *middleware.Compressor {
+	c := middleware.NewCompressor(compressionLevel)
+	c.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
+	})
+	return c
+}
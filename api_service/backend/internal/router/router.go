@@ -3,6 +3,8 @@ package router
 import (
 	"cookie-syncer/api/internal/config"
 	"cookie-syncer/api/internal/handler"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/poolclient"
 	"cookie-syncer/api/internal/store"
 	"fmt"
 	"net/http"
@@ -15,7 +17,7 @@ import (
 )
 
 // NewRouter creates and configures a new HTTP router using chi.
-func NewRouter(db store.Store, locker *handler.UserLockManager, cfg *config.Config) *chi.Mux {
+func NewRouter(db store.Store, syncLocker locker.Locker, cfg *config.Config) *chi.Mux {
 	r := chi.NewRouter()
 
 	// A good base middleware stack
@@ -27,6 +29,11 @@ func NewRouter(db store.Store, locker *handler.UserLockManager, cfg *config.Conf
 	// Set a timeout value on the request context (useful for databases and backend services)
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	// Compress JSON responses with brotli or gzip, as the client accepts, and
+	// cap request bodies.
+	r.Use(newCompressor().Handler)
+	r.Use(handler.LimitRequestBody(cfg.MaxBodyBytes))
+
 	// Swagger documentation
 	r.Get("/swagger", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/swagger/", http.StatusMovedPermanently)
@@ -43,35 +50,74 @@ func NewRouter(db store.Store, locker *handler.UserLockManager, cfg *config.Conf
 		handler.RespondWithJSON(w, http.StatusOK, "Service is healthy", nil)
 	})
 
+	// Share links, whose token is the credential
+	r.Post("/api/v1/share/{token}", handler.RedeemShareLinkHandler(db))
+
 	// Authenticated routes group for regular users
 	r.Group(func(r chi.Router) {
 		r.Use(handler.AuthMiddleware(db))
 
-		r.Post("/api/v1/sync", handler.SyncHandler(db, locker))
+		r.With(handler.DecompressRequestBody(cfg.MaxBodyBytes)).Post("/api/v1/sync", handler.SyncHandler(db, syncLocker, cfg))
 		r.Get("/api/v1/auth/test", handler.AuthTestHandler)
 		r.Get("/api/v1/cookies/all", handler.GetAllCookiesHandler(db))
 		r.Get("/api/v1/cookies/{domain}", handler.GetDomainCookiesHandler(db))
 		r.Get("/api/v1/cookies/{domain}/{name}", handler.GetCookieValueHandler(db))
+		r.Get("/api/v1/export/cookies", handler.ExportCookiesHandler(db))
 		r.Get("/api/v1/user/settings", handler.GetUserSettingsHandler(db))
 		r.Put("/api/v1/user/settings", handler.UpdateUserSettingsHandler(db))
+		r.Get("/api/v1/user/usage", handler.UserUsageHandler(db, cfg))
+		r.Get("/api/v1/user/probes", handler.ListUserProbesHandler(db))
+		r.Post("/api/v1/user/probes", handler.CreateUserProbeHandler(db))
+		r.Delete("/api/v1/user/probes/{id}", handler.DeleteUserProbeHandler(db))
+		r.Get("/api/v1/user/sessions", handler.UserSessionStatusHandler(db))
+		r.Get("/api/v1/user/pool/stats", handler.UserPoolStatsHandler(db))
+		r.Get("/api/v1/user/share-links", handler.ListShareLinksHandler(db))
+		r.Post("/api/v1/user/share-links", handler.CreateShareLinkHandler(db, cfg))
+		r.Post("/api/v1/user/share-links/{id}/revoke", handler.RevokeShareLinkHandler(db))
+		r.Get("/api/v1/user/share-links/{id}/events", handler.ListShareLinkEventsHandler(db))
+		r.Get("/api/v1/teams", handler.ListTeamsHandler(db))
+		r.Post("/api/v1/teams", handler.CreateTeamHandler(db))
+		r.Delete("/api/v1/teams/{id}", handler.DeleteTeamHandler(db))
+		r.Get("/api/v1/teams/{id}/members", handler.ListTeamMembersHandler(db))
+		r.Put("/api/v1/teams/{id}/members/{userID}", handler.SetTeamMemberHandler(db))
+		r.Delete("/api/v1/teams/{id}/members/{userID}", handler.RemoveTeamMemberHandler(db))
 	})
 
-	// Pool API for shared cookies, protected by a separate key
+	// Pool API for shared cookies, protected by pool client keys
+	poolLimiter := poolclient.NewLimiter()
 	r.Group(func(r chi.Router) {
 		// This middleware will check for the X-Pool-Key header
-		r.Use(handler.PoolKeyAuthMiddleware(cfg.PoolAccessKey))
-		r.Get("/api/v1/pool/cookies/{domain}", handler.GetSharableCookiesHandler(db))
+		r.Use(handler.PoolKeyAuthMiddleware(db, cfg.PoolAccessKey, poolLimiter))
+		r.Get("/api/v1/pool/domains", handler.ListPoolDomainsHandler(db))
+		r.Get("/api/v1/pool/cookies/{domain}", handler.GetSharableCookiesHandler(db, cfg))
+		r.Post("/api/v1/pool/leases", handler.LeasePoolSessionHandler(db, cfg))
+		r.Post("/api/v1/pool/leases/{id}/release", handler.ReleasePoolLeaseHandler(db, cfg))
+		r.Post("/api/v1/pool/report", handler.ReportPoolSessionHandler(db, cfg))
 	})
 
 	// Admin-only routes group, protected by a separate key
 	r.Group(func(r chi.Router) {
 		r.Use(handler.AdminKeyAuthMiddleware(cfg.AdminKey))
 
+		r.Get("/api/v1/admin/users", handler.AdminListUsersHandler(db))
+		r.Get("/api/v1/admin/stats/locks", handler.AdminLockStatsHandler(syncLocker))
+		r.Get("/api/v1/admin/stats/cache", handler.AdminCacheStatsHandler(db))
 		r.Post("/api/v1/admin/users", handler.AdminCreateUsersHandler(db, cfg))
 		r.Put("/api/v1/admin/users/{id}", handler.AdminUpdateUserHandler(db))
 		r.Put("/api/v1/admin/users/by-key/{apiKey}", handler.AdminUpdateUserByAPIKeyHandler(db))
 		r.Post("/api/v1/admin/users/{id}/refresh-key", handler.AdminRefreshUserAPIKeyHandler(db))
+		r.Post("/api/v1/admin/users/{id}/suspend", handler.AdminSuspendUserHandler(db))
+		r.Get("/api/v1/admin/users/{id}/usage", handler.AdminUserUsageHandler(db, cfg))
+		r.Put("/api/v1/admin/users/{id}/quota", handler.AdminUpdateUserQuotaHandler(db, cfg))
 		r.Post("/api/v1/admin/users/by-key/{apiKey}/refresh-key", handler.AdminRefreshUserAPIKeyByAPIKeyHandler(db))
+		r.Get("/api/v1/admin/pool/clients", handler.AdminListPoolClientsHandler(db))
+		r.Post("/api/v1/admin/pool/clients", handler.AdminCreatePoolClientHandler(db))
+		r.Put("/api/v1/admin/pool/clients/{id}", handler.AdminUpdatePoolClientHandler(db))
+		r.Post("/api/v1/admin/pool/clients/{id}/revoke", handler.AdminRevokePoolClientHandler(db))
+		r.Get("/api/v1/admin/pool/stats", handler.AdminPoolStatsHandler(db))
+		r.Get("/api/v1/admin/probes", handler.AdminListProbesHandler(db))
+		r.Post("/api/v1/admin/probes", handler.AdminCreateProbeHandler(db))
+		r.Delete("/api/v1/admin/probes/{id}", handler.AdminDeleteProbeHandler(db))
 	})
 
 	return r
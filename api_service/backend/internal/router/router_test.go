@@ -0,0 +1,103 @@
+package router
+
+import (
+	"compress/gzip"
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store/memstore"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestResponseCompression(t *testing.T) {
+	db := memstore.New("admin-key", "pool-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &model.Cookie{Domain: "a.com", Name: "x", Value: "1", Path: "/"}
+	if err := db.SyncCookies(context.Background(), user.ID, []*model.Cookie{c}); err != nil {
+		t.Fatal(err)
+	}
+	mux := NewRouter(db, locker.NewLocal(time.Second), &config.Config{MaxBodyBytes: 1 << 20})
+
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"", "", func(r io.Reader) (io.Reader, error) { return r, nil }},
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, deflate, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/cookies/all", nil)
+			req.Header.Set("x-api-key", user.APIKey)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			body, err := tt.decode(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp struct {
+				Data map[string]string `json:"data"`
+			}
+			if err := json.NewDecoder(body).Decode(&resp); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if resp.Data["a.com"] != "x=1" {
+				t.Errorf("data = %v, want a.com: x=1", resp.Data)
+			}
+		})
+	}
+}
+
+func TestExportDoesNotShadowDomains(t *testing.T) {
+	db := memstore.New("admin-key", "pool-key")
+	user, err := db.EnsureDefaultUser("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &model.Cookie{Domain: "export", Name: "x", Value: "1", Path: "/"}
+	if err := db.SyncCookies(context.Background(), user.ID, []*model.Cookie{c}); err != nil {
+		t.Fatal(err)
+	}
+	mux := NewRouter(db, locker.NewLocal(time.Second), &config.Config{MaxBodyBytes: 1 << 20})
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("x-api-key", user.APIKey)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/cookies/export")
+	var resp struct {
+		Data string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || resp.Data != "x=1" {
+		t.Errorf("cookies of domain export: status %d, %q, want x=1", rec.Code, resp.Data)
+	}
+	if rec := get("/api/v1/export/cookies?format=netscape"); rec.Code != http.StatusOK {
+		t.Errorf("export: status %d: %s", rec.Code, rec.Body)
+	}
+}
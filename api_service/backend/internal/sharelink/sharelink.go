@@ -0,0 +1,106 @@
+// Package sharelink issues share link tokens, protects links with passwords
+// and decides which cookies a link hands out.
+package sharelink
+
+import (
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/token"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenPrefix starts every share link token.
+const tokenPrefix = "csl_"
+
+// MaxActivePerUser is how many usable links a user may have at once.
+const MaxActivePerUser = 50
+
+// MaxPasswordBytes is the longest password bcrypt can hash.
+const MaxPasswordBytes = 72
+
+// MaxFailedAttempts is how many wrong passwords lock a link for good, so a
+// leaked token cannot be used to guess its password.
+const MaxFailedAttempts = 5
+
+// Why a link may not be redeemed.
+const (
+	ReasonRevoked       = "revoked"
+	ReasonExpired       = "expired"
+	ReasonUsedUp        = "used_up"
+	ReasonWrongPassword = "wrong_password"
+	ReasonLocked        = "locked"
+	ReasonSuspended     = "owner_suspended"
+)
+
+// NewToken returns a new random token, the prefix shown to its owner to tell
+// links apart and the hash to store.
+func NewToken() (tok, prefix, hash string, err error) {
+	return token.New(tokenPrefix)
+}
+
+// Hash returns the hash under which a link's token is stored.
+func Hash(tok string) string {
+	return token.Hash(tok)
+}
+
+// HashPassword returns the bcrypt hash to store for password, which people
+// choose and which therefore needs a slow hash.
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordBytes {
+		return "", fmt.Errorf("password is longer than %d bytes", MaxPasswordBytes)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("could not hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password opens link. A link without a
+// password opens with any.
+func CheckPassword(link *model.ShareLink, password string) (bool, error) {
+	if link.PasswordHash == "" {
+		return true, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Inactive returns why link may not be redeemed at now, or "" if it may.
+func Inactive(link *model.ShareLink, now time.Time) string {
+	switch {
+	case link.RevokedAt != nil:
+		return ReasonRevoked
+	case link.FailedAttempts >= MaxFailedAttempts:
+		return ReasonLocked
+	case !now.Before(link.ExpiresAt):
+		return ReasonExpired
+	case link.Uses >= link.MaxUses:
+		return ReasonUsedUp
+	}
+	return ""
+}
+
+// Filter returns the cookies that link hands out: those for its domain and
+// its subdomains, if it has one, with one of its names, if it has any.
+func Filter(link *model.ShareLink, cookies []*model.Cookie) []*model.Cookie {
+	shared := make([]*model.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		if link.Domain != "" && !poolhealth.Covers(link.Domain, c.Domain) {
+			continue
+		}
+		if len(link.Names) > 0 && !slices.Contains(link.Names, c.Name) {
+			continue
+		}
+		shared = append(shared, c)
+	}
+	return shared
+}
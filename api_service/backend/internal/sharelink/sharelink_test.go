@@ -0,0 +1,86 @@
+package sharelink
+
+import (
+	"cookie-syncer/api/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewToken(t *testing.T) {
+	token, prefix, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) || !strings.HasPrefix(token, prefix) || len(prefix) >= len(token) {
+		t.Errorf("token %q with prefix %q", token, prefix)
+	}
+	if hash != Hash(token) || hash == token {
+		t.Errorf("hash %q, want the token's hash", hash)
+	}
+	if other, _, _, _ := NewToken(); other == token {
+		t.Error("two tokens are the same")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := &model.ShareLink{PasswordHash: hash}
+	if ok, err := CheckPassword(link, "hunter2"); !ok || err != nil {
+		t.Errorf("right password: %v, %v", ok, err)
+	}
+	if ok, err := CheckPassword(link, "hunter3"); ok || err != nil {
+		t.Errorf("wrong password: %v, %v", ok, err)
+	}
+	if ok, _ := CheckPassword(&model.ShareLink{}, "anything"); !ok {
+		t.Error("a link without a password refused a password")
+	}
+	if _, err := HashPassword(strings.Repeat("x", MaxPasswordBytes+1)); err == nil {
+		t.Error("an overlong password was hashed")
+	}
+}
+
+func TestInactive(t *testing.T) {
+	now := time.Now()
+	revoked := now.Add(-time.Minute)
+	tests := []struct {
+		link *model.ShareLink
+		want string
+	}{
+		{&model.ShareLink{MaxUses: 1, ExpiresAt: now.Add(time.Hour)}, ""},
+		{&model.ShareLink{MaxUses: 1, ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked}, ReasonRevoked},
+		{&model.ShareLink{MaxUses: 1, ExpiresAt: now}, ReasonExpired},
+		{&model.ShareLink{MaxUses: 2, Uses: 2, ExpiresAt: now.Add(time.Hour)}, ReasonUsedUp},
+	}
+	for _, tt := range tests {
+		if got := Inactive(tt.link, now); got != tt.want {
+			t.Errorf("Inactive(%+v) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	cookies := []*model.Cookie{
+		{Domain: ".example.com", Name: "sid"},
+		{Domain: "www.example.com", Name: "pref"},
+		{Domain: "other.org", Name: "sid"},
+	}
+	names := func(link *model.ShareLink) (out []string) {
+		for _, c := range Filter(link, cookies) {
+			out = append(out, c.Domain+"/"+c.Name)
+		}
+		return out
+	}
+	if got := names(&model.ShareLink{Domain: "example.com"}); len(got) != 2 {
+		t.Errorf("domain link hands out %v, want both example.com cookies", got)
+	}
+	if got := names(&model.ShareLink{Names: []string{"sid"}}); len(got) != 2 || got[1] != "other.org/sid" {
+		t.Errorf("names link hands out %v, want sid on every domain", got)
+	}
+	if got := names(&model.ShareLink{Domain: "example.com", Names: []string{"sid"}}); len(got) != 1 || got[0] != ".example.com/sid" {
+		t.Errorf("domain and names link hands out %v, want .example.com/sid", got)
+	}
+}
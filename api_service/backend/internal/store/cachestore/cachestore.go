@@ -0,0 +1,304 @@
+// Package cachestore wraps a store.Store with a read-through cache for cookie
+// reads and pool queries.
+//
+// Cached entries are never deleted individually. Instead every key embeds a
+// generation counter: a sync bumps the user's generation and the pool
+// generation, and sharing changes bump the pool generation, so later reads
+// use fresh keys and the stale entries simply age out. Generations are bumped
+// after the underlying write commits, which makes a concurrent read that
+// caches old data harmless: it stores under the old generation.
+package cachestore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// keyPrefix namespaces all keys, which matters for a shared Redis.
+const keyPrefix = "cookiepusher:"
+
+// Backend stores cache entries and generation counters.
+type Backend interface {
+	// Name identifies the backend in stats, e.g. "memory" or "redis".
+	Name() string
+	// Get returns the value stored under key, if any.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Generation returns the counter stored under key, 0 if it was never bumped.
+	Generation(ctx context.Context, key string) (int64, error)
+	// Bump increments the counter stored under key.
+	Bump(ctx context.Context, key string) error
+	// Close releases the backend's resources.
+	Close() error
+}
+
+// Store is a store.Store whose cookie reads go through a cache. Every other
+// method is passed straight to the wrapped store.
+type Store struct {
+	store.Store
+	backend Backend
+	ttl     time.Duration
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	errors        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// New wraps next with a cache kept in backend. Entries live for at most ttl.
+func New(next store.Store, backend Backend, ttl time.Duration) *Store {
+	return &Store{Store: next, backend: backend, ttl: ttl}
+}
+
+// Close closes the cache backend. The wrapped store is left open.
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+// Stats describes cache usage since the store was created.
+type Stats struct {
+	Backend       string  `json:"backend"`             // memory, redis or none
+	Hits          uint64  `json:"hits"`                // reads answered from the cache
+	Misses        uint64  `json:"misses"`              // reads that went to the database
+	HitRatio      float64 `json:"hit_ratio"`           // hits / (hits + misses)
+	Errors        uint64  `json:"errors"`              // backend failures, answered from the database instead
+	Invalidations uint64  `json:"invalidations"`       // generation bumps caused by writes
+	Entries       int     `json:"entries,omitempty"`   // entries currently held (memory only)
+	Evictions     uint64  `json:"evictions,omitempty"` // entries dropped to make room (memory only)
+	TTLMS         int64   `json:"ttl_ms"`              // configured entry lifetime in milliseconds
+}
+
+// CacheStats returns a snapshot of the cache counters.
+func (s *Store) CacheStats() Stats {
+	stats := Stats{
+		Backend:       s.backend.Name(),
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Errors:        s.errors.Load(),
+		Invalidations: s.invalidations.Load(),
+		TTLMS:         s.ttl.Milliseconds(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	if lru, ok := s.backend.(*LRU); ok {
+		stats.Entries, stats.Evictions = lru.Len(), lru.Evictions()
+	}
+	return stats
+}
+
+// --- Keys ---
+
+const poolGenerationKey = keyPrefix + "gen:pool"
+
+func userGenerationKey(userID int64) string {
+	return fmt.Sprintf("%sgen:user:%d", keyPrefix, userID)
+}
+
+// --- Cached reads ---
+
+func (s *Store) GetCookiesByUserID(ctx context.Context, userID int64) ([]*model.Cookie, error) {
+	return s.cached(ctx, userGenerationKey(userID), fmt.Sprintf("user:%d:all", userID), func() ([]*model.Cookie, error) {
+		return s.Store.GetCookiesByUserID(ctx, userID)
+	})
+}
+
+func (s *Store) GetCookiesByDomain(ctx context.Context, userID int64, domain string) ([]*model.Cookie, error) {
+	return s.cached(ctx, userGenerationKey(userID), fmt.Sprintf("user:%d:domain:%s", userID, domain), func() ([]*model.Cookie, error) {
+		return s.Store.GetCookiesByDomain(ctx, userID, domain)
+	})
+}
+
+func (s *Store) GetSharableCookiesByDomain(ctx context.Context, domain string) ([]*model.Cookie, error) {
+	return s.cached(ctx, poolGenerationKey, "pool:domain:"+domain, func() ([]*model.Cookie, error) {
+		return s.Store.GetSharableCookiesByDomain(ctx, domain)
+	})
+}
+
+// cached answers a read from the cache entry for name under the current value
+// of genKey, loading and storing it on a miss. Backend failures are logged
+// and the read is served by load.
+func (s *Store) cached(ctx context.Context, genKey, name string, load func() ([]*model.Cookie, error)) ([]*model.Cookie, error) {
+	gen, err := s.backend.Generation(ctx, genKey)
+	if err != nil {
+		s.backendError(ctx, err, "read generation")
+		s.misses.Add(1)
+		return load()
+	}
+	key := fmt.Sprintf("%s%s:g%d", keyPrefix, name, gen)
+
+	data, ok, err := s.backend.Get(ctx, key)
+	if err != nil {
+		s.backendError(ctx, err, "read entry")
+	} else if ok {
+		var cookies []*model.Cookie
+		if err := json.Unmarshal(data, &cookies); err == nil {
+			s.hits.Add(1)
+			return cookies, nil
+		}
+		s.backendError(ctx, err, "decode entry")
+	}
+
+	s.misses.Add(1)
+	cookies, err := load()
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(cookies)
+	if err == nil {
+		err = s.backend.Set(ctx, key, data, s.ttl)
+	}
+	if err != nil {
+		s.backendError(ctx, err, "store entry")
+	}
+	return cookies, nil
+}
+
+// --- Writes that invalidate ---
+
+// SyncCookies replaces the user's cookies and invalidates their cached reads
+// and the pool.
+func (s *Store) SyncCookies(ctx context.Context, userID int64, cookies []*model.Cookie) error {
+	if err := s.Store.SyncCookies(ctx, userID, cookies); err != nil {
+		return err
+	}
+	s.invalidate(ctx, userGenerationKey(userID), poolGenerationKey)
+	return nil
+}
+
+func (s *Store) UpdateUserSharing(ctx context.Context, userID int64, enabled bool) error {
+	if err := s.Store.UpdateUserSharing(ctx, userID, enabled); err != nil {
+		return err
+	}
+	s.invalidate(ctx, poolGenerationKey)
+	return nil
+}
+
+func (s *Store) UpdateUserSharingRules(ctx context.Context, userID int64, rules model.SharingRules) error {
+	if err := s.Store.UpdateUserSharingRules(ctx, userID, rules); err != nil {
+		return err
+	}
+	s.invalidate(ctx, poolGenerationKey)
+	return nil
+}
+
+// ReportPoolSession invalidates the pool when the report quarantines the
+// session.
+func (s *Store) ReportPoolSession(ctx context.Context, clientID, userID int64, domain, reason string, policy poolhealth.Policy) (*model.PoolSessionHealth, error) {
+	health, err := s.Store.ReportPoolSession(ctx, clientID, userID, domain, reason, policy)
+	if err != nil {
+		return nil, err
+	}
+	if poolhealth.Quarantined(health, time.Now()) {
+		s.invalidate(ctx, poolGenerationKey)
+	}
+	return health, nil
+}
+
+// RecordProbeResult invalidates the pool, which prefers sessions that the
+// probes have not found expired, when the session becomes or stops being
+// expired. Other results leave the pool as it was.
+func (s *Store) RecordProbeResult(ctx context.Context, result *model.ProbeResult) error {
+	wasExpired, known := s.probeExpired(ctx, result.ProbeID, result.UserID)
+	if err := s.Store.RecordProbeResult(ctx, result); err != nil {
+		return err
+	}
+	if !known || wasExpired != (result.Outcome == model.ProbeExpired) {
+		s.invalidate(ctx, poolGenerationKey)
+	}
+	return nil
+}
+
+// probeExpired reports whether the user's latest result for the probe is
+// expired. known is false if that could not be found out.
+func (s *Store) probeExpired(ctx context.Context, probeID, userID int64) (expired, known bool) {
+	results, err := s.Store.ListProbeResults(ctx, userID)
+	if err != nil {
+		return false, false
+	}
+	for _, r := range results {
+		if r.ProbeID == probeID {
+			return r.Outcome == model.ProbeExpired, true
+		}
+	}
+	return false, true
+}
+
+// EndPoolLease invalidates the pool when the lease is released as working,
+// which resets the failures of the leased session.
+func (s *Store) EndPoolLease(ctx context.Context, clientID, leaseID int64, outcome string) (*model.PoolLease, error) {
+	lease, err := s.Store.EndPoolLease(ctx, clientID, leaseID, outcome)
+	if err != nil {
+		return nil, err
+	}
+	if outcome == model.LeaseReleased {
+		s.invalidate(ctx, poolGenerationKey)
+	}
+	return lease, nil
+}
+
+func (s *Store) DeleteSessionProbe(ctx context.Context, probeID int64) error {
+	if err := s.Store.DeleteSessionProbe(ctx, probeID); err != nil {
+		return err
+	}
+	s.invalidate(ctx, poolGenerationKey)
+	return nil
+}
+
+func (s *Store) SuspendUser(ctx context.Context, userID int64) error {
+	if err := s.Store.SuspendUser(ctx, userID); err != nil {
+		return err
+	}
+	s.invalidate(ctx, userGenerationKey(userID), poolGenerationKey)
+	return nil
+}
+
+// DeleteTeam invalidates the cached reads of the team's vault, whose cookies
+// it deletes.
+func (s *Store) DeleteTeam(ctx context.Context, teamID int64) error {
+	team, err := s.Store.GetTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteTeam(ctx, teamID); err != nil {
+		return err
+	}
+	s.invalidate(ctx, userGenerationKey(team.VaultUserID))
+	return nil
+}
+
+// invalidate bumps the given generations. The write has already committed,
+// so a failure is logged rather than returned; affected entries then stay
+// stale until their TTL runs out. The bump must not be skipped because the
+// caller gave up, so it ignores ctx's cancellation.
+func (s *Store) invalidate(ctx context.Context, genKeys ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range genKeys {
+		if err := s.backend.Bump(ctx, key); err != nil {
+			s.errors.Add(1)
+			log.Error().Err(err).Str("key", key).Dur("ttl", s.ttl).Msg("Could not invalidate cache, entries stay stale until they expire")
+			continue
+		}
+		s.invalidations.Add(1)
+	}
+}
+
+func (s *Store) backendError(ctx context.Context, err error, op string) {
+	if ctx.Err() != nil {
+		// The caller gave up; the wrapped store reports that.
+		return
+	}
+	s.errors.Add(1)
+	log.Warn().Err(err).Str("backend", s.backend.Name()).Msgf("Cache could not %s, using the database", op)
+}
+
+var _ store.Store = (*Store)(nil)
@@ -0,0 +1,217 @@
+package cachestore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/memstore"
+	"cookie-syncer/api/internal/store/storetest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryCache(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New(memstore.New("admin-key", "pool-key"), NewLRU(100), time.Minute)
+	})
+}
+
+func TestRedisCache(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New(memstore.New("admin-key", "pool-key"), newTestRedis(t), time.Minute)
+	})
+}
+
+func newTestRedis(t *testing.T) *Redis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r, err := NewRedis(context.Background(), "redis://"+mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// fixture is a cached store with one sharing user who synced a cookie.
+type fixture struct {
+	*Store
+	user *model.User
+}
+
+func newFixture(t *testing.T, backend Backend) fixture {
+	t.Helper()
+	ctx := context.Background()
+	s := New(memstore.New("admin-key", "pool-key"), backend, time.Minute)
+	users, err := s.CreateUsers(ctx, []string{"alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fixture{Store: s, user: users[0]}
+	if err := s.UpdateUserSharing(ctx, f.user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	f.sync(t, "v1")
+	return f
+}
+
+func (f fixture) sync(t *testing.T, value string) {
+	t.Helper()
+	c := &model.Cookie{Domain: "example.com", Name: "sid", Value: value, Path: "/", IsSharable: true}
+	if err := f.SyncCookies(context.Background(), f.user.ID, []*model.Cookie{c}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read performs every cached read and checks the values they return.
+func (f fixture) read(t *testing.T, want string, wantPool bool) {
+	t.Helper()
+	ctx := context.Background()
+	check := func(what string, cookies []*model.Cookie, err error, want string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		got := ""
+		if len(cookies) > 0 {
+			got = cookies[0].Value
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", what, got, want)
+		}
+	}
+	all, err := f.GetCookiesByUserID(ctx, f.user.ID)
+	check("GetCookiesByUserID", all, err, want)
+	byDomain, err := f.GetCookiesByDomain(ctx, f.user.ID, "example.com")
+	check("GetCookiesByDomain", byDomain, err, want)
+	pool, err := f.GetSharableCookiesByDomain(ctx, "example.com")
+	if !wantPool {
+		want = ""
+	}
+	check("GetSharableCookiesByDomain", pool, err, want)
+}
+
+func TestReadThroughAndInvalidation(t *testing.T) {
+	backends := map[string]func(t *testing.T) Backend{
+		"memory": func(t *testing.T) Backend { return NewLRU(100) },
+		"redis":  func(t *testing.T) Backend { return newTestRedis(t) },
+	}
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t, newBackend(t))
+
+			f.read(t, "v1", true)
+			f.read(t, "v1", true)
+			if stats := f.CacheStats(); stats.Misses != 3 || stats.Hits != 3 || stats.Backend != name {
+				t.Fatalf("stats after two reads = %+v, want 3 misses then 3 hits on %s", stats, name)
+			}
+
+			// A sync invalidates the user's reads and the pool.
+			f.sync(t, "v2")
+			f.read(t, "v2", true)
+
+			// Turning sharing off invalidates the pool but not the user's reads.
+			before := f.CacheStats()
+			if err := f.UpdateUserSharing(context.Background(), f.user.ID, false); err != nil {
+				t.Fatal(err)
+			}
+			f.read(t, "v2", false)
+			after := f.CacheStats()
+			if hits, misses := after.Hits-before.Hits, after.Misses-before.Misses; hits != 2 || misses != 1 {
+				t.Errorf("after sharing toggle: %d hits, %d misses, want 2 and 1", hits, misses)
+			}
+			if after.Errors != 0 {
+				t.Errorf("stats = %+v, want no errors", after)
+			}
+		})
+	}
+}
+
+func TestReadsSurviveBackendFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r, err := NewRedis(context.Background(), "redis://"+mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f := newFixture(t, r)
+	f.read(t, "v1", true)
+
+	mr.Close()
+	f.read(t, "v1", true)
+	f.sync(t, "v2") // the write succeeds even though invalidation fails
+	f.read(t, "v2", true)
+
+	if stats := f.CacheStats(); stats.Errors == 0 {
+		t.Errorf("stats = %+v, want backend errors counted", stats)
+	}
+}
+
+func TestEntriesExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r, err := NewRedis(context.Background(), "redis://"+mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f := newFixture(t, r)
+	f.read(t, "v1", true)
+
+	mr.FastForward(2 * time.Minute)
+	f.read(t, "v1", true)
+	if stats := f.CacheStats(); stats.Hits != 0 || stats.Misses != 6 {
+		t.Errorf("stats = %+v, want every read to miss after the TTL", stats)
+	}
+}
+
+func TestPoolHealthInvalidation(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, NewLRU(100))
+	probe := &model.SessionProbe{Domain: "example.com", URL: "https://example.com/", ExpectStatus: 200}
+	if err := f.CreateSessionProbe(ctx, probe); err != nil {
+		t.Fatal(err)
+	}
+
+	invalidatedBy := func(what string, want bool, write func() error) {
+		t.Helper()
+		before := f.CacheStats().Invalidations
+		if err := write(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if got := f.CacheStats().Invalidations > before; got != want {
+			t.Errorf("%s invalidated the pool: %v, want %v", what, got, want)
+		}
+	}
+	record := func(outcome string) func() error {
+		return func() error {
+			return f.RecordProbeResult(ctx, &model.ProbeResult{ProbeID: probe.ID, UserID: f.user.ID, Domain: "example.com", Outcome: outcome, CheckedAt: time.Now()})
+		}
+	}
+	invalidatedBy("first ok result", false, record(model.ProbeOK))
+	invalidatedBy("repeated ok result", false, record(model.ProbeOK))
+	invalidatedBy("error after ok", false, record(model.ProbeError))
+	invalidatedBy("expired result", true, record(model.ProbeExpired))
+	invalidatedBy("repeated expired result", false, record(model.ProbeExpired))
+	invalidatedBy("ok after expired", true, record(model.ProbeOK))
+
+	lease := func() *model.PoolLease {
+		t.Helper()
+		l, _, err := f.LeasePoolSession(ctx, 1, "example.com", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	bad := lease()
+	invalidatedBy("lease ended as bad", false, func() error {
+		_, err := f.EndPoolLease(ctx, 1, bad.ID, model.LeaseBad)
+		return err
+	})
+	good := lease()
+	invalidatedBy("lease released", true, func() error {
+		_, err := f.EndPoolLease(ctx, 1, good.ID, model.LeaseReleased)
+		return err
+	})
+}
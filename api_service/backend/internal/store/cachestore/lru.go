@@ -0,0 +1,112 @@
+package cachestore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process Backend holding at most a fixed number of entries,
+// evicting the least recently used one to make room. It only serves the
+// process it lives in, so replicas sharing a database should use Redis.
+type LRU struct {
+	size int
+
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List // front is most recently used
+	generations map[string]int64
+	evictions   uint64
+	now         func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an empty LRU holding up to size entries.
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:        max(size, 1),
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		generations: make(map[string]int64),
+		now:         time.Now,
+	}
+}
+
+func (c *LRU) Name() string { return "memory" }
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+	for c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	return nil
+}
+
+// Generation returns a counter. Counters are kept apart from the entries and
+// never evicted: losing one would make stale entries current again.
+func (c *LRU) Generation(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[key], nil
+}
+
+func (c *LRU) Bump(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[key]++
+	return nil
+}
+
+func (c *LRU) Close() error { return nil }
+
+// Len returns the number of entries held, including expired ones not yet
+// dropped.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Evictions returns how many entries were dropped to make room.
+func (c *LRU) Evictions() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evictions
+}
+
+var _ Backend = (*LRU)(nil)
@@ -0,0 +1,64 @@
+package cachestore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	c.Get(ctx, "a") // b is now the least recently used
+	c.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if c.Len() != 2 || c.Evictions() != 1 {
+		t.Errorf("Len = %d, Evictions = %d, want 2 and 1", c.Len(), c.Evictions())
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	now = now.Add(59 * time.Second)
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("entry expired early")
+	}
+	now = now.Add(time.Second)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Fatal("entry outlived its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len = %d, want the expired entry dropped", c.Len())
+	}
+}
+
+func TestLRUGenerationsAreNotEvicted(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(1)
+	c.Bump(ctx, "gen")
+	c.Bump(ctx, "gen")
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+
+	if gen, _ := c.Generation(ctx, "gen"); gen != 2 {
+		t.Errorf("Generation = %d, want 2", gen)
+	}
+	if gen, _ := c.Generation(ctx, "other"); gen != 0 {
+		t.Errorf("Generation of an unknown key = %d, want 0", gen)
+	}
+}
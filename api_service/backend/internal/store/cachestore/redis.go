@@ -0,0 +1,73 @@
+package cachestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Backend kept in Redis, shared by every replica using the same
+// server, so a sync handled by one replica invalidates the others' reads.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at url, e.g.
+// "redis://:password@localhost:6379/0", and checks that it answers. Failed
+// commands and dials are not retried (unless the URL sets max_retries): a
+// read is better served by the database than held up by an unreachable cache.
+func NewRedis(ctx context.Context, url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse redis URL: %w", err)
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = -1
+	}
+	opts.DialerRetries = 1
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to redis: %w", err)
+	}
+	return &Redis{client: client}, nil
+}
+
+func (c *Redis) Name() string { return "redis" }
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *Redis) Generation(ctx context.Context, key string) (int64, error) {
+	gen, err := c.client.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return gen, err
+}
+
+// Bump increments a counter. Counters have no expiry; a server evicting them
+// under memory pressure would only make entries of the reset generation
+// current again until their TTL runs out.
+func (c *Redis) Bump(ctx context.Context, key string) error {
+	return c.client.Incr(ctx, key).Err()
+}
+
+func (c *Redis) Close() error { return c.client.Close() }
+
+var _ Backend = (*Redis)(nil)
@@ -0,0 +1,16 @@
+package store
+
+import "errors"
+
+// Sentinel errors returned (wrapped) by Store implementations. Callers match
+// them with errors.Is.
+var (
+	// ErrNotFound means the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write would violate a uniqueness constraint.
+	ErrConflict = errors.New("already exists")
+	// ErrUnavailable means the database could not serve the request right
+	// now (connection lost, locked, timed out or cancelled); retrying later
+	// may succeed.
+	ErrUnavailable = errors.New("temporarily unavailable")
+)
@@ -0,0 +1,296 @@
+package gormstore
+
+import (
+	"cookie-syncer/api/internal/model"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// backupFormatVersion is bumped whenever the Backup layout changes. Layouts
+// only grow, so older backups restore with the data they lack left empty;
+// newer ones are refused, as they may hold data this binary would drop.
+const backupFormatVersion = 2
+
+// Backup is a dialect-independent snapshot of all stored data. It can be
+// restored into any supported database type.
+type Backup struct {
+	FormatVersion   int                    `json:"format_version"`
+	CreatedAt       time.Time              `json:"created_at"`
+	Dialect         string                 `json:"dialect"`
+	Users           []BackupUser           `json:"users"`
+	Cookies         []*model.Cookie        `json:"cookies"`
+	PoolClients     []BackupPoolClient     `json:"pool_clients,omitempty"`
+	SessionProbes   []model.SessionProbe   `json:"session_probes,omitempty"`
+	Teams           []model.Team           `json:"teams,omitempty"`
+	TeamMembers     []model.TeamMember     `json:"team_members,omitempty"`
+	ShareLinks      []BackupShareLink      `json:"share_links,omitempty"`
+	ShareLinkEvents []model.ShareLinkEvent `json:"share_link_events,omitempty"`
+}
+
+// BackupPoolClient is model.PoolClient including its key hash.
+type BackupPoolClient struct {
+	model.PoolClient
+	KeyHash string `json:"key_hash"`
+}
+
+// BackupShareLink is model.ShareLink including its owner and the hashes of
+// its token and password.
+type BackupShareLink struct {
+	model.ShareLink
+	UserID       int64  `json:"user_id"`
+	TokenHash    string `json:"token_hash"`
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// BackupUser is model.User including the fields it hides from JSON.
+type BackupUser struct {
+	ID             int64              `json:"id"`
+	APIKey         string             `json:"api_key"`
+	Remark         *string            `json:"remark,omitempty"`
+	SharingEnabled bool               `json:"sharing_enabled"`
+	LastSyncedAt   *time.Time         `json:"last_synced_at,omitempty"`
+	Quota          model.Quota        `json:"quota"`
+	DomainRules    model.DomainRules  `json:"domain_rules"`
+	SharingRules   model.SharingRules `json:"sharing_rules"`
+	TeamID         *int64             `json:"team_id,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	DeletedAt      *time.Time         `json:"deleted_at,omitempty"`
+}
+
+// WriteBackup writes a JSON snapshot of all users, including suspended ones,
+// and all cookies to w.
+func (s *GormStore) WriteBackup(w io.Writer) (*Backup, error) {
+	backup := &Backup{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Dialect:       s.Dialect(),
+	}
+
+	var users []*model.User
+	if err := s.db.Unscoped().Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not read users: %w", err)
+	}
+	backup.Users = make([]BackupUser, 0, len(users))
+	for _, u := range users {
+		bu := BackupUser{
+			ID:             u.ID,
+			APIKey:         u.APIKey,
+			Remark:         u.Remark,
+			SharingEnabled: u.SharingEnabled,
+			LastSyncedAt:   u.LastSyncedAt,
+			Quota:          u.Quota,
+			DomainRules:    u.DomainRules,
+			SharingRules:   u.SharingRules,
+			TeamID:         u.TeamID,
+			CreatedAt:      u.CreatedAt,
+			UpdatedAt:      u.UpdatedAt,
+		}
+		if u.DeletedAt.Valid {
+			deletedAt := u.DeletedAt.Time
+			bu.DeletedAt = &deletedAt
+		}
+		backup.Users = append(backup.Users, bu)
+	}
+
+	if err := s.db.Order("id").Find(&backup.Cookies).Error; err != nil {
+		return nil, fmt.Errorf("could not read cookies: %w", err)
+	}
+
+	var clients []model.PoolClient
+	if err := s.db.Order("id").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("could not read pool clients: %w", err)
+	}
+	for _, c := range clients {
+		backup.PoolClients = append(backup.PoolClients, BackupPoolClient{PoolClient: c, KeyHash: c.KeyHash})
+	}
+
+	if err := s.db.Order("id").Find(&backup.SessionProbes).Error; err != nil {
+		return nil, fmt.Errorf("could not read session probes: %w", err)
+	}
+
+	if err := s.db.Order("id").Find(&backup.Teams).Error; err != nil {
+		return nil, fmt.Errorf("could not read teams: %w", err)
+	}
+	if err := s.db.Order("team_id, user_id").Find(&backup.TeamMembers).Error; err != nil {
+		return nil, fmt.Errorf("could not read team members: %w", err)
+	}
+
+	var links []model.ShareLink
+	if err := s.db.Order("id").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("could not read share links: %w", err)
+	}
+	for _, l := range links {
+		backup.ShareLinks = append(backup.ShareLinks, BackupShareLink{ShareLink: l, UserID: l.UserID, TokenHash: l.TokenHash, PasswordHash: l.PasswordHash})
+	}
+	if err := s.db.Order("id").Find(&backup.ShareLinkEvents).Error; err != nil {
+		return nil, fmt.Errorf("could not read share link events: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(backup); err != nil {
+		return nil, fmt.Errorf("could not write backup: %w", err)
+	}
+	return backup, nil
+}
+
+// RestoreBackup replaces all users and cookies with the snapshot read from r.
+// The schema must already be migrated. Unless force is set, restoring into a
+// database that already has users is refused.
+func (s *GormStore) RestoreBackup(r io.Reader, force bool) (*Backup, error) {
+	var backup Backup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, fmt.Errorf("could not parse backup: %w", err)
+	}
+	if backup.FormatVersion < 1 || backup.FormatVersion > backupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d (this binary reads versions 1 to %d)", backup.FormatVersion, backupFormatVersion)
+	}
+
+	var userCount int64
+	if err := s.db.Unscoped().Model(&model.User{}).Count(&userCount).Error; err != nil {
+		return nil, fmt.Errorf("could not query user count: %w", err)
+	}
+	if userCount > 0 && !force {
+		return nil, fmt.Errorf("database already contains %d users; use force to overwrite", userCount)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.Cookie{}).Error; err != nil {
+			return fmt.Errorf("could not clear cookies: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.PoolClient{}).Error; err != nil {
+			return fmt.Errorf("could not clear pool clients: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.SessionProbe{}).Error; err != nil {
+			return fmt.Errorf("could not clear session probes: %w", err)
+		}
+		// Leases, reported failures, probe results and usage counts belong
+		// to the sessions being replaced.
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.PoolLease{}).Error; err != nil {
+			return fmt.Errorf("could not clear pool leases: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.PoolSessionHealth{}).Error; err != nil {
+			return fmt.Errorf("could not clear pool session health: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.PoolSessionReport{}).Error; err != nil {
+			return fmt.Errorf("could not clear pool session reports: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ProbeResult{}).Error; err != nil {
+			return fmt.Errorf("could not clear probe results: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.PoolUsage{}).Error; err != nil {
+			return fmt.Errorf("could not clear pool usage: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ShareLinkEvent{}).Error; err != nil {
+			return fmt.Errorf("could not clear share link events: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ShareLink{}).Error; err != nil {
+			return fmt.Errorf("could not clear share links: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.TeamMember{}).Error; err != nil {
+			return fmt.Errorf("could not clear team members: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.Team{}).Error; err != nil {
+			return fmt.Errorf("could not clear teams: %w", err)
+		}
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.User{}).Error; err != nil {
+			return fmt.Errorf("could not clear users: %w", err)
+		}
+
+		for _, bu := range backup.Users {
+			user := model.User{
+				ID:             bu.ID,
+				APIKey:         bu.APIKey,
+				Remark:         bu.Remark,
+				SharingEnabled: bu.SharingEnabled,
+				LastSyncedAt:   bu.LastSyncedAt,
+				Quota:          bu.Quota,
+				DomainRules:    bu.DomainRules,
+				SharingRules:   bu.SharingRules,
+				TeamID:         bu.TeamID,
+				CreatedAt:      bu.CreatedAt,
+				UpdatedAt:      bu.UpdatedAt,
+			}
+			if bu.DeletedAt != nil {
+				user.DeletedAt = gorm.DeletedAt{Time: *bu.DeletedAt, Valid: true}
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("could not restore user %d: %w", bu.ID, err)
+			}
+		}
+
+		for _, c := range backup.Cookies {
+			c.DomainKey = domainKey(c.Domain)
+		}
+		if len(backup.Cookies) > 0 {
+			if err := tx.CreateInBatches(backup.Cookies, 500).Error; err != nil {
+				return fmt.Errorf("could not restore cookies: %w", err)
+			}
+		}
+
+		for _, bc := range backup.PoolClients {
+			client := bc.PoolClient
+			client.KeyHash = bc.KeyHash
+			if err := tx.Create(&client).Error; err != nil {
+				return fmt.Errorf("could not restore pool client %d: %w", client.ID, err)
+			}
+		}
+
+		for _, p := range backup.SessionProbes {
+			if err := tx.Create(&p).Error; err != nil {
+				return fmt.Errorf("could not restore session probe %d: %w", p.ID, err)
+			}
+		}
+
+		for _, t := range backup.Teams {
+			if err := tx.Create(&t).Error; err != nil {
+				return fmt.Errorf("could not restore team %d: %w", t.ID, err)
+			}
+		}
+		if len(backup.TeamMembers) > 0 {
+			if err := tx.Create(&backup.TeamMembers).Error; err != nil {
+				return fmt.Errorf("could not restore team members: %w", err)
+			}
+		}
+
+		for _, bl := range backup.ShareLinks {
+			link := bl.ShareLink
+			link.UserID, link.TokenHash, link.PasswordHash = bl.UserID, bl.TokenHash, bl.PasswordHash
+			if err := tx.Create(&link).Error; err != nil {
+				return fmt.Errorf("could not restore share link %d: %w", link.ID, err)
+			}
+		}
+		if len(backup.ShareLinkEvents) > 0 {
+			if err := tx.CreateInBatches(backup.ShareLinkEvents, 500).Error; err != nil {
+				return fmt.Errorf("could not restore share link events: %w", err)
+			}
+		}
+
+		return resetSequences(tx, "users", "cookies", "pool_clients", "session_probes", "teams", "share_links", "share_link_events")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// resetSequences moves Postgres ID sequences past the restored rows so new
+// inserts do not collide. SQLite and MySQL advance their counters on explicit
+// inserts by themselves.
+func resetSequences(tx *gorm.DB, tables ...string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)`, table)
+		if err := tx.Exec(query).Error; err != nil {
+			return fmt.Errorf("could not reset %s id sequence: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package gormstore
+
+import (
+	"bytes"
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func openTestStore(t *testing.T) *GormStore {
+	t.Helper()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	s, err := Open(&config.Config{
+		DBType:               "sqlite",
+		DSN:                  filepath.Join(t.TempDir(), "test.db"),
+		DBMaxOpenConnections: 1,
+		DBMaxIdleConnections: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, err := s.MigrateUp(false); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBackupRestoresShareLinks(t *testing.T) {
+	ctx := context.Background()
+	src := openTestStore(t)
+	users, err := src.CreateUsers(ctx, []string{"owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := &model.ShareLink{UserID: users[0].ID, TokenHash: "token-hash", TokenPrefix: "sl_abc", Domain: "example.com", Names: []string{"sid"}, PasswordHash: "password-hash", MaxUses: 3, Uses: 1, FailedAttempts: 2, ExpiresAt: time.Now().Add(time.Hour).UTC()}
+	if err := src.CreateShareLink(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*model.ShareLinkEvent{
+		{LinkID: link.ID, Event: model.ShareLinkCreated},
+		{LinkID: link.ID, Event: model.ShareLinkDenied, Detail: "wrong password"},
+		{LinkID: link.ID, Event: model.ShareLinkDenied, Detail: "wrong password"},
+	} {
+		if err := src.AddShareLinkEvent(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := src.WriteBackup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := openTestStore(t)
+	backup, err := dst.RestoreBackup(&buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.ShareLinks) != 1 || len(backup.ShareLinkEvents) != 2 {
+		t.Fatalf("backup has %d share links and %d events, want 1 and 2", len(backup.ShareLinks), len(backup.ShareLinkEvents))
+	}
+
+	restored, err := dst.GetShareLinkByTokenHash(ctx, "token-hash")
+	if err != nil {
+		t.Fatalf("GetShareLinkByTokenHash after restore: %v", err)
+	}
+	if restored.ID != link.ID || restored.UserID != link.UserID || restored.PasswordHash != "password-hash" || restored.Uses != 1 || restored.FailedAttempts != 2 || len(restored.Names) != 1 {
+		t.Errorf("restored link = %+v, want %+v", restored, link)
+	}
+	events, err := dst.ListShareLinkEvents(ctx, link.UserID, link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Repeats != 1 {
+		t.Errorf("restored events = %+v, want the creation and a denial repeated once", events)
+	}
+
+	// New rows do not collide with the restored ones.
+	next := &model.ShareLink{UserID: link.UserID, TokenHash: "other-hash", TokenPrefix: "sl_def", MaxUses: 1, ExpiresAt: link.ExpiresAt}
+	if err := dst.CreateShareLink(ctx, next); err != nil || next.ID == link.ID {
+		t.Errorf("CreateShareLink after restore = ID %d, %v", next.ID, err)
+	}
+}
+
+func TestRestoreChecksFormatVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		wantErr bool
+	}{
+		{0, true},
+		{1, false},
+		{backupFormatVersion, false},
+		{backupFormatVersion + 1, true},
+	}
+	for _, tt := range tests {
+		s := openTestStore(t)
+		backup := fmt.Sprintf(`{"format_version": %d, "users": [{"id": 1, "api_key": "key"}], "cookies": []}`, tt.version)
+		if _, err := s.RestoreBackup(strings.NewReader(backup), false); (err != nil) != tt.wantErr {
+			t.Errorf("restoring format version %d: error %v, want error %v", tt.version, err, tt.wantErr)
+		}
+	}
+}
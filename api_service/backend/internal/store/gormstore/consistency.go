@@ -0,0 +1,257 @@
+package gormstore
+
+import (
+	"cookie-syncer/api/internal/model"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of divergence reported by CheckConsistency.
+const (
+	// IssueLegacyBlobMismatch: users.cookies_json (pre-v6 schema) disagrees with the cookies table.
+	IssueLegacyBlobMismatch = "legacy_blob_mismatch"
+	// IssueLegacyBlobInvalid: users.cookies_json cannot be parsed and is ignored.
+	IssueLegacyBlobInvalid = "legacy_blob_invalid"
+	// IssueStaleDomainKey: cookies.domain_key does not match cookies.domain.
+	IssueStaleDomainKey = "stale_domain_key"
+	// IssueOrphanedCookie: a cookie belongs to a user that no longer exists.
+	IssueOrphanedCookie = "orphaned_cookie"
+)
+
+// ConsistencyIssue is one divergence found by CheckConsistency.
+type ConsistencyIssue struct {
+	Kind     string `json:"kind"`
+	UserID   int64  `json:"user_id"`
+	CookieID int64  `json:"cookie_id,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// ConsistencyReport lists the issues found and whether they were repaired.
+type ConsistencyReport struct {
+	Issues   []ConsistencyIssue `json:"issues"`
+	Repaired bool               `json:"repaired"`
+}
+
+// CheckConsistency verifies that the cookies table, the single source of truth
+// for stored cookies, is internally consistent. On databases that have not yet
+// run migration v6 it also compares the legacy users.cookies_json blob with the
+// table. With repair set, every issue found is fixed in one transaction; the
+// legacy blob wins over the table because it is what users were served.
+func (s *GormStore) CheckConsistency(repair bool) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{Issues: []ConsistencyIssue{}}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn("users", "cookies_json") {
+			issues, err := reconcileLegacyBlobs(tx, repair)
+			if err != nil {
+				return err
+			}
+			report.Issues = append(report.Issues, issues...)
+		}
+
+		if tx.Migrator().HasColumn("cookies", "domain_key") {
+			issues, err := fixDomainKeys(tx, repair)
+			if err != nil {
+				return err
+			}
+			report.Issues = append(report.Issues, issues...)
+		}
+
+		var orphans []model.Cookie
+		if err := tx.Table("cookies").Select("id, user_id").
+			Where("user_id NOT IN (SELECT id FROM users)").
+			Find(&orphans).Error; err != nil {
+			return fmt.Errorf("could not look for orphaned cookies: %w", err)
+		}
+		for _, c := range orphans {
+			report.Issues = append(report.Issues, ConsistencyIssue{Kind: IssueOrphanedCookie, UserID: c.UserID, CookieID: c.ID, Detail: "cookie references a missing user"})
+		}
+		if repair && len(orphans) > 0 {
+			if err := tx.Exec("DELETE FROM cookies WHERE user_id NOT IN (SELECT id FROM users)").Error; err != nil {
+				return fmt.Errorf("could not delete orphaned cookies: %w", err)
+			}
+		}
+
+		report.Repaired = repair && len(report.Issues) > 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// cookieIdentity is the unique key of a cookie within one user's jar.
+type cookieIdentity struct {
+	domain, name, path string
+}
+
+// reconcileLegacyBlobs compares each user's cookies_json blob with their rows
+// in the cookies table and, with repair set, replaces the rows with the blob.
+func reconcileLegacyBlobs(tx *gorm.DB, repair bool) ([]ConsistencyIssue, error) {
+	var users []struct {
+		ID          int64
+		CookiesJSON *string
+	}
+	if err := tx.Table("users").Select("id, cookies_json").Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not read legacy cookie blobs: %w", err)
+	}
+
+	hasDomainKey := tx.Migrator().HasColumn("cookies", "domain_key")
+	var issues []ConsistencyIssue
+	for _, u := range users {
+		var blob []*model.Cookie
+		if u.CookiesJSON != nil && *u.CookiesJSON != "" {
+			if err := json.Unmarshal([]byte(*u.CookiesJSON), &blob); err != nil {
+				issues = append(issues, ConsistencyIssue{Kind: IssueLegacyBlobInvalid, UserID: u.ID, Detail: err.Error()})
+				continue
+			}
+		}
+
+		var rows []*model.Cookie
+		if err := tx.Table("cookies").Select("domain, name, path, value").Where("user_id = ?", u.ID).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("could not read cookies for user %d: %w", u.ID, err)
+		}
+
+		// Later duplicates in the blob win, matching what the unique index allows.
+		want := make(map[cookieIdentity]*model.Cookie, len(blob))
+		for _, c := range blob {
+			want[cookieIdentity{c.Domain, c.Name, c.Path}] = c
+		}
+		have := make(map[cookieIdentity]string, len(rows))
+		for _, c := range rows {
+			have[cookieIdentity{c.Domain, c.Name, c.Path}] = c.Value
+		}
+
+		missing, extra, changed := 0, 0, 0
+		for id, c := range want {
+			value, ok := have[id]
+			if !ok {
+				missing++
+			} else if value != c.Value {
+				changed++
+			}
+		}
+		for id := range have {
+			if _, ok := want[id]; !ok {
+				extra++
+			}
+		}
+		if missing == 0 && extra == 0 && changed == 0 {
+			continue
+		}
+		issues = append(issues, ConsistencyIssue{
+			Kind:   IssueLegacyBlobMismatch,
+			UserID: u.ID,
+			Detail: fmt.Sprintf("%d missing from table, %d only in table, %d with different values", missing, extra, changed),
+		})
+		if !repair {
+			continue
+		}
+
+		if err := tx.Where("user_id = ?", u.ID).Delete(&model.Cookie{}).Error; err != nil {
+			return nil, fmt.Errorf("could not clear cookies for user %d: %w", u.ID, err)
+		}
+		ids := make([]cookieIdentity, 0, len(want))
+		for id := range want {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := ids[i], ids[j]
+			if a.domain != b.domain {
+				return a.domain < b.domain
+			}
+			if a.name != b.name {
+				return a.name < b.name
+			}
+			return a.path < b.path
+		})
+		now := time.Now()
+		for _, id := range ids {
+			c := want[id]
+			updatedAt := c.LastUpdatedFromExtensionAt
+			if updatedAt.IsZero() {
+				updatedAt = now
+			}
+			row := map[string]interface{}{
+				"user_id":                        u.ID,
+				"domain":                         c.Domain,
+				"name":                           c.Name,
+				"value":                          c.Value,
+				"path":                           c.Path,
+				"expires":                        c.Expires,
+				"http_only":                      c.HTTPOnly,
+				"secure":                         c.Secure,
+				"same_site":                      c.SameSite,
+				"is_sharable":                    c.IsSharable,
+				"last_updated_from_extension_at": updatedAt,
+			}
+			if hasDomainKey {
+				row["domain_key"] = domainKey(c.Domain)
+			}
+			if err := tx.Table("cookies").Create(row).Error; err != nil {
+				return nil, fmt.Errorf("could not restore cookie %s/%s for user %d: %w", c.Domain, c.Name, u.ID, err)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// fixDomainKeys finds cookies whose domain_key does not match their domain
+// and, with repair set, recomputes it.
+func fixDomainKeys(tx *gorm.DB, repair bool) ([]ConsistencyIssue, error) {
+	var issues []ConsistencyIssue
+	var rows []model.Cookie
+	err := tx.Table("cookies").Select("id, user_id, domain, domain_key").FindInBatches(&rows, 1000, func(batch *gorm.DB, _ int) error {
+		for _, c := range rows {
+			want := domainKey(c.Domain)
+			if c.DomainKey == want {
+				continue
+			}
+			issues = append(issues, ConsistencyIssue{
+				Kind:     IssueStaleDomainKey,
+				UserID:   c.UserID,
+				CookieID: c.ID,
+				Detail:   fmt.Sprintf("domain_key %q should be %q", c.DomainKey, want),
+			})
+			if repair {
+				if err := tx.Table("cookies").Where("id = ?", c.ID).Update("domain_key", want).Error; err != nil {
+					return fmt.Errorf("could not update domain_key of cookie %d: %w", c.ID, err)
+				}
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not check domain keys: %w", err)
+	}
+	return issues, nil
+}
+
+// rebuildLegacyBlobs regenerates users.cookies_json from the cookies table.
+// It is used when migration v6 is reverted.
+func rebuildLegacyBlobs(tx *gorm.DB) error {
+	var userIDs []int64
+	if err := tx.Table("users").Pluck("id", &userIDs).Error; err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		cookies := make([]*model.Cookie, 0)
+		if err := tx.Table("cookies").
+			Select("id, user_id, domain, name, value, path, expires, http_only, secure, same_site, is_sharable, last_updated_from_extension_at").
+			Where("user_id = ?", userID).Order("id").Find(&cookies).Error; err != nil {
+			return err
+		}
+		data, err := json.Marshal(cookies)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table("users").Where("id = ?", userID).Update("cookies_json", string(data)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package gormstore
+
+import "strings"
+
+// domainKey returns the indexed lookup key for a cookie domain: the domain
+// lower-cased, without its leading dot and with its labels reversed, so that
+// "www.example.com" becomes "com.example.www". A cookie matches a lookup for
+// "example.com" when its key equals "com.example" or starts with
+// "com.example.", which turns suffix matching into an index-friendly prefix
+// match.
+func domainKey(domain string) string {
+	labels := strings.Split(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// subdomainPattern returns a LIKE pattern (using '!' as the escape character)
+// matching the keys of all subdomains of key.
+func subdomainPattern(key string) string {
+	return likeEscaper.Replace(key) + ".%"
+}
+
+// hostSuffixPattern returns a LIKE pattern (using '!' as the escape
+// character) matching all subdomains of a plain, unreversed domain.
+func hostSuffixPattern(domain string) string {
+	return "%." + likeEscaper.Replace(domain)
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
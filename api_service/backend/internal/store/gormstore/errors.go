@@ -0,0 +1,98 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/store"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"modernc.org/sqlite"
+)
+
+// classify wraps err with the store sentinel error it corresponds to, keeping
+// the original error in the chain. Errors that match no sentinel, or that are
+// already classified, are returned unchanged.
+func classify(err error) error {
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrUnavailable) {
+		return err
+	}
+	if sentinel := sentinelFor(err); sentinel != nil {
+		return fmt.Errorf("%w: %w", sentinel, err)
+	}
+	return err
+}
+
+// pgUnavailableCodes are Postgres SQLSTATEs for transient failures.
+var pgUnavailableCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"55P03": true, // lock_not_available
+	"57014": true, // query_canceled
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+func sentinelFor(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return store.ErrNotFound
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return store.ErrConflict
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) {
+		return store.ErrUnavailable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return store.ErrUnavailable
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case 1555, 2067: // SQLITE_CONSTRAINT_PRIMARYKEY, SQLITE_CONSTRAINT_UNIQUE
+			return store.ErrConflict
+		}
+		switch sqliteErr.Code() & 0xff {
+		case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+			return store.ErrUnavailable
+		}
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505": // unique_violation
+			return store.ErrConflict
+		case strings.HasPrefix(pgErr.Code, "08"), pgUnavailableCodes[pgErr.Code]: // connection exceptions
+			return store.ErrUnavailable
+		}
+		return nil
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062: // ER_DUP_ENTRY
+			return store.ErrConflict
+		case 1040, 1205, 1213, 3024: // too many connections, lock wait timeout, deadlock, query timeout
+			return store.ErrUnavailable
+		}
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package gormstore
 
 import (
+	"context"
 	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/domainrule"
 	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
 	"cookie-syncer/api/internal/store"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sort"
 	"time"
 
 	"database/sql"
@@ -17,6 +20,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	_ "modernc.org/sqlite" // Anonymous import for the pure Go SQLite driver
 )
@@ -26,14 +30,20 @@ type GormStore struct {
 	db       *gorm.DB
 	adminKey string
 	poolKey  string
+
+	// syncBatchSize is the number of cookies written per INSERT statement
+	// during a sync.
+	syncBatchSize int
 }
 
-// New creates a new GormStore instance and connects to the database.
-func New(cfg *config.Config, adminKey, poolKey string) (store.Store, error) {
-	var dialector gorm.Dialector
+// defaultSyncBatchSize keeps a batch (12 columns per cookie) well below the
+// bind parameter limits of all supported databases.
+const defaultSyncBatchSize = 500
 
-	var db *gorm.DB
-	var err error
+// Open connects to the database described by cfg without touching the schema.
+// Maintenance commands use it directly; the server goes through New.
+func Open(cfg *config.Config) (*GormStore, error) {
+	var dialector gorm.Dialector
 
 	switch cfg.DBType {
 	case "postgres":
@@ -76,13 +86,11 @@ func New(cfg *config.Config, adminKey, poolKey string) (store.Store, error) {
 		},
 	)
 
-	if db == nil { // If not already opened by sqlite special case
-		db, err = gorm.Open(dialector, &gorm.Config{
-			Logger: gormLogger,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to database: %w", err)
-		}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: gormLogger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	// Get underlying sqlDB to configure connection pool
@@ -95,320 +103,68 @@ func New(cfg *config.Config, adminKey, poolKey string) (store.Store, error) {
 	// Set max idle connections
 	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConnections)
 
-	s := &GormStore{db: db, adminKey: adminKey, poolKey: poolKey}
-
-	// Run auto-migration
-	if err := s.migrate(); err != nil {
-		return nil, fmt.Errorf("could not migrate database schema: %w", err)
-	}
-
-	// Check and create default admin user if the database is empty
-	var userCount int64
-	if err := s.db.Model(&model.User{}).Count(&userCount).Error; err != nil {
-		return nil, fmt.Errorf("could not query user count: %w", err)
-	}
-
-	if userCount == 0 {
-		defaultAPIKey := uuid.New().String()
-		defaultUser := model.User{
-			APIKey:         defaultAPIKey,
-			Remark:         stringPtr("Default user"),
-			SharingEnabled: false,
-		}
-		if err := s.db.Create(&defaultUser).Error; err != nil {
-			return nil, fmt.Errorf("could not create default user: %w", err)
-		}
-		log.Info().Str("api_key", defaultAPIKey).Int64("user_id", defaultUser.ID).Msg("Database was empty. Created default user")
-	}
-
-	return s, nil
+	return &GormStore{db: db, adminKey: cfg.AdminKey, poolKey: cfg.PoolAccessKey, syncBatchSize: defaultSyncBatchSize}, nil
 }
 
-// migrate runs GORM's AutoMigrate for all models.
-func (s *GormStore) migrate() error {
-	if s.db.Dialector.Name() == "sqlite" {
-		return s.migrateSQLite()
+// New creates a new GormStore instance, connects to the database, brings the
+// schema up to date and creates a default user if the database is empty.
+func New(cfg *config.Config, adminKey, poolKey string) (store.Store, error) {
+	s, err := Open(cfg)
+	if err != nil {
+		return nil, err
 	}
-	// For other databases like postgres, rely on AutoMigrate
-	return s.db.AutoMigrate(&model.User{}, &model.Cookie{})
-}
+	s.adminKey = adminKey
+	s.poolKey = poolKey
 
-func (s *GormStore) migrateSQLite() error {
-	// 1. Create meta table if it doesn't exist
-	if err := s.db.Exec(`CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT);`).Error; err != nil {
-		return fmt.Errorf("could not create meta table: %w", err)
+	if _, err := s.MigrateUp(false); err != nil {
+		return nil, fmt.Errorf("could not migrate database schema: %w", err)
 	}
 
-	// 2. Get current schema version
-	var version int
-	var meta struct {
-		Key   string
-		Value string
+	user, err := s.EnsureDefaultUser("Default user")
+	if err != nil {
+		return nil, err
 	}
-	s.db.Table("meta").Where("key = ?", "version").First(&meta)
-	fmt.Sscan(meta.Value, &version)
-
-	// 3. Apply migrations in order
-	if version == 0 {
-		// New database, create schema from scratch
-		log.Info().Msg("New database detected, running initial schema creation...")
-		if err := s.migrationInit(); err != nil {
-			return err
-		}
-		if err := s.setVersion(5); err != nil { // Set to the latest version
-			return err
-		}
-		log.Info().Msg("Initial schema creation successful.")
-	} else {
-		// Existing database, apply incremental migrations
-		if version < 2 {
-			log.Info().Msg("Running migration v2: Add sharing features...")
-			if err := s.migrationV2(); err != nil {
-				return err
-			}
-			if err := s.setVersion(2); err != nil {
-				return err
-			}
-			log.Info().Msg("Migration v2 successful.")
-		}
-		if version < 3 {
-			log.Info().Msg("Running migration v3: Fix UNIQUE constraint on cookies table...")
-			if err := s.migrationV3(); err != nil {
-				return err
-			}
-			if err := s.setVersion(3); err != nil {
-				return err
-			}
-			log.Info().Msg("Migration v3 successful.")
-		}
-		if version < 4 {
-			log.Info().Msg("Running migration v4: Remove user roles and add remarks...")
-			if err := s.migrationV4(); err != nil {
-				return err
-			}
-			if err := s.setVersion(4); err != nil {
-				return err
-			}
-			log.Info().Msg("Migration v4 successful.")
-		}
-		if version < 5 {
-			log.Info().Msg("Running migration v5: Add cookies_json and last_synced_at to users table...")
-			if err := s.migrationV5(); err != nil {
-				return err
-			}
-			if err := s.setVersion(5); err != nil {
-				return err
-			}
-			log.Info().Msg("Migration v5 successful.")
-		}
+	if user != nil {
+		log.Info().Str("api_key", user.APIKey).Int64("user_id", user.ID).Msg("Database was empty. Created default user")
 	}
 
-	return nil
+	return s, nil
 }
 
-func (s *GormStore) setVersion(version int) error {
-	return s.db.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('version', ?)`, version).Error
-}
-
-func (s *GormStore) migrationInit() error {
-	usersTable := `
-	CREATE TABLE users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		api_key TEXT NOT NULL UNIQUE,
-		remark TEXT,
-		sharing_enabled BOOLEAN NOT NULL DEFAULT 0,
-		last_synced_at DATETIME,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		deleted_at DATETIME,
-		cookies_json TEXT
-	);`
-
-	cookiesTable := `
-	CREATE TABLE cookies (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		domain TEXT NOT NULL,
-		name TEXT NOT NULL,
-		value TEXT NOT NULL,
-		path TEXT,
-		expires DATETIME,
-		http_only BOOLEAN,
-		secure BOOLEAN,
-		same_site TEXT,
-		is_sharable BOOLEAN NOT NULL DEFAULT 0,
-		last_updated_from_extension_at DATETIME NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE(user_id, domain, name, path)
-	);`
-
-	if err := s.db.Exec(usersTable).Error; err != nil {
-		return err
-	}
-	if err := s.db.Exec(cookiesTable).Error; err != nil {
+// Close releases the underlying connection pool.
+func (s *GormStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
 		return err
 	}
-	return nil
+	return sqlDB.Close()
 }
 
-func (s *GormStore) migrationV1() error {
-	usersTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		api_key TEXT NOT NULL UNIQUE,
-		role TEXT NOT NULL,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);`
-
-	cookiesTable := `
-	CREATE TABLE IF NOT EXISTS cookies (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		domain TEXT NOT NULL,
-		name TEXT NOT NULL,
-		value TEXT NOT NULL,
-		path TEXT,
-		expires DATETIME,
-		http_only BOOLEAN,
-		secure BOOLEAN,
-		same_site TEXT,
-		last_updated_from_extension_at DATETIME NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE(user_id, domain, name, path)
-	);`
-
-	if err := s.db.Exec(usersTable).Error; err != nil {
-		return err
-	}
-	if err := s.db.Exec(cookiesTable).Error; err != nil {
-		return err
-	}
-	return nil
+// Dialect returns the name of the connected database dialect.
+func (s *GormStore) Dialect() string {
+	return s.db.Dialector.Name()
 }
 
-func (s *GormStore) migrationV2() error {
-	// Add sharing_enabled to users table
-	if err := s.db.Exec(`ALTER TABLE users ADD COLUMN sharing_enabled BOOLEAN NOT NULL DEFAULT 0;`).Error; err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			return fmt.Errorf("could not add sharing_enabled to users: %w", err)
-		}
+// EnsureDefaultUser creates a user with the given remark if the database has
+// no users yet. It returns the created user, or nil if users already exist.
+func (s *GormStore) EnsureDefaultUser(remark string) (*model.User, error) {
+	var userCount int64
+	if err := s.db.Unscoped().Model(&model.User{}).Count(&userCount).Error; err != nil {
+		return nil, fmt.Errorf("could not query user count: %w", err)
 	}
-	// Add is_sharable to cookies table
-	if err := s.db.Exec(`ALTER TABLE cookies ADD COLUMN is_sharable BOOLEAN NOT NULL DEFAULT 0;`).Error; err != nil {
-		if !strings.Contains(err.Error(), "duplicate column name") {
-			return fmt.Errorf("could not add is_sharable to cookies: %w", err)
-		}
+	if userCount > 0 {
+		return nil, nil
 	}
-	return nil
-}
-
-func (s *GormStore) migrationV3() error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		cookiesTableNew := `
-		CREATE TABLE IF NOT EXISTS cookies_new (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			domain TEXT NOT NULL,
-			name TEXT NOT NULL,
-			value TEXT NOT NULL,
-			path TEXT,
-			expires DATETIME,
-			http_only BOOLEAN,
-			secure BOOLEAN,
-			same_site TEXT,
-			is_sharable BOOLEAN NOT NULL DEFAULT 0,
-			last_updated_from_extension_at DATETIME NOT NULL,
-			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
-			UNIQUE(user_id, domain, name, path)
-		);`
-		if err := tx.Exec(cookiesTableNew).Error; err != nil {
-			return fmt.Errorf("v3: could not create new cookies table: %w", err)
-		}
-
-		copyData := `
-		INSERT OR IGNORE INTO cookies_new (id, user_id, domain, name, value, path, expires, http_only, secure, same_site, is_sharable, last_updated_from_extension_at)
-		SELECT id, user_id, domain, name, value, path, expires, http_only, secure, same_site, is_sharable, last_updated_from_extension_at
-		FROM cookies;
-		`
-		if err := tx.Exec(copyData).Error; err != nil {
-			log.Warn().Err(err).Msg("v3: Some data might not have been copied due to new constraints, which is expected.")
-		}
-
-		if err := tx.Exec(`DROP TABLE cookies;`).Error; err != nil {
-			return fmt.Errorf("v3: could not drop old cookies table: %w", err)
-		}
-
-		if err := tx.Exec(`ALTER TABLE cookies_new RENAME TO cookies;`).Error; err != nil {
-			return fmt.Errorf("v3: could not rename new cookies table: %w", err)
-		}
-		return nil
-	})
-}
-
-func (s *GormStore) migrationV4() error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		usersTableNew := `
-		CREATE TABLE users_new (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			api_key TEXT NOT NULL UNIQUE,
-			remark TEXT,
-			sharing_enabled BOOLEAN NOT NULL DEFAULT 0,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
-		);`
-		if err := tx.Exec(usersTableNew).Error; err != nil {
-			return fmt.Errorf("v4: could not create new users table: %w", err)
-		}
-
-		copyData := `
-		INSERT INTO users_new (id, api_key, sharing_enabled, created_at, updated_at)
-		SELECT id, api_key, sharing_enabled, created_at, updated_at
-		FROM users;
-		`
-		if err := tx.Exec(copyData).Error; err != nil {
-			log.Warn().Err(err).Msg("v4: Error copying user data. This might happen if the old table structure is unexpected.")
-			copyDataSimple := `
-			INSERT INTO users_new (id, api_key, created_at, updated_at)
-			SELECT id, api_key, created_at, updated_at
-			FROM users;
-			`
-			if err2 := tx.Exec(copyDataSimple).Error; err2 != nil {
-				return fmt.Errorf("v4: could not copy data to new users table, even with simplified schema: %w", err2)
-			}
-		}
-
-		if err := tx.Exec(`DROP TABLE users;`).Error; err != nil {
-			return fmt.Errorf("v4: could not drop old users table: %w", err)
-		}
-
-		if err := tx.Exec(`ALTER TABLE users_new RENAME TO users;`).Error; err != nil {
-			return fmt.Errorf("v4: could not rename new users table: %w", err)
-		}
-		return nil
-	})
-}
 
-func (s *GormStore) migrationV5() error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Exec(`ALTER TABLE users ADD COLUMN cookies_json TEXT;`).Error; err != nil {
-			if !strings.Contains(err.Error(), "duplicate column name") {
-				return fmt.Errorf("v5: could not add cookies_json column to users: %w", err)
-			}
-		}
-		if err := tx.Exec(`ALTER TABLE users ADD COLUMN last_synced_at DATETIME;`).Error; err != nil {
-			if !strings.Contains(err.Error(), "duplicate column name") {
-				return fmt.Errorf("v5: could not add last_synced_at column to users: %w", err)
-			}
-		}
-		// Add deleted_at for soft delete support
-		if err := tx.Exec(`ALTER TABLE users ADD COLUMN deleted_at DATETIME;`).Error; err != nil {
-			if !strings.Contains(err.Error(), "duplicate column name") {
-				return fmt.Errorf("v5: could not add deleted_at column to users: %w", err)
-			}
-		}
-		return nil
-	})
+	defaultUser := model.User{
+		APIKey:         s.generateSafeAPIKey(),
+		Remark:         stringPtr(remark),
+		SharingEnabled: false,
+	}
+	if err := s.db.Create(&defaultUser).Error; err != nil {
+		return nil, fmt.Errorf("could not create default user: %w", err)
+	}
+	return &defaultUser, nil
 }
 
 // --- Helper Functions ---
@@ -429,45 +185,85 @@ func (s *GormStore) generateSafeAPIKey() string {
 // --- Store Interface Implementation ---
 
 // User methods
-func (s *GormStore) GetUserByAPIKey(apiKey string) (*model.User, error) {
+func (s *GormStore) GetUserByAPIKey(ctx context.Context, apiKey string) (*model.User, error) {
 	var user model.User
-	if err := s.db.Where("api_key = ?", apiKey).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
+	if err := s.db.WithContext(ctx).Where("api_key = ? AND team_id IS NULL", apiKey).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user %w", store.ErrNotFound)
 		}
-		return nil, fmt.Errorf("could not get user by api key: %w", err)
+		return nil, fmt.Errorf("could not get user by api key: %w", classify(err))
 	}
 	return &user, nil
 }
 
-func (s *GormStore) GetUserByID(userID int64) (*model.User, error) {
+func (s *GormStore) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
 	var user model.User
-	if err := s.db.First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user %w", store.ErrNotFound)
 		}
-		return nil, fmt.Errorf("could not get user by id: %w", err)
+		return nil, fmt.Errorf("could not get user by id: %w", classify(err))
 	}
 	return &user, nil
 }
 
-func (s *GormStore) UpdateUserSharing(userID int64, enabled bool) error {
-	result := s.db.Model(&model.User{}).Where("id = ?", userID).Update("sharing_enabled", enabled)
+func (s *GormStore) UpdateUserSharing(ctx context.Context, userID int64, enabled bool) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("sharing_enabled", enabled)
+	if result.Error != nil {
+		return fmt.Errorf("could not update user sharing status: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateUserQuota replaces the user's quota overrides; nil limits are cleared.
+func (s *GormStore) UpdateUserQuota(ctx context.Context, userID int64, quota model.Quota) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"quota_max_cookies": quota.MaxCookies,
+		"quota_max_bytes":   quota.MaxBytes,
+		"quota_max_domains": quota.MaxDomains,
+	})
 	if result.Error != nil {
-		return fmt.Errorf("could not update user sharing status: %w", result.Error)
+		return fmt.Errorf("could not update user quota: %w", classify(result.Error))
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("user %w", store.ErrNotFound)
 	}
 	return nil
 }
 
-func (s *GormStore) GetUserSettings(userID int64) (*model.User, error) {
-	return s.GetUserByID(userID)
+// UpdateUserDomainRules replaces the user's domain rules.
+func (s *GormStore) UpdateUserDomainRules(ctx context.Context, userID int64, rules model.DomainRules) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Select("domain_rules").Updates(&model.User{DomainRules: rules})
+	if result.Error != nil {
+		return fmt.Errorf("could not update user domain rules: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateUserSharingRules replaces the user's sharing rules.
+func (s *GormStore) UpdateUserSharingRules(ctx context.Context, userID int64, rules model.SharingRules) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Select("sharing_rules").Updates(&model.User{SharingRules: rules})
+	if result.Error != nil {
+		return fmt.Errorf("could not update user sharing rules: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *GormStore) GetUserSettings(ctx context.Context, userID int64) (*model.User, error) {
+	return s.GetUserByID(ctx, userID)
 }
 
 // Admin methods
-func (s *GormStore) CreateUsers(remarks []string) ([]*model.User, error) {
+func (s *GormStore) CreateUsers(ctx context.Context, remarks []string) ([]*model.User, error) {
 	var createdUsers []*model.User
 	for _, remarkStr := range remarks {
 		newUser := model.User{
@@ -475,152 +271,385 @@ func (s *GormStore) CreateUsers(remarks []string) ([]*model.User, error) {
 			Remark:         stringPtr(remarkStr),
 			SharingEnabled: false,
 		}
-		if err := s.db.Create(&newUser).Error; err != nil {
-			return nil, fmt.Errorf("could not create user with remark %s: %w", remarkStr, err)
+		if err := s.db.WithContext(ctx).Create(&newUser).Error; err != nil {
+			return nil, fmt.Errorf("could not create user with remark %s: %w", remarkStr, classify(err))
 		}
 		createdUsers = append(createdUsers, &newUser)
 	}
 	return createdUsers, nil
 }
 
-func (s *GormStore) UpdateUserRemark(userID int64, remark *string) error {
-	result := s.db.Model(&model.User{}).Where("id = ?", userID).Update("remark", remark)
+func (s *GormStore) UpdateUserRemark(ctx context.Context, userID int64, remark *string) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("remark", remark)
 	if result.Error != nil {
-		return result.Error
+		return fmt.Errorf("could not update user remark: %w", classify(result.Error))
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("user %w", store.ErrNotFound)
 	}
 	return nil
 }
 
-func (s *GormStore) UpdateUserRemarkByAPIKey(apiKey string, remark *string) error {
-	result := s.db.Model(&model.User{}).Where("api_key = ?", apiKey).Update("remark", remark)
+func (s *GormStore) UpdateUserRemarkByAPIKey(ctx context.Context, apiKey string, remark *string) error {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("api_key = ?", apiKey).Update("remark", remark)
 	if result.Error != nil {
-		return result.Error
+		return fmt.Errorf("could not update user remark: %w", classify(result.Error))
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("user %w", store.ErrNotFound)
 	}
 	return nil
 }
 
-func (s *GormStore) AdminUpdateUserAPIKey(userID int64) (*model.User, error) {
+func (s *GormStore) AdminUpdateUserAPIKey(ctx context.Context, userID int64) (*model.User, error) {
 	newAPIKey := s.generateSafeAPIKey()
-	if err := s.db.Model(&model.User{}).Where("id = ?", userID).Update("api_key", newAPIKey).Error; err != nil {
-		return nil, err
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("api_key", newAPIKey).Error; err != nil {
+		return nil, fmt.Errorf("could not update api key: %w", classify(err))
 	}
-	return s.GetUserByID(userID)
+	return s.GetUserByID(ctx, userID)
 }
 
-func (s *GormStore) AdminUpdateUserAPIKeyByAPIKey(apiKey string) (*model.User, error) {
-	user, err := s.GetUserByAPIKey(apiKey)
+func (s *GormStore) AdminUpdateUserAPIKeyByAPIKey(ctx context.Context, apiKey string) (*model.User, error) {
+	user, err := s.GetUserByAPIKey(ctx, apiKey)
 	if err != nil {
 		return nil, err // User not found
 	}
 	newAPIKey := s.generateSafeAPIKey()
-	if err := s.db.Model(&model.User{}).Where("id = ?", user.ID).Update("api_key", newAPIKey).Error; err != nil {
-		return nil, err
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).Update("api_key", newAPIKey).Error; err != nil {
+		return nil, fmt.Errorf("could not update api key: %w", classify(err))
+	}
+	return s.GetUserByID(ctx, user.ID)
+}
+
+// ListUsers returns every user, including suspended ones, ordered by ID.
+func (s *GormStore) ListUsers(ctx context.Context) ([]*model.User, error) {
+	var users []*model.User
+	if err := s.db.WithContext(ctx).Unscoped().Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not list users: %w", classify(err))
+	}
+	return users, nil
+}
+
+// SuspendUser soft-deletes a user so their API key stops authenticating.
+func (s *GormStore) SuspendUser(ctx context.Context, userID int64) error {
+	result := s.db.WithContext(ctx).Delete(&model.User{}, userID)
+	if result.Error != nil {
+		return fmt.Errorf("could not suspend user: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %w", store.ErrNotFound)
 	}
-	return s.GetUserByID(user.ID)
+	return nil
 }
 
 // Cookie methods
-func (s *GormStore) SyncCookies(userID int64, cookies []*model.Cookie) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+func (s *GormStore) SyncCookies(ctx context.Context, userID int64, cookies []*model.Cookie) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		now := time.Now()
 
-		// 1. Update the users table with the JSON blob and last_synced_at
-		jsonData, err := json.Marshal(cookies)
-		if err != nil {
-			return fmt.Errorf("could not marshal cookies to JSON: %w", err)
-		}
-		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
-			"cookies_json":   string(jsonData),
+		// 1. Record the sync time on the user
+		result := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 			"last_synced_at": &now,
 			"updated_at":     &now,
-		}).Error; err != nil {
-			return fmt.Errorf("could not update users table with JSON blob: %w", err)
+		})
+		if result.Error != nil {
+			return fmt.Errorf("could not update last_synced_at for user %d: %w", userID, classify(result.Error))
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("user %w", store.ErrNotFound)
 		}
 
-		// 2. Delete all existing cookies for the user
-		if err := tx.Where("user_id = ?", userID).Delete(&model.Cookie{}).Error; err != nil {
-			return fmt.Errorf("could not delete old cookies for user %d: %w", userID, err)
+		// 2. Forget the reports and probe results of the sessions this sync changes
+		newCookies := dedupeCookies(cookies)
+		if err := forgetChangedSessions(tx, userID, newCookies); err != nil {
+			return err
 		}
 
-		// 3. Insert new cookies
-		if len(cookies) > 0 {
-			for _, c := range cookies {
-				newCookie := &model.Cookie{
-					// ID is omitted to let the database generate it
-					UserID:                     userID,
-					Domain:                     c.Domain,
-					Name:                       c.Name,
-					Value:                      c.Value,
-					Path:                       c.Path,
-					Expires:                    c.Expires,
-					HTTPOnly:                   c.HTTPOnly,
-					Secure:                     c.Secure,
-					SameSite:                   c.SameSite,
-					IsSharable:                 c.IsSharable,
-					LastUpdatedFromExtensionAt: now,
-				}
-				if err := tx.Create(newCookie).Error; err != nil {
-					return fmt.Errorf("could not insert cookie %s/%s: %w", newCookie.Domain, newCookie.Name, err)
-				}
+		// 3. Delete all existing cookies for the user
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Cookie{}).Error; err != nil {
+			return fmt.Errorf("could not delete old cookies for user %d: %w", userID, classify(err))
+		}
+
+		// 4. Insert the new cookies with multi-row INSERTs
+		if len(newCookies) == 0 {
+			return nil
+		}
+		rows := make([]*model.Cookie, len(newCookies))
+		for i, c := range newCookies {
+			rows[i] = &model.Cookie{
+				// ID is omitted to let the database generate it
+				UserID:                     userID,
+				Domain:                     c.Domain,
+				DomainKey:                  domainKey(c.Domain),
+				Name:                       c.Name,
+				Value:                      c.Value,
+				Path:                       c.Path,
+				Expires:                    c.Expires,
+				HTTPOnly:                   c.HTTPOnly,
+				Secure:                     c.Secure,
+				SameSite:                   c.SameSite,
+				IsSharable:                 c.IsSharable,
+				LastUpdatedFromExtensionAt: now,
 			}
 		}
+		// Rows are deduplicated above, but the unique key can still collide
+		// where the database compares case-insensitively (MySQL's default
+		// collation), so let the later cookie win there as well.
+		upsert := clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "domain"}, {Name: "name"}, {Name: "path"}},
+			DoUpdates: clause.AssignmentColumns([]string{"domain", "domain_key", "name", "value", "path", "expires", "http_only", "secure", "same_site", "is_sharable", "last_updated_from_extension_at"}),
+		}
+		if err := tx.Clauses(upsert).CreateInBatches(rows, s.syncBatchSize).Error; err != nil {
+			return fmt.Errorf("could not insert %d cookies for user %d: %w", len(rows), userID, classify(err))
+		}
 
 		return nil
 	})
+	// Errors from BEGIN and COMMIT reach us unclassified.
+	return classify(err)
 }
 
-func (s *GormStore) GetCookiesByUserID(userID int64) ([]*model.Cookie, error) {
-	var user model.User
-	if err := s.db.Select("cookies_json").First(&user, userID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
+// dedupeCookies drops all but the last of several cookies sharing a
+// (domain, name, path) key, so one bad payload cannot fail a whole batch on
+// the unique index. Order is otherwise preserved.
+func dedupeCookies(cookies []*model.Cookie) []*model.Cookie {
+	last := make(map[cookieIdentity]int, len(cookies))
+	for i, c := range cookies {
+		last[cookieIdentity{c.Domain, c.Name, c.Path}] = i
+	}
+	if len(last) == len(cookies) {
+		return cookies
+	}
+	deduped := make([]*model.Cookie, 0, len(last))
+	for i, c := range cookies {
+		if last[cookieIdentity{c.Domain, c.Name, c.Path}] == i {
+			deduped = append(deduped, c)
 		}
-		return nil, fmt.Errorf("could not get user for cookies: %w", err)
 	}
+	return deduped
+}
 
-	if user.CookiesJSON == nil || *user.CookiesJSON == "" {
-		return []*model.Cookie{}, nil
+func (s *GormStore) GetCookiesByUserID(ctx context.Context, userID int64) ([]*model.Cookie, error) {
+	cookies := make([]*model.Cookie, 0)
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&cookies).Error; err != nil {
+		return nil, fmt.Errorf("could not get cookies for user %d: %w", userID, classify(err))
 	}
+	return cookies, nil
+}
 
-	var cookies []*model.Cookie
-	if err := json.Unmarshal([]byte(*user.CookiesJSON), &cookies); err != nil {
-		return nil, fmt.Errorf("could not unmarshal cookies from JSON: %w", err)
+func (s *GormStore) GetCookiesByDomain(ctx context.Context, userID int64, domain string) ([]*model.Cookie, error) {
+	key := domainKey(domain)
+	cookies := make([]*model.Cookie, 0)
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND (domain_key = ? OR domain_key LIKE ? ESCAPE '!')", userID, key, subdomainPattern(key)).
+		Order("id").
+		Find(&cookies).Error; err != nil {
+		return nil, fmt.Errorf("could not get cookies for user %d and domain %s: %w", userID, domain, classify(err))
 	}
-
 	return cookies, nil
 }
 
-func (s *GormStore) GetCookiesByDomain(userID int64, domain string) ([]*model.Cookie, error) {
-	allCookies, err := s.GetCookiesByUserID(userID)
+func (s *GormStore) GetSharableCookiesByDomain(ctx context.Context, domain string) ([]*model.Cookie, error) {
+	key := domainKey(domain)
+	var cookies []*model.Cookie
+	if err := s.db.WithContext(ctx).Table("cookies c").
+		Select("c.*").
+		Joins("INNER JOIN users u ON c.user_id = u.id").
+		Where("u.sharing_enabled = ? AND u.deleted_at IS NULL AND c.is_sharable = ? AND (c.domain_key = ? OR c.domain_key LIKE ? ESCAPE '!')", true, true, key, subdomainPattern(key)).
+		Order("c.id").
+		Find(&cookies).Error; err != nil {
+		return nil, fmt.Errorf("could not query sharable cookies: %w", classify(err))
+	}
+	cookies, err := s.applySharingRules(ctx, cookies)
+	if err != nil {
+		return nil, err
+	}
+	if cookies, err = s.skipQuarantined(ctx, cookies); err != nil {
+		return nil, err
+	}
+	return s.preferWorking(ctx, cookies)
+}
+
+// ListPoolSessions lists the healthy sessions in the pool. The same filters
+// as in GetSharableCookiesByDomain apply, on the distinct cookie domains of
+// each contributor rather than on the cookies themselves.
+func (s *GormStore) ListPoolSessions(ctx context.Context) ([]*model.PoolSession, error) {
+	var rows []*model.Cookie
+	if err := s.db.WithContext(ctx).Table("cookies c").
+		Select("DISTINCT c.user_id, c.domain").
+		Joins("INNER JOIN users u ON c.user_id = u.id").
+		Where("u.sharing_enabled = ? AND u.deleted_at IS NULL AND c.is_sharable = ?", true, true).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("could not query shared sessions: %w", classify(err))
+	}
+	type session struct {
+		userID int64
+		domain string
+	}
+	seen := make(map[session]bool, len(rows))
+	cookies := rows[:0]
+	for _, c := range rows {
+		c.Domain = poolhealth.NormalizeDomain(c.Domain)
+		if key := (session{c.UserID, c.Domain}); !seen[key] {
+			seen[key] = true
+			cookies = append(cookies, c)
+		}
+	}
+
+	cookies, err := s.applySharingRules(ctx, cookies)
 	if err != nil {
-		return nil, fmt.Errorf("could not get all cookies for user %d: %w", userID, err)
+		return nil, err
+	}
+	if cookies, err = s.skipQuarantined(ctx, cookies); err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return []*model.PoolSession{}, nil
+	}
+	var expired []*model.ProbeResult
+	if err := s.db.WithContext(ctx).Where("outcome = ?", model.ProbeExpired).Find(&expired).Error; err != nil {
+		return nil, fmt.Errorf("could not query probe results: %w", classify(err))
+	}
+	cookies = poolhealth.SkipExpired(cookies, expired)
+
+	userIDs := make([]int64, 0, len(cookies))
+	for _, c := range cookies {
+		userIDs = append(userIDs, c.UserID)
+	}
+	var users []*model.User
+	if err := s.db.WithContext(ctx).Select("id", "last_synced_at").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not query contributors: %w", classify(err))
+	}
+	synced := make(map[int64]*time.Time, len(users))
+	for _, u := range users {
+		synced[u.ID] = u.LastSyncedAt
 	}
 
-	filteredCookies := make([]*model.Cookie, 0)
-	for _, cookie := range allCookies {
-		if cookie.Domain == domain || strings.HasSuffix(cookie.Domain, "."+domain) {
-			filteredCookies = append(filteredCookies, cookie)
+	sessions := make([]*model.PoolSession, 0, len(cookies))
+	for _, c := range cookies {
+		sessions = append(sessions, &model.PoolSession{UserID: c.UserID, Domain: c.Domain, LastSyncedAt: synced[c.UserID]})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Domain != sessions[j].Domain {
+			return sessions[i].Domain < sessions[j].Domain
 		}
+		return sessions[i].UserID < sessions[j].UserID
+	})
+	return sessions, nil
+}
+
+// applySharingRules drops the cookies that their owners' sharing rules keep
+// out of the pool. The rules are patterns, so they are applied here rather
+// than in SQL.
+func (s *GormStore) applySharingRules(ctx context.Context, cookies []*model.Cookie) ([]*model.Cookie, error) {
+	if len(cookies) == 0 {
+		return cookies, nil
+	}
+	seen := make(map[int64]bool)
+	var userIDs []int64
+	for _, c := range cookies {
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			userIDs = append(userIDs, c.UserID)
+		}
+	}
+	var users []*model.User
+	if err := s.db.WithContext(ctx).Select("id", "sharing_rules").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not query sharing rules: %w", classify(err))
 	}
 
-	return filteredCookies, nil
+	filters := make(map[int64]*domainrule.Filter, len(users))
+	for _, u := range users {
+		filter, err := domainrule.NewSharingFilter(u.SharingRules)
+		if err != nil {
+			// Share nothing rather than more than the user asked for.
+			log.Warn().Err(err).Int64("user_id", u.ID).Msg("Invalid sharing rules, keeping the user's cookies out of the pool")
+			continue
+		}
+		filters[u.ID] = filter
+	}
+	kept := cookies[:0]
+	for _, c := range cookies {
+		if filter, ok := filters[c.UserID]; ok && filter.Allows(c.Domain) {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
 }
 
-func (s *GormStore) GetSharableCookiesByDomain(domain string) ([]*model.Cookie, error) {
-	var cookies []*model.Cookie
-	likeDomain := "%." + domain
-	if err := s.db.Table("cookies c").
-		Select("c.*").
-		Joins("INNER JOIN users u ON c.user_id = u.id").
-		Where("u.sharing_enabled = ? AND c.is_sharable = ? AND (c.domain = ? OR c.domain LIKE ?)", true, true, domain, likeDomain).
-		Find(&cookies).Error; err != nil {
-		return nil, fmt.Errorf("could not query sharable cookies: %w", err)
+// Pool client methods
+
+func (s *GormStore) CreatePoolClient(ctx context.Context, client *model.PoolClient) error {
+	if err := s.db.WithContext(ctx).Create(client).Error; err != nil {
+		return fmt.Errorf("could not create pool client: %w", classify(err))
 	}
-	return cookies, nil
+	return nil
+}
+
+func (s *GormStore) ListPoolClients(ctx context.Context) ([]*model.PoolClient, error) {
+	var clients []*model.PoolClient
+	if err := s.db.WithContext(ctx).Order("id").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("could not list pool clients: %w", classify(err))
+	}
+	return clients, nil
+}
+
+func (s *GormStore) GetPoolClientByKeyHash(ctx context.Context, keyHash string) (*model.PoolClient, error) {
+	var client model.PoolClient
+	if err := s.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("pool client %w", store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get pool client by key: %w", classify(err))
+	}
+	return &client, nil
+}
+
+func (s *GormStore) UpdatePoolClient(ctx context.Context, client *model.PoolClient) error {
+	client.UpdatedAt = time.Now()
+	result := s.db.WithContext(ctx).Model(&model.PoolClient{ID: client.ID}).
+		Select("name", "allowed_domains", "rate_limit", "expires_at", "updated_at").
+		Updates(client)
+	if result.Error != nil {
+		return fmt.Errorf("could not update pool client: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("pool client %w", store.ErrNotFound)
+	}
+	return nil
+}
+
+// RevokePoolClient revokes the client. Revoking it again is a no-op.
+func (s *GormStore) RevokePoolClient(ctx context.Context, clientID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var client model.PoolClient
+		if err := tx.Select("id", "revoked_at").First(&client, clientID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("pool client %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get pool client: %w", classify(err))
+		}
+		if client.RevokedAt != nil {
+			return nil
+		}
+		if err := tx.Model(&client).Update("revoked_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("could not revoke pool client: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) RecordPoolClientUse(ctx context.Context, clientID int64, cookiesServed int) error {
+	// UpdateColumns leaves updated_at alone: using a client does not change it.
+	result := s.db.WithContext(ctx).Model(&model.PoolClient{}).Where("id = ?", clientID).UpdateColumns(map[string]any{
+		"request_count":  gorm.Expr("request_count + 1"),
+		"cookies_served": gorm.Expr("cookies_served + ?", cookiesServed),
+		"last_used_at":   time.Now(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("could not record pool client use: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("pool client %w", store.ErrNotFound)
+	}
+	return nil
 }
@@ -0,0 +1,33 @@
+package gormstore
+
+import (
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/storetest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(&config.Config{
+			DBType:               "sqlite",
+			DSN:                  filepath.Join(t.TempDir(), "test.db"),
+			AdminKey:             "admin-key",
+			PoolAccessKey:        "pool-key",
+			DBMaxOpenConnections: 1,
+			DBMaxIdleConnections: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		if _, err := s.MigrateUp(false); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,191 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReportPoolSession updates the session's health row before counting its
+// reports, so the row lock orders reports handled by different replicas at
+// once and the last of them counts them all.
+func (s *GormStore) ReportPoolSession(ctx context.Context, clientID, userID int64, domain, reason string, policy poolhealth.Policy) (*model.PoolSessionHealth, error) {
+	domain = poolhealth.NormalizeDomain(domain)
+	key := domainKey(domain)
+	var health model.PoolSessionHealth
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var shared int64
+		if err := tx.Table("cookies c").
+			Joins("INNER JOIN users u ON c.user_id = u.id").
+			Where("c.user_id = ? AND u.sharing_enabled = ? AND u.deleted_at IS NULL AND c.is_sharable = ? AND (c.domain_key = ? OR c.domain_key LIKE ? ESCAPE '!')", userID, true, true, key, subdomainPattern(key)).
+			Count(&shared).Error; err != nil {
+			return fmt.Errorf("could not query shared session: %w", classify(err))
+		}
+		if shared == 0 {
+			return fmt.Errorf("shared session for %s %w", domain, store.ErrNotFound)
+		}
+
+		now := time.Now()
+		row := &model.PoolSessionHealth{UserID: userID, Domain: domain, CreatedAt: now, UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+			return fmt.Errorf("could not record session report: %w", classify(err))
+		}
+		if err := tx.Model(&model.PoolSessionHealth{}).
+			Where("user_id = ? AND domain = ?", userID, domain).
+			Updates(map[string]any{"last_reason": reason, "last_reported_at": now, "updated_at": now}).Error; err != nil {
+			return fmt.Errorf("could not record session report: %w", classify(err))
+		}
+		report := &model.PoolSessionReport{UserID: userID, Domain: domain, ClientID: clientID, Reason: reason, ReportedAt: now}
+		upsert := clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "domain"}, {Name: "client_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason", "reported_at"}),
+		}
+		if err := tx.Clauses(upsert).Create(report).Error; err != nil {
+			return fmt.Errorf("could not record session report: %w", classify(err))
+		}
+
+		if err := tx.Where("user_id = ? AND domain = ?", userID, domain).First(&health).Error; err != nil {
+			return fmt.Errorf("could not get session health: %w", classify(err))
+		}
+		var clients int64
+		if err := tx.Model(&model.PoolSessionReport{}).
+			Where("user_id = ? AND domain = ? AND reported_at > ?", userID, domain, poolhealth.CountSince(&health, policy, now)).
+			Count(&clients).Error; err != nil {
+			return fmt.Errorf("could not count session reports: %w", classify(err))
+		}
+		health.Failures = int(clients)
+		poolhealth.Quarantine(&health, reason, policy, now)
+		if err := tx.Model(&health).Select("failures", "quarantined_at", "quarantined_until").Updates(&health).Error; err != nil {
+			return fmt.Errorf("could not update session health: %w", classify(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return &health, nil
+}
+
+// skipQuarantined drops the cookies of quarantined sessions.
+func (s *GormStore) skipQuarantined(ctx context.Context, cookies []*model.Cookie) ([]*model.Cookie, error) {
+	if len(cookies) == 0 {
+		return cookies, nil
+	}
+	seen := make(map[int64]bool)
+	var userIDs []int64
+	for _, c := range cookies {
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			userIDs = append(userIDs, c.UserID)
+		}
+	}
+	var rows []*model.PoolSessionHealth
+	if err := s.db.WithContext(ctx).Where("user_id IN ? AND quarantined_at IS NOT NULL", userIDs).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("could not query quarantined sessions: %w", classify(err))
+	}
+	if len(rows) == 0 {
+		return cookies, nil
+	}
+
+	now := time.Now()
+	quarantined := make(map[int64][]string)
+	for _, h := range rows {
+		if poolhealth.Quarantined(h, now) {
+			quarantined[h.UserID] = append(quarantined[h.UserID], h.Domain)
+		}
+	}
+	kept := cookies[:0]
+	for _, c := range cookies {
+		skip := false
+		for _, domain := range quarantined[c.UserID] {
+			skip = skip || poolhealth.Covers(domain, c.Domain)
+		}
+		if !skip {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// forgetChangedSessions drops what is known about the user's sessions whose
+// cookies differ in cookies, the user's new cookies: their reports and
+// failures, which ends any quarantine, and their probe results.
+func forgetChangedSessions(tx *gorm.DB, userID int64, cookies []*model.Cookie) error {
+	var health []*model.PoolSessionHealth
+	if err := tx.Where("user_id = ?", userID).Find(&health).Error; err != nil {
+		return fmt.Errorf("could not query session health for user %d: %w", userID, classify(err))
+	}
+	var results []*model.ProbeResult
+	if err := tx.Where("user_id = ?", userID).Find(&results).Error; err != nil {
+		return fmt.Errorf("could not query probe results for user %d: %w", userID, classify(err))
+	}
+	if len(health) == 0 && len(results) == 0 {
+		return nil
+	}
+	var old []*model.Cookie
+	if err := tx.Select("domain", "name", "path", "value").Where("user_id = ?", userID).Find(&old).Error; err != nil {
+		return fmt.Errorf("could not get old cookies for user %d: %w", userID, classify(err))
+	}
+
+	var changedHealth, changedResults []int64
+	var changedDomains []string
+	for _, h := range health {
+		if poolhealth.Changed(h.Domain, old, cookies) {
+			changedHealth = append(changedHealth, h.ID)
+			changedDomains = append(changedDomains, h.Domain)
+		}
+	}
+	for _, r := range results {
+		if poolhealth.Changed(r.Domain, old, cookies) {
+			changedResults = append(changedResults, r.ID)
+		}
+	}
+	if len(changedHealth) > 0 {
+		if err := tx.Where("id IN ?", changedHealth).Delete(&model.PoolSessionHealth{}).Error; err != nil {
+			return fmt.Errorf("could not reinstate sessions for user %d: %w", userID, classify(err))
+		}
+		if err := tx.Where("user_id = ? AND domain IN ?", userID, changedDomains).Delete(&model.PoolSessionReport{}).Error; err != nil {
+			return fmt.Errorf("could not drop session reports for user %d: %w", userID, classify(err))
+		}
+	}
+	if len(changedResults) > 0 {
+		if err := tx.Where("id IN ?", changedResults).Delete(&model.ProbeResult{}).Error; err != nil {
+			return fmt.Errorf("could not drop probe results for user %d: %w", userID, classify(err))
+		}
+	}
+	return nil
+}
+
+// forgiveLeasedSession clears the reports and failures of the user's sessions
+// that a lease of domain, released as good, covered. A quarantine stays until
+// it ends by itself.
+func forgiveLeasedSession(tx *gorm.DB, userID int64, domain string) error {
+	var health []*model.PoolSessionHealth
+	if err := tx.Where("user_id = ? AND failures > 0", userID).Find(&health).Error; err != nil {
+		return fmt.Errorf("could not query session health for user %d: %w", userID, classify(err))
+	}
+	var ids []int64
+	var domains []string
+	for _, h := range health {
+		if poolhealth.Covers(domain, h.Domain) {
+			ids = append(ids, h.ID)
+			domains = append(domains, h.Domain)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("user_id = ? AND domain IN ?", userID, domains).Delete(&model.PoolSessionReport{}).Error; err != nil {
+		return fmt.Errorf("could not drop session reports for user %d: %w", userID, classify(err))
+	}
+	if err := tx.Model(&model.PoolSessionHealth{}).Where("id IN ?", ids).Update("failures", 0).Error; err != nil {
+		return fmt.Errorf("could not reset session failures for user %d: %w", userID, classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LeasePoolSession leases the least recently leased free session for domain.
+// The unique active_key, which holds the contributor and the domain's site,
+// makes a session's lease exclusive across replicas, also against leases of
+// overlapping domains: a concurrent lease of the same session fails with a
+// conflict, and the next candidate is tried.
+func (s *GormStore) LeasePoolSession(ctx context.Context, clientID int64, domain string, ttl time.Duration) (*model.PoolLease, []*model.Cookie, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	cookies, err := s.GetSharableCookiesByDomain(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions := make(map[int64][]*model.Cookie)
+	var userIDs []int64
+	for _, c := range cookies {
+		if _, ok := sessions[c.UserID]; !ok {
+			userIDs = append(userIDs, c.UserID)
+		}
+		sessions[c.UserID] = append(sessions[c.UserID], c)
+	}
+	if len(userIDs) == 0 {
+		return nil, nil, fmt.Errorf("shared session for %s %w", domain, store.ErrNotFound)
+	}
+
+	// Lease IDs grow over time, so the highest one is the latest lease of
+	// the site.
+	site := poolhealth.Site(domain)
+	var latest []struct {
+		UserID int64
+		LastID int64
+	}
+	if err := s.db.WithContext(ctx).Model(&model.PoolLease{}).
+		Select("user_id, MAX(id) AS last_id").
+		Where("(domain = ? OR domain LIKE ? ESCAPE '!') AND user_id IN ?", site, hostSuffixPattern(site), userIDs).
+		Group("user_id").
+		Scan(&latest).Error; err != nil {
+		return nil, nil, fmt.Errorf("could not query past leases: %w", classify(err))
+	}
+	lastLease := make(map[int64]int64, len(latest))
+	for _, l := range latest {
+		lastLease[l.UserID] = l.LastID
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := userIDs[i], userIDs[j]
+		if lastLease[a] != lastLease[b] {
+			return lastLease[a] < lastLease[b]
+		}
+		return a < b
+	})
+
+	// Free the sessions whose leases ran out, once; a lease expiring while
+	// the candidates are tried only waits for the next call.
+	now := time.Now()
+	if err := expireLeases(s.db.WithContext(ctx), now); err != nil {
+		return nil, nil, fmt.Errorf("could not expire leases: %w", classify(err))
+	}
+	for _, userID := range userIDs {
+		activeKey := strconv.FormatInt(userID, 10) + ":" + site
+		lease := &model.PoolLease{
+			ClientID:  clientID,
+			UserID:    userID,
+			Domain:    domain,
+			ActiveKey: &activeKey,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}
+		switch err := classify(s.db.WithContext(ctx).Create(lease).Error); {
+		case err == nil:
+			return lease, sessions[userID], nil
+		case errors.Is(err, store.ErrConflict):
+			continue // leased already
+		default:
+			return nil, nil, fmt.Errorf("could not lease session: %w", err)
+		}
+	}
+	return nil, nil, fmt.Errorf("every shared session for %s is leased: %w", domain, store.ErrConflict)
+}
+
+// expireLeases ends the leases that ran out at now, freeing their sessions.
+func expireLeases(tx *gorm.DB, now time.Time) error {
+	return tx.Model(&model.PoolLease{}).
+		Where("active_key IS NOT NULL AND expires_at <= ?", now).
+		Updates(map[string]any{"active_key": nil, "released_at": now, "outcome": model.LeaseExpired}).Error
+}
+
+func (s *GormStore) ListLeasedUsers(ctx context.Context, domain string) ([]int64, error) {
+	site := poolhealth.Site(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "."))
+	userIDs := make([]int64, 0)
+	if err := s.db.WithContext(ctx).Model(&model.PoolLease{}).
+		Distinct("user_id").
+		Where("active_key IS NOT NULL AND expires_at > ? AND (domain = ? OR domain LIKE ? ESCAPE '!')", time.Now(), site, hostSuffixPattern(site)).
+		Order("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, fmt.Errorf("could not query active leases: %w", classify(err))
+	}
+	return userIDs, nil
+}
+
+func (s *GormStore) EndPoolLease(ctx context.Context, clientID, leaseID int64, outcome string) (*model.PoolLease, error) {
+	now := time.Now()
+	var lease model.PoolLease
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND client_id = ?", leaseID, clientID).First(&lease).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("active lease %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get lease: %w", classify(err))
+		}
+		// The condition repeats the checks, so a concurrent release or
+		// expiry of the lease cannot be overwritten.
+		result := tx.Model(&model.PoolLease{}).
+			Where("id = ? AND active_key IS NOT NULL AND expires_at > ?", leaseID, now).
+			Updates(map[string]any{"active_key": nil, "released_at": now, "outcome": outcome})
+		if result.Error != nil {
+			return fmt.Errorf("could not end lease: %w", classify(result.Error))
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("active lease %w", store.ErrNotFound)
+		}
+		if outcome == model.LeaseReleased {
+			return forgiveLeasedSession(tx, lease.UserID, lease.Domain)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	lease.ActiveKey, lease.ReleasedAt, lease.Outcome = nil, &now, outcome
+	return &lease, nil
+}
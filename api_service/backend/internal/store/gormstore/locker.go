@@ -0,0 +1,297 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sync locks are Postgres advisory locks keyed by syncLockKey or MySQL named
+// locks.
+const (
+	syncLockNamespace  uint32 = 0x43505359 // "CPSY"
+	syncLockNamePrefix        = "cookiepusher_sync_"
+
+	syncLockMinPoll = 10 * time.Millisecond
+	syncLockMaxPoll = 250 * time.Millisecond
+
+	// syncUnlockTimeout bounds how long releasing a lock may take before the
+	// connection is discarded instead, which releases the lock server-side.
+	syncUnlockTimeout = 5 * time.Second
+
+	// syncLockMaxConns caps the lock pool. Each sync in flight holds one of
+	// these on top of the store connection it writes with, so further syncs
+	// wait for a lock connection, within the lock timeout, rather than
+	// opening more connections to the database.
+	syncLockMaxConns = 4
+)
+
+// NewSyncLocker returns a locker that serialises syncs of the same user across
+// every server sharing the database described by cfg. Postgres uses advisory
+// locks and MySQL uses GET_LOCK; SQLite cannot be shared between hosts, so it
+// gets the in-process locker.
+//
+// Database locks belong to a session, so each held lock pins a connection
+// from a small pool of its own (see syncLockMaxConns) rather than starving
+// the store of connections while syncs run.
+func NewSyncLocker(cfg *config.Config) (locker.Locker, error) {
+	var lock sessionLock
+	var driverName string
+	switch cfg.DBType {
+	case "postgres":
+		lock, driverName = pgSessionLock{}, "pgx"
+	case "mysql":
+		lock, driverName = mysqlSessionLock{}, "mysql"
+	case "sqlite":
+		return sqliteLocker{locker.NewLocal(cfg.SyncLockTimeout)}, nil
+	default:
+		return nil, fmt.Errorf("database sync locks are not supported for database type: %s", cfg.DBType)
+	}
+
+	db, err := sql.Open(driverName, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sync lock connection pool: %w", err)
+	}
+	db.SetMaxOpenConns(syncLockMaxConns)
+	db.SetMaxIdleConns(syncLockMaxConns)
+	return newDBLocker(db, lock, cfg.SyncLockTimeout), nil
+}
+
+// sqliteLocker is the no-op database locker for SQLite: a single database
+// file has a single server, so the in-process locks are all that is needed.
+type sqliteLocker struct {
+	*locker.Local
+}
+
+func (l sqliteLocker) Stats() locker.Stats {
+	stats := l.Local.Stats()
+	stats.Backend = "sqlite"
+	return stats
+}
+
+// sessionLock is a dialect's session-level named lock.
+type sessionLock interface {
+	name() string
+	// tryLock attempts to take the lock without waiting.
+	tryLock(ctx context.Context, conn *sql.Conn, userID int64) (bool, error)
+	unlock(ctx context.Context, conn *sql.Conn, userID int64) error
+}
+
+// syncLockKey folds the namespace and the full user ID into one bigint
+// advisory lock key. The two-key form only takes int4 keys, which would make
+// users whose IDs are 2^32 apart share a lock. A hash collision, with another
+// user or with migrationLockID, only makes one holder wait for the other.
+func syncLockKey(userID int64) int64 {
+	var buf [12]byte
+	binary.BigEndian.PutUint32(buf[:4], syncLockNamespace)
+	binary.BigEndian.PutUint64(buf[4:], uint64(userID))
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return int64(h.Sum64())
+}
+
+type pgSessionLock struct{}
+
+func (pgSessionLock) name() string { return "postgres" }
+
+func (pgSessionLock) tryLock(ctx context.Context, conn *sql.Conn, userID int64) (bool, error) {
+	var got bool
+	err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, syncLockKey(userID)).Scan(&got)
+	return got, err
+}
+
+func (pgSessionLock) unlock(ctx context.Context, conn *sql.Conn, userID int64) error {
+	var released bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, syncLockKey(userID)).Scan(&released); err != nil {
+		return err
+	}
+	if !released {
+		return fmt.Errorf("advisory lock for user %d was not held", userID)
+	}
+	return nil
+}
+
+type mysqlSessionLock struct{}
+
+func (mysqlSessionLock) name() string { return "mysql" }
+
+func (mysqlSessionLock) tryLock(ctx context.Context, conn *sql.Conn, userID int64) (bool, error) {
+	// GET_LOCK returns 1 on success, 0 on timeout and NULL on error.
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, fmt.Sprintf("%s%d", syncLockNamePrefix, userID)).Scan(&got); err != nil {
+		return false, err
+	}
+	if !got.Valid {
+		return false, fmt.Errorf("GET_LOCK failed for user %d", userID)
+	}
+	return got.Int64 == 1, nil
+}
+
+func (mysqlSessionLock) unlock(ctx context.Context, conn *sql.Conn, userID int64) error {
+	var released sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT RELEASE_LOCK(?)`, fmt.Sprintf("%s%d", syncLockNamePrefix, userID)).Scan(&released); err != nil {
+		return err
+	}
+	if released.Int64 != 1 {
+		return fmt.Errorf("named lock for user %d was not held", userID)
+	}
+	return nil
+}
+
+// dbLocker layers a database session lock over the in-process locker. The
+// local lock is taken first, so within one process only a single request per
+// user ever talks to the database about that user's lock.
+type dbLocker struct {
+	db      *sql.DB
+	lock    sessionLock
+	timeout time.Duration
+	local   *locker.Local
+
+	mu    sync.Mutex
+	conns map[int64]*sql.Conn // connection holding each user's lock
+
+	remoteContended atomic.Uint64
+	remoteTimedOut  atomic.Uint64
+	remoteCancelled atomic.Uint64
+	remoteFailed    atomic.Uint64 // local lock taken but database lock not
+}
+
+func newDBLocker(db *sql.DB, lock sessionLock, timeout time.Duration) *dbLocker {
+	return &dbLocker{
+		db:      db,
+		lock:    lock,
+		timeout: timeout,
+		local:   locker.NewLocal(timeout),
+		conns:   make(map[int64]*sql.Conn),
+	}
+}
+
+// Lock takes the user's local lock and then the database lock, polling the
+// latter until it is free. The timeout covers both waits.
+func (l *dbLocker) Lock(ctx context.Context, userID int64) error {
+	start := time.Now()
+	if err := l.local.Lock(ctx, userID); err != nil {
+		return err
+	}
+
+	waitCtx := ctx
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithDeadline(ctx, start.Add(l.timeout))
+		defer cancel()
+	}
+
+	conn, err := l.acquire(waitCtx, userID)
+	if err != nil {
+		l.remoteFailed.Add(1)
+		l.local.Unlock(userID)
+		switch {
+		case ctx.Err() != nil:
+			l.remoteCancelled.Add(1)
+			return ctx.Err()
+		case waitCtx.Err() != nil:
+			l.remoteTimedOut.Add(1)
+			return locker.ErrTimeout
+		}
+		return err
+	}
+
+	l.mu.Lock()
+	l.conns[userID] = conn
+	l.mu.Unlock()
+	return nil
+}
+
+// acquire pins a connection and polls the session lock on it.
+func (l *dbLocker) acquire(ctx context.Context, userID int64) (*sql.Conn, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire connection for sync lock: %w", classify(err))
+	}
+
+	poll := syncLockMinPoll
+	for attempt := 0; ; attempt++ {
+		got, err := l.lock.tryLock(ctx, conn, userID)
+		if err != nil {
+			discardConn(conn)
+			return nil, fmt.Errorf("could not acquire sync lock: %w", classify(err))
+		}
+		if got {
+			return conn, nil
+		}
+		if attempt == 0 {
+			l.remoteContended.Add(1)
+		}
+
+		timer := time.NewTimer(poll)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		poll = min(poll*2, syncLockMaxPoll)
+	}
+}
+
+// Unlock releases the database lock and then the local lock.
+func (l *dbLocker) Unlock(userID int64) {
+	l.mu.Lock()
+	conn, ok := l.conns[userID]
+	delete(l.conns, userID)
+	l.mu.Unlock()
+
+	if ok {
+		ctx, cancel := context.WithTimeout(context.Background(), syncUnlockTimeout)
+		if err := l.lock.unlock(ctx, conn, userID); err != nil {
+			// Closing the session releases its locks, so drop the connection
+			// rather than returning it to the pool still holding the lock.
+			log.Warn().Err(err).Int64("user_id", userID).Msg("Could not release sync lock, discarding its connection")
+			discardConn(conn)
+		} else {
+			conn.Close()
+		}
+		cancel()
+	}
+	l.local.Unlock(userID)
+}
+
+// Stats reports the local counters adjusted for the database lock: waits for
+// other replicas count as contended, and local acquisitions that then failed
+// to get the database lock are not counted as acquired.
+func (l *dbLocker) Stats() locker.Stats {
+	stats := l.local.Stats()
+	stats.Backend = l.lock.name()
+	stats.Acquired -= l.remoteFailed.Load()
+	stats.RemoteContended = l.remoteContended.Load()
+	stats.TimedOut += l.remoteTimedOut.Load()
+	stats.Cancelled += l.remoteCancelled.Load()
+	return stats
+}
+
+// Close closes the locker's connection pool, releasing any locks still held.
+func (l *dbLocker) Close() error {
+	return l.db.Close()
+}
+
+// discardConn closes conn and removes it from the pool instead of reusing it.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+var (
+	_ locker.Locker = sqliteLocker{}
+	_ locker.Locker = (*dbLocker)(nil)
+)
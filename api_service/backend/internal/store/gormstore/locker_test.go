@@ -0,0 +1,233 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/locker"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSessionLock stands in for a database lock held by other replicas.
+type fakeSessionLock struct {
+	mu     sync.Mutex
+	held   map[int64]bool
+	tries  int
+	broken bool
+}
+
+func (f *fakeSessionLock) name() string { return "fake" }
+
+func (f *fakeSessionLock) tryLock(ctx context.Context, conn *sql.Conn, userID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tries++
+	if f.broken {
+		return false, errors.New("connection reset")
+	}
+	if f.held[userID] {
+		return false, nil
+	}
+	f.held[userID] = true
+	return true, nil
+}
+
+func (f *fakeSessionLock) unlock(ctx context.Context, conn *sql.Conn, userID int64) error {
+	f.set(userID, false)
+	return nil
+}
+
+func (f *fakeSessionLock) set(userID int64, held bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.held[userID] = held
+}
+
+func newFakeDBLocker(t *testing.T, timeout time.Duration) (*dbLocker, *fakeSessionLock) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "locks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSessionLock{held: make(map[int64]bool)}
+	l := newDBLocker(db, fake, timeout)
+	t.Cleanup(func() { l.Close() })
+	return l, fake
+}
+
+func TestDBLockerWaitsForOtherReplica(t *testing.T) {
+	l, fake := newFakeDBLocker(t, time.Second)
+	fake.set(1, true) // another replica holds user 1
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fake.set(1, false)
+	}()
+	if err := l.Lock(context.Background(), 1); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	l.Unlock(1)
+
+	stats := l.Stats()
+	if stats.Backend != "fake" || stats.Acquired != 1 || stats.RemoteContended != 1 {
+		t.Errorf("stats = %+v, want backend fake, 1 acquired, 1 remote contended", stats)
+	}
+	if fake.held[1] {
+		t.Error("database lock still held after Unlock")
+	}
+	if open := l.db.Stats().InUse; open != 0 {
+		t.Errorf("%d connections still in use after Unlock", open)
+	}
+}
+
+func TestDBLockerTimeout(t *testing.T) {
+	l, fake := newFakeDBLocker(t, 50*time.Millisecond)
+	fake.set(1, true)
+
+	if err := l.Lock(context.Background(), 1); !errors.Is(err, locker.ErrTimeout) {
+		t.Fatalf("Lock = %v, want ErrTimeout", err)
+	}
+	stats := l.Stats()
+	if stats.Acquired != 0 || stats.TimedOut != 1 || stats.ActiveLocks != 0 {
+		t.Errorf("stats = %+v, want 0 acquired, 1 timed out, no active locks", stats)
+	}
+
+	// The local lock was released, so the user can be locked once free.
+	fake.set(1, false)
+	if err := l.Lock(context.Background(), 1); err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	l.Unlock(1)
+}
+
+func TestDBLockerCancelled(t *testing.T) {
+	l, fake := newFakeDBLocker(t, 0)
+	fake.set(1, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := l.Lock(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock = %v, want context.DeadlineExceeded", err)
+	}
+	if stats := l.Stats(); stats.Cancelled != 1 || stats.TimedOut != 0 {
+		t.Errorf("stats = %+v, want 1 cancelled", stats)
+	}
+}
+
+func TestDBLockerDatabaseError(t *testing.T) {
+	l, fake := newFakeDBLocker(t, time.Second)
+	fake.broken = true
+
+	err := l.Lock(context.Background(), 1)
+	if err == nil || errors.Is(err, locker.ErrTimeout) {
+		t.Fatalf("Lock = %v, want the database error", err)
+	}
+	if stats := l.Stats(); stats.ActiveLocks != 0 || stats.Acquired != 0 {
+		t.Errorf("stats = %+v, want no locks", stats)
+	}
+}
+
+func TestDBLockerLocalFirst(t *testing.T) {
+	l, fake := newFakeDBLocker(t, 50*time.Millisecond)
+	if err := l.Lock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock(1)
+
+	// A second request in the same process waits on the local lock and
+	// never asks the database.
+	if err := l.Lock(context.Background(), 1); !errors.Is(err, locker.ErrTimeout) {
+		t.Fatalf("second Lock = %v, want ErrTimeout", err)
+	}
+	if fake.tries != 1 {
+		t.Errorf("database lock tried %d times, want 1", fake.tries)
+	}
+}
+
+func TestSyncLockKey(t *testing.T) {
+	seen := make(map[int64]int64)
+	for _, id := range []int64{1, 2, 1<<32 + 1, 1<<32 + 2, -1, 1 << 62} {
+		key := syncLockKey(id)
+		if other, ok := seen[key]; ok {
+			t.Errorf("users %d and %d share sync lock key %d", other, id, key)
+		}
+		seen[key] = id
+		if key == migrationLockID {
+			t.Errorf("user %d shares the migration lock key", id)
+		}
+	}
+	if syncLockKey(7) != syncLockKey(7) {
+		t.Error("sync lock key is not stable")
+	}
+}
+
+func TestNewSyncLockerSQLite(t *testing.T) {
+	l, err := NewSyncLocker(&config.Config{DBType: "sqlite", SyncLockTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	l.Unlock(1)
+	if stats := l.Stats(); stats.Backend != "sqlite" || stats.Acquired != 1 {
+		t.Errorf("stats = %+v, want backend sqlite with 1 acquisition", stats)
+	}
+
+	if _, err := NewSyncLocker(&config.Config{DBType: "memory"}); err == nil {
+		t.Error("NewSyncLocker accepted the memory store")
+	}
+}
+
+// TestSyncLockerAcrossReplicas checks that two lockers on the same database,
+// standing in for two server replicas, exclude each other. It runs against
+// Postgres or MySQL when TEST_POSTGRES_DSN or TEST_MYSQL_DSN is set.
+func TestSyncLockerAcrossReplicas(t *testing.T) {
+	for _, d := range []struct{ dialect, dsnEnv string }{
+		{"postgres", "TEST_POSTGRES_DSN"},
+		{"mysql", "TEST_MYSQL_DSN"},
+	} {
+		t.Run(d.dialect, func(t *testing.T) {
+			dsn := os.Getenv(d.dsnEnv)
+			if dsn == "" {
+				t.Skipf("set %s to test %s sync locks", d.dsnEnv, d.dialect)
+			}
+			cfg := &config.Config{DBType: d.dialect, DSN: dsn, DBMaxOpenConnections: 4, DBMaxIdleConnections: 2, SyncLockTimeout: 200 * time.Millisecond}
+			replica := func() *dbLocker {
+				l, err := NewSyncLocker(cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { l.(*dbLocker).Close() })
+				return l.(*dbLocker)
+			}
+			a, b := replica(), replica()
+			ctx := context.Background()
+
+			if err := a.Lock(ctx, 42); err != nil {
+				t.Fatalf("replica a: %v", err)
+			}
+			if err := b.Lock(ctx, 42); !errors.Is(err, locker.ErrTimeout) {
+				t.Fatalf("replica b while a holds the lock = %v, want ErrTimeout", err)
+			}
+			if err := b.Lock(ctx, 43); err != nil {
+				t.Fatalf("replica b, other user: %v", err)
+			}
+			b.Unlock(43)
+
+			a.Unlock(42)
+			if err := b.Lock(ctx, 42); err != nil {
+				t.Fatalf("replica b after a unlocked: %v", err)
+			}
+			b.Unlock(42)
+			if stats := b.Stats(); stats.RemoteContended == 0 || stats.Backend != d.dialect {
+				t.Errorf("stats = %+v, want remote contention on %s", stats, d.dialect)
+			}
+		})
+	}
+}
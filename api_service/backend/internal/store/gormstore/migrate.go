@@ -0,0 +1,474 @@
+package gormstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// The migration framework applies numbered migrations (see migrations.go) to
+// SQLite, Postgres and MySQL alike. Applied versions are recorded in the
+// schema_migrations table together with a checksum of the steps that ran, so
+// editing a migration after it shipped is detected instead of silently
+// diverging. Each migration runs in its own transaction; note that MySQL
+// commits DDL implicitly, so a failing MySQL migration may be partially
+// applied. Steps are written to be idempotent so re-running them is safe.
+
+// The migration lock is a Postgres advisory lock or a MySQL named lock.
+const (
+	migrationLockID   int64 = 0x436f6f6b696550 // "CookieP"
+	migrationLockName       = "cookiepusher_schema_migrations"
+	migrationLockWait       = 5 * time.Minute
+)
+
+// step is one schema operation within a migration. Its description feeds the
+// migration checksum.
+type step interface {
+	apply(tx *gorm.DB) error
+	describe() string
+}
+
+// execSQL runs a raw SQL statement.
+type execSQL string
+
+func (s execSQL) apply(tx *gorm.DB) error { return tx.Exec(string(s)).Error }
+func (s execSQL) describe() string        { return strings.Join(strings.Fields(string(s)), " ") }
+
+// addColumn adds a column unless it already exists.
+type addColumn struct {
+	table, column, definition string
+}
+
+func (s addColumn) apply(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(s.table, s.column) {
+		return nil
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", s.table, s.column, s.definition)).Error
+}
+
+func (s addColumn) describe() string {
+	return fmt.Sprintf("add column %s.%s %s", s.table, s.column, s.definition)
+}
+
+// dropColumn drops a column if it exists.
+type dropColumn struct {
+	table, column string
+}
+
+func (s dropColumn) apply(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(s.table, s.column) {
+		return nil
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", s.table, s.column)).Error
+}
+
+func (s dropColumn) describe() string {
+	return fmt.Sprintf("drop column %s.%s", s.table, s.column)
+}
+
+// createIndex creates an index unless one with the same name exists.
+type createIndex struct {
+	table, name string
+	unique      bool
+	columns     []string
+}
+
+func (s createIndex) apply(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(s.table, s.name) {
+		return nil
+	}
+	kind := "INDEX"
+	if s.unique {
+		kind = "UNIQUE INDEX"
+	}
+	return tx.Exec(fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, s.name, s.table, strings.Join(s.columns, ", "))).Error
+}
+
+func (s createIndex) describe() string {
+	kind := "index"
+	if s.unique {
+		kind = "unique index"
+	}
+	return fmt.Sprintf("create %s %s on %s (%s)", kind, s.name, s.table, strings.Join(s.columns, ", "))
+}
+
+// dropIndex drops an index if it exists.
+type dropIndex struct {
+	table, name string
+}
+
+func (s dropIndex) apply(tx *gorm.DB) error {
+	if !tx.Migrator().HasIndex(s.table, s.name) {
+		return nil
+	}
+	if tx.Dialector.Name() == "mysql" {
+		return tx.Exec(fmt.Sprintf("DROP INDEX %s ON %s", s.name, s.table)).Error
+	}
+	return tx.Exec(fmt.Sprintf("DROP INDEX %s", s.name)).Error
+}
+
+func (s dropIndex) describe() string {
+	return fmt.Sprintf("drop index %s on %s", s.name, s.table)
+}
+
+// goStep runs Go code, typically to backfill data. Changing the function body
+// does not change the checksum, so give it a new name when its meaning changes.
+type goStep struct {
+	name string
+	fn   func(tx *gorm.DB) error
+}
+
+func (s goStep) apply(tx *gorm.DB) error { return s.fn(tx) }
+func (s goStep) describe() string        { return "go:" + s.name }
+
+// dialectSteps maps a dialect name ("sqlite", "postgres", "mysql") to steps.
+type dialectSteps map[string][]step
+
+// allDialects uses the same steps for every dialect.
+func allDialects(steps ...step) dialectSteps {
+	return dialectSteps{"sqlite": steps, "postgres": steps, "mysql": steps}
+}
+
+// migration is one numbered schema change.
+type migration struct {
+	version int
+	name    string
+	up      dialectSteps
+	down    dialectSteps
+}
+
+func (m migration) checksum(dialect string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", m.version)
+	for _, s := range m.up[dialect] {
+		fmt.Fprintf(h, "%s\n", s.describe())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// schemaMigration is a row of the schema_migrations table.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	Checksum  string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationInfo describes a single migration and whether it has been applied.
+type MigrationInfo struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified is set when the stored checksum no longer matches the migration.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// MigrationStatus reports the schema state of the connected database.
+type MigrationStatus struct {
+	Dialect    string          `json:"dialect"`
+	Current    int             `json:"current"`
+	Latest     int             `json:"latest"`
+	Migrations []MigrationInfo `json:"migrations"`
+	Pending    []MigrationInfo `json:"pending"`
+}
+
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// appliedMigrations reads schema_migrations, or returns nil if it does not exist.
+func (s *GormStore) appliedMigrations() (map[int]schemaMigration, error) {
+	applied := make(map[int]schemaMigration)
+	if !s.db.Migrator().HasTable(&schemaMigration{}) {
+		return applied, nil
+	}
+	var rows []schemaMigration
+	if err := s.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// legacySQLiteVersion returns the schema version recorded by the old
+// meta-table migrator, or 0 if there is none.
+func (s *GormStore) legacySQLiteVersion() int {
+	if s.Dialect() != "sqlite" || !s.db.Migrator().HasTable("meta") {
+		return 0
+	}
+	var meta struct {
+		Key   string
+		Value string
+	}
+	var version int
+	s.db.Table("meta").Where("key = ?", "version").Limit(1).Find(&meta)
+	fmt.Sscan(meta.Value, &version)
+	return version
+}
+
+// MigrationStatus returns every known migration and whether it was applied.
+func (s *GormStore) MigrationStatus() (*MigrationStatus, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	legacy := 0
+	if len(applied) == 0 {
+		legacy = s.legacySQLiteVersion()
+	}
+
+	dialect := s.Dialect()
+	status := &MigrationStatus{Dialect: dialect, Latest: latestVersion(), Pending: []MigrationInfo{}}
+	for _, m := range migrations {
+		info := MigrationInfo{Version: m.version, Name: m.name}
+		if row, ok := applied[m.version]; ok {
+			info.Applied = true
+			appliedAt := row.AppliedAt
+			info.AppliedAt = &appliedAt
+			info.Modified = row.Checksum != m.checksum(dialect)
+		} else if m.version <= legacy {
+			info.Applied = true
+		}
+		if info.Applied {
+			status.Current = m.version
+		} else {
+			status.Pending = append(status.Pending, info)
+		}
+		status.Migrations = append(status.Migrations, info)
+	}
+	return status, nil
+}
+
+// MigrateUp applies all pending migrations and returns the steps it applied.
+// With dryRun set it only reports what would be applied.
+func (s *GormStore) MigrateUp(dryRun bool) ([]MigrationInfo, error) {
+	if dryRun {
+		status, err := s.MigrationStatus()
+		if err != nil {
+			return nil, err
+		}
+		return status.Pending, nil
+	}
+
+	var result []MigrationInfo
+	err := s.withMigrationLock(func() error {
+		if err := s.createMigrationsTable(); err != nil {
+			return err
+		}
+		if err := s.adoptLegacySQLiteVersion(); err != nil {
+			return err
+		}
+
+		status, err := s.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, info := range status.Migrations {
+			if info.Modified {
+				return fmt.Errorf("migration v%d (%s) was modified after it was applied; its checksum no longer matches", info.Version, info.Name)
+			}
+		}
+
+		dialect := s.Dialect()
+		pending := make(map[int]bool, len(status.Pending))
+		for _, info := range status.Pending {
+			pending[info.Version] = true
+		}
+		for _, m := range migrations {
+			if !pending[m.version] {
+				continue
+			}
+			log.Info().Msgf("Running migration v%d: %s...", m.version, m.name)
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				for _, st := range m.up[dialect] {
+					if err := st.apply(tx); err != nil {
+						return fmt.Errorf("%s: %w", st.describe(), err)
+					}
+				}
+				return tx.Create(&schemaMigration{
+					Version:   m.version,
+					Name:      m.name,
+					Checksum:  m.checksum(dialect),
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration v%d failed: %w", m.version, err)
+			}
+			log.Info().Msgf("Migration v%d successful.", m.version)
+			result = append(result, MigrationInfo{Version: m.version, Name: m.name, Applied: true})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// MigrateDown reverts the given number of applied migrations, newest first,
+// and returns the steps it reverted. With dryRun set it only reports them.
+func (s *GormStore) MigrateDown(steps int, dryRun bool) ([]MigrationInfo, error) {
+	var reverted []MigrationInfo
+	run := func() error {
+		if !dryRun {
+			if err := s.createMigrationsTable(); err != nil {
+				return err
+			}
+			if err := s.adoptLegacySQLiteVersion(); err != nil {
+				return err
+			}
+		}
+		status, err := s.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		dialect := s.Dialect()
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if !status.Migrations[i].Applied {
+				continue
+			}
+			info := MigrationInfo{Version: m.version, Name: m.name}
+			if dryRun {
+				reverted = append(reverted, info)
+				continue
+			}
+			log.Info().Msgf("Reverting migration v%d: %s...", m.version, m.name)
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				for _, st := range m.down[dialect] {
+					if err := st.apply(tx); err != nil {
+						return fmt.Errorf("%s: %w", st.describe(), err)
+					}
+				}
+				return tx.Delete(&schemaMigration{}, m.version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration v%d failed: %w", m.version, err)
+			}
+			reverted = append(reverted, info)
+		}
+		return nil
+	}
+
+	if dryRun {
+		return reverted, run()
+	}
+	err := s.withMigrationLock(run)
+	return reverted, err
+}
+
+func (s *GormStore) createMigrationsTable() error {
+	var ddl string
+	switch s.Dialect() {
+	case "postgres":
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`
+	case "mysql":
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at DATETIME(3) NOT NULL
+		)`
+	default:
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`
+	}
+	if err := s.db.Exec(ddl).Error; err != nil {
+		return fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// adoptLegacySQLiteVersion records the migrations applied by the old
+// meta-table migrator in schema_migrations and drops the meta table.
+func (s *GormStore) adoptLegacySQLiteVersion() error {
+	var count int64
+	if err := s.db.Model(&schemaMigration{}).Count(&count).Error; err != nil {
+		return err
+	}
+	legacy := s.legacySQLiteVersion()
+	if count > 0 || legacy == 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		for _, m := range migrations {
+			if m.version > legacy {
+				break
+			}
+			if err := tx.Create(&schemaMigration{Version: m.version, Name: m.name, Checksum: m.checksum("sqlite"), AppliedAt: now}).Error; err != nil {
+				return fmt.Errorf("could not record legacy migration v%d: %w", m.version, err)
+			}
+		}
+		if err := tx.Exec(`DROP TABLE meta`).Error; err != nil {
+			return fmt.Errorf("could not drop legacy meta table: %w", err)
+		}
+		log.Info().Msgf("Adopted legacy SQLite schema version %d.", legacy)
+		return nil
+	})
+}
+
+// withMigrationLock runs fn while holding a database-wide lock so that
+// replicas starting at the same time do not migrate concurrently. SQLite
+// serialises writers itself, so no extra lock is taken there.
+func (s *GormStore) withMigrationLock(fn func() error) error {
+	dialect := s.Dialect()
+	if dialect != "postgres" && dialect != "mysql" {
+		return fn()
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), migrationLockWait)
+	defer cancel()
+
+	// Session-level locks belong to a connection, so pin one for the duration.
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not acquire connection for migration lock: %w", err)
+	}
+	defer conn.Close()
+
+	log.Debug().Msg("Waiting for migration lock...")
+	if dialect == "postgres" {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("could not acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	} else {
+		var got int
+		if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, migrationLockName, int(migrationLockWait.Seconds())).Scan(&got); err != nil {
+			return fmt.Errorf("could not acquire migration lock: %w", err)
+		}
+		if got != 1 {
+			return fmt.Errorf("timed out waiting for migration lock")
+		}
+		defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLockName)
+	}
+
+	return fn()
+}
@@ -0,0 +1,897 @@
+package gormstore
+
+import (
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// migrations is the ordered schema history shared by all dialects. Versions
+// 1-5 reproduce the original SQLite migrations; for Postgres and MySQL, whose
+// schema used to be managed by AutoMigrate, the same steps are idempotent so
+// existing databases are brought in line (dropping the stale role column,
+// rebuilding the cookie key index) rather than recreated.
+//
+// Never edit a migration that has shipped: add a new one instead. Applied
+// migrations are checksummed and MigrateUp refuses to run if they change.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS users (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					api_key TEXT NOT NULL UNIQUE,
+					role TEXT NOT NULL,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+				execSQL(`CREATE TABLE IF NOT EXISTS cookies (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					name TEXT NOT NULL,
+					value TEXT NOT NULL,
+					path TEXT,
+					expires DATETIME,
+					http_only BOOLEAN,
+					secure BOOLEAN,
+					same_site TEXT,
+					last_updated_from_extension_at DATETIME NOT NULL,
+					FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+					UNIQUE(user_id, domain, name, path)
+				)`),
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS users (
+					id BIGSERIAL PRIMARY KEY,
+					api_key TEXT NOT NULL,
+					role TEXT NOT NULL DEFAULT 'user',
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "users", name: "idx_users_api_key", unique: true, columns: []string{"api_key"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS cookies (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					domain TEXT NOT NULL,
+					name TEXT NOT NULL,
+					value TEXT NOT NULL,
+					path TEXT NOT NULL DEFAULT '/',
+					expires TIMESTAMPTZ,
+					http_only BOOLEAN NOT NULL DEFAULT false,
+					secure BOOLEAN NOT NULL DEFAULT false,
+					same_site VARCHAR(16),
+					last_updated_from_extension_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "cookies", name: "idx_cookie_key", unique: true, columns: []string{"user_id", "domain", "name", "path"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS users (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					api_key VARCHAR(191) NOT NULL,
+					role VARCHAR(32) NOT NULL DEFAULT 'user',
+					created_at DATETIME(3) NOT NULL,
+					updated_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "users", name: "idx_users_api_key", unique: true, columns: []string{"api_key"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS cookies (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					name VARCHAR(191) NOT NULL,
+					value LONGTEXT NOT NULL,
+					path VARCHAR(191) NOT NULL DEFAULT '/',
+					expires DATETIME(3) NULL,
+					http_only BOOLEAN NOT NULL DEFAULT FALSE,
+					secure BOOLEAN NOT NULL DEFAULT FALSE,
+					same_site VARCHAR(16),
+					last_updated_from_extension_at DATETIME(3) NOT NULL,
+					CONSTRAINT fk_cookies_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				)`),
+				createIndex{table: "cookies", name: "idx_cookie_key", unique: true, columns: []string{"user_id", "domain", "name", "path"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS cookies`),
+			execSQL(`DROP TABLE IF EXISTS users`),
+		),
+	},
+	{
+		version: 2,
+		name:    "add sharing features",
+		up: dialectSteps{
+			"sqlite": {
+				addColumn{table: "users", column: "sharing_enabled", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+				addColumn{table: "cookies", column: "is_sharable", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+			},
+			"postgres": {
+				addColumn{table: "users", column: "sharing_enabled", definition: "BOOLEAN NOT NULL DEFAULT false"},
+				addColumn{table: "cookies", column: "is_sharable", definition: "BOOLEAN NOT NULL DEFAULT false"},
+			},
+			"mysql": {
+				addColumn{table: "users", column: "sharing_enabled", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+				addColumn{table: "cookies", column: "is_sharable", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+			},
+		},
+		down: allDialects(
+			dropColumn{table: "cookies", column: "is_sharable"},
+			dropColumn{table: "users", column: "sharing_enabled"},
+		),
+	},
+	{
+		version: 3,
+		name:    "fix UNIQUE constraint on cookies table",
+		up: dialectSteps{
+			// Rebuild the table; rows that violate the constraint are dropped.
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS cookies_new (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					name TEXT NOT NULL,
+					value TEXT NOT NULL,
+					path TEXT,
+					expires DATETIME,
+					http_only BOOLEAN,
+					secure BOOLEAN,
+					same_site TEXT,
+					is_sharable BOOLEAN NOT NULL DEFAULT 0,
+					last_updated_from_extension_at DATETIME NOT NULL,
+					FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+					UNIQUE(user_id, domain, name, path)
+				)`),
+				execSQL(`INSERT OR IGNORE INTO cookies_new (id, user_id, domain, name, value, path, expires, http_only, secure, same_site, is_sharable, last_updated_from_extension_at)
+					SELECT id, user_id, domain, name, value, path, expires, http_only, secure, same_site, is_sharable, last_updated_from_extension_at
+					FROM cookies`),
+				execSQL(`DROP TABLE cookies`),
+				execSQL(`ALTER TABLE cookies_new RENAME TO cookies`),
+			},
+			// Remove duplicates (keeping the newest row) and recreate the index.
+			"postgres": {
+				execSQL(`DELETE FROM cookies a USING cookies b
+					WHERE a.user_id = b.user_id AND a.domain = b.domain AND a.name = b.name AND a.path = b.path AND a.id < b.id`),
+				dropIndex{table: "cookies", name: "idx_cookie_key"},
+				createIndex{table: "cookies", name: "idx_cookie_key", unique: true, columns: []string{"user_id", "domain", "name", "path"}},
+			},
+			"mysql": {
+				execSQL(`DELETE a FROM cookies a JOIN cookies b
+					ON a.user_id = b.user_id AND a.domain = b.domain AND a.name = b.name AND a.path = b.path AND a.id < b.id`),
+				dropIndex{table: "cookies", name: "idx_cookie_key"},
+				createIndex{table: "cookies", name: "idx_cookie_key", unique: true, columns: []string{"user_id", "domain", "name", "path"}},
+			},
+		},
+		// Nothing to undo: the constraint existed in the original schema and
+		// dropped duplicates cannot be restored.
+		down: dialectSteps{},
+	},
+	{
+		version: 4,
+		name:    "remove user roles and add remarks",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE users_new (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					api_key TEXT NOT NULL UNIQUE,
+					remark TEXT,
+					sharing_enabled BOOLEAN NOT NULL DEFAULT 0,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+				execSQL(`INSERT INTO users_new (id, api_key, sharing_enabled, created_at, updated_at)
+					SELECT id, api_key, sharing_enabled, created_at, updated_at
+					FROM users`),
+				execSQL(`DROP TABLE users`),
+				execSQL(`ALTER TABLE users_new RENAME TO users`),
+			},
+			"postgres": {
+				dropColumn{table: "users", column: "role"},
+				addColumn{table: "users", column: "remark", definition: "TEXT"},
+			},
+			"mysql": {
+				dropColumn{table: "users", column: "role"},
+				addColumn{table: "users", column: "remark", definition: "TEXT"},
+			},
+		},
+		// Every user gets the plain "user" role back; remarks are lost.
+		down: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE users_old (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					api_key TEXT NOT NULL UNIQUE,
+					role TEXT NOT NULL,
+					sharing_enabled BOOLEAN NOT NULL DEFAULT 0,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+				execSQL(`INSERT INTO users_old (id, api_key, role, sharing_enabled, created_at, updated_at)
+					SELECT id, api_key, 'user', sharing_enabled, created_at, updated_at
+					FROM users`),
+				execSQL(`DROP TABLE users`),
+				execSQL(`ALTER TABLE users_old RENAME TO users`),
+			},
+			"postgres": {
+				dropColumn{table: "users", column: "remark"},
+				addColumn{table: "users", column: "role", definition: "TEXT NOT NULL DEFAULT 'user'"},
+			},
+			"mysql": {
+				dropColumn{table: "users", column: "remark"},
+				addColumn{table: "users", column: "role", definition: "VARCHAR(32) NOT NULL DEFAULT 'user'"},
+			},
+		},
+	},
+	{
+		version: 5,
+		name:    "add cookies_json and last_synced_at to users table",
+		up: dialectSteps{
+			"sqlite": {
+				addColumn{table: "users", column: "cookies_json", definition: "TEXT"},
+				addColumn{table: "users", column: "last_synced_at", definition: "DATETIME"},
+				// Add deleted_at for soft delete support
+				addColumn{table: "users", column: "deleted_at", definition: "DATETIME"},
+			},
+			"postgres": {
+				addColumn{table: "users", column: "cookies_json", definition: "TEXT"},
+				addColumn{table: "users", column: "last_synced_at", definition: "TIMESTAMPTZ"},
+				addColumn{table: "users", column: "deleted_at", definition: "TIMESTAMPTZ"},
+				createIndex{table: "users", name: "idx_users_deleted_at", columns: []string{"deleted_at"}},
+			},
+			"mysql": {
+				addColumn{table: "users", column: "cookies_json", definition: "LONGTEXT"},
+				addColumn{table: "users", column: "last_synced_at", definition: "DATETIME(3) NULL"},
+				addColumn{table: "users", column: "deleted_at", definition: "DATETIME(3) NULL"},
+				createIndex{table: "users", name: "idx_users_deleted_at", columns: []string{"deleted_at"}},
+			},
+		},
+		down: dialectSteps{
+			"sqlite": {
+				dropColumn{table: "users", column: "deleted_at"},
+				dropColumn{table: "users", column: "last_synced_at"},
+				dropColumn{table: "users", column: "cookies_json"},
+			},
+			"postgres": {
+				dropIndex{table: "users", name: "idx_users_deleted_at"},
+				dropColumn{table: "users", column: "deleted_at"},
+				dropColumn{table: "users", column: "last_synced_at"},
+				dropColumn{table: "users", column: "cookies_json"},
+			},
+			"mysql": {
+				dropIndex{table: "users", name: "idx_users_deleted_at"},
+				dropColumn{table: "users", column: "deleted_at"},
+				dropColumn{table: "users", column: "last_synced_at"},
+				dropColumn{table: "users", column: "cookies_json"},
+			},
+		},
+	},
+	{
+		version: 6,
+		name:    "make the cookies table the single source of truth",
+		up: dialectSteps{
+			"sqlite":   cookiesAuthoritativeUp(`TEXT NOT NULL DEFAULT '' COLLATE NOCASE`),
+			"postgres": cookiesAuthoritativeUp(`TEXT COLLATE "C" NOT NULL DEFAULT ''`),
+			"mysql":    cookiesAuthoritativeUp(`VARCHAR(255) NOT NULL DEFAULT ''`),
+		},
+		down: dialectSteps{
+			"sqlite":   cookiesAuthoritativeDown("TEXT"),
+			"postgres": cookiesAuthoritativeDown("TEXT"),
+			"mysql":    cookiesAuthoritativeDown("LONGTEXT"),
+		},
+	},
+	{
+		version: 7,
+		name:    "add per-user quota overrides",
+		up: allDialects(
+			addColumn{table: "users", column: "quota_max_cookies", definition: "BIGINT"},
+			addColumn{table: "users", column: "quota_max_bytes", definition: "BIGINT"},
+			addColumn{table: "users", column: "quota_max_domains", definition: "BIGINT"},
+		),
+		down: allDialects(
+			dropColumn{table: "users", column: "quota_max_domains"},
+			dropColumn{table: "users", column: "quota_max_bytes"},
+			dropColumn{table: "users", column: "quota_max_cookies"},
+		),
+	},
+	{
+		version: 8,
+		name:    "add per-user domain rules",
+		up: allDialects(
+			addColumn{table: "users", column: "domain_rules", definition: "TEXT"},
+		),
+		down: allDialects(
+			dropColumn{table: "users", column: "domain_rules"},
+		),
+	},
+	{
+		version: 9,
+		name:    "add per-user sharing rules",
+		up: allDialects(
+			addColumn{table: "users", column: "sharing_rules", definition: "TEXT"},
+		),
+		down: allDialects(
+			dropColumn{table: "users", column: "sharing_rules"},
+		),
+	},
+	{
+		version: 10,
+		name:    "add pool clients",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_clients (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					key_hash TEXT NOT NULL UNIQUE,
+					key_prefix TEXT NOT NULL,
+					allowed_domains TEXT,
+					rate_limit INTEGER NOT NULL DEFAULT 0,
+					expires_at DATETIME,
+					revoked_at DATETIME,
+					request_count INTEGER NOT NULL DEFAULT 0,
+					cookies_served INTEGER NOT NULL DEFAULT 0,
+					last_used_at DATETIME,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_clients (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					key_hash TEXT NOT NULL,
+					key_prefix TEXT NOT NULL,
+					allowed_domains TEXT,
+					rate_limit INTEGER NOT NULL DEFAULT 0,
+					expires_at TIMESTAMPTZ,
+					revoked_at TIMESTAMPTZ,
+					request_count BIGINT NOT NULL DEFAULT 0,
+					cookies_served BIGINT NOT NULL DEFAULT 0,
+					last_used_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "pool_clients", name: "idx_pool_clients_key_hash", unique: true, columns: []string{"key_hash"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_clients (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(191) NOT NULL,
+					key_hash VARCHAR(64) NOT NULL,
+					key_prefix VARCHAR(32) NOT NULL,
+					allowed_domains TEXT,
+					rate_limit INT NOT NULL DEFAULT 0,
+					expires_at DATETIME(3) NULL,
+					revoked_at DATETIME(3) NULL,
+					request_count BIGINT NOT NULL DEFAULT 0,
+					cookies_served BIGINT NOT NULL DEFAULT 0,
+					last_used_at DATETIME(3) NULL,
+					created_at DATETIME(3) NOT NULL,
+					updated_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "pool_clients", name: "idx_pool_clients_key_hash", unique: true, columns: []string{"key_hash"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS pool_clients`),
+		),
+	},
+	{
+		version: 11,
+		name:    "add pool leases",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_leases (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					client_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					active_key TEXT UNIQUE,
+					expires_at DATETIME NOT NULL,
+					released_at DATETIME,
+					outcome TEXT NOT NULL DEFAULT '',
+					created_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "pool_leases", name: "idx_pool_leases_client_id", columns: []string{"client_id"}},
+				createIndex{table: "pool_leases", name: "idx_pool_leases_domain_user", columns: []string{"domain", "user_id"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_leases (
+					id BIGSERIAL PRIMARY KEY,
+					client_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain TEXT NOT NULL,
+					active_key TEXT,
+					expires_at TIMESTAMPTZ NOT NULL,
+					released_at TIMESTAMPTZ,
+					outcome VARCHAR(16) NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "pool_leases", name: "idx_pool_leases_active_key", unique: true, columns: []string{"active_key"}},
+				createIndex{table: "pool_leases", name: "idx_pool_leases_client_id", columns: []string{"client_id"}},
+				createIndex{table: "pool_leases", name: "idx_pool_leases_domain_user", columns: []string{"domain", "user_id"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_leases (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					client_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					active_key VARCHAR(255) NULL,
+					expires_at DATETIME(3) NOT NULL,
+					released_at DATETIME(3) NULL,
+					outcome VARCHAR(16) NOT NULL DEFAULT '',
+					created_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "pool_leases", name: "idx_pool_leases_active_key", unique: true, columns: []string{"active_key"}},
+				createIndex{table: "pool_leases", name: "idx_pool_leases_client_id", columns: []string{"client_id"}},
+				createIndex{table: "pool_leases", name: "idx_pool_leases_domain_user", columns: []string{"domain", "user_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS pool_leases`),
+		),
+	},
+	{
+		version: 12,
+		name:    "add pool session health",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_health (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					failures INTEGER NOT NULL DEFAULT 0,
+					last_reason TEXT NOT NULL DEFAULT '',
+					last_reported_at DATETIME,
+					quarantined_at DATETIME,
+					quarantined_until DATETIME,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "pool_session_health", name: "idx_pool_session_health_user_domain", unique: true, columns: []string{"user_id", "domain"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_health (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					domain TEXT NOT NULL,
+					failures INTEGER NOT NULL DEFAULT 0,
+					last_reason VARCHAR(16) NOT NULL DEFAULT '',
+					last_reported_at TIMESTAMPTZ,
+					quarantined_at TIMESTAMPTZ,
+					quarantined_until TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "pool_session_health", name: "idx_pool_session_health_user_domain", unique: true, columns: []string{"user_id", "domain"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_health (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					failures INT NOT NULL DEFAULT 0,
+					last_reason VARCHAR(16) NOT NULL DEFAULT '',
+					last_reported_at DATETIME(3) NULL,
+					quarantined_at DATETIME(3) NULL,
+					quarantined_until DATETIME(3) NULL,
+					created_at DATETIME(3) NOT NULL,
+					updated_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "pool_session_health", name: "idx_pool_session_health_user_domain", unique: true, columns: []string{"user_id", "domain"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS pool_session_health`),
+		),
+	},
+	{
+		version: 13,
+		name:    "add session probes",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS session_probes (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL DEFAULT 0,
+					domain TEXT NOT NULL,
+					url TEXT NOT NULL,
+					expect_status INTEGER NOT NULL DEFAULT 200,
+					body_regex TEXT NOT NULL DEFAULT '',
+					login_redirect TEXT NOT NULL DEFAULT '',
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "session_probes", name: "idx_session_probes_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS probe_results (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					probe_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					outcome TEXT NOT NULL,
+					status_code INTEGER NOT NULL DEFAULT 0,
+					detail TEXT NOT NULL DEFAULT '',
+					checked_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "probe_results", name: "idx_probe_results_probe_user", unique: true, columns: []string{"probe_id", "user_id"}},
+				createIndex{table: "probe_results", name: "idx_probe_results_user_id", columns: []string{"user_id"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS session_probes (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL DEFAULT 0,
+					domain TEXT NOT NULL,
+					url TEXT NOT NULL,
+					expect_status INTEGER NOT NULL DEFAULT 200,
+					body_regex TEXT NOT NULL DEFAULT '',
+					login_redirect TEXT NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "session_probes", name: "idx_session_probes_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS probe_results (
+					id BIGSERIAL PRIMARY KEY,
+					probe_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain TEXT NOT NULL,
+					outcome VARCHAR(16) NOT NULL,
+					status_code INTEGER NOT NULL DEFAULT 0,
+					detail TEXT NOT NULL DEFAULT '',
+					checked_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "probe_results", name: "idx_probe_results_probe_user", unique: true, columns: []string{"probe_id", "user_id"}},
+				createIndex{table: "probe_results", name: "idx_probe_results_user_id", columns: []string{"user_id"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS session_probes (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL DEFAULT 0,
+					domain VARCHAR(191) NOT NULL,
+					url TEXT NOT NULL,
+					expect_status INT NOT NULL DEFAULT 200,
+					body_regex TEXT NOT NULL,
+					login_redirect TEXT NOT NULL,
+					created_at DATETIME(3) NOT NULL,
+					updated_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "session_probes", name: "idx_session_probes_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS probe_results (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					probe_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					outcome VARCHAR(16) NOT NULL,
+					status_code INT NOT NULL DEFAULT 0,
+					detail TEXT NOT NULL,
+					checked_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "probe_results", name: "idx_probe_results_probe_user", unique: true, columns: []string{"probe_id", "user_id"}},
+				createIndex{table: "probe_results", name: "idx_probe_results_user_id", columns: []string{"user_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS probe_results`),
+			execSQL(`DROP TABLE IF EXISTS session_probes`),
+		),
+	},
+	{
+		version: 14,
+		name:    "add pool usage",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_usage (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					hour DATETIME NOT NULL,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					served INTEGER NOT NULL DEFAULT 0,
+					leased INTEGER NOT NULL DEFAULT 0,
+					reported_bad INTEGER NOT NULL DEFAULT 0
+				)`),
+				createIndex{table: "pool_usage", name: "idx_pool_usage_hour_user_domain", unique: true, columns: []string{"hour", "user_id", "domain"}},
+				createIndex{table: "pool_usage", name: "idx_pool_usage_user_id", columns: []string{"user_id"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_usage (
+					id BIGSERIAL PRIMARY KEY,
+					hour TIMESTAMPTZ NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain TEXT NOT NULL,
+					served BIGINT NOT NULL DEFAULT 0,
+					leased BIGINT NOT NULL DEFAULT 0,
+					reported_bad BIGINT NOT NULL DEFAULT 0
+				)`),
+				createIndex{table: "pool_usage", name: "idx_pool_usage_hour_user_domain", unique: true, columns: []string{"hour", "user_id", "domain"}},
+				createIndex{table: "pool_usage", name: "idx_pool_usage_user_id", columns: []string{"user_id"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_usage (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					hour DATETIME(3) NOT NULL,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					served BIGINT NOT NULL DEFAULT 0,
+					leased BIGINT NOT NULL DEFAULT 0,
+					reported_bad BIGINT NOT NULL DEFAULT 0
+				)`),
+				createIndex{table: "pool_usage", name: "idx_pool_usage_hour_user_domain", unique: true, columns: []string{"hour", "user_id", "domain"}},
+				createIndex{table: "pool_usage", name: "idx_pool_usage_user_id", columns: []string{"user_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS pool_usage`),
+		),
+	},
+	{
+		version: 15,
+		name:    "add share links",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS share_links (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					token_hash TEXT NOT NULL UNIQUE,
+					token_prefix TEXT NOT NULL,
+					domain TEXT,
+					names TEXT,
+					password_hash TEXT,
+					max_uses INTEGER NOT NULL,
+					uses INTEGER NOT NULL DEFAULT 0,
+					expires_at DATETIME NOT NULL,
+					revoked_at DATETIME,
+					last_used_at DATETIME,
+					created_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "share_links", name: "idx_share_links_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS share_link_events (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					link_id INTEGER NOT NULL,
+					event TEXT NOT NULL,
+					detail TEXT,
+					cookie_count INTEGER,
+					remote_addr TEXT,
+					user_agent TEXT,
+					created_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "share_link_events", name: "idx_share_link_events_link_id", columns: []string{"link_id"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS share_links (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					token_hash TEXT NOT NULL,
+					token_prefix TEXT NOT NULL,
+					domain TEXT,
+					names TEXT,
+					password_hash TEXT,
+					max_uses INTEGER NOT NULL,
+					uses INTEGER NOT NULL DEFAULT 0,
+					expires_at TIMESTAMPTZ NOT NULL,
+					revoked_at TIMESTAMPTZ,
+					last_used_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "share_links", name: "idx_share_links_token_hash", unique: true, columns: []string{"token_hash"}},
+				createIndex{table: "share_links", name: "idx_share_links_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS share_link_events (
+					id BIGSERIAL PRIMARY KEY,
+					link_id BIGINT NOT NULL,
+					event TEXT NOT NULL,
+					detail TEXT,
+					cookie_count INTEGER,
+					remote_addr TEXT,
+					user_agent TEXT,
+					created_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "share_link_events", name: "idx_share_link_events_link_id", columns: []string{"link_id"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS share_links (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					token_hash VARCHAR(64) NOT NULL,
+					token_prefix VARCHAR(32) NOT NULL,
+					domain VARCHAR(191),
+					names TEXT,
+					password_hash VARCHAR(72),
+					max_uses INT NOT NULL,
+					uses INT NOT NULL DEFAULT 0,
+					expires_at DATETIME(3) NOT NULL,
+					revoked_at DATETIME(3) NULL,
+					last_used_at DATETIME(3) NULL,
+					created_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "share_links", name: "idx_share_links_token_hash", unique: true, columns: []string{"token_hash"}},
+				createIndex{table: "share_links", name: "idx_share_links_user_id", columns: []string{"user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS share_link_events (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					link_id BIGINT NOT NULL,
+					event VARCHAR(32) NOT NULL,
+					detail VARCHAR(191),
+					cookie_count INT,
+					remote_addr VARCHAR(191),
+					user_agent TEXT,
+					created_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "share_link_events", name: "idx_share_link_events_link_id", columns: []string{"link_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS share_link_events`),
+			execSQL(`DROP TABLE IF EXISTS share_links`),
+		),
+	},
+	{
+		version: 16,
+		name:    "add teams",
+		up: dialectSteps{
+			"sqlite": {
+				addColumn{table: "users", column: "team_id", definition: "INTEGER"},
+				createIndex{table: "users", name: "idx_users_team_id", columns: []string{"team_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS teams (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					vault_user_id INTEGER NOT NULL,
+					created_at DATETIME,
+					updated_at DATETIME
+				)`),
+				createIndex{table: "teams", name: "idx_teams_vault_user_id", unique: true, columns: []string{"vault_user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS team_members (
+					team_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					role TEXT NOT NULL,
+					created_at DATETIME,
+					updated_at DATETIME,
+					PRIMARY KEY (team_id, user_id)
+				)`),
+				createIndex{table: "team_members", name: "idx_team_members_user_id", columns: []string{"user_id"}},
+			},
+			"postgres": {
+				addColumn{table: "users", column: "team_id", definition: "BIGINT"},
+				createIndex{table: "users", name: "idx_users_team_id", columns: []string{"team_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS teams (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					vault_user_id BIGINT NOT NULL,
+					created_at TIMESTAMPTZ,
+					updated_at TIMESTAMPTZ
+				)`),
+				createIndex{table: "teams", name: "idx_teams_vault_user_id", unique: true, columns: []string{"vault_user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS team_members (
+					team_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					role TEXT NOT NULL,
+					created_at TIMESTAMPTZ,
+					updated_at TIMESTAMPTZ,
+					PRIMARY KEY (team_id, user_id)
+				)`),
+				createIndex{table: "team_members", name: "idx_team_members_user_id", columns: []string{"user_id"}},
+			},
+			"mysql": {
+				addColumn{table: "users", column: "team_id", definition: "BIGINT NULL"},
+				createIndex{table: "users", name: "idx_users_team_id", columns: []string{"team_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS teams (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(191) NOT NULL,
+					vault_user_id BIGINT NOT NULL,
+					created_at DATETIME(3) NULL,
+					updated_at DATETIME(3) NULL
+				)`),
+				createIndex{table: "teams", name: "idx_teams_vault_user_id", unique: true, columns: []string{"vault_user_id"}},
+				execSQL(`CREATE TABLE IF NOT EXISTS team_members (
+					team_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					role VARCHAR(32) NOT NULL,
+					created_at DATETIME(3) NULL,
+					updated_at DATETIME(3) NULL,
+					PRIMARY KEY (team_id, user_id)
+				)`),
+				createIndex{table: "team_members", name: "idx_team_members_user_id", columns: []string{"user_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS team_members`),
+			execSQL(`DROP TABLE IF EXISTS teams`),
+			dropIndex{table: "users", name: "idx_users_team_id"},
+			dropColumn{table: "users", column: "team_id"},
+		),
+	},
+	{
+		version: 17,
+		name:    "add pool session reports",
+		up: dialectSteps{
+			"sqlite": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_reports (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					domain TEXT NOT NULL,
+					client_id INTEGER NOT NULL,
+					reason TEXT NOT NULL DEFAULT '',
+					reported_at DATETIME NOT NULL
+				)`),
+				createIndex{table: "pool_session_reports", name: "idx_pool_session_reports_session_client", unique: true, columns: []string{"user_id", "domain", "client_id"}},
+			},
+			"postgres": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_reports (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					domain TEXT NOT NULL,
+					client_id BIGINT NOT NULL,
+					reason VARCHAR(16) NOT NULL DEFAULT '',
+					reported_at TIMESTAMPTZ NOT NULL
+				)`),
+				createIndex{table: "pool_session_reports", name: "idx_pool_session_reports_session_client", unique: true, columns: []string{"user_id", "domain", "client_id"}},
+			},
+			"mysql": {
+				execSQL(`CREATE TABLE IF NOT EXISTS pool_session_reports (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					domain VARCHAR(191) NOT NULL,
+					client_id BIGINT NOT NULL,
+					reason VARCHAR(16) NOT NULL DEFAULT '',
+					reported_at DATETIME(3) NOT NULL
+				)`),
+				createIndex{table: "pool_session_reports", name: "idx_pool_session_reports_session_client", unique: true, columns: []string{"user_id", "domain", "client_id"}},
+			},
+		},
+		down: allDialects(
+			execSQL(`DROP TABLE IF EXISTS pool_session_reports`),
+		),
+	},
+	{
+		version: 18,
+		name:    "limit share link password attempts",
+		up: dialectSteps{
+			"sqlite": {
+				addColumn{table: "share_links", column: "failed_attempts", definition: "INTEGER NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "repeats", definition: "INTEGER NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "last_at", definition: "DATETIME"},
+			},
+			"postgres": {
+				addColumn{table: "share_links", column: "failed_attempts", definition: "INTEGER NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "repeats", definition: "INTEGER NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "last_at", definition: "TIMESTAMPTZ"},
+			},
+			"mysql": {
+				addColumn{table: "share_links", column: "failed_attempts", definition: "INT NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "repeats", definition: "INT NOT NULL DEFAULT 0"},
+				addColumn{table: "share_link_events", column: "last_at", definition: "DATETIME(3) NULL"},
+			},
+		},
+		down: allDialects(
+			dropColumn{table: "share_link_events", column: "last_at"},
+			dropColumn{table: "share_link_events", column: "repeats"},
+			dropColumn{table: "share_links", column: "failed_attempts"},
+		),
+	},
+}
+
+// cookiesAuthoritativeUp moves every user's cookies_json blob into the cookies
+// table (the blob wins where they disagree, since it is what users were
+// served), indexes cookies by domain_key and drops the blob column.
+func cookiesAuthoritativeUp(domainKeyDefinition string) []step {
+	return []step{
+		addColumn{table: "cookies", column: "domain_key", definition: domainKeyDefinition},
+		goStep{name: "reconcile users.cookies_json into cookies", fn: func(tx *gorm.DB) error {
+			issues, err := reconcileLegacyBlobs(tx, true)
+			if len(issues) > 0 {
+				log.Warn().Int("users", len(issues)).Msg("v6: cookies table diverged from cookies_json; the JSON blob was kept")
+			}
+			return err
+		}},
+		goStep{name: "backfill cookies.domain_key", fn: func(tx *gorm.DB) error {
+			_, err := fixDomainKeys(tx, true)
+			return err
+		}},
+		createIndex{table: "cookies", name: "idx_cookies_domain_key", columns: []string{"domain_key"}},
+		createIndex{table: "cookies", name: "idx_cookies_user_domain_key", columns: []string{"user_id", "domain_key"}},
+		dropColumn{table: "users", column: "cookies_json"},
+	}
+}
+
+func cookiesAuthoritativeDown(blobDefinition string) []step {
+	return []step{
+		addColumn{table: "users", column: "cookies_json", definition: blobDefinition},
+		goStep{name: "rebuild users.cookies_json from cookies", fn: rebuildLegacyBlobs},
+		dropIndex{table: "cookies", name: "idx_cookies_user_domain_key"},
+		dropIndex{table: "cookies", name: "idx_cookies_domain_key"},
+		dropColumn{table: "cookies", column: "domain_key"},
+	}
+}
@@ -0,0 +1,108 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Session probe methods
+
+func (s *GormStore) CreateSessionProbe(ctx context.Context, probe *model.SessionProbe) error {
+	if err := s.db.WithContext(ctx).Create(probe).Error; err != nil {
+		return fmt.Errorf("could not create session probe: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *GormStore) ListSessionProbes(ctx context.Context) ([]*model.SessionProbe, error) {
+	probes := make([]*model.SessionProbe, 0)
+	if err := s.db.WithContext(ctx).Order("id").Find(&probes).Error; err != nil {
+		return nil, fmt.Errorf("could not list session probes: %w", classify(err))
+	}
+	return probes, nil
+}
+
+func (s *GormStore) GetSessionProbe(ctx context.Context, probeID int64) (*model.SessionProbe, error) {
+	var probe model.SessionProbe
+	if err := s.db.WithContext(ctx).First(&probe, probeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("session probe %w", store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get session probe %d: %w", probeID, classify(err))
+	}
+	return &probe, nil
+}
+
+func (s *GormStore) DeleteSessionProbe(ctx context.Context, probeID int64) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.SessionProbe{}, probeID)
+		if result.Error != nil {
+			return fmt.Errorf("could not delete session probe %d: %w", probeID, classify(result.Error))
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("session probe %w", store.ErrNotFound)
+		}
+		if err := tx.Where("probe_id = ?", probeID).Delete(&model.ProbeResult{}).Error; err != nil {
+			return fmt.Errorf("could not delete results of session probe %d: %w", probeID, classify(err))
+		}
+		return nil
+	})
+	return classify(err)
+}
+
+func (s *GormStore) RecordProbeResult(ctx context.Context, result *model.ProbeResult) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var probes int64
+		if err := tx.Model(&model.SessionProbe{}).Where("id = ?", result.ProbeID).Count(&probes).Error; err != nil {
+			return fmt.Errorf("could not query session probe %d: %w", result.ProbeID, classify(err))
+		}
+		if probes == 0 {
+			return fmt.Errorf("session probe %w", store.ErrNotFound)
+		}
+		upsert := clause.OnConflict{
+			Columns:   []clause.Column{{Name: "probe_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"domain", "outcome", "status_code", "detail", "checked_at"}),
+		}
+		if err := tx.Clauses(upsert).Create(result).Error; err != nil {
+			return fmt.Errorf("could not record probe result: %w", classify(err))
+		}
+		return nil
+	})
+	return classify(err)
+}
+
+func (s *GormStore) ListProbeResults(ctx context.Context, userID int64) ([]*model.ProbeResult, error) {
+	results := make([]*model.ProbeResult, 0)
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("domain, probe_id").Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("could not list probe results for user %d: %w", userID, classify(err))
+	}
+	return results, nil
+}
+
+// preferWorking drops the cookies of sessions a probe found expired while
+// other sessions are left.
+func (s *GormStore) preferWorking(ctx context.Context, cookies []*model.Cookie) ([]*model.Cookie, error) {
+	if len(cookies) == 0 {
+		return cookies, nil
+	}
+	seen := make(map[int64]bool)
+	var userIDs []int64
+	for _, c := range cookies {
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			userIDs = append(userIDs, c.UserID)
+		}
+	}
+	var expired []*model.ProbeResult
+	if err := s.db.WithContext(ctx).Where("user_id IN ? AND outcome = ?", userIDs, model.ProbeExpired).Find(&expired).Error; err != nil {
+		return nil, fmt.Errorf("could not query probe results: %w", classify(err))
+	}
+	return poolhealth.PreferWorking(cookies, expired), nil
+}
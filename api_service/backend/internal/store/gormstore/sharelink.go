@@ -0,0 +1,156 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (s *GormStore) CreateShareLink(ctx context.Context, link *model.ShareLink) error {
+	if err := s.db.WithContext(ctx).Create(link).Error; err != nil {
+		return fmt.Errorf("could not create share link: %w", classify(err))
+	}
+	return nil
+}
+
+func (s *GormStore) ListShareLinks(ctx context.Context, userID int64) ([]*model.ShareLink, error) {
+	var links []*model.ShareLink
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("could not list share links: %w", classify(err))
+	}
+	return links, nil
+}
+
+func (s *GormStore) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*model.ShareLink, error) {
+	var link model.ShareLink
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get share link by token: %w", classify(err))
+	}
+	return &link, nil
+}
+
+// RevokeShareLink revokes the user's link. Revoking it again is a no-op.
+func (s *GormStore) RevokeShareLink(ctx context.Context, userID, linkID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var link model.ShareLink
+		if err := tx.Select("id", "revoked_at").Where("user_id = ?", userID).First(&link, linkID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("share link %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get share link: %w", classify(err))
+		}
+		if link.RevokedAt != nil {
+			return nil
+		}
+		if err := tx.Model(&link).Update("revoked_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("could not revoke share link: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+// UseShareLink counts a redemption with a conditional increment, which the
+// database serializes, so two replicas cannot both take the last use.
+func (s *GormStore) UseShareLink(ctx context.Context, linkID int64, now time.Time) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.ShareLink{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", linkID, now).
+			UpdateColumns(map[string]any{
+				"uses":         gorm.Expr("uses + 1"),
+				"last_used_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("could not use share link: %w", classify(result.Error))
+		}
+		if err := tx.First(&link, linkID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("share link %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get share link: %w", classify(err))
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("share link is no longer usable: %w", store.ErrConflict)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// FailShareLinkPassword counts the attempt with an atomic increment, so
+// guesses spread over replicas are all counted.
+func (s *GormStore) FailShareLinkPassword(ctx context.Context, linkID int64) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.ShareLink{}).Where("id = ?", linkID).
+			UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1")).Error; err != nil {
+			return fmt.Errorf("could not count failed share link attempt: %w", classify(err))
+		}
+		if err := tx.First(&link, linkID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("share link %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get share link: %w", classify(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (s *GormStore) AddShareLinkEvent(ctx context.Context, event *model.ShareLinkEvent) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if event.Event == model.ShareLinkDenied {
+			var latest model.ShareLinkEvent
+			err := tx.Where("link_id = ?", event.LinkID).Order("id DESC").Limit(1).Find(&latest).Error
+			if err != nil {
+				return fmt.Errorf("could not get latest share link event: %w", classify(err))
+			}
+			if latest.ID != 0 && latest.Event == event.Event && latest.Detail == event.Detail {
+				at := event.CreatedAt
+				if at.IsZero() {
+					at = time.Now()
+				}
+				if err := tx.Model(&latest).UpdateColumns(map[string]any{"repeats": gorm.Expr("repeats + 1"), "last_at": at}).Error; err != nil {
+					return fmt.Errorf("could not record repeated share link event: %w", classify(err))
+				}
+				*event = latest
+				event.Repeats++
+				event.LastAt = &at
+				return nil
+			}
+		}
+		if err := tx.Create(event).Error; err != nil {
+			return fmt.Errorf("could not record share link event: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) ListShareLinkEvents(ctx context.Context, userID, linkID int64) ([]*model.ShareLinkEvent, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.ShareLink{}).Where("id = ? AND user_id = ?", linkID, userID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("could not get share link: %w", classify(err))
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+	}
+	var events []*model.ShareLinkEvent
+	if err := s.db.WithContext(ctx).Where("link_id = ?", linkID).Order("id").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("could not list share link events: %w", classify(err))
+	}
+	return events, nil
+}
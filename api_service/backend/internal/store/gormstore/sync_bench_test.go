@@ -0,0 +1,158 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/config"
+	"cookie-syncer/api/internal/model"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// BenchmarkSyncCookies compares the original one-INSERT-per-cookie sync with
+// the batched path. SQLite always runs; Postgres and MySQL run when
+// BENCH_POSTGRES_DSN or BENCH_MYSQL_DSN point at a scratch database, e.g.
+//
+//	BENCH_POSTGRES_DSN="host=localhost user=user password=pass dbname=bench sslmode=disable" \
+//		go test -run '^$' -bench SyncCookies ./internal/store/gormstore
+func BenchmarkSyncCookies(b *testing.B) {
+	dialects := []struct {
+		name, dsnEnv string
+	}{
+		{"sqlite", ""},
+		{"postgres", "BENCH_POSTGRES_DSN"},
+		{"mysql", "BENCH_MYSQL_DSN"},
+	}
+	paths := []struct {
+		name string
+		sync func(s *GormStore, ctx context.Context, userID int64, cookies []*model.Cookie) error
+	}{
+		{"per-row", (*GormStore).syncCookiesPerRow},
+		{"batched", (*GormStore).SyncCookies},
+	}
+
+	for _, d := range dialects {
+		b.Run(d.name, func(b *testing.B) {
+			s := openBenchStore(b, d.name, d.dsnEnv)
+			for _, n := range []int{100, 2000} {
+				cookies := benchCookies(n)
+				for _, p := range paths {
+					b.Run(fmt.Sprintf("%s/%d", p.name, n), func(b *testing.B) {
+						ctx := context.Background()
+						users, err := s.CreateUsers(ctx, []string{"bench"})
+						if err != nil {
+							b.Fatal(err)
+						}
+						userID := users[0].ID
+
+						b.ResetTimer()
+						for i := 0; i < b.N; i++ {
+							if err := p.sync(s, ctx, userID, cookies); err != nil {
+								b.Fatal(err)
+							}
+						}
+						b.StopTimer()
+
+						var stored int64
+						if err := s.db.Model(&model.Cookie{}).Where("user_id = ?", userID).Count(&stored).Error; err != nil {
+							b.Fatal(err)
+						}
+						if stored != int64(n) {
+							b.Fatalf("stored %d cookies, want %d", stored, n)
+						}
+					})
+				}
+			}
+		})
+	}
+}
+
+// syncCookiesPerRow is SyncCookies as it was before batching: one INSERT
+// per cookie. It is kept here as the benchmark baseline only.
+func (s *GormStore) syncCookiesPerRow(ctx context.Context, userID int64, cookies []*model.Cookie) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// 1. Update user's last_synced_at timestamp
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"last_synced_at": &now,
+			"updated_at":     &now,
+		}).Error; err != nil {
+			return fmt.Errorf("could not update last_synced_at for user %d: %w", userID, err)
+		}
+
+		// 2. Delete all existing cookies for the user
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Cookie{}).Error; err != nil {
+			return fmt.Errorf("could not delete old cookies for user %d: %w", userID, err)
+		}
+
+		// 3. Insert new cookies
+		for _, c := range cookies {
+			newCookie := &model.Cookie{
+				// ID is omitted to let the database generate it
+				UserID:                     userID,
+				Domain:                     c.Domain,
+				DomainKey:                  domainKey(c.Domain),
+				Name:                       c.Name,
+				Value:                      c.Value,
+				Path:                       c.Path,
+				Expires:                    c.Expires,
+				HTTPOnly:                   c.HTTPOnly,
+				Secure:                     c.Secure,
+				SameSite:                   c.SameSite,
+				IsSharable:                 c.IsSharable,
+				LastUpdatedFromExtensionAt: now,
+			}
+			if err := tx.Create(newCookie).Error; err != nil {
+				return fmt.Errorf("could not insert cookie %s/%s: %w", newCookie.Domain, newCookie.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func openBenchStore(b *testing.B, dialect, dsnEnv string) *GormStore {
+	b.Helper()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	dsn := filepath.Join(b.TempDir(), "bench.db")
+	if dsnEnv != "" {
+		dsn = os.Getenv(dsnEnv)
+		if dsn == "" {
+			b.Skipf("set %s to benchmark %s", dsnEnv, dialect)
+		}
+	}
+
+	s, err := Open(&config.Config{DBType: dialect, DSN: dsn, DBMaxOpenConnections: 4, DBMaxIdleConnections: 4})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { s.Close() })
+	if _, err := s.MigrateUp(false); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+func benchCookies(n int) []*model.Cookie {
+	expires := time.Now().Add(24 * time.Hour)
+	cookies := make([]*model.Cookie, n)
+	for i := range cookies {
+		cookies[i] = &model.Cookie{
+			Domain:   fmt.Sprintf(".site%d.example.com", i%50),
+			Name:     fmt.Sprintf("cookie_%d", i),
+			Value:    fmt.Sprintf("value-%d-0123456789abcdef0123456789abcdef", i),
+			Path:     "/",
+			Expires:  &expires,
+			HTTPOnly: i%2 == 0,
+			Secure:   true,
+			SameSite: "Lax",
+		}
+	}
+	return cookies
+}
@@ -0,0 +1,203 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTeam creates the team's vault user, the team and its owner in one
+// transaction.
+func (s *GormStore) CreateTeam(ctx context.Context, team *model.Team, ownerID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := activePerson(tx, ownerID); err != nil {
+			return err
+		}
+		vault := model.User{
+			APIKey: s.generateSafeAPIKey(),
+			Remark: stringPtr("team vault: " + team.Name),
+		}
+		if err := tx.Create(&vault).Error; err != nil {
+			return fmt.Errorf("could not create team vault: %w", classify(err))
+		}
+		team.VaultUserID = vault.ID
+		if err := tx.Create(team).Error; err != nil {
+			return fmt.Errorf("could not create team: %w", classify(err))
+		}
+		if err := tx.Model(&vault).Update("team_id", team.ID).Error; err != nil {
+			return fmt.Errorf("could not link team vault: %w", classify(err))
+		}
+		owner := model.TeamMember{TeamID: team.ID, UserID: ownerID, Role: model.TeamOwner}
+		if err := tx.Create(&owner).Error; err != nil {
+			return fmt.Errorf("could not add team owner: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) GetTeam(ctx context.Context, teamID int64) (*model.Team, error) {
+	var team model.Team
+	if err := s.db.WithContext(ctx).First(&team, teamID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("team %w", store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get team: %w", classify(err))
+	}
+	return &team, nil
+}
+
+// DeleteTeam deletes the team, its members and its vault's cookies, and
+// suspends the vault user so that its ID is never reused.
+func (s *GormStore) DeleteTeam(ctx context.Context, teamID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var team model.Team
+		if err := tx.First(&team, teamID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("team %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get team: %w", classify(err))
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&model.TeamMember{}).Error; err != nil {
+			return fmt.Errorf("could not delete team members: %w", classify(err))
+		}
+		if err := tx.Where("user_id = ?", team.VaultUserID).Delete(&model.Cookie{}).Error; err != nil {
+			return fmt.Errorf("could not delete team cookies: %w", classify(err))
+		}
+		if err := tx.Delete(&model.User{}, team.VaultUserID).Error; err != nil {
+			return fmt.Errorf("could not suspend team vault: %w", classify(err))
+		}
+		if err := tx.Delete(&team).Error; err != nil {
+			return fmt.Errorf("could not delete team: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) ListUserTeams(ctx context.Context, userID int64) ([]*model.TeamMember, error) {
+	var members []*model.TeamMember
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("team_id").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("could not list teams: %w", classify(err))
+	}
+	return members, nil
+}
+
+func (s *GormStore) ListTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error) {
+	var members []*model.TeamMember
+	if err := s.db.WithContext(ctx).Where("team_id = ?", teamID).Order("user_id").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("could not list team members: %w", classify(err))
+	}
+	return members, nil
+}
+
+func (s *GormStore) GetTeamMember(ctx context.Context, teamID, userID int64) (*model.TeamMember, error) {
+	var member model.TeamMember
+	if err := s.db.WithContext(ctx).Where("team_id = ? AND user_id = ?", teamID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("team member %w", store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get team member: %w", classify(err))
+	}
+	return &member, nil
+}
+
+func (s *GormStore) SetTeamMember(ctx context.Context, member *model.TeamMember) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, member.TeamID); err != nil {
+			return err
+		}
+		if err := activePerson(tx, member.UserID); err != nil {
+			return err
+		}
+		var existing model.TeamMember
+		err := tx.Where("team_id = ? AND user_id = ?", member.TeamID, member.UserID).First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(member).Error; err != nil {
+				return fmt.Errorf("could not add team member: %w", classify(err))
+			}
+			return nil
+		case err != nil:
+			return fmt.Errorf("could not get team member: %w", classify(err))
+		}
+		if existing.Role == model.TeamOwner && member.Role != model.TeamOwner {
+			if err := keepAnOwner(tx, member.TeamID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&existing).Update("role", member.Role).Error; err != nil {
+			return fmt.Errorf("could not change team member role: %w", classify(err))
+		}
+		existing.Role = member.Role
+		*member = existing
+		return nil
+	})
+}
+
+func (s *GormStore) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, teamID); err != nil {
+			return err
+		}
+		var existing model.TeamMember
+		if err := tx.Where("team_id = ? AND user_id = ?", teamID, userID).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("team member %w", store.ErrNotFound)
+			}
+			return fmt.Errorf("could not get team member: %w", classify(err))
+		}
+		if existing.Role == model.TeamOwner {
+			if err := keepAnOwner(tx, teamID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&model.TeamMember{}).Error; err != nil {
+			return fmt.Errorf("could not remove team member: %w", classify(err))
+		}
+		return nil
+	})
+}
+
+// lockTeam touches the team's row, which holds a row lock until the
+// transaction ends, so that concurrent membership changes of one team cannot
+// both remove its last owner.
+func lockTeam(tx *gorm.DB, teamID int64) error {
+	result := tx.Model(&model.Team{}).Where("id = ?", teamID).Update("updated_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("could not lock team: %w", classify(result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("team %w", store.ErrNotFound)
+	}
+	return nil
+}
+
+// keepAnOwner fails with ErrConflict unless the team has another owner
+// besides the one about to be demoted or removed.
+func keepAnOwner(tx *gorm.DB, teamID int64) error {
+	var owners int64
+	if err := tx.Model(&model.TeamMember{}).Where("team_id = ? AND role = ?", teamID, model.TeamOwner).Count(&owners).Error; err != nil {
+		return fmt.Errorf("could not count team owners: %w", classify(err))
+	}
+	if owners <= 1 {
+		return fmt.Errorf("a team needs an owner: %w", store.ErrConflict)
+	}
+	return nil
+}
+
+// activePerson fails with ErrNotFound unless userID is an active user that
+// is not a team vault.
+func activePerson(tx *gorm.DB, userID int64) error {
+	var count int64
+	if err := tx.Model(&model.User{}).Where("id = ? AND team_id IS NULL", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("could not get user: %w", classify(err))
+	}
+	if count == 0 {
+		return fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package gormstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AddPoolUsage increments existing rows in place and inserts missing ones.
+// An insert that loses a race against another replica's insert of the same
+// row runs in a savepoint, so the increment can be retried in the same
+// transaction.
+func (s *GormStore) AddPoolUsage(ctx context.Context, usage []*model.PoolUsage) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, u := range usage {
+			if u.Served == 0 && u.Leased == 0 && u.ReportedBad == 0 {
+				continue
+			}
+			row := *u
+			row.ID = 0
+			row.Hour = u.Hour.UTC().Truncate(time.Hour)
+			increment := func() (bool, error) {
+				result := tx.Model(&model.PoolUsage{}).
+					Where("hour = ? AND user_id = ? AND domain = ?", row.Hour, row.UserID, row.Domain).
+					UpdateColumns(map[string]any{
+						"served":       gorm.Expr("served + ?", row.Served),
+						"leased":       gorm.Expr("leased + ?", row.Leased),
+						"reported_bad": gorm.Expr("reported_bad + ?", row.ReportedBad),
+					})
+				return result.RowsAffected > 0, result.Error
+			}
+
+			done, err := increment()
+			if err != nil {
+				return fmt.Errorf("could not count pool usage: %w", classify(err))
+			}
+			if done {
+				continue
+			}
+			err = tx.Transaction(func(sp *gorm.DB) error { return sp.Create(&row).Error })
+			if err = classify(err); errors.Is(err, store.ErrConflict) {
+				_, err = increment()
+			}
+			if err != nil {
+				return fmt.Errorf("could not count pool usage: %w", classify(err))
+			}
+		}
+		return nil
+	})
+	return classify(err)
+}
+
+func (s *GormStore) ListPoolUsage(ctx context.Context, userID int64, domain string, since time.Time) ([]*model.PoolUsage, error) {
+	query := s.db.WithContext(ctx).Where("hour >= ?", since.UTC().Truncate(time.Hour))
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if domain != "" {
+		query = query.Where("domain = ?", domain)
+	}
+	usage := make([]*model.PoolUsage, 0)
+	if err := query.Order("hour, domain, user_id").Find(&usage).Error; err != nil {
+		return nil, fmt.Errorf("could not list pool usage: %w", classify(err))
+	}
+	return usage, nil
+}
+
+func (s *GormStore) PrunePoolUsage(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("hour < ?", before.UTC().Truncate(time.Hour)).Delete(&model.PoolUsage{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not prune pool usage: %w", classify(result.Error))
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,1428 @@
+// Package memstore implements store.Store in memory. It is meant for tests
+// and single-binary demos: nothing is persisted and all data is lost when the
+// process exits.
+package memstore
+
+import (
+	"context"
+	"cookie-syncer/api/internal/domainrule"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store is an in-memory store.Store. It mirrors the behaviour of the GORM
+// store, including soft-deleted (suspended) users. The zero value is not
+// usable; create one with New.
+type Store struct {
+	adminKey string
+	poolKey  string
+
+	mu           sync.RWMutex
+	users        map[int64]*model.User
+	cookies      map[int64][]*model.Cookie // by user ID, in insertion order
+	nextUserID   int64
+	nextCookieID int64
+
+	poolClients      map[int64]*model.PoolClient
+	nextPoolClientID int64
+	leases           []*model.PoolLease // in ID order
+
+	health       map[sessionKey]*model.PoolSessionHealth
+	nextHealthID int64
+	reports      map[sessionKey]map[int64]time.Time // latest report time by client ID
+
+	probes            map[int64]*model.SessionProbe
+	nextProbeID       int64
+	probeResults      map[probeResultKey]*model.ProbeResult
+	nextProbeResultID int64
+
+	usage       map[usageKey]*model.PoolUsage
+	nextUsageID int64
+
+	shareLinks       map[int64]*model.ShareLink
+	nextShareLinkID  int64
+	shareLinkEvents  []*model.ShareLinkEvent // in ID order
+	nextShareEventID int64
+
+	teams       map[int64]*model.Team
+	nextTeamID  int64
+	teamMembers map[teamMemberKey]*model.TeamMember
+}
+
+// teamMemberKey identifies a user's membership of a team.
+type teamMemberKey struct {
+	teamID int64
+	userID int64
+}
+
+// usageKey identifies the pool usage row of a user's session for a domain in
+// one hour.
+type usageKey struct {
+	hour   int64 // Unix time
+	userID int64
+	domain string
+}
+
+// probeResultKey identifies the result of a probe for a user's session.
+type probeResultKey struct {
+	probeID int64
+	userID  int64
+}
+
+// sessionKey identifies a contributor's pool session for a domain.
+type sessionKey struct {
+	userID int64
+	domain string
+}
+
+// New returns an empty store. The admin and pool keys are never handed out as
+// user API keys.
+func New(adminKey, poolKey string) *Store {
+	return &Store{
+		adminKey:     adminKey,
+		poolKey:      poolKey,
+		users:        make(map[int64]*model.User),
+		cookies:      make(map[int64][]*model.Cookie),
+		nextUserID:   1,
+		nextCookieID: 1,
+
+		poolClients:      make(map[int64]*model.PoolClient),
+		nextPoolClientID: 1,
+
+		health:       make(map[sessionKey]*model.PoolSessionHealth),
+		nextHealthID: 1,
+		reports:      make(map[sessionKey]map[int64]time.Time),
+
+		probes:            make(map[int64]*model.SessionProbe),
+		nextProbeID:       1,
+		probeResults:      make(map[probeResultKey]*model.ProbeResult),
+		nextProbeResultID: 1,
+
+		usage:       make(map[usageKey]*model.PoolUsage),
+		nextUsageID: 1,
+
+		shareLinks:       make(map[int64]*model.ShareLink),
+		nextShareLinkID:  1,
+		nextShareEventID: 1,
+
+		teams:       make(map[int64]*model.Team),
+		nextTeamID:  1,
+		teamMembers: make(map[teamMemberKey]*model.TeamMember),
+	}
+}
+
+// EnsureDefaultUser creates a user with the given remark if the store has no
+// users yet. It returns the created user, or nil if users already exist.
+func (s *Store) EnsureDefaultUser(remark string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.users) > 0 {
+		return nil, nil
+	}
+	return copyUser(s.createUserLocked(remark)), nil
+}
+
+// --- Helper Functions ---
+
+// checkContext reports a cancelled context the way the GORM store does.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrUnavailable, err)
+	}
+	return nil
+}
+
+func copyUser(u *model.User) *model.User {
+	c := *u
+	return &c
+}
+
+func copyCookies(cookies []*model.Cookie) []*model.Cookie {
+	copied := make([]*model.Cookie, len(cookies))
+	for i, c := range cookies {
+		cc := *c
+		copied[i] = &cc
+	}
+	return copied
+}
+
+// activeUserLocked returns the user with the given ID unless it does not exist
+// or is suspended.
+func (s *Store) activeUserLocked(userID int64) (*model.User, error) {
+	u, ok := s.users[userID]
+	if !ok || u.DeletedAt.Valid {
+		return nil, fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return u, nil
+}
+
+func (s *Store) activeUserByAPIKeyLocked(apiKey string) (*model.User, error) {
+	for _, u := range s.users {
+		if u.APIKey == apiKey && !u.DeletedAt.Valid && u.TeamID == nil {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("user %w", store.ErrNotFound)
+}
+
+func (s *Store) createUserLocked(remark string) *model.User {
+	now := time.Now()
+	remarkCopy := remark
+	u := &model.User{
+		ID:        s.nextUserID,
+		APIKey:    s.generateSafeAPIKeyLocked(),
+		Remark:    &remarkCopy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.nextUserID++
+	s.users[u.ID] = u
+	return u
+}
+
+func (s *Store) generateSafeAPIKeyLocked() string {
+	for {
+		apiKey := uuid.New().String()
+		if apiKey == s.adminKey || apiKey == s.poolKey {
+			continue
+		}
+		taken := false
+		for _, u := range s.users {
+			if u.APIKey == apiKey {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return apiKey
+		}
+	}
+}
+
+// normalizeDomain lower-cases a cookie domain and strips its leading dot.
+func normalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// domainMatches reports whether a cookie set for cookieDomain belongs to
+// domain or one of its subdomains, matching the GORM store's domain_key
+// lookup.
+func domainMatches(cookieDomain, domain string) bool {
+	c, d := normalizeDomain(cookieDomain), normalizeDomain(domain)
+	return c == d || strings.HasSuffix(c, "."+d)
+}
+
+// --- Store Interface Implementation ---
+
+// User methods
+func (s *Store) GetUserByAPIKey(ctx context.Context, apiKey string) (*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, err := s.activeUserByAPIKeyLocked(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return copyUser(u), nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	return copyUser(u), nil
+}
+
+func (s *Store) UpdateUserSharing(ctx context.Context, userID int64, enabled bool) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	u.SharingEnabled = enabled
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *Store) GetUserSettings(ctx context.Context, userID int64) (*model.User, error) {
+	return s.GetUserByID(ctx, userID)
+}
+
+// Admin methods
+func (s *Store) CreateUsers(ctx context.Context, remarks []string) ([]*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var createdUsers []*model.User
+	for _, remark := range remarks {
+		createdUsers = append(createdUsers, copyUser(s.createUserLocked(remark)))
+	}
+	return createdUsers, nil
+}
+
+func (s *Store) UpdateUserRemark(ctx context.Context, userID int64, remark *string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	setRemark(u, remark)
+	return nil
+}
+
+func (s *Store) UpdateUserRemarkByAPIKey(ctx context.Context, apiKey string, remark *string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserByAPIKeyLocked(apiKey)
+	if err != nil {
+		return err
+	}
+	setRemark(u, remark)
+	return nil
+}
+
+func setRemark(u *model.User, remark *string) {
+	if remark != nil {
+		r := *remark
+		remark = &r
+	}
+	u.Remark = remark
+	u.UpdatedAt = time.Now()
+}
+
+func (s *Store) AdminUpdateUserAPIKey(ctx context.Context, userID int64) (*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	u.APIKey = s.generateSafeAPIKeyLocked()
+	u.UpdatedAt = time.Now()
+	return copyUser(u), nil
+}
+
+func (s *Store) AdminUpdateUserAPIKeyByAPIKey(ctx context.Context, apiKey string) (*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserByAPIKeyLocked(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	u.APIKey = s.generateSafeAPIKeyLocked()
+	u.UpdatedAt = time.Now()
+	return copyUser(u), nil
+}
+
+// ListUsers returns every user, including suspended ones, ordered by ID.
+func (s *Store) ListUsers(ctx context.Context) ([]*model.User, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]*model.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, copyUser(u))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// SuspendUser soft-deletes a user so their API key stops authenticating.
+func (s *Store) SuspendUser(ctx context.Context, userID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	u.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+// UpdateUserQuota replaces the user's quota overrides; nil limits are cleared.
+func (s *Store) UpdateUserQuota(ctx context.Context, userID int64, quota model.Quota) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	copyLimit := func(limit *int64) *int64 {
+		if limit == nil {
+			return nil
+		}
+		l := *limit
+		return &l
+	}
+	u.Quota = model.Quota{
+		MaxCookies: copyLimit(quota.MaxCookies),
+		MaxBytes:   copyLimit(quota.MaxBytes),
+		MaxDomains: copyLimit(quota.MaxDomains),
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateUserDomainRules replaces the user's domain rules.
+func (s *Store) UpdateUserDomainRules(ctx context.Context, userID int64, rules model.DomainRules) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	// Stored rules are never modified in place, so copies of the user can
+	// share them.
+	u.DomainRules = model.DomainRules{
+		Mode:  rules.Mode,
+		Allow: slices.Clone(rules.Allow),
+		Deny:  slices.Clone(rules.Deny),
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateUserSharingRules replaces the user's sharing rules.
+func (s *Store) UpdateUserSharingRules(ctx context.Context, userID int64, rules model.SharingRules) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+	u.SharingRules = model.SharingRules{
+		Allow: slices.Clone(rules.Allow),
+		Deny:  slices.Clone(rules.Deny),
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// Cookie methods
+
+// SyncCookies replaces all of the user's cookies. Of several cookies sharing a
+// (domain, name, path) key only the last one is kept.
+func (s *Store) SyncCookies(ctx context.Context, userID int64, cookies []*model.Cookie) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return err
+	}
+
+	type identity struct{ domain, name, path string }
+	last := make(map[identity]int, len(cookies))
+	for i, c := range cookies {
+		last[identity{c.Domain, c.Name, c.Path}] = i
+	}
+
+	now := time.Now()
+	stored := make([]*model.Cookie, 0, len(last))
+	for i, c := range cookies {
+		if last[identity{c.Domain, c.Name, c.Path}] != i {
+			continue
+		}
+		stored = append(stored, &model.Cookie{
+			ID:                         s.nextCookieID,
+			UserID:                     userID,
+			Domain:                     c.Domain,
+			Name:                       c.Name,
+			Value:                      c.Value,
+			Path:                       c.Path,
+			Expires:                    c.Expires,
+			HTTPOnly:                   c.HTTPOnly,
+			Secure:                     c.Secure,
+			SameSite:                   c.SameSite,
+			IsSharable:                 c.IsSharable,
+			LastUpdatedFromExtensionAt: now,
+		})
+		s.nextCookieID++
+	}
+	// Reinstate the pool sessions whose cookies this sync changes.
+	for key, h := range s.health {
+		if key.userID == userID && poolhealth.Changed(h.Domain, s.cookies[userID], stored) {
+			delete(s.health, key)
+			delete(s.reports, key)
+		}
+	}
+	for key, r := range s.probeResults {
+		if key.userID == userID && poolhealth.Changed(r.Domain, s.cookies[userID], stored) {
+			delete(s.probeResults, key)
+		}
+	}
+	s.cookies[userID] = stored
+	u.LastSyncedAt = &now
+	u.UpdatedAt = now
+	return nil
+}
+
+func (s *Store) GetSharableCookiesByDomain(ctx context.Context, domain string) ([]*model.Cookie, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	var cookies []*model.Cookie
+	for userID, userCookies := range s.cookies {
+		u, ok := s.users[userID]
+		if !ok || !u.SharingEnabled || u.DeletedAt.Valid {
+			continue
+		}
+		filter, err := domainrule.NewSharingFilter(u.SharingRules)
+		if err != nil {
+			continue // share nothing rather than more than the user asked for
+		}
+		for _, c := range userCookies {
+			if c.IsSharable && domainMatches(c.Domain, domain) && filter.Allows(c.Domain) && !s.quarantinedLocked(c, now) {
+				cookies = append(cookies, c)
+			}
+		}
+	}
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i].ID < cookies[j].ID })
+	results := make([]*model.ProbeResult, 0, len(s.probeResults))
+	for _, r := range s.probeResults {
+		results = append(results, r)
+	}
+	return copyCookies(poolhealth.PreferWorking(cookies, results)), nil
+}
+
+func (s *Store) ListPoolSessions(ctx context.Context) ([]*model.PoolSession, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	type session struct {
+		userID int64
+		domain string
+	}
+	seen := make(map[session]bool)
+	var cookies []*model.Cookie
+	for userID, userCookies := range s.cookies {
+		u, ok := s.users[userID]
+		if !ok || !u.SharingEnabled || u.DeletedAt.Valid {
+			continue
+		}
+		filter, err := domainrule.NewSharingFilter(u.SharingRules)
+		if err != nil {
+			continue // share nothing rather than more than the user asked for
+		}
+		for _, c := range userCookies {
+			domain := poolhealth.NormalizeDomain(c.Domain)
+			key := session{userID, domain}
+			if seen[key] || !c.IsSharable || !filter.Allows(c.Domain) || s.quarantinedLocked(c, now) {
+				continue
+			}
+			seen[key] = true
+			cookies = append(cookies, &model.Cookie{UserID: userID, Domain: domain})
+		}
+	}
+	results := make([]*model.ProbeResult, 0, len(s.probeResults))
+	for _, r := range s.probeResults {
+		results = append(results, r)
+	}
+
+	sessions := make([]*model.PoolSession, 0, len(cookies))
+	for _, c := range poolhealth.SkipExpired(cookies, results) {
+		var synced *time.Time
+		if t := s.users[c.UserID].LastSyncedAt; t != nil {
+			synced = new(time.Time)
+			*synced = *t
+		}
+		sessions = append(sessions, &model.PoolSession{UserID: c.UserID, Domain: c.Domain, LastSyncedAt: synced})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Domain != sessions[j].Domain {
+			return sessions[i].Domain < sessions[j].Domain
+		}
+		return sessions[i].UserID < sessions[j].UserID
+	})
+	return sessions, nil
+}
+
+// quarantinedLocked reports whether c belongs to a quarantined session.
+func (s *Store) quarantinedLocked(c *model.Cookie, now time.Time) bool {
+	for key, h := range s.health {
+		if key.userID == c.UserID && poolhealth.Quarantined(h, now) && poolhealth.Covers(h.Domain, c.Domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetCookiesByUserID(ctx context.Context, userID int64) ([]*model.Cookie, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyCookies(s.cookies[userID]), nil
+}
+
+func (s *Store) GetCookiesByDomain(ctx context.Context, userID int64, domain string) ([]*model.Cookie, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cookies := make([]*model.Cookie, 0)
+	for _, c := range s.cookies[userID] {
+		if domainMatches(c.Domain, domain) {
+			cookies = append(cookies, c)
+		}
+	}
+	return copyCookies(cookies), nil
+}
+
+var _ store.Store = (*Store)(nil)
+
+// Pool client methods
+
+func copyPoolClient(c *model.PoolClient) *model.PoolClient {
+	cc := *c
+	return &cc
+}
+
+func (s *Store) CreatePoolClient(ctx context.Context, client *model.PoolClient) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.poolClients {
+		if c.KeyHash == client.KeyHash {
+			return fmt.Errorf("pool client key %w", store.ErrConflict)
+		}
+	}
+	now := time.Now()
+	client.ID = s.nextPoolClientID
+	client.AllowedDomains = slices.Clone(client.AllowedDomains)
+	client.CreatedAt, client.UpdatedAt = now, now
+	s.nextPoolClientID++
+	s.poolClients[client.ID] = copyPoolClient(client)
+	return nil
+}
+
+func (s *Store) ListPoolClients(ctx context.Context) ([]*model.PoolClient, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]*model.PoolClient, 0, len(s.poolClients))
+	for _, c := range s.poolClients {
+		clients = append(clients, copyPoolClient(c))
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func (s *Store) GetPoolClientByKeyHash(ctx context.Context, keyHash string) (*model.PoolClient, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.poolClients {
+		if c.KeyHash == keyHash {
+			return copyPoolClient(c), nil
+		}
+	}
+	return nil, fmt.Errorf("pool client %w", store.ErrNotFound)
+}
+
+func (s *Store) UpdatePoolClient(ctx context.Context, client *model.PoolClient) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.poolClients[client.ID]
+	if !ok {
+		return fmt.Errorf("pool client %w", store.ErrNotFound)
+	}
+	c.Name = client.Name
+	c.AllowedDomains = slices.Clone(client.AllowedDomains)
+	c.RateLimit = client.RateLimit
+	c.ExpiresAt = client.ExpiresAt
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+// RevokePoolClient revokes the client. Revoking it again is a no-op.
+func (s *Store) RevokePoolClient(ctx context.Context, clientID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.poolClients[clientID]
+	if !ok {
+		return fmt.Errorf("pool client %w", store.ErrNotFound)
+	}
+	if c.RevokedAt == nil {
+		now := time.Now()
+		c.RevokedAt = &now
+		c.UpdatedAt = now
+	}
+	return nil
+}
+
+func (s *Store) RecordPoolClientUse(ctx context.Context, clientID int64, cookiesServed int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.poolClients[clientID]
+	if !ok {
+		return fmt.Errorf("pool client %w", store.ErrNotFound)
+	}
+	now := time.Now()
+	c.RequestCount++
+	c.CookiesServed += int64(cookiesServed)
+	c.LastUsedAt = &now
+	return nil
+}
+
+// Pool lease methods
+
+func (s *Store) LeasePoolSession(ctx context.Context, clientID int64, domain string, ttl time.Duration) (*model.PoolLease, []*model.Cookie, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	cookies, err := s.GetSharableCookiesByDomain(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions := make(map[int64][]*model.Cookie)
+	var userIDs []int64
+	for _, c := range cookies {
+		if _, ok := sessions[c.UserID]; !ok {
+			userIDs = append(userIDs, c.UserID)
+		}
+		sessions[c.UserID] = append(sessions[c.UserID], c)
+	}
+	if len(userIDs) == 0 {
+		return nil, nil, fmt.Errorf("shared session for %s %w", domain, store.ErrNotFound)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	site := poolhealth.Site(domain)
+	lastLease := make(map[int64]int64)
+	leased := make(map[int64]bool)
+	for _, l := range s.leases {
+		if l.ActiveKey != nil && !now.Before(l.ExpiresAt) {
+			l.ActiveKey, l.ReleasedAt, l.Outcome = nil, &now, model.LeaseExpired
+		}
+		if poolhealth.Site(l.Domain) == site {
+			lastLease[l.UserID] = l.ID
+			leased[l.UserID] = leased[l.UserID] || l.ActiveKey != nil
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := userIDs[i], userIDs[j]
+		if lastLease[a] != lastLease[b] {
+			return lastLease[a] < lastLease[b]
+		}
+		return a < b
+	})
+	for _, userID := range userIDs {
+		if leased[userID] {
+			continue
+		}
+		activeKey := fmt.Sprintf("%d:%s", userID, site)
+		lease := &model.PoolLease{
+			ID:        int64(len(s.leases)) + 1,
+			ClientID:  clientID,
+			UserID:    userID,
+			Domain:    domain,
+			ActiveKey: &activeKey,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}
+		s.leases = append(s.leases, lease)
+		l := *lease
+		return &l, sessions[userID], nil
+	}
+	return nil, nil, fmt.Errorf("every shared session for %s is leased: %w", domain, store.ErrConflict)
+}
+
+func (s *Store) ListLeasedUsers(ctx context.Context, domain string) ([]int64, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	site := poolhealth.Site(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "."))
+	seen := make(map[int64]bool)
+	userIDs := make([]int64, 0)
+	for _, l := range s.leases {
+		if l.ActiveKey != nil && now.Before(l.ExpiresAt) && poolhealth.Site(l.Domain) == site && !seen[l.UserID] {
+			seen[l.UserID] = true
+			userIDs = append(userIDs, l.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	return userIDs, nil
+}
+
+func (s *Store) EndPoolLease(ctx context.Context, clientID, leaseID int64, outcome string) (*model.PoolLease, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if leaseID < 1 || leaseID > int64(len(s.leases)) {
+		return nil, fmt.Errorf("active lease %w", store.ErrNotFound)
+	}
+	l := s.leases[leaseID-1]
+	if l.ClientID != clientID || l.ActiveKey == nil || !now.Before(l.ExpiresAt) {
+		return nil, fmt.Errorf("active lease %w", store.ErrNotFound)
+	}
+	l.ActiveKey, l.ReleasedAt, l.Outcome = nil, &now, outcome
+	if outcome == model.LeaseReleased {
+		// The session worked, so its reports are forgiven; a quarantine
+		// stays until it ends by itself.
+		for key, h := range s.health {
+			if key.userID == l.UserID && poolhealth.Covers(l.Domain, h.Domain) {
+				h.Failures = 0
+				delete(s.reports, key)
+			}
+		}
+	}
+	ended := *l
+	return &ended, nil
+}
+
+// Pool session health methods
+
+func (s *Store) ReportPoolSession(ctx context.Context, clientID, userID int64, domain, reason string, policy poolhealth.Policy) (*model.PoolSessionHealth, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	domain = poolhealth.NormalizeDomain(domain)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	shared := ok && u.SharingEnabled && !u.DeletedAt.Valid && slices.ContainsFunc(s.cookies[userID], func(c *model.Cookie) bool {
+		return c.IsSharable && domainMatches(c.Domain, domain)
+	})
+	if !shared {
+		return nil, fmt.Errorf("shared session for %s %w", domain, store.ErrNotFound)
+	}
+
+	now := time.Now()
+	key := sessionKey{userID, domain}
+	h, ok := s.health[key]
+	if !ok {
+		h = &model.PoolSessionHealth{ID: s.nextHealthID, UserID: userID, Domain: domain, CreatedAt: now}
+		s.nextHealthID++
+		s.health[key] = h
+	}
+	if s.reports[key] == nil {
+		s.reports[key] = make(map[int64]time.Time)
+	}
+	s.reports[key][clientID] = now
+	since := poolhealth.CountSince(h, policy, now)
+	h.Failures = 0
+	for _, at := range s.reports[key] {
+		if at.After(since) {
+			h.Failures++
+		}
+	}
+	h.LastReason, h.LastReportedAt, h.UpdatedAt = reason, now, now
+	poolhealth.Quarantine(h, reason, policy, now)
+	reported := *h
+	return &reported, nil
+}
+
+// Session probe methods
+
+func (s *Store) CreateSessionProbe(ctx context.Context, probe *model.SessionProbe) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	probe.ID = s.nextProbeID
+	probe.CreatedAt, probe.UpdatedAt = now, now
+	s.nextProbeID++
+	p := *probe
+	s.probes[p.ID] = &p
+	return nil
+}
+
+func (s *Store) ListSessionProbes(ctx context.Context) ([]*model.SessionProbe, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	probes := make([]*model.SessionProbe, 0, len(s.probes))
+	for _, p := range s.probes {
+		c := *p
+		probes = append(probes, &c)
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].ID < probes[j].ID })
+	return probes, nil
+}
+
+func (s *Store) GetSessionProbe(ctx context.Context, probeID int64) (*model.SessionProbe, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.probes[probeID]
+	if !ok {
+		return nil, fmt.Errorf("session probe %w", store.ErrNotFound)
+	}
+	c := *p
+	return &c, nil
+}
+
+func (s *Store) DeleteSessionProbe(ctx context.Context, probeID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.probes[probeID]; !ok {
+		return fmt.Errorf("session probe %w", store.ErrNotFound)
+	}
+	delete(s.probes, probeID)
+	for key := range s.probeResults {
+		if key.probeID == probeID {
+			delete(s.probeResults, key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) RecordProbeResult(ctx context.Context, result *model.ProbeResult) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.probes[result.ProbeID]; !ok {
+		return fmt.Errorf("session probe %w", store.ErrNotFound)
+	}
+	key := probeResultKey{result.ProbeID, result.UserID}
+	if old, ok := s.probeResults[key]; ok {
+		result.ID = old.ID
+	} else {
+		result.ID = s.nextProbeResultID
+		s.nextProbeResultID++
+	}
+	r := *result
+	s.probeResults[key] = &r
+	return nil
+}
+
+func (s *Store) ListProbeResults(ctx context.Context, userID int64) ([]*model.ProbeResult, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]*model.ProbeResult, 0)
+	for key, r := range s.probeResults {
+		if key.userID == userID {
+			c := *r
+			results = append(results, &c)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Domain != results[j].Domain {
+			return results[i].Domain < results[j].Domain
+		}
+		return results[i].ProbeID < results[j].ProbeID
+	})
+	return results, nil
+}
+
+// Pool usage methods
+
+func (s *Store) AddPoolUsage(ctx context.Context, usage []*model.PoolUsage) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range usage {
+		if u.Served == 0 && u.Leased == 0 && u.ReportedBad == 0 {
+			continue
+		}
+		hour := u.Hour.UTC().Truncate(time.Hour)
+		key := usageKey{hour.Unix(), u.UserID, u.Domain}
+		row, ok := s.usage[key]
+		if !ok {
+			row = &model.PoolUsage{ID: s.nextUsageID, Hour: hour, UserID: u.UserID, Domain: u.Domain}
+			s.nextUsageID++
+			s.usage[key] = row
+		}
+		row.Served += u.Served
+		row.Leased += u.Leased
+		row.ReportedBad += u.ReportedBad
+	}
+	return nil
+}
+
+func (s *Store) ListPoolUsage(ctx context.Context, userID int64, domain string, since time.Time) ([]*model.PoolUsage, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	since = since.UTC().Truncate(time.Hour)
+	usage := make([]*model.PoolUsage, 0)
+	for _, row := range s.usage {
+		if row.Hour.Before(since) || (userID != 0 && row.UserID != userID) || (domain != "" && row.Domain != domain) {
+			continue
+		}
+		c := *row
+		usage = append(usage, &c)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if !a.Hour.Equal(b.Hour) {
+			return a.Hour.Before(b.Hour)
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.UserID < b.UserID
+	})
+	return usage, nil
+}
+
+func (s *Store) PrunePoolUsage(ctx context.Context, before time.Time) (int64, error) {
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before = before.UTC().Truncate(time.Hour)
+	var pruned int64
+	for key, row := range s.usage {
+		if row.Hour.Before(before) {
+			delete(s.usage, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func copyShareLink(l *model.ShareLink) *model.ShareLink {
+	lc := *l
+	lc.Names = slices.Clone(l.Names)
+	return &lc
+}
+
+func (s *Store) CreateShareLink(ctx context.Context, link *model.ShareLink) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.shareLinks {
+		if l.TokenHash == link.TokenHash {
+			return fmt.Errorf("share link token %w", store.ErrConflict)
+		}
+	}
+	link.ID = s.nextShareLinkID
+	link.CreatedAt = time.Now()
+	s.nextShareLinkID++
+	s.shareLinks[link.ID] = copyShareLink(link)
+	return nil
+}
+
+func (s *Store) ListShareLinks(ctx context.Context, userID int64) ([]*model.ShareLink, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]*model.ShareLink, 0)
+	for _, l := range s.shareLinks {
+		if l.UserID == userID {
+			links = append(links, copyShareLink(l))
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links, nil
+}
+
+func (s *Store) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*model.ShareLink, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.shareLinks {
+		if l.TokenHash == tokenHash {
+			return copyShareLink(l), nil
+		}
+	}
+	return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+}
+
+func (s *Store) RevokeShareLink(ctx context.Context, userID, linkID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.shareLinks[linkID]
+	if !ok || l.UserID != userID {
+		return fmt.Errorf("share link %w", store.ErrNotFound)
+	}
+	if l.RevokedAt == nil {
+		now := time.Now()
+		l.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *Store) UseShareLink(ctx context.Context, linkID int64, now time.Time) (*model.ShareLink, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.shareLinks[linkID]
+	if !ok {
+		return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+	}
+	if l.RevokedAt != nil || !l.ExpiresAt.After(now) || l.Uses >= l.MaxUses {
+		return nil, fmt.Errorf("share link is no longer usable: %w", store.ErrConflict)
+	}
+	l.Uses++
+	used := now
+	l.LastUsedAt = &used
+	return copyShareLink(l), nil
+}
+
+func (s *Store) FailShareLinkPassword(ctx context.Context, linkID int64) (*model.ShareLink, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.shareLinks[linkID]
+	if !ok {
+		return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+	}
+	l.FailedAttempts++
+	return copyShareLink(l), nil
+}
+
+func (s *Store) AddShareLinkEvent(ctx context.Context, event *model.ShareLinkEvent) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Event == model.ShareLinkDenied {
+		for i := len(s.shareLinkEvents) - 1; i >= 0; i-- {
+			latest := s.shareLinkEvents[i]
+			if latest.LinkID != event.LinkID {
+				continue
+			}
+			if latest.Event == event.Event && latest.Detail == event.Detail {
+				at := event.CreatedAt
+				latest.Repeats++
+				latest.LastAt = &at
+				*event = *latest
+				return nil
+			}
+			break
+		}
+	}
+	event.ID = s.nextShareEventID
+	s.nextShareEventID++
+	ec := *event
+	s.shareLinkEvents = append(s.shareLinkEvents, &ec)
+	return nil
+}
+
+func (s *Store) ListShareLinkEvents(ctx context.Context, userID, linkID int64) ([]*model.ShareLinkEvent, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if l, ok := s.shareLinks[linkID]; !ok || l.UserID != userID {
+		return nil, fmt.Errorf("share link %w", store.ErrNotFound)
+	}
+	events := make([]*model.ShareLinkEvent, 0)
+	for _, e := range s.shareLinkEvents {
+		if e.LinkID == linkID {
+			ec := *e
+			events = append(events, &ec)
+		}
+	}
+	return events, nil
+}
+
+// activePersonLocked returns the active user with the given ID unless it is
+// a team vault.
+func (s *Store) activePersonLocked(userID int64) (*model.User, error) {
+	u, err := s.activeUserLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TeamID != nil {
+		return nil, fmt.Errorf("user %w", store.ErrNotFound)
+	}
+	return u, nil
+}
+
+// keepAnOwnerLocked fails with ErrConflict unless the team has another owner
+// besides the one about to be demoted or removed.
+func (s *Store) keepAnOwnerLocked(teamID int64) error {
+	owners := 0
+	for k, m := range s.teamMembers {
+		if k.teamID == teamID && m.Role == model.TeamOwner {
+			owners++
+		}
+	}
+	if owners <= 1 {
+		return fmt.Errorf("a team needs an owner: %w", store.ErrConflict)
+	}
+	return nil
+}
+
+func (s *Store) CreateTeam(ctx context.Context, team *model.Team, ownerID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.activePersonLocked(ownerID); err != nil {
+		return err
+	}
+	vault := s.createUserLocked("team vault: " + team.Name)
+	now := time.Now()
+	team.ID = s.nextTeamID
+	team.VaultUserID = vault.ID
+	team.CreatedAt = now
+	team.UpdatedAt = now
+	s.nextTeamID++
+	teamID := team.ID
+	vault.TeamID = &teamID
+	tc := *team
+	s.teams[team.ID] = &tc
+	s.teamMembers[teamMemberKey{team.ID, ownerID}] = &model.TeamMember{
+		TeamID: team.ID, UserID: ownerID, Role: model.TeamOwner, CreatedAt: now, UpdatedAt: now,
+	}
+	return nil
+}
+
+func (s *Store) GetTeam(ctx context.Context, teamID int64) (*model.Team, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.teams[teamID]
+	if !ok {
+		return nil, fmt.Errorf("team %w", store.ErrNotFound)
+	}
+	tc := *t
+	return &tc, nil
+}
+
+func (s *Store) DeleteTeam(ctx context.Context, teamID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[teamID]
+	if !ok {
+		return fmt.Errorf("team %w", store.ErrNotFound)
+	}
+	for k := range s.teamMembers {
+		if k.teamID == teamID {
+			delete(s.teamMembers, k)
+		}
+	}
+	delete(s.cookies, t.VaultUserID)
+	if vault, ok := s.users[t.VaultUserID]; ok {
+		vault.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	}
+	delete(s.teams, teamID)
+	return nil
+}
+
+// sortedMembers returns copies of the memberships that match, ordered by team
+// and user.
+func (s *Store) sortedMembers(match func(teamMemberKey) bool) []*model.TeamMember {
+	members := make([]*model.TeamMember, 0)
+	for k, m := range s.teamMembers {
+		if match(k) {
+			mc := *m
+			members = append(members, &mc)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].TeamID != members[j].TeamID {
+			return members[i].TeamID < members[j].TeamID
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members
+}
+
+func (s *Store) ListUserTeams(ctx context.Context, userID int64) ([]*model.TeamMember, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedMembers(func(k teamMemberKey) bool { return k.userID == userID }), nil
+}
+
+func (s *Store) ListTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedMembers(func(k teamMemberKey) bool { return k.teamID == teamID }), nil
+}
+
+func (s *Store) GetTeamMember(ctx context.Context, teamID, userID int64) (*model.TeamMember, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.teamMembers[teamMemberKey{teamID, userID}]
+	if !ok {
+		return nil, fmt.Errorf("team member %w", store.ErrNotFound)
+	}
+	mc := *m
+	return &mc, nil
+}
+
+func (s *Store) SetTeamMember(ctx context.Context, member *model.TeamMember) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[member.TeamID]; !ok {
+		return fmt.Errorf("team %w", store.ErrNotFound)
+	}
+	if _, err := s.activePersonLocked(member.UserID); err != nil {
+		return err
+	}
+	now := time.Now()
+	key := teamMemberKey{member.TeamID, member.UserID}
+	existing, ok := s.teamMembers[key]
+	if !ok {
+		member.CreatedAt = now
+		member.UpdatedAt = now
+		mc := *member
+		s.teamMembers[key] = &mc
+		return nil
+	}
+	if existing.Role == model.TeamOwner && member.Role != model.TeamOwner {
+		if err := s.keepAnOwnerLocked(member.TeamID); err != nil {
+			return err
+		}
+	}
+	existing.Role = member.Role
+	existing.UpdatedAt = now
+	*member = *existing
+	return nil
+}
+
+func (s *Store) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[teamID]; !ok {
+		return fmt.Errorf("team %w", store.ErrNotFound)
+	}
+	key := teamMemberKey{teamID, userID}
+	existing, ok := s.teamMembers[key]
+	if !ok {
+		return fmt.Errorf("team member %w", store.ErrNotFound)
+	}
+	if existing.Role == model.TeamOwner {
+		if err := s.keepAnOwnerLocked(teamID); err != nil {
+			return err
+		}
+	}
+	delete(s.teamMembers, key)
+	return nil
+}
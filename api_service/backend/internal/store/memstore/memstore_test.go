@@ -0,0 +1,13 @@
+package memstore
+
+import (
+	"cookie-syncer/api/internal/store"
+	"cookie-syncer/api/internal/store/storetest"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New("admin-key", "pool-key")
+	})
+}
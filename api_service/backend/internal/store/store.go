@@ -1,27 +1,137 @@
 package store
 
-import "cookie-syncer/api/internal/model"
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"time"
+)
 
-// Store defines the interface for database operations.
+// Store defines the interface for database operations. Every method honours
+// cancellation of ctx, and failures wrap ErrNotFound, ErrConflict or
+// ErrUnavailable where they apply.
 type Store interface {
 	// User methods
-	GetUserByAPIKey(apiKey string) (*model.User, error)
-	GetUserByID(userID int64) (*model.User, error)
-	UpdateUserSharing(userID int64, enabled bool) error
-	GetUserSettings(userID int64) (*model.User, error)
+	GetUserByAPIKey(ctx context.Context, apiKey string) (*model.User, error)
+	GetUserByID(ctx context.Context, userID int64) (*model.User, error)
+	UpdateUserSharing(ctx context.Context, userID int64, enabled bool) error
+	GetUserSettings(ctx context.Context, userID int64) (*model.User, error)
 
 	// Admin methods
-	CreateUsers(remarks []string) ([]*model.User, error)
-	UpdateUserRemark(userID int64, remark *string) error
-	UpdateUserRemarkByAPIKey(apiKey string, remark *string) error
-	AdminUpdateUserAPIKey(userID int64) (*model.User, error)
-	AdminUpdateUserAPIKeyByAPIKey(apiKey string) (*model.User, error)
+	CreateUsers(ctx context.Context, remarks []string) ([]*model.User, error)
+	UpdateUserRemark(ctx context.Context, userID int64, remark *string) error
+	UpdateUserRemarkByAPIKey(ctx context.Context, apiKey string, remark *string) error
+	AdminUpdateUserAPIKey(ctx context.Context, userID int64) (*model.User, error)
+	AdminUpdateUserAPIKeyByAPIKey(ctx context.Context, apiKey string) (*model.User, error)
+	ListUsers(ctx context.Context) ([]*model.User, error)
+	SuspendUser(ctx context.Context, userID int64) error
+	UpdateUserQuota(ctx context.Context, userID int64, quota model.Quota) error
+	UpdateUserDomainRules(ctx context.Context, userID int64, rules model.DomainRules) error
+	UpdateUserSharingRules(ctx context.Context, userID int64, rules model.SharingRules) error
 
 	// Cookie methods
-	SyncCookies(userID int64, cookies []*model.Cookie) error
-	GetSharableCookiesByDomain(domain string) ([]*model.Cookie, error)
-	GetCookiesByUserID(userID int64) ([]*model.Cookie, error)
-	GetCookiesByDomain(userID int64, domain string) ([]*model.Cookie, error)
+	SyncCookies(ctx context.Context, userID int64, cookies []*model.Cookie) error
+	GetSharableCookiesByDomain(ctx context.Context, domain string) ([]*model.Cookie, error)
+	GetCookiesByUserID(ctx context.Context, userID int64) ([]*model.Cookie, error)
+	GetCookiesByDomain(ctx context.Context, userID int64, domain string) ([]*model.Cookie, error)
+	// Pool client methods. UpdatePoolClient changes the name, allowed
+	// domains, rate limit and expiry; RecordPoolClientUse counts a request
+	// and the cookies it was served.
+	CreatePoolClient(ctx context.Context, client *model.PoolClient) error
+	ListPoolClients(ctx context.Context) ([]*model.PoolClient, error)
+	GetPoolClientByKeyHash(ctx context.Context, keyHash string) (*model.PoolClient, error)
+	UpdatePoolClient(ctx context.Context, client *model.PoolClient) error
+	RevokePoolClient(ctx context.Context, clientID int64) error
+	RecordPoolClientUse(ctx context.Context, clientID int64, cookiesServed int) error
+
+	// Pool lease methods. LeasePoolSession leases the contributor session
+	// for domain (one user's sharable cookies for it) that was leased least
+	// recently and is not leased already, and returns the session's
+	// cookies. It fails with ErrNotFound if nobody shares cookies for domain
+	// and with ErrConflict if every session is leased. A lease covers the
+	// contributor's whole site (registrable domain), so leases of
+	// overlapping domains never share cookies. EndPoolLease ends one
+	// of the client's active leases with the given outcome.
+	// ListLeasedUsers returns the users whose session for domain's site is
+	// under an active lease, in ID order.
+	LeasePoolSession(ctx context.Context, clientID int64, domain string, ttl time.Duration) (*model.PoolLease, []*model.Cookie, error)
+	EndPoolLease(ctx context.Context, clientID, leaseID int64, outcome string) (*model.PoolLease, error)
+	ListLeasedUsers(ctx context.Context, domain string) ([]int64, error)
+
+	// Pool session health. ReportPoolSession records the client's report of
+	// a failure of the user's session for domain, sets the session's
+	// failures to the number of clients reporting it since
+	// poolhealth.CountSince and quarantines it under policy; it fails with
+	// ErrNotFound if the user shares no cookies for domain. Quarantined
+	// sessions are left out of GetSharableCookiesByDomain (and so of leases)
+	// until SyncCookies changes their cookies, which also clears their
+	// reports. Ending a lease as released clears the reports of the
+	// sessions it covered.
+	ReportPoolSession(ctx context.Context, clientID, userID int64, domain, reason string, policy poolhealth.Policy) (*model.PoolSessionHealth, error)
+
+	// ListPoolSessions returns every healthy session in the pool, one per
+	// contributor and cookie domain (lower-case, without a leading dot),
+	// ordered by domain and user: the sharable cookies that
+	// GetSharableCookiesByDomain could return, less quarantined sessions and
+	// those a probe found expired.
+	ListPoolSessions(ctx context.Context) ([]*model.PoolSession, error)
+
+	// Session probe methods. DeleteSessionProbe deletes the probe's results
+	// too; RecordProbeResult replaces the probe's result for the user and
+	// fails with ErrNotFound if the probe is gone. GetSharableCookiesByDomain
+	// leaves out the sessions whose latest result is expired while another
+	// session for the domain is not, and SyncCookies drops the results of
+	// the sessions it changes.
+	CreateSessionProbe(ctx context.Context, probe *model.SessionProbe) error
+	ListSessionProbes(ctx context.Context) ([]*model.SessionProbe, error)
+	GetSessionProbe(ctx context.Context, probeID int64) (*model.SessionProbe, error)
+	DeleteSessionProbe(ctx context.Context, probeID int64) error
+	RecordProbeResult(ctx context.Context, result *model.ProbeResult) error
+	ListProbeResults(ctx context.Context, userID int64) ([]*model.ProbeResult, error)
+
+	// Pool usage methods. AddPoolUsage adds the counts of each entry to the
+	// row for its user, domain and hour (Hour is truncated to the hour).
+	// ListPoolUsage returns the rows from since on, of one user unless userID
+	// is 0 and one domain unless domain is empty, ordered by hour, domain and
+	// user. PrunePoolUsage deletes the rows for hours before before.
+	AddPoolUsage(ctx context.Context, usage []*model.PoolUsage) error
+	ListPoolUsage(ctx context.Context, userID int64, domain string, since time.Time) ([]*model.PoolUsage, error)
+	PrunePoolUsage(ctx context.Context, before time.Time) (int64, error)
+
+	// Share link methods. Links are looked up by their owner and ID, or by
+	// their token's hash; another user's link is ErrNotFound. UseShareLink
+	// counts a redemption at now, failing with ErrConflict if the link is
+	// revoked, expired or used up by then, so concurrent redemptions never
+	// exceed MaxUses. FailShareLinkPassword counts a wrong password given
+	// for the link and returns it. RevokeShareLink of a revoked link is a
+	// no-op. AddShareLinkEvent folds a denial with the same detail as the
+	// link's latest event into that event, counting it in Repeats, so
+	// refused redemptions cannot grow the log without bound.
+	CreateShareLink(ctx context.Context, link *model.ShareLink) error
+	ListShareLinks(ctx context.Context, userID int64) ([]*model.ShareLink, error)
+	GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*model.ShareLink, error)
+	RevokeShareLink(ctx context.Context, userID, linkID int64) error
+	UseShareLink(ctx context.Context, linkID int64, now time.Time) (*model.ShareLink, error)
+	FailShareLinkPassword(ctx context.Context, linkID int64) (*model.ShareLink, error)
+	AddShareLinkEvent(ctx context.Context, event *model.ShareLinkEvent) error
+	ListShareLinkEvents(ctx context.Context, userID, linkID int64) ([]*model.ShareLinkEvent, error)
+
+	// Team methods. CreateTeam creates the team with its vault user and makes
+	// ownerID its owner. Members are people, not vaults; adding someone else
+	// is ErrNotFound. SetTeamMember adds a member or changes their role, and
+	// it and RemoveTeamMember fail with ErrConflict rather than leave a team
+	// without an owner. DeleteTeam removes the members, deletes the vault's
+	// cookies and suspends the vault user. GetUserByAPIKey never returns a
+	// vault user.
+	CreateTeam(ctx context.Context, team *model.Team, ownerID int64) error
+	GetTeam(ctx context.Context, teamID int64) (*model.Team, error)
+	DeleteTeam(ctx context.Context, teamID int64) error
+	ListUserTeams(ctx context.Context, userID int64) ([]*model.TeamMember, error)
+	ListTeamMembers(ctx context.Context, teamID int64) ([]*model.TeamMember, error)
+	GetTeamMember(ctx context.Context, teamID, userID int64) (*model.TeamMember, error)
+	SetTeamMember(ctx context.Context, member *model.TeamMember) error
+	RemoveTeamMember(ctx context.Context, teamID, userID int64) error
+
 	// GetCookieByName(userID int64, domain, name string) (*model.Cookie, error) // Removed
 
 	// SearchCookies(domain, name string) ([]*model.Cookie, error) // Not implemented, removed
@@ -0,0 +1,1253 @@
+// Package storetest is a behavioural test suite that every store.Store
+// implementation must pass. Call Run from the implementation's tests:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store { return memstore.New("", "") })
+//	}
+package storetest
+
+import (
+	"context"
+	"cookie-syncer/api/internal/model"
+	"cookie-syncer/api/internal/poolhealth"
+	"cookie-syncer/api/internal/store"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Factory returns a new, empty store for a single test.
+type Factory func(t *testing.T) store.Store
+
+// Run runs the suite against stores created by newStore. Every subtest gets a
+// store of its own.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"CreateAndLookUpUsers", testCreateAndLookUpUsers},
+		{"ListUsers", testListUsers},
+		{"NotFound", testNotFound},
+		{"KeyRotation", testKeyRotation},
+		{"SuspendUser", testSuspendUser},
+		{"UserQuota", testUserQuota},
+		{"UserDomainRules", testUserDomainRules},
+		{"SyncReplacesCookies", testSyncReplacesCookies},
+		{"SyncDeduplicates", testSyncDeduplicates},
+		{"DomainSuffixMatching", testDomainSuffixMatching},
+		{"SharingVisibility", testSharingVisibility},
+		{"SharingRules", testSharingRules},
+		{"PoolClients", testPoolClients},
+		{"PoolLeases", testPoolLeases},
+		{"PoolSessionHealth", testPoolSessionHealth},
+		{"SessionProbes", testSessionProbes},
+		{"PoolUsage", testPoolUsage},
+		{"PoolSessions", testPoolSessions},
+		{"ShareLinks", testShareLinks},
+		{"Teams", testTeams},
+		{"CancelledContext", testCancelledContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// --- Helper Functions ---
+
+func createUser(t *testing.T, s store.Store, remark string) *model.User {
+	t.Helper()
+	users, err := s.CreateUsers(context.Background(), []string{remark})
+	if err != nil {
+		t.Fatalf("CreateUsers: %v", err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("CreateUsers returned %d users, want 1", len(users))
+	}
+	return users[0]
+}
+
+func syncCookies(t *testing.T, s store.Store, userID int64, cookies ...*model.Cookie) {
+	t.Helper()
+	if err := s.SyncCookies(context.Background(), userID, cookies); err != nil {
+		t.Fatalf("SyncCookies(%d): %v", userID, err)
+	}
+}
+
+func cookie(domain, name, value string) *model.Cookie {
+	return &model.Cookie{Domain: domain, Name: name, Value: value, Path: "/"}
+}
+
+func sharable(c *model.Cookie) *model.Cookie {
+	c.IsSharable = true
+	return c
+}
+
+// values returns the cookies as "name=value" in the order given.
+func values(cookies []*model.Cookie) []string {
+	out := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		out = append(out, c.Name+"="+c.Value)
+	}
+	return out
+}
+
+func sortedValues(cookies []*model.Cookie) []string {
+	out := values(cookies)
+	sort.Strings(out)
+	return out
+}
+
+func expectValues(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func expectErr(t *testing.T, what string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+// --- Tests ---
+
+func testCreateAndLookUpUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	users, err := s.CreateUsers(ctx, []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("CreateUsers: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("CreateUsers returned %d users, want 2", len(users))
+	}
+	alice, bob := users[0], users[1]
+	if alice.ID == 0 || alice.ID == bob.ID {
+		t.Errorf("user IDs %d and %d must be non-zero and distinct", alice.ID, bob.ID)
+	}
+	if alice.APIKey == "" || alice.APIKey == bob.APIKey {
+		t.Errorf("API keys %q and %q must be non-empty and distinct", alice.APIKey, bob.APIKey)
+	}
+	if alice.Remark == nil || *alice.Remark != "alice" {
+		t.Errorf("remark = %v, want alice", alice.Remark)
+	}
+
+	got, err := s.GetUserByAPIKey(ctx, bob.APIKey)
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey: %v", err)
+	}
+	if got.ID != bob.ID {
+		t.Errorf("GetUserByAPIKey returned user %d, want %d", got.ID, bob.ID)
+	}
+
+	renamed := "Alice"
+	if err := s.UpdateUserRemark(ctx, alice.ID, &renamed); err != nil {
+		t.Fatalf("UpdateUserRemark: %v", err)
+	}
+	if err := s.UpdateUserSharing(ctx, alice.ID, true); err != nil {
+		t.Fatalf("UpdateUserSharing: %v", err)
+	}
+	settings, err := s.GetUserSettings(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUserSettings: %v", err)
+	}
+	if !settings.SharingEnabled {
+		t.Error("sharing_enabled was not saved")
+	}
+	if settings.Remark == nil || *settings.Remark != "Alice" {
+		t.Errorf("remark = %v, want Alice", settings.Remark)
+	}
+
+	if err := s.UpdateUserRemarkByAPIKey(ctx, bob.APIKey, nil); err != nil {
+		t.Fatalf("UpdateUserRemarkByAPIKey: %v", err)
+	}
+	got, err = s.GetUserByID(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.Remark != nil {
+		t.Errorf("remark = %q, want it cleared", *got.Remark)
+	}
+}
+
+func testListUsers(t *testing.T, s store.Store) {
+	var want []int64
+	for _, remark := range []string{"a", "b", "c"} {
+		want = append(want, createUser(t, s, remark).ID)
+	}
+	users, err := s.ListUsers(context.Background())
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	var got []int64
+	for _, u := range users {
+		got = append(got, u.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUsers IDs = %v, want %v in order", got, want)
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	const missing = int64(1 << 40)
+	remark := "x"
+
+	_, err := s.GetUserByAPIKey(ctx, "no-such-key")
+	expectErr(t, "GetUserByAPIKey", err, store.ErrNotFound)
+	_, err = s.GetUserByID(ctx, missing)
+	expectErr(t, "GetUserByID", err, store.ErrNotFound)
+	expectErr(t, "UpdateUserSharing", s.UpdateUserSharing(ctx, missing, true), store.ErrNotFound)
+	expectErr(t, "UpdateUserRemark", s.UpdateUserRemark(ctx, missing, &remark), store.ErrNotFound)
+	expectErr(t, "UpdateUserRemarkByAPIKey", s.UpdateUserRemarkByAPIKey(ctx, "no-such-key", &remark), store.ErrNotFound)
+	_, err = s.AdminUpdateUserAPIKey(ctx, missing)
+	expectErr(t, "AdminUpdateUserAPIKey", err, store.ErrNotFound)
+	_, err = s.AdminUpdateUserAPIKeyByAPIKey(ctx, "no-such-key")
+	expectErr(t, "AdminUpdateUserAPIKeyByAPIKey", err, store.ErrNotFound)
+	expectErr(t, "SuspendUser", s.SuspendUser(ctx, missing), store.ErrNotFound)
+	expectErr(t, "SyncCookies", s.SyncCookies(ctx, missing, nil), store.ErrNotFound)
+}
+
+func testKeyRotation(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "rotating")
+	syncCookies(t, s, user.ID, cookie("example.com", "sid", "1"))
+
+	rotated, err := s.AdminUpdateUserAPIKey(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("AdminUpdateUserAPIKey: %v", err)
+	}
+	if rotated.ID != user.ID || rotated.APIKey == "" || rotated.APIKey == user.APIKey {
+		t.Fatalf("rotated user = %d/%q, want user %d with a new key", rotated.ID, rotated.APIKey, user.ID)
+	}
+	_, err = s.GetUserByAPIKey(ctx, user.APIKey)
+	expectErr(t, "old key after rotation", err, store.ErrNotFound)
+
+	again, err := s.AdminUpdateUserAPIKeyByAPIKey(ctx, rotated.APIKey)
+	if err != nil {
+		t.Fatalf("AdminUpdateUserAPIKeyByAPIKey: %v", err)
+	}
+	if again.APIKey == rotated.APIKey {
+		t.Fatal("AdminUpdateUserAPIKeyByAPIKey kept the old key")
+	}
+	_, err = s.GetUserByAPIKey(ctx, rotated.APIKey)
+	expectErr(t, "previous key after second rotation", err, store.ErrNotFound)
+
+	got, err := s.GetUserByAPIKey(ctx, again.APIKey)
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey(new key): %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("new key resolves to user %d, want %d", got.ID, user.ID)
+	}
+
+	// Rotation only changes the key; the user's data stays.
+	cookies, err := s.GetCookiesByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	expectValues(t, "cookies after rotation", values(cookies), []string{"sid=1"})
+}
+
+func testSuspendUser(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "suspended")
+	if err := s.SuspendUser(ctx, user.ID); err != nil {
+		t.Fatalf("SuspendUser: %v", err)
+	}
+
+	_, err := s.GetUserByAPIKey(ctx, user.APIKey)
+	expectErr(t, "GetUserByAPIKey of a suspended user", err, store.ErrNotFound)
+	expectErr(t, "SuspendUser twice", s.SuspendUser(ctx, user.ID), store.ErrNotFound)
+	expectErr(t, "SyncCookies for a suspended user", s.SyncCookies(ctx, user.ID, nil), store.ErrNotFound)
+
+	users, err := s.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != user.ID || !users[0].DeletedAt.Valid {
+		t.Errorf("ListUsers must include the suspended user, marked as deleted; got %+v", users)
+	}
+}
+
+func testUserQuota(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "quota")
+	if q := user.Quota; q.MaxCookies != nil || q.MaxBytes != nil || q.MaxDomains != nil {
+		t.Errorf("new user has quota overrides %+v, want none", q)
+	}
+
+	maxCookies, unlimited := int64(10), int64(0)
+	quota := model.Quota{MaxCookies: &maxCookies, MaxDomains: &unlimited}
+	if err := s.UpdateUserQuota(ctx, user.ID, quota); err != nil {
+		t.Fatalf("UpdateUserQuota: %v", err)
+	}
+	maxCookies = 99 // the store must not keep the caller's pointers
+
+	check := func(what string, got model.Quota, wantCookies, wantDomains *int64) {
+		t.Helper()
+		if !reflect.DeepEqual(got.MaxCookies, wantCookies) || got.MaxBytes != nil || !reflect.DeepEqual(got.MaxDomains, wantDomains) {
+			t.Errorf("%s: quota %+v, want max_cookies %v, max_domains %v and no max_bytes", what, got, wantCookies, wantDomains)
+		}
+	}
+	ten := int64(10)
+	byID, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	check("GetUserByID", byID.Quota, &ten, &unlimited)
+	byKey, err := s.GetUserByAPIKey(ctx, user.APIKey)
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey: %v", err)
+	}
+	check("GetUserByAPIKey", byKey.Quota, &ten, &unlimited)
+
+	if err := s.UpdateUserQuota(ctx, user.ID, model.Quota{}); err != nil {
+		t.Fatalf("UpdateUserQuota to clear: %v", err)
+	}
+	cleared, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	check("after clearing", cleared.Quota, nil, nil)
+
+	expectErr(t, "UpdateUserQuota of a missing user", s.UpdateUserQuota(ctx, user.ID+1000, quota), store.ErrNotFound)
+}
+
+func testUserDomainRules(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "rules")
+	if r := user.DomainRules; len(r.Allow) != 0 || len(r.Deny) != 0 {
+		t.Errorf("new user has domain rules %+v, want none", r)
+	}
+
+	rules := model.DomainRules{
+		Mode:  model.DomainRulesReject,
+		Allow: []model.DomainRule{{Type: model.DomainRuleWildcard, Pattern: "*.example.com"}},
+		Deny:  []model.DomainRule{{Type: model.DomainRuleExact, Pattern: "bank.com"}, {Type: model.DomainRuleRegex, Pattern: `mail\..*`}},
+	}
+	if err := s.UpdateUserDomainRules(ctx, user.ID, rules); err != nil {
+		t.Fatalf("UpdateUserDomainRules: %v", err)
+	}
+	want := model.DomainRules{
+		Mode:  rules.Mode,
+		Allow: slices.Clone(rules.Allow),
+		Deny:  slices.Clone(rules.Deny),
+	}
+	rules.Deny[0].Pattern = "changed.com" // the store must not keep the caller's slices
+
+	byID, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if !reflect.DeepEqual(byID.DomainRules, want) {
+		t.Errorf("GetUserByID: domain rules %+v, want %+v", byID.DomainRules, want)
+	}
+	byKey, err := s.GetUserByAPIKey(ctx, user.APIKey)
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey: %v", err)
+	}
+	if !reflect.DeepEqual(byKey.DomainRules, want) {
+		t.Errorf("GetUserByAPIKey: domain rules %+v, want %+v", byKey.DomainRules, want)
+	}
+
+	if err := s.UpdateUserDomainRules(ctx, user.ID, model.DomainRules{Mode: model.DomainRulesDrop}); err != nil {
+		t.Fatalf("UpdateUserDomainRules to clear: %v", err)
+	}
+	cleared, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if r := cleared.DomainRules; r.Mode != model.DomainRulesDrop || len(r.Allow) != 0 || len(r.Deny) != 0 {
+		t.Errorf("after clearing: domain rules %+v, want drop mode and no rules", r)
+	}
+
+	expectErr(t, "UpdateUserDomainRules of a missing user", s.UpdateUserDomainRules(ctx, user.ID+1000, rules), store.ErrNotFound)
+}
+
+func testSyncReplacesCookies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+
+	syncCookies(t, s, alice.ID, cookie("a.com", "one", "1"), cookie("a.com", "two", "2"))
+	syncCookies(t, s, bob.ID, cookie("b.com", "bob", "b"))
+	syncCookies(t, s, alice.ID, cookie("c.com", "three", "3"), cookie("a.com", "two", "2b"))
+
+	cookies, err := s.GetCookiesByUserID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	expectValues(t, "alice's cookies", values(cookies), []string{"three=3", "two=2b"})
+	for _, c := range cookies {
+		if c.ID == 0 || c.UserID != alice.ID {
+			t.Errorf("cookie %s has ID %d and user %d, want a generated ID and user %d", c.Name, c.ID, c.UserID, alice.ID)
+		}
+		if c.LastUpdatedFromExtensionAt.IsZero() {
+			t.Errorf("cookie %s has no last_updated_from_extension_at", c.Name)
+		}
+	}
+
+	user, err := s.GetUserByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.LastSyncedAt == nil {
+		t.Error("last_synced_at was not set")
+	}
+
+	others, err := s.GetCookiesByUserID(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	expectValues(t, "bob's cookies", values(others), []string{"bob=b"})
+
+	syncCookies(t, s, alice.ID)
+	cookies, err = s.GetCookiesByUserID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	if len(cookies) != 0 {
+		t.Errorf("an empty sync left %v", values(cookies))
+	}
+}
+
+func testSyncDeduplicates(t *testing.T, s store.Store) {
+	user := createUser(t, s, "dupes")
+	syncCookies(t, s, user.ID,
+		cookie("a.com", "x", "first"),
+		cookie("a.com", "y", "y"),
+		cookie("a.com", "x", "last"),
+	)
+	cookies, err := s.GetCookiesByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	expectValues(t, "cookies", values(cookies), []string{"y=y", "x=last"})
+}
+
+func testDomainSuffixMatching(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "domains")
+	other := createUser(t, s, "other")
+	syncCookies(t, s, user.ID,
+		cookie(".Example.com", "root", "1"),
+		cookie("www.example.com", "www", "2"),
+		cookie("deep.api.example.com", "deep", "3"),
+		cookie("notexample.com", "lookalike", "4"),
+		cookie("example.com.evil.io", "embedded", "5"),
+		cookie("sub.a_b.io", "underscore", "6"),
+		cookie("sub.axb.io", "wildcard", "7"),
+	)
+	syncCookies(t, s, other.ID, cookie("example.com", "foreign", "8"))
+
+	cases := []struct {
+		domain string
+		want   []string
+	}{
+		{"example.com", []string{"deep=3", "root=1", "www=2"}},
+		{"EXAMPLE.COM", []string{"deep=3", "root=1", "www=2"}},
+		{".example.com", []string{"deep=3", "root=1", "www=2"}},
+		{"www.example.com", []string{"www=2"}},
+		{"api.example.com", []string{"deep=3"}},
+		{"com", []string{"deep=3", "lookalike=4", "root=1", "www=2"}},
+		{"a_b.io", []string{"underscore=6"}},
+		{"b.io", nil},
+		{"unknown.org", nil},
+	}
+	for _, tc := range cases {
+		cookies, err := s.GetCookiesByDomain(ctx, user.ID, tc.domain)
+		if err != nil {
+			t.Fatalf("GetCookiesByDomain(%q): %v", tc.domain, err)
+		}
+		expectValues(t, "GetCookiesByDomain("+tc.domain+")", sortedValues(cookies), tc.want)
+	}
+}
+
+func testSharingVisibility(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	sharer := createUser(t, s, "sharer")
+	private := createUser(t, s, "private")
+
+	if err := s.UpdateUserSharing(ctx, sharer.ID, true); err != nil {
+		t.Fatalf("UpdateUserSharing: %v", err)
+	}
+	syncCookies(t, s, sharer.ID,
+		sharable(cookie(".example.com", "shared", "1")),
+		cookie(".example.com", "kept", "2"),
+		sharable(cookie("other.org", "elsewhere", "3")),
+	)
+	syncCookies(t, s, private.ID, sharable(cookie("www.example.com", "optedout", "4")))
+
+	pool := func() []string {
+		t.Helper()
+		cookies, err := s.GetSharableCookiesByDomain(ctx, "example.com")
+		if err != nil {
+			t.Fatalf("GetSharableCookiesByDomain: %v", err)
+		}
+		return sortedValues(cookies)
+	}
+
+	expectValues(t, "pool with one sharing user", pool(), []string{"shared=1"})
+
+	if err := s.UpdateUserSharing(ctx, private.ID, true); err != nil {
+		t.Fatalf("UpdateUserSharing: %v", err)
+	}
+	expectValues(t, "pool after the second user opts in", pool(), []string{"optedout=4", "shared=1"})
+
+	if err := s.UpdateUserSharing(ctx, sharer.ID, false); err != nil {
+		t.Fatalf("UpdateUserSharing: %v", err)
+	}
+	expectValues(t, "pool after the first user opts out", pool(), []string{"optedout=4"})
+
+	if err := s.SuspendUser(ctx, private.ID); err != nil {
+		t.Fatalf("SuspendUser: %v", err)
+	}
+	expectValues(t, "pool after suspending the remaining sharer", pool(), nil)
+}
+
+func testSharingRules(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	sharer := createUser(t, s, "sharer")
+	other := createUser(t, s, "other")
+	for _, u := range []*model.User{sharer, other} {
+		if err := s.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatalf("UpdateUserSharing: %v", err)
+		}
+	}
+	syncCookies(t, s, sharer.ID,
+		sharable(cookie(".example.com", "root", "1")),
+		sharable(cookie("mail.example.com", "mail", "2")),
+		sharable(cookie("bank.com", "bank", "3")),
+	)
+	syncCookies(t, s, other.ID, sharable(cookie("www.example.com", "other", "4")))
+
+	pool := func(domain string) []string {
+		t.Helper()
+		cookies, err := s.GetSharableCookiesByDomain(ctx, domain)
+		if err != nil {
+			t.Fatalf("GetSharableCookiesByDomain: %v", err)
+		}
+		return sortedValues(cookies)
+	}
+	expectValues(t, "pool without rules", pool("example.com"), []string{"mail=2", "other=4", "root=1"})
+
+	rules := model.SharingRules{
+		Allow: []model.DomainRule{{Type: model.DomainRuleWildcard, Pattern: "*.example.com"}},
+		Deny:  []model.DomainRule{{Type: model.DomainRuleRegex, Pattern: `mail\..*`}},
+	}
+	if err := s.UpdateUserSharingRules(ctx, sharer.ID, rules); err != nil {
+		t.Fatalf("UpdateUserSharingRules: %v", err)
+	}
+	expectValues(t, "pool with the sharer's rules", pool("example.com"), []string{"other=4", "root=1"})
+	expectValues(t, "pool for a domain outside the allow rules", pool("bank.com"), nil)
+
+	user, err := s.GetUserByID(ctx, sharer.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if !reflect.DeepEqual(user.SharingRules, rules) {
+		t.Errorf("sharing rules = %+v, want %+v", user.SharingRules, rules)
+	}
+
+	if err := s.UpdateUserSharingRules(ctx, sharer.ID, model.SharingRules{}); err != nil {
+		t.Fatalf("UpdateUserSharingRules to clear: %v", err)
+	}
+	expectValues(t, "pool after clearing the rules", pool("bank.com"), []string{"bank=3"})
+
+	expectErr(t, "UpdateUserSharingRules of a missing user", s.UpdateUserSharingRules(ctx, other.ID+1000, rules), store.ErrNotFound)
+}
+
+func testPoolClients(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	client := &model.PoolClient{
+		Name:           "scraper",
+		KeyHash:        "hash-1",
+		KeyPrefix:      "cpk_1",
+		AllowedDomains: []string{"example.com"},
+		RateLimit:      60,
+		ExpiresAt:      &expires,
+	}
+	if err := s.CreatePoolClient(ctx, client); err != nil {
+		t.Fatalf("CreatePoolClient: %v", err)
+	}
+	if client.ID == 0 || client.CreatedAt.IsZero() {
+		t.Errorf("created client has ID %d and created_at %v, want both set", client.ID, client.CreatedAt)
+	}
+	expectErr(t, "CreatePoolClient with a used key", s.CreatePoolClient(ctx, &model.PoolClient{Name: "dup", KeyHash: "hash-1", KeyPrefix: "cpk_1"}), store.ErrConflict)
+	other := &model.PoolClient{Name: "other", KeyHash: "hash-2", KeyPrefix: "cpk_2"}
+	if err := s.CreatePoolClient(ctx, other); err != nil {
+		t.Fatalf("CreatePoolClient: %v", err)
+	}
+
+	got, err := s.GetPoolClientByKeyHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("GetPoolClientByKeyHash: %v", err)
+	}
+	if got.ID != client.ID || got.Name != "scraper" || !reflect.DeepEqual(got.AllowedDomains, []string{"example.com"}) ||
+		got.RateLimit != 60 || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("GetPoolClientByKeyHash = %+v, want the created client", got)
+	}
+	_, err = s.GetPoolClientByKeyHash(ctx, "missing")
+	expectErr(t, "GetPoolClientByKeyHash of an unknown key", err, store.ErrNotFound)
+
+	for i := 0; i < 2; i++ {
+		if err := s.RecordPoolClientUse(ctx, client.ID, 3); err != nil {
+			t.Fatalf("RecordPoolClientUse: %v", err)
+		}
+	}
+	got.Name = "renamed"
+	got.AllowedDomains = nil
+	got.RateLimit = 0
+	got.ExpiresAt = nil
+	got.RequestCount = 100 // counters are not updated by UpdatePoolClient
+	if err := s.UpdatePoolClient(ctx, got); err != nil {
+		t.Fatalf("UpdatePoolClient: %v", err)
+	}
+	if err := s.RevokePoolClient(ctx, client.ID); err != nil {
+		t.Fatalf("RevokePoolClient: %v", err)
+	}
+	if err := s.RevokePoolClient(ctx, client.ID); err != nil {
+		t.Errorf("revoking twice: %v", err)
+	}
+
+	clients, err := s.ListPoolClients(ctx)
+	if err != nil {
+		t.Fatalf("ListPoolClients: %v", err)
+	}
+	if len(clients) != 2 || clients[0].ID != client.ID || clients[1].ID != other.ID {
+		t.Fatalf("ListPoolClients = %+v, want both clients in creation order", clients)
+	}
+	c := clients[0]
+	if c.Name != "renamed" || len(c.AllowedDomains) != 0 || c.RateLimit != 0 || c.ExpiresAt != nil {
+		t.Errorf("updated client = %+v, want the new name, no domains, no limit and no expiry", c)
+	}
+	if c.RequestCount != 2 || c.CookiesServed != 6 || c.LastUsedAt == nil {
+		t.Errorf("client counters: %d requests, %d cookies, last used %v; want 2, 6 and a time", c.RequestCount, c.CookiesServed, c.LastUsedAt)
+	}
+	if c.RevokedAt == nil || clients[1].RevokedAt != nil {
+		t.Errorf("revoked_at = %v and %v, want only the first client revoked", c.RevokedAt, clients[1].RevokedAt)
+	}
+
+	expectErr(t, "UpdatePoolClient of a missing client", s.UpdatePoolClient(ctx, &model.PoolClient{ID: 999, Name: "x"}), store.ErrNotFound)
+	expectErr(t, "RevokePoolClient of a missing client", s.RevokePoolClient(ctx, 999), store.ErrNotFound)
+	expectErr(t, "RecordPoolClientUse of a missing client", s.RecordPoolClientUse(ctx, 999, 1), store.ErrNotFound)
+}
+
+func testPoolLeases(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	first := createUser(t, s, "first")
+	second := createUser(t, s, "second")
+	private := createUser(t, s, "private")
+	for _, u := range []*model.User{first, second} {
+		if err := s.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatalf("UpdateUserSharing: %v", err)
+		}
+	}
+	syncCookies(t, s, first.ID, sharable(cookie(".example.com", "a", "1")), sharable(cookie("www.example.com", "b", "2")), sharable(cookie("other.org", "c", "3")))
+	syncCookies(t, s, second.ID, sharable(cookie("example.com", "d", "4")))
+	syncCookies(t, s, private.ID, sharable(cookie("example.com", "e", "5")))
+
+	lease := func(clientID int64, ttl time.Duration) (*model.PoolLease, []*model.Cookie) {
+		t.Helper()
+		l, cookies, err := s.LeasePoolSession(ctx, clientID, "Example.com", ttl)
+		if err != nil {
+			t.Fatalf("LeasePoolSession: %v", err)
+		}
+		return l, cookies
+	}
+	leased := func(domain string, want ...int64) {
+		t.Helper()
+		got, err := s.ListLeasedUsers(ctx, domain)
+		if err != nil {
+			t.Fatalf("ListLeasedUsers: %v", err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(append([]int64{}, want...)) {
+			t.Errorf("ListLeasedUsers(%q) = %v, want %v", domain, got, want)
+		}
+	}
+
+	l1, cookies := lease(1, time.Hour)
+	if l1.UserID != first.ID || l1.Domain != "example.com" || l1.ClientID != 1 || l1.ID == 0 {
+		t.Errorf("first lease = %+v, want the first user's example.com session for client 1", l1)
+	}
+	expectValues(t, "first leased session", sortedValues(cookies), []string{"a=1", "b=2"})
+	l2, cookies := lease(2, time.Hour)
+	if l2.UserID != second.ID {
+		t.Errorf("second lease is for user %d, want the second user %d (the first is leased)", l2.UserID, second.ID)
+	}
+	expectValues(t, "second leased session", sortedValues(cookies), []string{"d=4"})
+	_, _, err := s.LeasePoolSession(ctx, 1, "example.com", time.Hour)
+	expectErr(t, "LeasePoolSession with every session leased", err, store.ErrConflict)
+	leased("www.example.com", first.ID, second.ID)
+	leased("other.org")
+	_, _, err = s.LeasePoolSession(ctx, 1, "nobody-shares.net", time.Hour)
+	expectErr(t, "LeasePoolSession of an unshared domain", err, store.ErrNotFound)
+
+	_, err = s.EndPoolLease(ctx, 2, l1.ID, model.LeaseReleased)
+	expectErr(t, "EndPoolLease by another client", err, store.ErrNotFound)
+	ended, err := s.EndPoolLease(ctx, 1, l1.ID, model.LeaseReleased)
+	if err != nil {
+		t.Fatalf("EndPoolLease: %v", err)
+	}
+	if ended.ID != l1.ID || ended.UserID != first.ID || ended.Domain != "example.com" || ended.Outcome != model.LeaseReleased || ended.ReleasedAt == nil {
+		t.Errorf("ended lease = %+v, want the first lease released", ended)
+	}
+	_, err = s.EndPoolLease(ctx, 1, l1.ID, model.LeaseReleased)
+	expectErr(t, "EndPoolLease twice", err, store.ErrNotFound)
+
+	l3, _ := lease(1, time.Hour)
+	if l3.UserID != first.ID {
+		t.Errorf("lease after release is for user %d, want the freed first user %d", l3.UserID, first.ID)
+	}
+	for _, l := range []*model.PoolLease{l2, l3} {
+		if _, err := s.EndPoolLease(ctx, l.ClientID, l.ID, model.LeaseBad); err != nil {
+			t.Fatalf("EndPoolLease: %v", err)
+		}
+	}
+	// Both are free now; the second user's session was leased less recently.
+	l4, _ := lease(1, time.Millisecond)
+	if l4.UserID != second.ID {
+		t.Errorf("lease with both free is for user %d, want the least recently leased user %d", l4.UserID, second.ID)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = s.EndPoolLease(ctx, 1, l4.ID, model.LeaseReleased)
+	expectErr(t, "EndPoolLease of an expired lease", err, store.ErrNotFound)
+	leased("example.com")
+	l5, _ := lease(2, time.Hour)
+	l6, _ := lease(2, time.Hour)
+	if l5.UserID != first.ID || l6.UserID != second.ID {
+		t.Errorf("leases after expiry are for users %d and %d, want both sessions back (%d, %d)", l5.UserID, l6.UserID, first.ID, second.ID)
+	}
+
+	// Only the first user shares www.example.com, and its session overlaps
+	// the leased example.com one.
+	_, _, err = s.LeasePoolSession(ctx, 3, "www.example.com", time.Hour)
+	expectErr(t, "LeasePoolSession of a subdomain of a leased session", err, store.ErrConflict)
+	if _, err := s.EndPoolLease(ctx, 2, l5.ID, model.LeaseReleased); err != nil {
+		t.Fatalf("EndPoolLease: %v", err)
+	}
+	l7, _, err := s.LeasePoolSession(ctx, 3, "www.example.com", time.Hour)
+	if err != nil || l7.UserID != first.ID {
+		t.Fatalf("LeasePoolSession of www.example.com = %+v, %v: want the first user's session", l7, err)
+	}
+	_, _, err = s.LeasePoolSession(ctx, 3, "example.com", time.Hour)
+	expectErr(t, "LeasePoolSession of a parent of a leased session", err, store.ErrConflict)
+}
+
+func testPoolSessionHealth(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	reported := createUser(t, s, "reported")
+	healthy := createUser(t, s, "healthy")
+	for _, u := range []*model.User{reported, healthy} {
+		if err := s.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatalf("UpdateUserSharing: %v", err)
+		}
+	}
+	syncCookies(t, s, reported.ID, sharable(cookie(".example.com", "sid", "1")), sharable(cookie("other.org", "o", "2")))
+	syncCookies(t, s, healthy.ID, sharable(cookie("example.com", "h", "3")))
+
+	pool := func(domain string) []string {
+		t.Helper()
+		cookies, err := s.GetSharableCookiesByDomain(ctx, domain)
+		if err != nil {
+			t.Fatalf("GetSharableCookiesByDomain: %v", err)
+		}
+		return sortedValues(cookies)
+	}
+	policy := poolhealth.Policy{Threshold: 2, RateLimitCooldown: time.Hour, Window: time.Hour}
+	reportWith := func(clientID int64, reason string, policy poolhealth.Policy) *model.PoolSessionHealth {
+		t.Helper()
+		h, err := s.ReportPoolSession(ctx, clientID, reported.ID, "Example.com", reason, policy)
+		if err != nil {
+			t.Fatalf("ReportPoolSession: %v", err)
+		}
+		return h
+	}
+	report := func(clientID int64, reason string) *model.PoolSessionHealth {
+		t.Helper()
+		return reportWith(clientID, reason, policy)
+	}
+
+	_, err := s.ReportPoolSession(ctx, 1, reported.ID, "nowhere.net", model.SessionInvalid, policy)
+	expectErr(t, "ReportPoolSession of an unshared domain", err, store.ErrNotFound)
+
+	for range 3 {
+		if h := report(1, model.SessionInvalid); h.Failures != 1 || h.Domain != "example.com" || h.QuarantinedAt != nil {
+			t.Errorf("report by the first client = %+v, want one failure and no quarantine", h)
+		}
+	}
+	expectValues(t, "pool below the threshold", pool("example.com"), []string{"h=3", "sid=1"})
+	if h := report(2, model.SessionInvalid); h.Failures != 2 || h.QuarantinedAt == nil || h.QuarantinedUntil != nil || h.LastReason != model.SessionInvalid {
+		t.Errorf("report by a second client = %+v, want the session quarantined until it changes", h)
+	}
+	expectValues(t, "pool with the session quarantined", pool("example.com"), []string{"h=3"})
+	expectValues(t, "pool for another domain of the user", pool("other.org"), []string{"o=2"})
+	if _, cookies, err := s.LeasePoolSession(ctx, 1, "example.com", time.Hour); err != nil || len(cookies) != 1 || cookies[0].UserID != healthy.ID {
+		t.Errorf("LeasePoolSession = %v, %v: want the healthy user's session", cookies, err)
+	}
+
+	// A sync that leaves the session alone keeps it quarantined.
+	syncCookies(t, s, reported.ID, sharable(cookie(".example.com", "sid", "1")), sharable(cookie("other.org", "o", "changed")))
+	expectValues(t, "pool after an unrelated change", pool("example.com"), []string{"h=3"})
+	// New cookies for it bring it back with no failures.
+	syncCookies(t, s, reported.ID, sharable(cookie(".example.com", "sid", "renewed")), sharable(cookie("other.org", "o", "changed")))
+	expectValues(t, "pool after the session changed", pool("example.com"), []string{"h=3", "sid=renewed"})
+	if h := report(1, model.SessionInvalid); h.Failures != 1 || h.QuarantinedAt != nil {
+		t.Errorf("report after reinstatement = %+v, want the failures reset", h)
+	}
+
+	// A lease of the session released as good forgives its reports.
+	for range 2 {
+		l, _, err := s.LeasePoolSession(ctx, 3, "example.com", time.Hour)
+		if err != nil {
+			t.Fatalf("LeasePoolSession: %v", err)
+		}
+		if _, err := s.EndPoolLease(ctx, 3, l.ID, model.LeaseReleased); err != nil {
+			t.Fatalf("EndPoolLease: %v", err)
+		}
+	}
+	if h := report(2, model.SessionInvalid); h.Failures != 1 || h.QuarantinedAt != nil {
+		t.Errorf("report after a good lease = %+v, want the earlier report forgiven", h)
+	}
+
+	// Reports made before a rate-limit cooldown ends stop counting after it.
+	short := poolhealth.Policy{Threshold: 2, RateLimitCooldown: 100 * time.Millisecond, Window: time.Hour}
+	if h := reportWith(1, model.SessionRateLimited, short); h.QuarantinedUntil == nil || time.Until(*h.QuarantinedUntil) <= 0 {
+		t.Errorf("rate limited report = %+v, want a quarantine for the cooldown", h)
+	}
+	expectValues(t, "pool with the session rate limited", pool("example.com"), []string{"h=3"})
+	time.Sleep(150 * time.Millisecond)
+	if h := reportWith(3, model.SessionRateLimited, short); h.Failures != 1 || poolhealth.Quarantined(h, time.Now()) {
+		t.Errorf("report after the cooldown = %+v, want one failure and no quarantine", h)
+	}
+}
+
+func testSessionProbes(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	working := createUser(t, s, "working")
+	expired := createUser(t, s, "expired")
+	for _, u := range []*model.User{working, expired} {
+		if err := s.UpdateUserSharing(ctx, u.ID, true); err != nil {
+			t.Fatalf("UpdateUserSharing: %v", err)
+		}
+	}
+	syncCookies(t, s, working.ID, sharable(cookie("example.com", "w", "1")))
+	syncCookies(t, s, expired.ID, sharable(cookie("www.example.com", "e", "1")), sharable(cookie("other.org", "o", "1")))
+
+	admin := &model.SessionProbe{Domain: "example.com", URL: "https://example.com/account", ExpectStatus: 200}
+	own := &model.SessionProbe{UserID: expired.ID, Domain: "other.org", URL: "https://other.org/", ExpectStatus: 200, BodyRegex: "hi"}
+	for _, p := range []*model.SessionProbe{admin, own} {
+		if err := s.CreateSessionProbe(ctx, p); err != nil {
+			t.Fatalf("CreateSessionProbe: %v", err)
+		}
+	}
+	if admin.ID == 0 || own.ID == admin.ID {
+		t.Fatalf("probe IDs %d and %d, want distinct IDs", admin.ID, own.ID)
+	}
+	probes, err := s.ListSessionProbes(ctx)
+	if err != nil {
+		t.Fatalf("ListSessionProbes: %v", err)
+	}
+	if len(probes) != 2 || probes[0].ID != admin.ID || probes[1].BodyRegex != "hi" || probes[1].UserID != expired.ID {
+		t.Errorf("ListSessionProbes = %+v, want both probes in order", probes)
+	}
+	got, err := s.GetSessionProbe(ctx, own.ID)
+	if err != nil || got.URL != own.URL {
+		t.Errorf("GetSessionProbe = %+v, %v: want the user's probe", got, err)
+	}
+	_, err = s.GetSessionProbe(ctx, 999999)
+	expectErr(t, "GetSessionProbe of a missing probe", err, store.ErrNotFound)
+
+	pool := func() []string {
+		t.Helper()
+		cookies, err := s.GetSharableCookiesByDomain(ctx, "example.com")
+		if err != nil {
+			t.Fatalf("GetSharableCookiesByDomain: %v", err)
+		}
+		return sortedValues(cookies)
+	}
+	record := func(probeID, userID int64, domain, outcome string) {
+		t.Helper()
+		result := &model.ProbeResult{ProbeID: probeID, UserID: userID, Domain: domain, Outcome: outcome, StatusCode: 200, CheckedAt: time.Now()}
+		if err := s.RecordProbeResult(ctx, result); err != nil {
+			t.Fatalf("RecordProbeResult: %v", err)
+		}
+	}
+	record(admin.ID, working.ID, "example.com", model.ProbeOK)
+	record(admin.ID, expired.ID, "example.com", model.ProbeOK)
+	record(admin.ID, expired.ID, "example.com", model.ProbeExpired) // replaces the last result
+	record(own.ID, expired.ID, "other.org", model.ProbeOK)
+	expectErr(t, "RecordProbeResult of a missing probe", s.RecordProbeResult(ctx, &model.ProbeResult{ProbeID: 999999, UserID: working.ID, Outcome: model.ProbeOK, CheckedAt: time.Now()}), store.ErrNotFound)
+
+	results, err := s.ListProbeResults(ctx, expired.ID)
+	if err != nil {
+		t.Fatalf("ListProbeResults: %v", err)
+	}
+	if len(results) != 2 || results[0].Domain != "example.com" || results[0].Outcome != model.ProbeExpired || results[1].Domain != "other.org" {
+		t.Errorf("ListProbeResults = %+v, want the latest example.com and other.org results", results)
+	}
+	expectValues(t, "pool with one session expired", pool(), []string{"w=1"})
+
+	record(admin.ID, working.ID, "example.com", model.ProbeExpired)
+	expectValues(t, "pool with every session expired", pool(), []string{"e=1", "w=1"})
+
+	// New cookies for the session clear its results; the other domain's stay.
+	syncCookies(t, s, expired.ID, sharable(cookie("www.example.com", "e", "2")), sharable(cookie("other.org", "o", "1")))
+	results, err = s.ListProbeResults(ctx, expired.ID)
+	if err != nil {
+		t.Fatalf("ListProbeResults: %v", err)
+	}
+	if len(results) != 1 || results[0].Domain != "other.org" {
+		t.Errorf("results after the sync = %+v, want only other.org's", results)
+	}
+	expectValues(t, "pool after the expired session changed", pool(), []string{"e=2"})
+
+	if err := s.DeleteSessionProbe(ctx, own.ID); err != nil {
+		t.Fatalf("DeleteSessionProbe: %v", err)
+	}
+	expectErr(t, "DeleteSessionProbe twice", s.DeleteSessionProbe(ctx, own.ID), store.ErrNotFound)
+	if results, err := s.ListProbeResults(ctx, expired.ID); err != nil || len(results) != 0 {
+		t.Errorf("results after deleting the probe = %+v, %v: want none", results, err)
+	}
+}
+
+func testPoolUsage(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Hour)
+	earlier := now.Add(-3 * time.Hour)
+	add := func(usage ...*model.PoolUsage) {
+		t.Helper()
+		if err := s.AddPoolUsage(ctx, usage); err != nil {
+			t.Fatalf("AddPoolUsage: %v", err)
+		}
+	}
+	add(
+		&model.PoolUsage{Hour: earlier.Add(20 * time.Minute), UserID: 1, Domain: "example.com", Served: 1},
+		&model.PoolUsage{Hour: now.Add(5 * time.Minute), UserID: 1, Domain: "example.com", Served: 2, Leased: 1},
+		&model.PoolUsage{Hour: now, UserID: 2, Domain: "example.com", ReportedBad: 1},
+		&model.PoolUsage{Hour: now, UserID: 1, Domain: "other.org", Served: 1},
+		&model.PoolUsage{Hour: now, UserID: 3, Domain: "example.com"}, // nothing to count
+	)
+	add(&model.PoolUsage{Hour: now.Add(30 * time.Minute), UserID: 1, Domain: "example.com", Served: 3, ReportedBad: 2})
+
+	list := func(userID int64, domain string, since time.Time) []string {
+		t.Helper()
+		usage, err := s.ListPoolUsage(ctx, userID, domain, since)
+		if err != nil {
+			t.Fatalf("ListPoolUsage: %v", err)
+		}
+		out := make([]string, 0, len(usage))
+		for _, u := range usage {
+			out = append(out, fmt.Sprintf("%dh %d %s %d/%d/%d", int(now.Sub(u.Hour).Hours()), u.UserID, u.Domain, u.Served, u.Leased, u.ReportedBad))
+		}
+		return out
+	}
+	expectValues(t, "all usage", list(0, "", earlier), []string{
+		"3h 1 example.com 1/0/0",
+		"0h 1 example.com 5/1/2",
+		"0h 2 example.com 0/0/1",
+		"0h 1 other.org 1/0/0",
+	})
+	expectValues(t, "usage of user 1 for example.com", list(1, "example.com", earlier), []string{"3h 1 example.com 1/0/0", "0h 1 example.com 5/1/2"})
+	expectValues(t, "usage in the last hour", list(0, "example.com", now.Add(59*time.Minute)), []string{"0h 1 example.com 5/1/2", "0h 2 example.com 0/0/1"})
+
+	pruned, err := s.PrunePoolUsage(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("PrunePoolUsage: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("PrunePoolUsage pruned %d rows, want 1", pruned)
+	}
+	expectValues(t, "usage after pruning", list(1, "example.com", earlier), []string{"0h 1 example.com 5/1/2"})
+}
+
+func testPoolSessions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	users := make(map[string]*model.User)
+	for _, name := range []string{"a", "b", "private", "quarantined", "expired"} {
+		users[name] = createUser(t, s, name)
+		if name != "private" {
+			if err := s.UpdateUserSharing(ctx, users[name].ID, true); err != nil {
+				t.Fatalf("UpdateUserSharing: %v", err)
+			}
+		}
+	}
+	syncCookies(t, s, users["a"].ID,
+		sharable(cookie(".Example.com", "sid", "1")), sharable(cookie("example.com", "x", "2")),
+		sharable(cookie("www.example.com", "w", "3")), cookie("unshared.org", "u", "4"))
+	syncCookies(t, s, users["b"].ID, sharable(cookie("example.com", "sid", "5")), sharable(cookie("denied.org", "d", "6")))
+	syncCookies(t, s, users["private"].ID, sharable(cookie("private.net", "p", "7")))
+	syncCookies(t, s, users["quarantined"].ID, sharable(cookie("example.com", "q", "8")), sharable(cookie("other.org", "o", "9")))
+	syncCookies(t, s, users["expired"].ID, sharable(cookie("expired.io", "e", "10")))
+
+	rules := model.SharingRules{Deny: []model.DomainRule{{Type: model.DomainRuleExact, Pattern: "denied.org"}}}
+	if err := s.UpdateUserSharingRules(ctx, users["b"].ID, rules); err != nil {
+		t.Fatalf("UpdateUserSharingRules: %v", err)
+	}
+	if _, err := s.ReportPoolSession(ctx, 1, users["quarantined"].ID, "example.com", model.SessionInvalid, poolhealth.Policy{Threshold: 1}); err != nil {
+		t.Fatalf("ReportPoolSession: %v", err)
+	}
+	probe := &model.SessionProbe{Domain: "expired.io", URL: "https://expired.io/", ExpectStatus: 200}
+	if err := s.CreateSessionProbe(ctx, probe); err != nil {
+		t.Fatalf("CreateSessionProbe: %v", err)
+	}
+	result := &model.ProbeResult{ProbeID: probe.ID, UserID: users["expired"].ID, Domain: "expired.io", Outcome: model.ProbeExpired, CheckedAt: time.Now()}
+	if err := s.RecordProbeResult(ctx, result); err != nil {
+		t.Fatalf("RecordProbeResult: %v", err)
+	}
+
+	sessions, err := s.ListPoolSessions(ctx)
+	if err != nil {
+		t.Fatalf("ListPoolSessions: %v", err)
+	}
+	names := make(map[int64]string, len(users))
+	for name, u := range users {
+		names[u.ID] = name
+	}
+	var got []string
+	for _, session := range sessions {
+		got = append(got, session.Domain+"/"+names[session.UserID])
+		if session.LastSyncedAt == nil {
+			t.Errorf("session %s has no last sync", got[len(got)-1])
+		}
+	}
+	want := []string{"example.com/a", "example.com/b", "other.org/quarantined", "www.example.com/a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ListPoolSessions = %v, want %v", got, want)
+	}
+}
+
+func testShareLinks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner")
+	other := createUser(t, s, "other")
+	now := time.Now()
+	newLink := func(userID int64, token string, maxUses int, expiresAt time.Time) *model.ShareLink {
+		t.Helper()
+		link := &model.ShareLink{UserID: userID, TokenHash: token, TokenPrefix: token[:2], Domain: "example.com", Names: []string{"sid"}, MaxUses: maxUses, ExpiresAt: expiresAt}
+		if err := s.CreateShareLink(ctx, link); err != nil {
+			t.Fatalf("CreateShareLink: %v", err)
+		}
+		return link
+	}
+	twice := newLink(owner.ID, "twice", 2, now.Add(time.Hour))
+	expired := newLink(owner.ID, "expired", 1, now.Add(-time.Minute))
+	theirs := newLink(other.ID, "theirs", 1, now.Add(time.Hour))
+	expectErr(t, "CreateShareLink with a taken token", s.CreateShareLink(ctx, &model.ShareLink{UserID: owner.ID, TokenHash: "twice", MaxUses: 1, ExpiresAt: now.Add(time.Hour)}), store.ErrConflict)
+
+	links, err := s.ListShareLinks(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("ListShareLinks: %v", err)
+	}
+	if len(links) != 2 || links[0].ID != twice.ID || links[1].ID != expired.ID {
+		t.Fatalf("ListShareLinks = %+v, want the owner's two links", links)
+	}
+	got, err := s.GetShareLinkByTokenHash(ctx, "twice")
+	if err != nil {
+		t.Fatalf("GetShareLinkByTokenHash: %v", err)
+	}
+	if got.ID != twice.ID || got.UserID != owner.ID || len(got.Names) != 1 || got.Names[0] != "sid" || got.Domain != "example.com" {
+		t.Errorf("GetShareLinkByTokenHash = %+v, want the first link", got)
+	}
+	_, err = s.GetShareLinkByTokenHash(ctx, "unknown")
+	expectErr(t, "GetShareLinkByTokenHash of an unknown token", err, store.ErrNotFound)
+
+	for i := 1; i <= 2; i++ {
+		used, err := s.UseShareLink(ctx, twice.ID, now)
+		if err != nil {
+			t.Fatalf("UseShareLink %d: %v", i, err)
+		}
+		if used.Uses != i || used.LastUsedAt == nil {
+			t.Errorf("UseShareLink %d = %+v, want %d uses", i, used, i)
+		}
+	}
+	_, err = s.UseShareLink(ctx, twice.ID, now)
+	expectErr(t, "UseShareLink of a used up link", err, store.ErrConflict)
+	_, err = s.UseShareLink(ctx, expired.ID, now)
+	expectErr(t, "UseShareLink of an expired link", err, store.ErrConflict)
+
+	expectErr(t, "RevokeShareLink of another user's link", s.RevokeShareLink(ctx, owner.ID, theirs.ID), store.ErrNotFound)
+	for i := 0; i < 2; i++ {
+		if err := s.RevokeShareLink(ctx, other.ID, theirs.ID); err != nil {
+			t.Fatalf("RevokeShareLink: %v", err)
+		}
+	}
+	_, err = s.UseShareLink(ctx, theirs.ID, now)
+	expectErr(t, "UseShareLink of a revoked link", err, store.ErrConflict)
+
+	for _, event := range []string{model.ShareLinkCreated, model.ShareLinkRedeemed} {
+		if err := s.AddShareLinkEvent(ctx, &model.ShareLinkEvent{LinkID: twice.ID, Event: event, CookieCount: 1, RemoteAddr: "192.0.2.1", CreatedAt: now}); err != nil {
+			t.Fatalf("AddShareLinkEvent: %v", err)
+		}
+	}
+	events, err := s.ListShareLinkEvents(ctx, owner.ID, twice.ID)
+	if err != nil {
+		t.Fatalf("ListShareLinkEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Event != model.ShareLinkCreated || events[1].Event != model.ShareLinkRedeemed || events[1].RemoteAddr != "192.0.2.1" {
+		t.Errorf("ListShareLinkEvents = %+v, want the two events in order", events)
+	}
+	_, err = s.ListShareLinkEvents(ctx, other.ID, twice.ID)
+	expectErr(t, "ListShareLinkEvents of another user's link", err, store.ErrNotFound)
+
+	// Repeated denials fold into one entry until something else happens.
+	for _, detail := range []string{"wrong_password", "wrong_password", "wrong_password", "used_up", "wrong_password"} {
+		if err := s.AddShareLinkEvent(ctx, &model.ShareLinkEvent{LinkID: twice.ID, Event: model.ShareLinkDenied, Detail: detail, CreatedAt: now}); err != nil {
+			t.Fatalf("AddShareLinkEvent: %v", err)
+		}
+	}
+	// Another link's events do not interrupt a run.
+	if err := s.AddShareLinkEvent(ctx, &model.ShareLinkEvent{LinkID: expired.ID, Event: model.ShareLinkDenied, Detail: "wrong_password", CreatedAt: now}); err != nil {
+		t.Fatalf("AddShareLinkEvent: %v", err)
+	}
+	if err := s.AddShareLinkEvent(ctx, &model.ShareLinkEvent{LinkID: twice.ID, Event: model.ShareLinkDenied, Detail: "wrong_password", CreatedAt: now}); err != nil {
+		t.Fatalf("AddShareLinkEvent: %v", err)
+	}
+	events, err = s.ListShareLinkEvents(ctx, owner.ID, twice.ID)
+	if err != nil {
+		t.Fatalf("ListShareLinkEvents: %v", err)
+	}
+	var denials []string
+	for _, e := range events[2:] {
+		denials = append(denials, fmt.Sprintf("%s:%d", e.Detail, e.Repeats))
+	}
+	expectValues(t, "denials", denials, []string{"wrong_password:2", "used_up:0", "wrong_password:1"})
+	if events[2].LastAt == nil {
+		t.Errorf("folded denial %+v, want the time of the last repeat", events[2])
+	}
+
+	for i := 1; i <= 2; i++ {
+		failed, err := s.FailShareLinkPassword(ctx, twice.ID)
+		if err != nil {
+			t.Fatalf("FailShareLinkPassword: %v", err)
+		}
+		if failed.ID != twice.ID || failed.FailedAttempts != i {
+			t.Errorf("FailShareLinkPassword %d = %+v, want %d failed attempts", i, failed, i)
+		}
+	}
+	_, err = s.FailShareLinkPassword(ctx, 9999)
+	expectErr(t, "FailShareLinkPassword of an unknown link", err, store.ErrNotFound)
+}
+
+func testTeams(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner")
+	editor := createUser(t, s, "editor")
+	outsider := createUser(t, s, "outsider")
+
+	team := &model.Team{Name: "ops"}
+	if err := s.CreateTeam(ctx, team, owner.ID); err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+	if team.ID == 0 || team.VaultUserID == 0 {
+		t.Fatalf("CreateTeam = %+v, want an ID and a vault", team)
+	}
+	expectErr(t, "CreateTeam with an unknown owner", s.CreateTeam(ctx, &model.Team{Name: "x"}, 9999), store.ErrNotFound)
+
+	vault, err := s.GetUserByID(ctx, team.VaultUserID)
+	if err != nil {
+		t.Fatalf("GetUserByID of the vault: %v", err)
+	}
+	if vault.TeamID == nil || *vault.TeamID != team.ID {
+		t.Errorf("vault %+v, want team %d", vault, team.ID)
+	}
+	_, err = s.GetUserByAPIKey(ctx, vault.APIKey)
+	expectErr(t, "GetUserByAPIKey of a vault", err, store.ErrNotFound)
+	syncCookies(t, s, vault.ID, cookie("example.com", "sid", "team"))
+
+	got, err := s.GetTeam(ctx, team.ID)
+	if err != nil {
+		t.Fatalf("GetTeam: %v", err)
+	}
+	if got.Name != "ops" || got.VaultUserID != vault.ID {
+		t.Errorf("GetTeam = %+v, want %+v", got, team)
+	}
+
+	if err := s.SetTeamMember(ctx, &model.TeamMember{TeamID: team.ID, UserID: editor.ID, Role: model.TeamEditor}); err != nil {
+		t.Fatalf("SetTeamMember: %v", err)
+	}
+	expectErr(t, "SetTeamMember of a vault", s.SetTeamMember(ctx, &model.TeamMember{TeamID: team.ID, UserID: vault.ID, Role: model.TeamReader}), store.ErrNotFound)
+	expectErr(t, "SetTeamMember of an unknown team", s.SetTeamMember(ctx, &model.TeamMember{TeamID: 9999, UserID: editor.ID, Role: model.TeamReader}), store.ErrNotFound)
+	member, err := s.GetTeamMember(ctx, team.ID, editor.ID)
+	if err != nil || member.Role != model.TeamEditor {
+		t.Errorf("GetTeamMember = %+v, %v, want an editor", member, err)
+	}
+	_, err = s.GetTeamMember(ctx, team.ID, outsider.ID)
+	expectErr(t, "GetTeamMember of an outsider", err, store.ErrNotFound)
+
+	members, err := s.ListTeamMembers(ctx, team.ID)
+	if err != nil {
+		t.Fatalf("ListTeamMembers: %v", err)
+	}
+	if len(members) != 2 || members[0].UserID != owner.ID || members[0].Role != model.TeamOwner || members[1].UserID != editor.ID {
+		t.Errorf("ListTeamMembers = %+v, want the owner and the editor", members)
+	}
+	teams, err := s.ListUserTeams(ctx, editor.ID)
+	if err != nil {
+		t.Fatalf("ListUserTeams: %v", err)
+	}
+	if len(teams) != 1 || teams[0].TeamID != team.ID || teams[0].Role != model.TeamEditor {
+		t.Errorf("ListUserTeams = %+v, want the editor's membership", teams)
+	}
+
+	// The last owner can neither be demoted nor removed.
+	expectErr(t, "demoting the last owner", s.SetTeamMember(ctx, &model.TeamMember{TeamID: team.ID, UserID: owner.ID, Role: model.TeamReader}), store.ErrConflict)
+	expectErr(t, "removing the last owner", s.RemoveTeamMember(ctx, team.ID, owner.ID), store.ErrConflict)
+	promoted := &model.TeamMember{TeamID: team.ID, UserID: editor.ID, Role: model.TeamOwner}
+	if err := s.SetTeamMember(ctx, promoted); err != nil {
+		t.Fatalf("SetTeamMember promoting: %v", err)
+	}
+	if promoted.Role != model.TeamOwner || promoted.CreatedAt.IsZero() {
+		t.Errorf("SetTeamMember = %+v, want the promoted membership", promoted)
+	}
+	if err := s.RemoveTeamMember(ctx, team.ID, owner.ID); err != nil {
+		t.Fatalf("RemoveTeamMember of one of two owners: %v", err)
+	}
+	expectErr(t, "RemoveTeamMember of a non-member", s.RemoveTeamMember(ctx, team.ID, owner.ID), store.ErrNotFound)
+
+	if err := s.DeleteTeam(ctx, team.ID); err != nil {
+		t.Fatalf("DeleteTeam: %v", err)
+	}
+	_, err = s.GetTeam(ctx, team.ID)
+	expectErr(t, "GetTeam of a deleted team", err, store.ErrNotFound)
+	_, err = s.GetUserByID(ctx, vault.ID)
+	expectErr(t, "GetUserByID of a deleted team's vault", err, store.ErrNotFound)
+	if teams, err := s.ListUserTeams(ctx, editor.ID); err != nil || len(teams) != 0 {
+		t.Errorf("ListUserTeams after DeleteTeam = %+v, %v, want none", teams, err)
+	}
+	expectErr(t, "DeleteTeam of a deleted team", s.DeleteTeam(ctx, team.ID), store.ErrNotFound)
+}
+
+func testCancelledContext(t *testing.T, s store.Store) {
+	user := createUser(t, s, "cancelled")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.GetUserByID(ctx, user.ID)
+	expectErr(t, "GetUserByID with a cancelled context", err, store.ErrUnavailable)
+	expectErr(t, "GetUserByID with a cancelled context", err, context.Canceled)
+
+	err = s.SyncCookies(ctx, user.ID, []*model.Cookie{cookie("a.com", "x", "1")})
+	expectErr(t, "SyncCookies with a cancelled context", err, store.ErrUnavailable)
+	cookies, err := s.GetCookiesByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetCookiesByUserID: %v", err)
+	}
+	if len(cookies) != 0 {
+		t.Errorf("a cancelled sync stored %v", values(cookies))
+	}
+}
@@ -0,0 +1,42 @@
+// Package team ranks team member roles and validates team names.
+package team
+
+import (
+	"cookie-syncer/api/internal/model"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the longest team name, in characters.
+const MaxNameLength = 100
+
+// rank orders the roles; a role may do what every lower one may.
+var rank = map[string]int{
+	model.TeamReader: 1,
+	model.TeamEditor: 2,
+	model.TeamOwner:  3,
+}
+
+// ValidRole reports whether role is a team member role.
+func ValidRole(role string) bool {
+	return rank[role] > 0
+}
+
+// Allows reports whether a member with role may do what needs the role need.
+func Allows(role, need string) bool {
+	return ValidRole(role) && rank[role] >= rank[need]
+}
+
+// NormalizeName trims name and checks that it is not empty or too long.
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return "", fmt.Errorf("name is longer than %d characters", MaxNameLength)
+	}
+	return name, nil
+}
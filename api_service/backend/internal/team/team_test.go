@@ -0,0 +1,42 @@
+package team
+
+import (
+	"cookie-syncer/api/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role, need string
+		want       bool
+	}{
+		{model.TeamOwner, model.TeamReader, true},
+		{model.TeamOwner, model.TeamOwner, true},
+		{model.TeamEditor, model.TeamEditor, true},
+		{model.TeamEditor, model.TeamOwner, false},
+		{model.TeamReader, model.TeamReader, true},
+		{model.TeamReader, model.TeamEditor, false},
+		{"admin", model.TeamReader, false},
+		{"", model.TeamReader, false},
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.role, tt.need); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.role, tt.need, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	if got, err := NormalizeName("  Ops  "); got != "Ops" || err != nil {
+		t.Errorf("NormalizeName = %q, %v, want Ops", got, err)
+	}
+	for _, name := range []string{"", "   ", strings.Repeat("团", MaxNameLength+1)} {
+		if _, err := NormalizeName(name); err == nil {
+			t.Errorf("NormalizeName(%q) accepted", name)
+		}
+	}
+	if _, err := NormalizeName(strings.Repeat("团", MaxNameLength)); err != nil {
+		t.Errorf("a name of %d characters: %v", MaxNameLength, err)
+	}
+}
@@ -0,0 +1,34 @@
+// Package token issues the random bearer credentials the server hands out,
+// such as pool client keys and share link tokens, and hashes them for
+// storage.
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// DisplayLength is how many random characters after the prefix are shown to
+// tell credentials apart.
+const DisplayLength = 8
+
+// New returns a new random credential starting with prefix, which marks what
+// it is so a leaked one is recognizable, the part of it shown to its owner
+// and the hash to store.
+func New(prefix string) (token, display, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("could not generate %s token: %w", prefix, err)
+	}
+	token = prefix + hex.EncodeToString(b)
+	return token, token[:len(prefix)+DisplayLength], Hash(token), nil
+}
+
+// Hash returns the hash under which token is stored. Tokens are random, so a
+// plain SHA-256 is enough; there is nothing to guess.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
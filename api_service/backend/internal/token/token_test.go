@@ -0,0 +1,29 @@
+package token
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tok, display, hash, err := New("abc_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tok, "abc_") || len(tok) != len("abc_")+64 {
+		t.Errorf("token %q, want abc_ and 64 hex characters", tok)
+	}
+	if display != tok[:len("abc_")+DisplayLength] {
+		t.Errorf("display %q is not the start of %q", display, tok)
+	}
+	if hash != Hash(tok) || hash == tok {
+		t.Errorf("hash %q does not match Hash of the token", hash)
+	}
+	other, _, _, err := New("abc_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == tok {
+		t.Error("two tokens are equal")
+	}
+}
@@ -0,0 +1,166 @@
+// Package validate checks and normalizes client input before it reaches the
+// store.
+package validate
+
+import (
+	"cookie-syncer/api/internal/model"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Limits on synced cookies. They follow what browsers accept, so any cookie
+// a browser really holds passes.
+const (
+	MaxNameValueBytes = 4096 // name and value together
+	MaxDomainBytes    = 253
+	MaxPathBytes      = 1024
+)
+
+// SameSite values, as reported by the browser extension (chrome.cookies).
+var sameSiteValues = map[string]string{
+	"":               "unspecified",
+	"unspecified":    "unspecified",
+	"no_restriction": "no_restriction",
+	"none":           "no_restriction",
+	"lax":            "lax",
+	"strict":         "strict",
+}
+
+// Problem describes why one cookie of a sync was rejected.
+type Problem struct {
+	Index  int    `json:"index"`           // position in the submitted array
+	Field  string `json:"field,omitempty"` // JSON field at fault, empty for the whole cookie
+	Reason string `json:"reason"`
+}
+
+// Cookies normalizes cookies in place and checks them. Domains are trimmed
+// and lower-cased, an empty path becomes "/", SameSite is mapped to the
+// extension's spelling and a zero expiry means a session cookie. Of several
+// cookies with the same (domain, name, path) only the last one is kept.
+//
+// If any cookie is invalid, Cookies returns every problem found and no
+// cookies.
+func Cookies(cookies []*model.Cookie) ([]*model.Cookie, []Problem) {
+	var problems []Problem
+	for i, c := range cookies {
+		if c == nil {
+			problems = append(problems, Problem{Index: i, Reason: "cookie is null"})
+			continue
+		}
+		normalize(c)
+		for _, p := range check(c) {
+			p.Index = i
+			problems = append(problems, p)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return dedupe(cookies), nil
+}
+
+func normalize(c *model.Cookie) {
+	c.Domain = strings.ToLower(strings.TrimSpace(c.Domain))
+	c.Name = strings.TrimSpace(c.Name)
+	c.Path = strings.TrimSpace(c.Path)
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if sameSite, ok := sameSiteValues[strings.ToLower(strings.TrimSpace(c.SameSite))]; ok {
+		c.SameSite = sameSite
+	}
+	if c.Expires != nil && c.Expires.IsZero() {
+		c.Expires = nil
+	}
+}
+
+func check(c *model.Cookie) []Problem {
+	var problems []Problem
+	add := func(field, format string, args ...any) {
+		problems = append(problems, Problem{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if reason := checkDomain(c.Domain); reason != "" {
+		add("domain", "%s", reason)
+	}
+
+	switch {
+	case c.Name == "":
+		add("name", "name is empty")
+	case strings.ContainsAny(c.Name, "=;"):
+		add("name", "name contains '=' or ';'")
+	case hasControl(c.Name):
+		add("name", "name contains control characters")
+	}
+
+	if strings.Contains(c.Value, ";") || hasControl(c.Value) {
+		add("value", "value contains ';' or control characters")
+	}
+	if n := len(c.Name) + len(c.Value); n > MaxNameValueBytes {
+		add("value", "name and value are %d bytes, more than the limit of %d", n, MaxNameValueBytes)
+	}
+
+	switch {
+	case !strings.HasPrefix(c.Path, "/"):
+		add("path", "path must start with '/'")
+	case len(c.Path) > MaxPathBytes:
+		add("path", "path is %d bytes, more than the limit of %d", len(c.Path), MaxPathBytes)
+	case strings.Contains(c.Path, ";") || hasControl(c.Path):
+		add("path", "path contains ';' or control characters")
+	}
+
+	if _, ok := sameSiteValues[c.SameSite]; !ok {
+		add("same_site", "same_site %q is not one of no_restriction, lax, strict or unspecified", c.SameSite)
+	}
+	return problems
+}
+
+// checkDomain returns why domain is not a valid cookie domain, or "" if it
+// is. A leading dot (a domain cookie, as opposed to a host-only one) is
+// allowed.
+func checkDomain(domain string) string {
+	host := strings.TrimPrefix(domain, ".")
+	switch {
+	case host == "":
+		return "domain is empty"
+	case len(host) > MaxDomainBytes:
+		return fmt.Sprintf("domain is %d bytes, more than the limit of %d", len(host), MaxDomainBytes)
+	case net.ParseIP(strings.Trim(host, "[]")) != nil:
+		return ""
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return "domain has an empty or over-long label"
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Sprintf("domain contains the invalid character %q", r)
+			}
+		}
+	}
+	return ""
+}
+
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < 0x20 && r != '\t' || r == 0x7f }) >= 0
+}
+
+// dedupe keeps the last cookie for each (domain, name, path).
+func dedupe(cookies []*model.Cookie) []*model.Cookie {
+	type key struct{ domain, name, path string }
+	last := make(map[key]int, len(cookies))
+	for i, c := range cookies {
+		last[key{c.Domain, c.Name, c.Path}] = i
+	}
+	if len(last) == len(cookies) {
+		return cookies
+	}
+	kept := make([]*model.Cookie, 0, len(last))
+	for i, c := range cookies {
+		if last[key{c.Domain, c.Name, c.Path}] == i {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
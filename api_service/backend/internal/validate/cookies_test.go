@@ -0,0 +1,97 @@
+package validate
+
+import (
+	"cookie-syncer/api/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookiesNormalizes(t *testing.T) {
+	var zero time.Time
+	cookies := []*model.Cookie{
+		{Domain: " .Example.COM ", Name: " sid ", Value: "1", SameSite: "Lax", Expires: &zero},
+		{Domain: "127.0.0.1", Name: "a", Value: "2", Path: "/app", SameSite: "none"},
+		{Domain: "[::1]", Name: "b", Value: "3", Path: "/"},
+	}
+	got, problems := Cookies(cookies)
+	if problems != nil {
+		t.Fatalf("problems = %+v, want none", problems)
+	}
+	want := []model.Cookie{
+		{Domain: ".example.com", Name: "sid", Value: "1", Path: "/", SameSite: "lax"},
+		{Domain: "127.0.0.1", Name: "a", Value: "2", Path: "/app", SameSite: "no_restriction"},
+		{Domain: "[::1]", Name: "b", Value: "3", Path: "/", SameSite: "unspecified"},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(*got[i], want[i]) {
+			t.Errorf("cookie %d = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+func TestCookiesDeduplicates(t *testing.T) {
+	cookies := []*model.Cookie{
+		{Domain: "a.com", Name: "x", Value: "first", Path: "/"},
+		{Domain: "b.com", Name: "x", Value: "other", Path: "/"},
+		{Domain: "A.com", Name: "x", Value: "last", Path: ""}, // the same key once normalized
+	}
+	got, problems := Cookies(cookies)
+	if problems != nil {
+		t.Fatalf("problems = %+v, want none", problems)
+	}
+	var values []string
+	for _, c := range got {
+		values = append(values, c.Value)
+	}
+	if want := []string{"other", "last"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+}
+
+func TestCookiesReportsProblems(t *testing.T) {
+	valid := func() *model.Cookie { return &model.Cookie{Domain: "a.com", Name: "x", Value: "1", Path: "/"} }
+	with := func(edit func(c *model.Cookie)) *model.Cookie {
+		c := valid()
+		edit(c)
+		return c
+	}
+	cookies := []*model.Cookie{
+		valid(),
+		nil,
+		with(func(c *model.Cookie) { c.Name = "  " }),
+		with(func(c *model.Cookie) { c.Domain = "" }),
+		with(func(c *model.Cookie) { c.Value = strings.Repeat("v", 10<<20) }),
+		with(func(c *model.Cookie) { c.SameSite = "sometimes" }),
+		with(func(c *model.Cookie) { c.Domain = "exa mple.com" }),
+		with(func(c *model.Cookie) { c.Domain = "a..com" }),
+		with(func(c *model.Cookie) { c.Path = "app" }),
+		with(func(c *model.Cookie) { c.Name = "a=b" }),
+		with(func(c *model.Cookie) { c.Value = "a\nb" }),
+		with(func(c *model.Cookie) { c.Name, c.Domain = "", "" }),
+	}
+	got, problems := Cookies(cookies)
+	if got != nil {
+		t.Errorf("returned %d cookies despite problems", len(got))
+	}
+
+	type fault struct {
+		index int
+		field string
+	}
+	var faults []fault
+	for _, p := range problems {
+		if p.Reason == "" {
+			t.Errorf("problem %+v has no reason", p)
+		}
+		faults = append(faults, fault{p.Index, p.Field})
+	}
+	want := []fault{
+		{1, ""}, {2, "name"}, {3, "domain"}, {4, "value"}, {5, "same_site"}, {6, "domain"},
+		{7, "domain"}, {8, "path"}, {9, "name"}, {10, "value"}, {11, "domain"}, {11, "name"},
+	}
+	if !reflect.DeepEqual(faults, want) {
+		t.Errorf("faults = %v, want %v", faults, want)
+	}
+}